@@ -0,0 +1,36 @@
+package main
+
+import (
+	"atc_freq/internal/sim"
+	"os"
+)
+
+const ansiReset = "\033[0m"
+
+// categoryColours are the colours aviation weather charts use for flight categories
+var categoryColours = map[sim.FlightCategory]string{
+	sim.CategoryVFR:  "\033[32m", // Green
+	sim.CategoryMVFR: "\033[34m", // Blue
+	sim.CategoryIFR:  "\033[31m", // Red
+	sim.CategoryLIFR: "\033[35m", // Magenta
+}
+
+// colourEnabled is false when the output is redirected or NO_COLOR is set
+var colourEnabled = isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// colourCategory returns the category name wrapped in its colour
+func colourCategory(category sim.FlightCategory) string {
+	colour, ok := categoryColours[category]
+	if !colourEnabled || !ok {
+		return string(category)
+	}
+	return colour + string(category) + ansiReset
+}
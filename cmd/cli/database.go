@@ -0,0 +1,66 @@
+package main
+
+import (
+	"atc_freq/internal/freqdb"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+// importDatabase builds the offline frequency database, it doesn't need the simulator
+func importDatabase(cliContext *cli.Context) error {
+	var db *freqdb.Database
+	var err error
+
+	switch cliContext.NArg() {
+	case 1:
+		db, err = importAptDat(cliContext.Args().Get(0))
+	case 2:
+		db, err = importOurAirports(cliContext.Args().Get(0), cliContext.Args().Get(1))
+	default:
+		return fmt.Errorf("requires airports.csv and airport-frequencies.csv from OurAirports or an X-Plane apt.dat")
+	}
+	if err != nil {
+		return err
+	}
+
+	path := cliContext.String("out")
+	if path == "" {
+		if path, err = freqdb.DefaultPath(); err != nil {
+			return fmt.Errorf("no --out given and no default location: %w", err)
+		}
+	}
+	if err := db.Save(path); err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d airports from %s to %s\n", len(db.Airports), db.Source, path)
+	return nil
+}
+
+func importAptDat(path string) (*freqdb.Database, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return freqdb.ImportAptDat(file)
+}
+
+func importOurAirports(airportsPath, frequenciesPath string) (*freqdb.Database, error) {
+	airports, err := os.Open(airportsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer airports.Close()
+
+	frequencies, err := os.Open(frequenciesPath)
+	if err != nil {
+		return nil, err
+	}
+	defer frequencies.Close()
+
+	return freqdb.ImportOurAirports(airports, frequencies)
+}
@@ -1,56 +1,251 @@
-//go:build windows
-
 package main
 
 import (
 	"atc_freq/internal/app"
+	"atc_freq/internal/format"
+	"atc_freq/internal/server"
 	"atc_freq/internal/sim"
+	"context"
 	"fmt"
+	"maps"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
 
 	"github.com/urfave/cli/v2"
 )
 
 func main() {
-	connection, err := sim.NewConnection()
-	if err != nil {
-		fmt.Printf("Can't create application: %v\n", err)
-		os.Exit(1)
-	}
+	// Ctrl-C cancels the request in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	coreApp := app.NewApp(connection)
+	// host and its coreApp are created once the global flags are parsed
+	var host *app.Host
+	var coreApp *app.App
 
 	cliApp := &cli.App{
 		Name:  "cli",
 		Usage: "Get airport frequencies and weather information from MSFS",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "fake-sim",
+				Usage: "use the built-in fake simulator instead of MSFS",
+			},
+			&cli.StringFlag{
+				Name:  "fixtures",
+				Usage: "JSON file with airports, METARs and clouds for --fake-sim",
+			},
+			&cli.StringFlag{
+				Name:  "record",
+				Usage: "record the SimConnect traffic of the session to a capture file",
+			},
+			&cli.StringFlag{
+				Name:  "replay",
+				Usage: "replay a capture file recorded with --record instead of connecting to the simulator",
+			},
+			&cli.StringFlag{
+				Name:  "database",
+				Usage: "offline frequency database for when the simulator isn't running, defaults to the one written by import",
+			},
+			&cli.BoolFlag{
+				Name:  "merge-database",
+				Usage: "add the frequencies of the offline database the simulator doesn't have",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Value:   string(format.Table),
+				Usage:   "output format: table, json, yaml, csv, markdown or html",
+			},
+		},
+		Before: func(cliContext *cli.Context) error {
+			if _, err := format.Parse(cliContext.String("output")); err != nil {
+				return err
+			}
+
+			connection, err := app.NewConnection(app.ConnectionOptions{
+				FakeSim:  cliContext.Bool("fake-sim"),
+				Fixtures: cliContext.String("fixtures"),
+				Record:   cliContext.String("record"),
+				Replay:   cliContext.String("replay"),
+			})
+			if err != nil {
+				return fmt.Errorf("can't create application: %w", err)
+			}
+
+			host = app.NewHost(connection)
+			host.AddContext(ctx)
+			coreApp = host.App
+
+			if path := app.FrequencyDatabasePath(cliContext.String("database")); path != "" {
+				if _, err := coreApp.LoadFrequencyDatabase(path, cliContext.Bool("merge-database")); err != nil {
+					return fmt.Errorf("can't load frequency database: %w", err)
+				}
+			}
+			return nil
+		},
 		Commands: []*cli.Command{
 			{
 				Name:        "freq",
 				Usage:       "Get all frequencies for an airfield",
 				ArgsUsage:   "<ICAO>",
-				Action:      freq(coreApp),
+				Action:      freq(&coreApp),
 				Description: "Retrieves and displays all available frequencies for the specified airport.\n\n   Example:\n      atc_freq freq EDDB",
 			},
 			{
 				Name:        "weather",
 				Usage:       "Get weather at waypoints",
 				ArgsUsage:   "<waypoint1,waypoint2,...>",
-				Action:      weather(coreApp),
-				Description: "Retrieves weather information for a comma-separated list of waypoints.\n\n   Example:\n      atc_freq weather EDDB,UUMI,KJFK",
+				Action:      weather(&coreApp),
+				Description: "Retrieves weather information for a comma-separated list of waypoints, or for the airports of a\n   MSFS (.pln) or Little Navmap (.lnmpln) flight plan together with their frequencies.\n\n   Examples:\n      atc_freq weather EDDB,UUMI,KJFK\n      atc_freq weather --plan route.pln",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "plan",
+						Usage: "flight plan file to take the airports from instead of the waypoint list",
+					},
+				},
+			},
+			{
+				Name:        "runway",
+				Usage:       "Recommend the runway in use from the METAR wind",
+				ArgsUsage:   "<ICAO>",
+				Action:      runway(&coreApp),
+				Description: "Ranks the runway ends of the airport by headwind and crosswind from the reported wind.\n\n   Example:\n      atc_freq runway EDDB",
+			},
+			{
+				Name:        "brief",
+				Usage:       "Build a pre-flight briefing for the airports of a route",
+				ArgsUsage:   "<ICAO1,ICAO2,...>",
+				Action:      brief(&coreApp),
+				Description: "Combines METAR, flight category, recommended runway, frequencies in phase of flight order and cloud\n   layers for every airport of a comma-separated route. Use --output markdown or html for a document.\n\n   Example:\n      atc_freq --output markdown brief EDDB,EDDH > briefing.md",
+			},
+			{
+				Name:        "nearby",
+				Usage:       "Find airports around an airport, a position or the aircraft",
+				ArgsUsage:   "[ICAO|lat,lon]",
+				Action:      nearby(&coreApp),
+				Description: "Lists the airports within the radius, nearest first, with the frequency to call them on.\n   Without an argument the search is around the user aircraft.\n   Only airports the simulator has loaded around the aircraft are found.\n\n   Examples:\n      atc_freq nearby --radius 30 EDDB\n      atc_freq nearby 52.35,13.49\n      atc_freq nearby",
+				Flags: []cli.Flag{
+					&cli.Float64Flag{
+						Name:  "radius",
+						Value: 25,
+						Usage: "search radius in nautical miles",
+					},
+					&cli.BoolFlag{
+						Name:  "frequencies",
+						Value: true,
+						Usage: "look up the tower, CTAF or UNICOM frequency of every airport",
+					},
+				},
+			},
+			{
+				Name:        "aircraft",
+				Usage:       "Show the position and radios of the user aircraft",
+				Action:      aircraft(&coreApp),
+				Description: "Shows where the user aircraft is, the COM1 and COM2 frequencies and the nearest airport.\n\n   Example:\n      atc_freq aircraft",
+			},
+			{
+				Name:        "tune",
+				Usage:       "Tune a COM or NAV radio of the aircraft",
+				ArgsUsage:   "<COM1|COM2|NAV1|NAV2> <MHz>",
+				Action:      tune(&coreApp),
+				Description: "Sets the active frequency of the radio, the previous one is kept in standby.\n   COM radios take 25 kHz and 8.33 kHz channels, NAV radios 50 kHz channels.\n\n   Examples:\n      atc_freq tune COM1 118.700\n      atc_freq tune --standby COM2 121.805",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "standby",
+						Usage: "set the standby frequency and leave the active one",
+					},
+				},
+			},
+			{
+				Name:        "advise",
+				Usage:       "Suggest the next frequency for a flight",
+				ArgsUsage:   "<departure> <destination>",
+				Action:      advise(&coreApp),
+				Description: "Works out the phase of flight from the aircraft position and radios and suggests the\n   frequency needed next: ATIS, clearance, ground, tower, departure, center, approach, tower, ground.\n\n   Examples:\n      atc_freq advise EDDB EDDH\n      atc_freq advise --tune EDDB EDDH",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "tune",
+						Usage: "set the suggested frequency as COM1 standby",
+					},
+				},
+			},
+			{
+				Name:        "serve",
+				Usage:       "Serve the data over HTTP/JSON and a WebSocket",
+				Action:      serve(&host),
+				Description: "Serves frequencies, weather, clouds, airport details and nearby airports as JSON and streams\n   the user aircraft over a WebSocket, for kneeboards on a tablet and stream overlays. Runs until Ctrl-C.\n\n   Endpoints:\n      GET /api/frequencies/{icao}\n      GET /api/airports/{icao}\n      GET /api/weather?waypoints=EDDB,EDDH\n      GET /api/clouds?waypoints=EDDB,EDDH\n      GET /api/clouds/profile?waypoints=EDDB&min=0&max=10000&step=500\n      GET /api/clouds/grid?waypoint=EDDB&min=2000&max=2500&box=5\n      GET /api/nearby?center=EDDB&radius=25&frequencies=true\n      GET /api/aircraft\n      GET /api/aircraft/ws (WebSocket)\n      GET /api/cache\n\n   Examples:\n      atc_freq serve --addr :8080\n      atc_freq serve --cors-origin http://localhost:5173",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "addr",
+						Value: ":8080",
+						Usage: "address to listen on",
+					},
+					&cli.StringSliceFlag{
+						Name:  "cors-origin",
+						Usage: "browser origin allowed to use the API, repeat for several or use * for any",
+					},
+				},
+			},
+			{
+				Name:        "import",
+				Usage:       "Import an offline frequency database from OurAirports or X-Plane",
+				ArgsUsage:   "<airports.csv> <airport-frequencies.csv> | <apt.dat>",
+				Action:      importDatabase,
+				Description: "Builds the frequency database used while the simulator isn't running from the airports.csv and\n   airport-frequencies.csv files of OurAirports or from an X-Plane apt.dat file.\n\n   Examples:\n      atc_freq import airports.csv airport-frequencies.csv\n      atc_freq import --out navdata.json apt.dat\n      atc_freq --database navdata.json freq EDDB",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "file to write the database to, defaults to the one loaded by the other commands",
+					},
+				},
+			},
+			{
+				Name:        "clouds",
+				Usage:       "Get cloud density layers at waypoints",
+				ArgsUsage:   "<waypoint1,waypoint2,...>",
+				Action:      clouds(&coreApp),
+				Description: "Retrieves cloud density from the ground up to 10000 ft in 500 ft layers for a comma-separated list of waypoints.\n   With --layers adjacent cloudy levels are merged into layers with their base, top and thickness.\n\n   Examples:\n      atc_freq --output csv clouds EDDB,EDDH\n      atc_freq clouds --max-altitude 20000 --step 250 --layers EDDB",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "min-altitude",
+						Value: sim.DefaultCloudProfile.MinAlt,
+						Usage: "lowest altitude in feet",
+					},
+					&cli.IntFlag{
+						Name:  "max-altitude",
+						Value: sim.DefaultCloudProfile.MaxAlt,
+						Usage: "highest altitude in feet",
+					},
+					&cli.IntFlag{
+						Name:  "step",
+						Value: sim.DefaultCloudProfile.Step,
+						Usage: "height of a level in feet",
+					},
+					&cli.BoolFlag{
+						Name:  "layers",
+						Usage: "list cloud layers instead of every level",
+					},
+				},
 			},
 		},
 	}
 
-	if err := cliApp.Run(os.Args); err != nil {
+	err := cliApp.RunContext(ctx, os.Args)
+	if host != nil {
+		host.Close()
+	}
+	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func freq(coreApp *app.App) cli.ActionFunc {
+func freq(coreApp **app.App) cli.ActionFunc {
 	return func(cliContext *cli.Context) error {
-		return freqCommand(cliContext, coreApp)
+		return freqCommand(cliContext, *coreApp)
 	}
 }
 
@@ -66,26 +261,32 @@ func freqCommand(cliContext *cli.Context, app *app.App) error {
 		return err
 	}
 
-	if len(freqs) == 0 {
-		fmt.Printf("No frequencies found for %s\n", strings.ToUpper(icao))
-		return nil
-	}
-
-	fmt.Printf("Frequencies for %s:\n", strings.ToUpper(icao))
-	for _, f := range freqs {
-		fmt.Printf("  %-10s %8.3f MHz  %s\n", f.Type, f.MHz, f.Name)
+	if outputFormat(cliContext) == format.Table {
+		if len(freqs) == 0 {
+			fmt.Printf("No frequencies found for %s\n", strings.ToUpper(icao))
+			return nil
+		}
+		if source := freqs[0].Source; source != sim.SourceSimulator {
+			fmt.Printf("Frequencies for %s from the %s database:\n", strings.ToUpper(icao), source)
+		} else {
+			fmt.Printf("Frequencies for %s:\n", strings.ToUpper(icao))
+		}
 	}
 
-	return nil
+	return write(cliContext, freqs, format.FrequencyRows(freqs))
 }
 
-func weather(coreApp *app.App) cli.ActionFunc {
+func weather(coreApp **app.App) cli.ActionFunc {
 	return func(cliContext *cli.Context) error {
-		return weatherCommand(cliContext, coreApp)
+		return weatherCommand(cliContext, *coreApp)
 	}
 }
 
 func weatherCommand(ctx *cli.Context, coreApp *app.App) error {
+	if ctx.IsSet("plan") {
+		return planWeatherCommand(ctx, coreApp)
+	}
+
 	if ctx.NArg() != 1 {
 		return fmt.Errorf("requires exactly one argument (comma-separated waypoints)")
 	}
@@ -93,25 +294,298 @@ func weatherCommand(ctx *cli.Context, coreApp *app.App) error {
 	waypointsStr := ctx.Args().Get(0)
 	waypoints := strings.Split(waypointsStr, ",")
 
-	weatherData, err := coreApp.GetWeather(waypoints)
+	route, err := coreApp.GetRouteWeather(waypoints)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("Weather information:")
-	for wp, weather := range weatherData {
-		fmt.Printf("  %s:\n", wp)
-		fmt.Printf("    Visibility: %d SM\n", weather.Visibility)
-		if len(weather.Clouds) > 0 {
-			fmt.Printf("    Clouds:\n")
-			for _, cloud := range weather.Clouds {
-				fmt.Printf("      %s at %d ft\n", cloud.Coverage, cloud.Base)
-			}
-		} else {
-			fmt.Printf("    Clouds: Clear\n")
+	if err := write(ctx, route, format.WeatherRows(route.Stations)); err != nil {
+		return err
+	}
+
+	if outputFormat(ctx) == format.Table {
+		printWorstCategory(route)
+	}
+
+	return nil
+}
+
+// planWeatherCommand prints weather and frequencies for the airports of a flight plan
+func planWeatherCommand(ctx *cli.Context, coreApp *app.App) error {
+	if ctx.NArg() != 0 {
+		return fmt.Errorf("--plan can't be combined with a waypoint list")
+	}
+
+	plan, err := coreApp.LoadFlightPlan(ctx.String("plan"))
+	if err != nil {
+		return err
+	}
+
+	// JSON and YAML get the whole plan, CSV only has room for the weather table
+	if outputFormat(ctx) != format.Table {
+		return write(ctx, plan, format.WeatherRows(plan.Weather.Stations))
+	}
+
+	fmt.Printf("Weather for %s:\n", strings.Join(plan.Plan.Airports(), ", "))
+	if err := write(ctx, plan, format.WeatherRows(plan.Weather.Stations)); err != nil {
+		return err
+	}
+	printWorstCategory(plan.Weather)
+
+	for _, icao := range plan.Plan.Airports() {
+		freqs, found := plan.Frequencies[icao]
+		if !found || len(freqs) == 0 {
+			continue
+		}
+		fmt.Printf("\nFrequencies for %s:\n", icao)
+		if err := write(ctx, freqs, format.FrequencyRows(freqs)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func printWorstCategory(route *sim.RouteWeather) {
+	if len(route.WorstAt) > 0 {
+		fmt.Printf("Worst category along route: %s at %s\n", colourCategory(route.Worst), strings.Join(route.WorstAt, ", "))
+	}
+}
+
+func runway(coreApp **app.App) cli.ActionFunc {
+	return func(cliContext *cli.Context) error {
+		return runwayCommand(cliContext, *coreApp)
+	}
+}
+
+func runwayCommand(cliContext *cli.Context, coreApp *app.App) error {
+	if cliContext.NArg() != 1 {
+		return fmt.Errorf("requires exactly one ICAO code argument")
+	}
+
+	recommendation, err := coreApp.GetRunwayRecommendation(cliContext.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	if outputFormat(cliContext) == format.Table {
+		if recommendation.Recommended == nil {
+			fmt.Printf("No runways found for %s\n", recommendation.ICAO)
+			return nil
+		}
+		fmt.Printf("Runways for %s, wind %s, best first:\n", recommendation.ICAO, format.DescribeWind(recommendation.Wind))
+	}
+
+	return write(cliContext, recommendation, format.RunwayRows(recommendation))
+}
+
+func brief(coreApp **app.App) cli.ActionFunc {
+	return func(cliContext *cli.Context) error {
+		return briefCommand(cliContext, *coreApp)
+	}
+}
+
+func briefCommand(cliContext *cli.Context, coreApp *app.App) error {
+	if cliContext.NArg() != 1 {
+		return fmt.Errorf("requires exactly one argument (comma-separated airports)")
+	}
+
+	briefing, err := coreApp.GetBriefing(strings.Split(cliContext.Args().Get(0), ","))
+	if err != nil {
+		return err
+	}
+
+	return format.WriteBriefing(os.Stdout, outputFormat(cliContext), briefing)
+}
+
+func nearby(coreApp **app.App) cli.ActionFunc {
+	return func(cliContext *cli.Context) error {
+		return nearbyCommand(cliContext, *coreApp)
+	}
+}
+
+func nearbyCommand(cliContext *cli.Context, coreApp *app.App) error {
+	if cliContext.NArg() > 1 {
+		return fmt.Errorf("requires at most one ICAO code or lat,lon argument")
+	}
+
+	center := cliContext.Args().Get(0)
+	radius := cliContext.Float64("radius")
+
+	airports, err := coreApp.GetNearbyAirports(center, radius, cliContext.Bool("frequencies"))
+	if err != nil {
+		return err
+	}
+
+	if outputFormat(cliContext) == format.Table {
+		around := strings.ToUpper(center)
+		if around == "" {
+			around = "the aircraft"
+		}
+		if len(airports) == 0 {
+			fmt.Printf("No airports within %g NM of %s\n", radius, around)
+			return nil
 		}
-		fmt.Printf("    Raw: %s\n", weather.RawMetar)
+		fmt.Printf("Airports within %g NM of %s:\n", radius, around)
 	}
 
+	return write(cliContext, airports, format.NearbyRows(airports))
+}
+
+func aircraft(coreApp **app.App) cli.ActionFunc {
+	return func(cliContext *cli.Context) error {
+		return aircraftCommand(cliContext, *coreApp)
+	}
+}
+
+func aircraftCommand(cliContext *cli.Context, coreApp *app.App) error {
+	if cliContext.NArg() != 0 {
+		return fmt.Errorf("takes no arguments")
+	}
+
+	update, err := coreApp.GetAircraft()
+	if err != nil {
+		return err
+	}
+
+	return write(cliContext, update, format.AircraftRows(update.Aircraft, update.Nearest))
+}
+
+func tune(coreApp **app.App) cli.ActionFunc {
+	return func(cliContext *cli.Context) error {
+		return tuneCommand(cliContext, *coreApp)
+	}
+}
+
+func tuneCommand(cliContext *cli.Context, coreApp *app.App) error {
+	if cliContext.NArg() != 2 {
+		return fmt.Errorf("requires a radio and a frequency in MHz, e.g. COM1 118.700")
+	}
+
+	radio := strings.ToUpper(cliContext.Args().Get(0))
+	hz, err := sim.ParseMHz(cliContext.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	slot := sim.SlotActive
+	if cliContext.Bool("standby") {
+		slot = sim.SlotStandby
+	}
+
+	if err := coreApp.TuneRadio(radio, string(slot), hz); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s %s set to %.3f MHz\n", radio, slot, float64(hz)/1e6)
+	return nil
+}
+
+func advise(coreApp **app.App) cli.ActionFunc {
+	return func(cliContext *cli.Context) error {
+		return adviseCommand(cliContext, *coreApp)
+	}
+}
+
+func adviseCommand(cliContext *cli.Context, coreApp *app.App) error {
+	if cliContext.NArg() != 2 {
+		return fmt.Errorf("requires a departure and a destination airport, e.g. EDDB EDDH")
+	}
+
+	if _, err := coreApp.SetAdvisorRoute(cliContext.Args().Get(0), cliContext.Args().Get(1)); err != nil {
+		return err
+	}
+	update, err := coreApp.GetAircraft()
+	if err != nil {
+		return err
+	}
+	if update.Next == nil {
+		return fmt.Errorf("no frequency left to suggest for this flight")
+	}
+
+	if err := write(cliContext, update.Next, format.AdviceRows(update.Next)); err != nil {
+		return err
+	}
+	if !cliContext.Bool("tune") {
+		return nil
+	}
+
+	if err := coreApp.TuneRadio(string(sim.RadioCOM1), string(sim.SlotStandby), update.Next.Frequency.Hz); err != nil {
+		return err
+	}
+	fmt.Printf("%s %s set to %.3f MHz\n", sim.RadioCOM1, sim.SlotStandby, update.Next.Frequency.MHz)
+	return nil
+}
+
+func serve(host **app.Host) cli.ActionFunc {
+	return func(cliContext *cli.Context) error {
+		return serveCommand(cliContext, *host)
+	}
+}
+
+func serveCommand(cliContext *cli.Context, host *app.Host) error {
+	if cliContext.NArg() != 0 {
+		return fmt.Errorf("takes no arguments")
+	}
+
+	options := server.Options{
+		Addr:           cliContext.String("addr"),
+		AllowedOrigins: cliContext.StringSlice("cors-origin"),
+	}
+	fmt.Printf("Serving on %s, press Ctrl-C to stop\n", options.Addr)
+	return server.New(host.Service(), options).ListenAndServe(cliContext.Context)
+}
+
+func clouds(coreApp **app.App) cli.ActionFunc {
+	return func(cliContext *cli.Context) error {
+		return cloudsCommand(cliContext, *coreApp)
+	}
+}
+
+func cloudsCommand(cliContext *cli.Context, coreApp *app.App) error {
+	if cliContext.NArg() != 1 {
+		return fmt.Errorf("requires exactly one argument (comma-separated waypoints)")
+	}
+
+	waypoints := strings.Split(cliContext.Args().Get(0), ",")
+
+	opts := sim.CloudProfileOptions{
+		MinAlt: cliContext.Int("min-altitude"),
+		MaxAlt: cliContext.Int("max-altitude"),
+		Step:   cliContext.Int("step"),
+	}
+	result, err := coreApp.GetCloudProfile(waypoints, opts)
+	if err != nil {
+		return err
+	}
+	profiles := result.Profiles
+
+	if cliContext.Bool("layers") {
+		err = write(cliContext, profiles, format.CloudLayerRows(waypoints, profiles))
+	} else {
+		clouds := make(map[string][]sim.CloudDensity, len(profiles))
+		for wp, profile := range profiles {
+			clouds[wp] = profile.Levels
+		}
+		err = write(cliContext, clouds, format.CloudRows(waypoints, clouds))
+	}
+	if err != nil {
+		return err
+	}
+
+	// Unknown waypoints are skipped. The levels that were answered are written, the others are
+	// reported on stderr and fail the command.
+	for _, wp := range result.Unknown {
+		fmt.Fprintf(os.Stderr, "%s: unknown waypoint\n", wp)
+	}
+	failed := 0
+	for _, wp := range slices.Sorted(maps.Keys(result.Failures)) {
+		for _, failure := range result.Failures[wp] {
+			fmt.Fprintf(os.Stderr, "%s %d-%d ft: %s\n", wp, failure.MinAlt, failure.MaxAlt, failure.Error)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("the simulator didn't answer %d cloud levels", failed)
+	}
 	return nil
 }
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"atc_freq/internal/format"
+	"atc_freq/internal/sim"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+// outputFormat returns the format selected with --output, validated in Before
+func outputFormat(cliContext *cli.Context) format.Format {
+	f, err := format.Parse(cliContext.String("output"))
+	if err != nil {
+		return format.Table
+	}
+	return f
+}
+
+// write prints a command result to stdout in the selected format
+func write(cliContext *cli.Context, value any, rows *format.Rows) error {
+	rows.Highlight = map[string]func(string) string{
+		"Category": func(category string) string { return colourCategory(sim.FlightCategory(category)) },
+	}
+	return format.Write(os.Stdout, outputFormat(cliContext), value, rows)
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"atc_freq/internal/flightplan"
+	"atc_freq/internal/sim"
+	"context"
+	"errors"
+)
+
+// SetAdvisorRoute makes the next frequency advice follow a flight from departure to destination
+func (a *App) SetAdvisorRoute(departure, destination string) (*sim.FrequencyAdvisor, error) {
+	advisor, err := a.simService.NewFrequencyAdvisorCtx(a.requestContext(), departure, destination)
+	if err != nil {
+		return nil, explain(err)
+	}
+
+	a.setAdvisor(advisor)
+	return advisor, nil
+}
+
+// SetAutoTune turns pushing the advised frequency to COM1 standby on or off
+func (a *App) SetAutoTune(enabled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.autoTune = enabled
+	a.autoTunedHz = 0
+}
+
+// setAdvisor replaces the advisor used for the aircraft updates
+func (a *App) setAdvisor(advisor *sim.FrequencyAdvisor) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.advisor = advisor
+	a.autoTunedHz = 0
+}
+
+// setPlanAdvisor follows the departure and arrival of a loaded flight plan. Plans without
+// both airports keep the current advisor.
+func (a *App) setPlanAdvisor(plan *flightplan.Plan, frequencies map[string][]sim.AirportFrequency) {
+	if plan.Departure == nil || plan.Arrival == nil {
+		return
+	}
+
+	airport := func(w *flightplan.Waypoint) sim.AdvisorAirport {
+		return sim.AdvisorAirport{ICAO: w.Ident, Position: w.Position, Frequencies: frequencies[w.Ident]}
+	}
+	a.setAdvisor(sim.NewFrequencyAdvisor(airport(plan.Departure), airport(plan.Arrival)))
+}
+
+// advise returns the next frequency for state, nil without a route. With auto tune on, an advised
+// frequency that isn't tuned yet is set as COM1 standby once, so the pilot can still change it.
+func (a *App) advise(ctx context.Context, state sim.AircraftState) *sim.FrequencyAdvice {
+	a.mu.Lock()
+	advisor, autoTune, autoTunedHz := a.advisor, a.autoTune, a.autoTunedHz
+	a.mu.Unlock()
+
+	if advisor == nil {
+		return nil
+	}
+	advice := advisor.Next(state)
+	if advice == nil || !autoTune {
+		return advice
+	}
+
+	hz := advice.Frequency.Hz
+	if hz == autoTunedHz || state.COM1.Tuned(hz) {
+		return advice
+	}
+	// Failures from the connection are tried again with the next update, a frequency
+	// the radio can't take would fail every time
+	err := a.simService.TuneRadioCtx(ctx, sim.RadioCOM1, sim.SlotStandby, hz)
+	if err == nil || errors.Is(err, sim.ErrInvalidFrequency) {
+		a.mu.Lock()
+		a.autoTunedHz = hz
+		a.mu.Unlock()
+	}
+	return advice
+}
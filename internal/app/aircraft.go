@@ -0,0 +1,118 @@
+package app
+
+import (
+	"atc_freq/internal/sim"
+	"context"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Events emitted to the frontend by StartAircraftEvents
+const (
+	AircraftEvent     = "aircraft"      // Data is an AircraftUpdate
+	AircraftLostEvent = "aircraft:lost" // Data is the error message, updates resume when the simulator is back
+)
+
+const (
+	// aircraftRetryInterval is how long to wait before subscribing again when the simulator is gone
+	aircraftRetryInterval = 5 * time.Second
+	// nearestRadiusNM is how far the nearest airport is searched around the aircraft
+	nearestRadiusNM = 25
+	// nearestRefreshNM is how far the aircraft moves before the nearest airport is looked up again
+	nearestRefreshNM = 1
+)
+
+// AircraftUpdate is the user aircraft with the airport nearest to it and the frequency it needs next
+type AircraftUpdate struct {
+	Aircraft sim.AircraftState    `json:"aircraft"`
+	Nearest  *sim.NearbyAirport   `json:"nearest"` // nil when no airport is within nearestRadiusNM
+	Next     *sim.FrequencyAdvice `json:"next"`    // nil until a route is set with SetAdvisorRoute or a flight plan
+}
+
+// GetAircraft returns the position and radios of the user aircraft with the nearest airport.
+// The next frequency is advised but never tuned, that is left to the aircraft events.
+func (a *App) GetAircraft() (*AircraftUpdate, error) {
+	ctx := a.requestContext()
+
+	state, err := a.simService.GetAircraftStateCtx(ctx)
+	if err != nil {
+		return nil, explain(err)
+	}
+
+	nearest, err := a.nearestAirport(ctx, state.Position)
+	if err != nil {
+		return nil, explain(err)
+	}
+
+	a.mu.Lock()
+	advisor := a.advisor
+	a.mu.Unlock()
+
+	update := &AircraftUpdate{Aircraft: *state, Nearest: nearest}
+	if advisor != nil {
+		update.Next = advisor.Next(*state)
+	}
+	return update, nil
+}
+
+// watchAircraft keeps an aircraft subscription open, subscribing again after the simulator quit
+func (a *App) watchAircraft(ctx context.Context) {
+	var nearest *sim.NearbyAirport
+	var nearestAt *sim.Coordinates
+
+	for {
+		sub := a.simService.SubscribeAircraftCtx(ctx)
+		for state := range sub.Updates() {
+			if nearestAt == nil || sim.DistanceNM(*nearestAt, state.Position) > nearestRefreshNM {
+				// A failed lookup keeps the last airport and is tried again with the next update
+				if airport, err := a.nearestAirport(ctx, state.Position); err == nil {
+					position := state.Position
+					nearest, nearestAt = airport, &position
+				}
+			}
+			runtime.EventsEmit(ctx, AircraftEvent, AircraftUpdate{Aircraft: state, Nearest: nearest, Next: a.advise(ctx, state)})
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		if err := sub.Err(); err != nil {
+			runtime.EventsEmit(ctx, AircraftLostEvent, explain(err).Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(aircraftRetryInterval):
+		}
+	}
+}
+
+// nearestAirport returns the airport nearest to position with its local frequency
+func (a *App) nearestAirport(ctx context.Context, position sim.Coordinates) (*sim.NearbyAirport, error) {
+	airports, err := a.simService.NearbyAirportsCtx(ctx, position, nearestRadiusNM)
+	if err != nil || len(airports) == 0 {
+		return nil, err
+	}
+
+	nearest := airports[:1]
+	if err := a.simService.AddLocalFrequenciesCtx(ctx, nearest); err != nil {
+		return nil, err
+	}
+	return &nearest[0], nil
+}
+
+// TuneRadio sets the active or standby frequency of COM1, COM2, NAV1 or NAV2 of the user aircraft
+func (a *App) TuneRadio(radio string, slot string, hz int) error {
+	radioName, err := sim.ParseRadio(radio)
+	if err != nil {
+		return err
+	}
+	radioSlot, err := sim.ParseSlot(slot)
+	if err != nil {
+		return err
+	}
+
+	return explain(a.simService.TuneRadioCtx(a.requestContext(), radioName, radioSlot, hz))
+}
@@ -3,14 +3,22 @@ package app
 import (
 	"atc_freq/internal/sim"
 	"context"
+	"sync"
 )
 
 type App struct {
 	ctx        context.Context
 	simService *sim.Service
+
+	// mu guards the frequency advisor, it is used by bound methods and the aircraft events
+	mu          sync.Mutex
+	advisor     *sim.FrequencyAdvisor
+	autoTune    bool
+	autoTunedHz int // Last frequency pushed to COM1 standby by auto tune
 }
 
-func NewApp(connection sim.Connection) *App {
+// newApp creates the App bound to the frontend, NewHost runs it
+func newApp(connection sim.Connection) *App {
 	client := sim.NewClient(connection)
 
 	return &App{
@@ -18,24 +26,55 @@ func NewApp(connection sim.Connection) *App {
 	}
 }
 
-// AddContext is called when the Wails app starts. The context is saved
-// so we can call the runtime methods
-func (a *App) AddContext(ctx context.Context) {
-	a.ctx = ctx
+// requestContext returns the context stored by AddContext, requests are cancelled when it is done
+func (a *App) requestContext() context.Context {
+	if a.ctx == nil {
+		return context.Background()
+	}
+	return a.ctx
 }
 
 // GetFrequencies returns airport frequencies for the given ICAO code
 func (a *App) GetFrequencies(icao string) ([]sim.AirportFrequency, error) {
-	return a.simService.GetFrequency(icao)
+	freqs, err := a.simService.GetFrequencyCtx(a.requestContext(), icao)
+	return freqs, explain(err)
 }
 
 // GetWeather returns weather information for the given waypoints
 func (a *App) GetWeather(waypoints []string) (map[string]*sim.Weather, error) {
-	return a.simService.GetWeather(waypoints)
+	weather, err := a.simService.GetWeatherCtx(a.requestContext(), waypoints)
+	return weather, explain(err)
+}
+
+// GetRouteWeather returns weather for the given waypoints in route order with the worst flight category
+func (a *App) GetRouteWeather(waypoints []string) (*sim.RouteWeather, error) {
+	route, err := a.simService.GetRouteWeatherCtx(a.requestContext(), waypoints)
+	return route, explain(err)
+}
+
+// GetRunwayRecommendation returns the runway ends of the airport ranked by the wind in its METAR
+func (a *App) GetRunwayRecommendation(icao string) (*sim.RunwayRecommendation, error) {
+	recommendation, err := a.simService.RecommendRunwayCtx(a.requestContext(), icao)
+	return recommendation, explain(err)
+}
+
+// GetBriefing returns a pre-flight briefing for every airport of the route
+func (a *App) GetBriefing(route []string) (*sim.Briefing, error) {
+	briefing, err := a.simService.BriefCtx(a.requestContext(), route)
+	return briefing, explain(err)
 }
 
 // GetClouds returns weather information for the given waypoints
 // Implementation of SimConnect_WeatherRequestCloudState in MSFS202 SDK API is broken and always returns 0
-func (a *App) GetClouds(waypoints []string) (map[string][]sim.CloudDensity, error) {
-	return a.simService.GetCloudDensity(waypoints)
+// Levels that failed are listed in the result, it only fails when no level was answered.
+func (a *App) GetClouds(waypoints []string) (*sim.CloudDensities, error) {
+	clouds, err := sim.NewCloudDensities(a.simService.GetCloudDensityCtx(a.requestContext(), waypoints))
+	return clouds, explain(err)
+}
+
+// GetCloudProfile returns the cloud levels and layers above the given waypoints for the altitudes of opts.
+// Levels that failed are listed in the result, it only fails when no level was answered.
+func (a *App) GetCloudProfile(waypoints []string, opts sim.CloudProfileOptions) (*sim.CloudProfiles, error) {
+	profiles, err := sim.NewCloudProfiles(a.simService.GetCloudProfileCtx(a.requestContext(), waypoints, opts))
+	return profiles, explain(err)
 }
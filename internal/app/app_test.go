@@ -2,11 +2,22 @@ package app_test
 
 import (
 	"atc_freq/internal/app"
+	"atc_freq/internal/freqdb"
 	"atc_freq/internal/sim"
 	"atc_freq/internal/testutil"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestApp_GetAirportFrequencies(t *testing.T) {
@@ -21,27 +32,28 @@ func TestApp_GetAirportFrequencies(t *testing.T) {
 			icao: "KJFK",
 			mockSetup: func(m *sim.MockConnection) {
 				// Expect Open call
-				m.On("Open", "go-freq-client").Return(nil).Once()
+				m.On("Open", "atc-freq").Return(nil).Once()
 
 				// Expect all addField calls
-				m.On("AddField", "OPEN AIRPORT", uint32(sim.DEFINE_ID)).Return(nil).Once()
-				m.On("AddField", "OPEN FREQUENCY", uint32(sim.DEFINE_ID)).Return(nil).Once()
-				m.On("AddField", "TYPE", uint32(sim.DEFINE_ID)).Return(nil).Once()
-				m.On("AddField", "FREQUENCY", uint32(sim.DEFINE_ID)).Return(nil).Once()
-				m.On("AddField", "NAME", uint32(sim.DEFINE_ID)).Return(nil).Once()
-				m.On("AddField", "CLOSE FREQUENCY", uint32(sim.DEFINE_ID)).Return(nil).Once()
-				m.On("AddField", "CLOSE AIRPORT", uint32(sim.DEFINE_ID)).Return(nil).Once()
+				m.On("AddField", "OPEN AIRPORT", uint32(sim.FirstDefineID)).Return(nil).Once()
+				m.On("AddField", "OPEN FREQUENCY", uint32(sim.FirstDefineID)).Return(nil).Once()
+				m.On("AddField", "TYPE", uint32(sim.FirstDefineID)).Return(nil).Once()
+				m.On("AddField", "FREQUENCY", uint32(sim.FirstDefineID)).Return(nil).Once()
+				m.On("AddField", "NAME", uint32(sim.FirstDefineID)).Return(nil).Once()
+				m.On("AddField", "CLOSE FREQUENCY", uint32(sim.FirstDefineID)).Return(nil).Once()
+				m.On("AddField", "CLOSE AIRPORT", uint32(sim.FirstDefineID)).Return(nil).Once()
 
 				// Expect RequestFacilityData
-				m.On("RequestFacilityData", "KJFK", "", uint32(sim.DEFINE_ID), uint32(sim.REQUEST_ID)).Return(nil).Once()
+				m.On("RequestFacilityData", "KJFK", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once()
 
 				// Mock frequency data response
-				freqData := testutil.CreateFacilityDataResponse(6, 118700000, "Tower")
+				freqData := testutil.CreateFacilityDataResponse(sim.FirstRequestID, 6, 118700000, "Tower")
 				m.On("GetNextDispatch").Return(freqData, true).Once()
 
 				// Mock facility data end
-				endData := testutil.CreateFacilityDataEndResponse()
+				endData := testutil.CreateFacilityDataEndResponse(sim.FirstRequestID)
 				m.On("GetNextDispatch").Return(endData, true).Once()
+				m.On("GetNextDispatch").Return(nil, false).Maybe()
 
 				// Expect Close call
 				m.On("Close").Return().Once()
@@ -53,6 +65,7 @@ func TestApp_GetAirportFrequencies(t *testing.T) {
 					Name:     "Tower",
 					Hz:       118700000,
 					MHz:      118.7,
+					Source:   sim.SourceSimulator,
 				},
 			},
 		},
@@ -71,9 +84,10 @@ func TestApp_GetAirportFrequencies(t *testing.T) {
 			mockConn := new(sim.MockConnection)
 			tt.mockSetup(mockConn)
 
-			application := app.NewApp(mockConn)
+			application := app.NewHost(mockConn)
 
 			freqs, err := application.GetFrequencies(tt.icao)
+			application.Close()
 
 			if tt.expectedFreqs == nil {
 				assert.Error(t, err)
@@ -86,3 +100,207 @@ func TestApp_GetAirportFrequencies(t *testing.T) {
 		})
 	}
 }
+
+func TestApp_BindsNoLifecycleMethods(t *testing.T) {
+	// Wails binds every exported method of App, the frontend must not close the session or restart the events
+	bound := reflect.TypeOf(&app.App{})
+	for _, name := range []string{"AddContext", "StartAircraftEvents", "Shutdown", "Close", "Service"} {
+		_, found := bound.MethodByName(name)
+		assert.False(t, found, name)
+	}
+}
+
+func TestApp_GetFrequenciesUsesAppContext(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	mockConn.On("AddField", mock.Anything, mock.Anything).Return(nil).Times(7)
+
+	// Shutting down the Wails app cancels the context stored by AddContext
+	mockConn.On("RequestFacilityData", "KJFK", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once().
+		Run(func(mock.Arguments) { cancel() })
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	application := app.NewHost(mockConn)
+	application.AddContext(ctx)
+
+	_, err := application.GetFrequencies("KJFK")
+	application.Close()
+
+	assert.ErrorIs(t, err, context.Canceled)
+	mockConn.AssertExpectations(t)
+}
+
+func TestApp_ExplainsSimErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		mockSetup     func(*sim.MockConnection)
+		expectedError string
+		expectedIs    error
+	}{
+		{
+			name: "simulator not running",
+			mockSetup: func(m *sim.MockConnection) {
+				m.On("Open", "atc-freq").Return(fmt.Errorf("%w: %w", sim.ErrNotConnected, &sim.HResultError{Call: "SimConnect_Open", HResult: 0x80004005})).Once()
+			},
+			expectedError: "Flight Simulator is not running or no flight is loaded: failed to get frequencies for XXXX: not connected to the simulator: SimConnect_Open failed HRESULT=0x80004005",
+			expectedIs:    sim.ErrNotConnected,
+		},
+		{
+			name: "unknown icao",
+			mockSetup: func(m *sim.MockConnection) {
+				m.On("Open", "atc-freq").Return(nil).Once()
+				m.On("AddField", mock.Anything, mock.Anything).Return(nil).Times(7)
+				m.On("RequestFacilityData", "XXXX", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once()
+				m.On("GetNextDispatch").Return(testutil.CreateFacilityDataEndResponse(sim.FirstRequestID), true).Once()
+				m.On("GetNextDispatch").Return(nil, false).Maybe()
+				m.On("Close").Return().Once()
+			},
+			expectedError: "the simulator doesn't know this identifier, check the ICAO code: failed to get frequencies for XXXX: unknown facility: [XXXX]",
+			expectedIs:    sim.ErrUnknownFacility,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockConn := new(sim.MockConnection)
+			tt.mockSetup(mockConn)
+
+			application := app.NewHost(mockConn)
+
+			_, err := application.GetFrequencies("XXXX")
+			application.Close()
+
+			assert.EqualError(t, err, tt.expectedError)
+			assert.ErrorIs(t, err, tt.expectedIs)
+			mockConn.AssertExpectations(t)
+		})
+	}
+}
+
+func TestApp_LoadFlightPlan(t *testing.T) {
+	connection, err := app.NewConnection(app.ConnectionOptions{FakeSim: true})
+	require.NoError(t, err)
+	coreApp := app.NewHost(connection)
+	defer coreApp.Close()
+
+	// EDDP is unknown to the fake simulator, it's left out instead of failing the plan
+	path := filepath.Join(t.TempDir(), "route.lnmpln")
+	require.NoError(t, os.WriteFile(path, []byte(`<LittleNavmap><Flightplan>
+		<Alternates>
+			<Alternate><Ident>EDDP</Ident><Type>AIRPORT</Type><Pos Lon="12.24" Lat="51.42" Alt="465"/></Alternate>
+		</Alternates>
+		<Waypoints>
+			<Waypoint><Ident>EDDB</Ident><Type>AIRPORT</Type><Pos Lon="13.50" Lat="52.36" Alt="157"/></Waypoint>
+			<Waypoint><Ident>LUROS</Ident><Type>WAYPOINT</Type><Pos Lon="12.5" Lat="52.75" Alt="24000"/></Waypoint>
+			<Waypoint><Ident>EDDH</Ident><Type>AIRPORT</Type><Pos Lon="9.99" Lat="53.63" Alt="53"/></Waypoint>
+		</Waypoints>
+	</Flightplan></LittleNavmap>`), 0o600))
+
+	plan, err := coreApp.LoadFlightPlan(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"EDDB", "EDDH", "EDDP"}, plan.Plan.Airports())
+	require.Len(t, plan.Weather.Stations, 2)
+	assert.Equal(t, "EDDB", plan.Weather.Stations[0].Waypoint)
+	assert.Equal(t, "EDDH", plan.Weather.Stations[1].Waypoint)
+	assert.NotEmpty(t, plan.Frequencies["EDDB"])
+	assert.NotEmpty(t, plan.Frequencies["EDDH"])
+	assert.NotContains(t, plan.Frequencies, "EDDP")
+
+	// The frontend reads the plan by its json names
+	data, err := json.Marshal(plan)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"plan":{"title":"EDDB to EDDH","type":"","cruising_altitude":0,"departure":{"ident":"EDDB"`)
+	assert.Contains(t, string(data), `"weather":{"stations":[`)
+
+	// The plan sets the route of the next frequency advice
+	update, err := coreApp.GetAircraft()
+	require.NoError(t, err)
+	require.NotNil(t, update.Next)
+	assert.Equal(t, "EDDB", update.Next.ICAO)
+}
+
+func TestApp_GetAircraft(t *testing.T) {
+	connection, err := app.NewConnection(app.ConnectionOptions{FakeSim: true})
+	require.NoError(t, err)
+	coreApp := app.NewHost(connection)
+	defer coreApp.Close()
+
+	update, err := coreApp.GetAircraft()
+	require.NoError(t, err)
+	assert.Equal(t, 121880000, update.Aircraft.COM1.ActiveHz)
+
+	// The fake aircraft is parked at EDDB
+	require.NotNil(t, update.Nearest)
+	assert.Equal(t, "EDDB", update.Nearest.ICAO)
+	require.NotNil(t, update.Nearest.Frequency)
+	assert.Equal(t, "TOWER", update.Nearest.Frequency.Type)
+
+	data, err := json.Marshal(update)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"nearest":{"icao":"EDDB"`)
+
+	// Without a center the search is around the aircraft, which is not at an airport
+	nearby, err := coreApp.GetNearbyAirports("", 30, false)
+	require.NoError(t, err)
+	require.Len(t, nearby, 3)
+	assert.Equal(t, "EDDB", nearby[0].ICAO)
+}
+
+func TestApp_SetAdvisorRoute(t *testing.T) {
+	connection, err := app.NewConnection(app.ConnectionOptions{FakeSim: true})
+	require.NoError(t, err)
+	coreApp := app.NewHost(connection)
+	defer coreApp.Close()
+
+	update, err := coreApp.GetAircraft()
+	require.NoError(t, err)
+	assert.Nil(t, update.Next)
+
+	advisor, err := coreApp.SetAdvisorRoute("eddb", "EDDH")
+	require.NoError(t, err)
+	assert.Equal(t, "EDDH", advisor.Destination.ICAO)
+	assert.NotEmpty(t, advisor.Destination.Frequencies)
+
+	// The fake aircraft is parked at EDDB with COM1 on ground, the tower follows
+	update, err = coreApp.GetAircraft()
+	require.NoError(t, err)
+	require.NotNil(t, update.Next)
+	assert.Equal(t, sim.PhasePreflight, update.Next.Phase)
+	assert.Equal(t, "EDDB", update.Next.ICAO)
+	assert.Equal(t, "TOWER", update.Next.Frequency.Type)
+
+	_, err = coreApp.SetAdvisorRoute("EDDB", "XXXX")
+	assert.ErrorIs(t, err, sim.ErrUnknownFacility)
+}
+
+func TestApp_LoadFrequencyDatabase(t *testing.T) {
+	db, err := freqdb.ImportAptDat(strings.NewReader("1 157 0 0 EDDB Berlin Brandenburg\n1054 118800 TOWER\n99\n"))
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "frequencies.json")
+	require.NoError(t, db.Save(path))
+
+	// Without SimConnect the app starts and explains why requests fail
+	coreApp := app.NewHost(sim.NewDisconnectedConnection(errors.New("SimConnect.dll not found")))
+	defer coreApp.Close()
+
+	_, err = coreApp.GetFrequencies("EDDB")
+	assert.ErrorIs(t, err, sim.ErrNotConnected)
+	assert.ErrorContains(t, err, "Flight Simulator is not running")
+
+	assert.Equal(t, path, app.FrequencyDatabasePath(path))
+	_, err = coreApp.LoadFrequencyDatabase(path, false)
+	require.NoError(t, err)
+
+	freqs, err := coreApp.GetFrequencies("EDDB")
+	require.NoError(t, err)
+	require.Len(t, freqs, 1)
+	assert.Equal(t, freqdb.SourceXPlane, freqs[0].Source)
+	assert.Equal(t, 118800000, freqs[0].Hz)
+
+	_, err = coreApp.LoadFrequencyDatabase(filepath.Join(t.TempDir(), "missing.json"), false)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"atc_freq/internal/sim"
+	"atc_freq/internal/simcapture"
+	"atc_freq/internal/simfake"
+)
+
+// ConnectionOptions selects the simulator connection used by the app
+type ConnectionOptions struct {
+	FakeSim  bool   // Use the built-in fake simulator instead of SimConnect
+	Fixtures string // JSON fixtures for the fake simulator, the embedded ones are used when empty
+	Record   string // Capture file to record the session to, see package simcapture
+	Replay   string // Capture file to replay instead of connecting to a simulator
+}
+
+// NewConnection creates the SimConnect connection or the fake simulator, depending on options.
+// When SimConnect can't be loaded the app still starts, its requests fail with sim.ErrNotConnected
+// and the reason unless an offline frequency database answers them.
+func NewConnection(options ConnectionOptions) (sim.Connection, error) {
+	if options.Replay != "" {
+		return simcapture.LoadReplay(options.Replay)
+	}
+
+	connection, err := newSimConnection(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Record != "" {
+		return simcapture.Create(options.Record, connection)
+	}
+	return connection, nil
+}
+
+// newSimConnection creates the SimConnect connection or the fake simulator
+func newSimConnection(options ConnectionOptions) (sim.Connection, error) {
+	if !options.FakeSim {
+		connection, err := sim.NewConnection()
+		if err != nil {
+			return sim.NewDisconnectedConnection(err), nil
+		}
+		return connection, nil
+	}
+
+	fixtures := simfake.DefaultFixtures()
+	if options.Fixtures != "" {
+		var err error
+		fixtures, err = simfake.LoadFixtures(options.Fixtures)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return simfake.NewConnection(fixtures), nil
+}
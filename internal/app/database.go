@@ -0,0 +1,41 @@
+package app
+
+import (
+	"atc_freq/internal/freqdb"
+	"atc_freq/internal/sim"
+	"os"
+)
+
+// FrequencyDatabasePath returns path, or the database written by the import command to
+// freqdb.DefaultPath when path is empty. It returns "" when there is no database to load.
+func FrequencyDatabasePath(path string) string {
+	if path != "" {
+		return path
+	}
+
+	path, err := freqdb.DefaultPath()
+	if err != nil {
+		return ""
+	}
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// LoadFrequencyDatabase loads an offline frequency database written by the import command.
+// Its frequencies are used when the simulator can't answer, or added to those of the simulator
+// when merge is set.
+func (a *App) LoadFrequencyDatabase(path string, merge bool) (*freqdb.Database, error) {
+	db, err := freqdb.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := sim.SourceFallback
+	if merge {
+		mode = sim.SourceMerge
+	}
+	a.simService.SetFrequencySource(db, mode)
+	return db, nil
+}
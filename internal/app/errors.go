@@ -0,0 +1,31 @@
+package app
+
+import (
+	"atc_freq/internal/sim"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// explain prefixes errors from the sim package with a hint the user can act on.
+// The original error stays wrapped, so errors.Is and errors.As keep working.
+func explain(err error) error {
+	var exception *sim.ExceptionError
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("request cancelled: %w", err)
+	case errors.Is(err, sim.ErrNotConnected):
+		return fmt.Errorf("Flight Simulator is not running or no flight is loaded: %w", err)
+	case errors.Is(err, sim.ErrUnknownFacility):
+		return fmt.Errorf("the simulator doesn't know this identifier, check the ICAO code: %w", err)
+	case errors.Is(err, sim.ErrTimeout):
+		return fmt.Errorf("the simulator didn't answer in time, try again once the flight has finished loading: %w", err)
+	case errors.As(err, &exception):
+		return fmt.Errorf("the simulator rejected the request: %w", err)
+	}
+
+	return err
+}
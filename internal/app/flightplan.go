@@ -0,0 +1,79 @@
+package app
+
+import (
+	"atc_freq/internal/flightplan"
+	"atc_freq/internal/sim"
+	"context"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// FlightPlan is a loaded flight plan with the weather and frequencies of the airports along it
+type FlightPlan struct {
+	Path        string                            `json:"path"`
+	Plan        *flightplan.Plan                  `json:"plan"`
+	Weather     *sim.RouteWeather                 `json:"weather"`
+	Frequencies map[string][]sim.AirportFrequency `json:"frequencies"`
+}
+
+// OpenFlightPlan asks for a .pln or .lnmpln file and loads it. It returns nil when the dialog is cancelled.
+func (a *App) OpenFlightPlan() (*FlightPlan, error) {
+	path, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Open flight plan",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "Flight plans (*.pln, *.lnmpln)", Pattern: "*.pln;*.lnmpln"},
+		},
+	})
+	if err != nil || path == "" {
+		return nil, err
+	}
+
+	return a.LoadFlightPlan(path)
+}
+
+// LoadFlightPlan reads a flight plan and fetches weather and frequencies for every airport on it.
+// Airports without a weather report or unknown to the simulator are left out of the results.
+// The next frequency advice follows the departure and arrival of the plan from then on.
+func (a *App) LoadFlightPlan(path string) (*FlightPlan, error) {
+	plan, err := flightplan.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	airports := plan.Airports()
+	weather, err := a.airportWeather(a.requestContext(), airports)
+	if err != nil {
+		return nil, explain(err)
+	}
+
+	frequencies, err := a.airportFrequencies(a.requestContext(), airports)
+	if err != nil {
+		return nil, explain(err)
+	}
+	a.setPlanAdvisor(plan, frequencies)
+
+	return &FlightPlan{
+		Path:        path,
+		Plan:        plan,
+		Weather:     sim.SummarizeRoute(airports, weather),
+		Frequencies: frequencies,
+	}, nil
+}
+
+// airportWeather requests all airports in one batch, airports without a weather station are left out
+func (a *App) airportWeather(ctx context.Context, airports []string) (map[string]*sim.Weather, error) {
+	weather, err := a.simService.GetWeatherCtx(ctx, airports)
+	if err := sim.IgnoreUnknownFacilities(err); err != nil {
+		return nil, err
+	}
+	return weather, nil
+}
+
+// airportFrequencies requests all airports in one batch, airports unknown to the simulator are left out
+func (a *App) airportFrequencies(ctx context.Context, airports []string) (map[string][]sim.AirportFrequency, error) {
+	freqs, err := a.simService.GetFrequencyBatchCtx(ctx, airports)
+	if err := sim.IgnoreUnknownFacilities(err); err != nil {
+		return nil, err
+	}
+	return freqs, nil
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"atc_freq/internal/sim"
+	"context"
+	"sync"
+)
+
+// Host runs an App for Wails or the CLI. It holds the lifecycle hooks and the simulator session,
+// which the frontend must not reach: only the embedded App is bound, Host methods aren't.
+type Host struct {
+	*App
+
+	// aircraftEvents starts the aircraft watcher once, Wails calls OnDomReady again on every reload
+	aircraftEvents sync.Once
+}
+
+// NewHost creates the App of connection and its host
+func NewHost(connection sim.Connection) *Host {
+	return &Host{App: newApp(connection)}
+}
+
+// AddContext is called when the Wails app starts. The context is saved
+// so we can call the runtime methods and cancel requests in flight
+func (h *Host) AddContext(ctx context.Context) {
+	h.ctx = ctx
+}
+
+// StartAircraftEvents emits an AircraftEvent whenever the user aircraft changes until ctx is done.
+// It is called once the frontend is loaded, so no update is emitted before it listens. Reloading the
+// frontend calls it again, the events keep coming from the first call.
+func (h *Host) StartAircraftEvents(ctx context.Context) {
+	h.aircraftEvents.Do(func() {
+		go h.watchAircraft(ctx)
+	})
+}
+
+// Shutdown is called when the Wails app is closing. It closes the SimConnect session
+func (h *Host) Shutdown(ctx context.Context) {
+	h.Close()
+}
+
+// Close closes the SimConnect session used by the app
+func (h *Host) Close() {
+	h.simService.Close()
+}
+
+// Service returns the simulator service of the app, for the HTTP server to share its session
+func (h *Host) Service() *sim.Service {
+	return h.simService
+}
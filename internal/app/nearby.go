@@ -0,0 +1,13 @@
+package app
+
+import (
+	"atc_freq/internal/sim"
+)
+
+// GetNearbyAirports returns the airports within radiusNM of an ICAO code, a "lat,lon" position
+// or the user aircraft when center is empty, nearest first. With frequencies set every airport
+// gets its tower, CTAF or UNICOM frequency. The airport searched around is not part of the result.
+func (a *App) GetNearbyAirports(center string, radiusNM float64, frequencies bool) ([]sim.NearbyAirport, error) {
+	airports, err := a.simService.FindNearbyCtx(a.requestContext(), center, radiusNM, frequencies)
+	return airports, explain(err)
+}
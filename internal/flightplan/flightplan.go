@@ -0,0 +1,149 @@
+// Package flightplan reads flight plans saved by the MSFS planner (.pln) and by
+// Little Navmap (.lnmpln), so route lookups don't need hand-typed waypoint lists.
+package flightplan
+
+import (
+	"atc_freq/internal/sim"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Waypoint types, the MSFS Intersection type is reported as TypeWaypoint
+const (
+	TypeAirport  = "AIRPORT"
+	TypeWaypoint = "WAYPOINT"
+	TypeVOR      = "VOR"
+	TypeNDB      = "NDB"
+	TypeUser     = "USER"
+)
+
+// Plan is a flight plan with its airports and enroute waypoints
+type Plan struct {
+	Title            string     `json:"title"`
+	Type             string     `json:"type"`              // IFR or VFR
+	CruisingAltitude int        `json:"cruising_altitude"` // Feet
+	Departure        *Waypoint  `json:"departure"`
+	Arrival          *Waypoint  `json:"arrival"`
+	Alternates       []Waypoint `json:"alternates"`
+	Enroute          []Waypoint `json:"enroute"` // Waypoints between departure and arrival in route order
+}
+
+// Waypoint is a point of the route
+type Waypoint struct {
+	Ident    string          `json:"ident"`
+	Region   string          `json:"region"`
+	Name     string          `json:"name"`
+	Type     string          `json:"type"` // One of the Type constants
+	Position sim.Coordinates `json:"position"`
+	Altitude float64         `json:"altitude"` // Feet, the elevation of airports and the planned altitude of enroute waypoints
+}
+
+// ErrUnknownFormat is returned for files that are neither an MSFS nor a Little Navmap flight plan
+var ErrUnknownFormat = errors.New("unknown flight plan format")
+
+// Load reads a .pln or .lnmpln flight plan, the format is detected from the content
+func Load(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flight plan: %w", err)
+	}
+
+	plan, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse flight plan %s: %w", path, err)
+	}
+	return plan, nil
+}
+
+// Parse decodes an MSFS or Little Navmap flight plan
+func Parse(data []byte) (*Plan, error) {
+	root, err := rootElement(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch root {
+	case "SimBase.Document":
+		return parseMSFS(data)
+	case "LittleNavmap":
+		return parseLNM(data)
+	}
+	return nil, fmt.Errorf("%w: root element %s", ErrUnknownFormat, root)
+}
+
+// Airports returns the identifiers of the departure, enroute airports, arrival and alternates
+// in that order, each airport once
+func (p *Plan) Airports() []string {
+	var airports []string
+	seen := make(map[string]bool)
+	add := func(wp *Waypoint) {
+		if wp == nil || wp.Type != TypeAirport || seen[wp.Ident] {
+			return
+		}
+		seen[wp.Ident] = true
+		airports = append(airports, wp.Ident)
+	}
+
+	add(p.Departure)
+	for i := range p.Enroute {
+		add(&p.Enroute[i])
+	}
+	add(p.Arrival)
+	for i := range p.Alternates {
+		add(&p.Alternates[i])
+	}
+
+	return airports
+}
+
+// Route returns every waypoint from departure to arrival, alternates are not included
+func (p *Plan) Route() []Waypoint {
+	var route []Waypoint
+	if p.Departure != nil {
+		route = append(route, *p.Departure)
+	}
+	route = append(route, p.Enroute...)
+	if p.Arrival != nil {
+		route = append(route, *p.Arrival)
+	}
+	return route
+}
+
+// rootElement returns the name of the first element of an XML document
+func rootElement(data []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+// splitEnds takes the departure and arrival airports off the ends of the route
+func splitEnds(plan *Plan, route []Waypoint) {
+	if len(route) > 0 && route[0].Type == TypeAirport {
+		plan.Departure = &route[0]
+		route = route[1:]
+	}
+	if len(route) > 0 && route[len(route)-1].Type == TypeAirport {
+		plan.Arrival = &route[len(route)-1]
+		route = route[:len(route)-1]
+	}
+	plan.Enroute = route
+}
+
+func normalizeType(t string) string {
+	t = strings.ToUpper(strings.TrimSpace(t))
+	if t == "INTERSECTION" {
+		return TypeWaypoint
+	}
+	return t
+}
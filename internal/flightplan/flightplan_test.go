@@ -0,0 +1,205 @@
+package flightplan_test
+
+import (
+	"atc_freq/internal/flightplan"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const msfsPlan = `<?xml version="1.0" encoding="UTF-8"?>
+<SimBase.Document Type="AceXML" version="1,0">
+    <Descr>AceXML Document</Descr>
+    <FlightPlan.FlightPlan>
+        <Title>EDDB to EDDH</Title>
+        <FPType>IFR</FPType>
+        <RouteType>HighAlt</RouteType>
+        <CruisingAlt>24000</CruisingAlt>
+        <DepartureID>EDDB</DepartureID>
+        <DepartureLLA>N52° 21' 4.92",E13° 29' 37.92",+000157.00</DepartureLLA>
+        <DestinationID>EDDH</DestinationID>
+        <DestinationLLA>N53° 37' 49.00",E9° 59' 17.00",+000053.00</DestinationLLA>
+        <DepartureName>Berlin Brandenburg</DepartureName>
+        <DestinationName>Hamburg</DestinationName>
+        <ATCWaypoint id="EDDB">
+            <ATCWaypointType>Airport</ATCWaypointType>
+            <WorldPosition>N52° 21' 4.92",E13° 29' 37.92",+000157.00</WorldPosition>
+            <ICAO>
+                <ICAOIdent>EDDB</ICAOIdent>
+            </ICAO>
+        </ATCWaypoint>
+        <ATCWaypoint id="LUROS">
+            <ATCWaypointType>Intersection</ATCWaypointType>
+            <WorldPosition>N52° 45' 0.00",E12° 30' 0.00",+024000.00</WorldPosition>
+            <ICAO>
+                <ICAORegion>ED</ICAORegion>
+                <ICAOIdent>LUROS</ICAOIdent>
+            </ICAO>
+        </ATCWaypoint>
+        <ATCWaypoint id="EDDH">
+            <ATCWaypointType>Airport</ATCWaypointType>
+            <WorldPosition>N53° 37' 49.00",E9° 59' 17.00",+000053.00</WorldPosition>
+            <ICAO>
+                <ICAOIdent>EDDH</ICAOIdent>
+            </ICAO>
+        </ATCWaypoint>
+    </FlightPlan.FlightPlan>
+</SimBase.Document>
+`
+
+const lnmPlan = `<?xml version="1.0" encoding="UTF-8"?>
+<LittleNavmap xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:noNamespaceSchemaLocation="https://www.littlenavmap.org/schema/lnmpln.xsd">
+  <Flightplan>
+    <Header>
+      <FlightplanType>VFR</FlightplanType>
+      <CruisingAlt>4500</CruisingAlt>
+      <ProgramName>Little Navmap</ProgramName>
+    </Header>
+    <Departure>
+      <Pos Lon="-118.408051" Lat="33.942536" Alt="125.00"/>
+      <Start>25R</Start>
+    </Departure>
+    <Alternates>
+      <Alternate>
+        <Name>Ontario Intl</Name>
+        <Ident>KONT</Ident>
+        <Type>AIRPORT</Type>
+        <Pos Lon="-117.601196" Lat="34.056000" Alt="944.00"/>
+      </Alternate>
+    </Alternates>
+    <Waypoints>
+      <Waypoint>
+        <Name>Los Angeles Intl</Name>
+        <Ident>KLAX</Ident>
+        <Type>AIRPORT</Type>
+        <Pos Lon="-118.408051" Lat="33.942536" Alt="125.00"/>
+      </Waypoint>
+      <Waypoint>
+        <Name>Santa Monica</Name>
+        <Ident>SMO</Ident>
+        <Region>K2</Region>
+        <Type>VOR</Type>
+        <Pos Lon="-118.456" Lat="34.010" Alt="4500.00"/>
+      </Waypoint>
+      <Waypoint>
+        <Name>Van Nuys</Name>
+        <Ident>KVNY</Ident>
+        <Type>AIRPORT</Type>
+        <Pos Lon="-118.490" Lat="34.209" Alt="4500.00"/>
+      </Waypoint>
+      <Waypoint>
+        <Name>Burbank</Name>
+        <Ident>KBUR</Ident>
+        <Type>AIRPORT</Type>
+        <Pos Lon="-118.358" Lat="34.200" Alt="778.00"/>
+      </Waypoint>
+    </Waypoints>
+  </Flightplan>
+</LittleNavmap>
+`
+
+func TestParse_MSFS(t *testing.T) {
+	plan, err := flightplan.Parse([]byte(msfsPlan))
+	require.NoError(t, err)
+
+	assert.Equal(t, "EDDB to EDDH", plan.Title)
+	assert.Equal(t, "IFR", plan.Type)
+	assert.Equal(t, 24000, plan.CruisingAltitude)
+
+	require.NotNil(t, plan.Departure)
+	assert.Equal(t, "EDDB", plan.Departure.Ident)
+	assert.Equal(t, "Berlin Brandenburg", plan.Departure.Name)
+	assert.InDelta(t, 52.3514, plan.Departure.Position.Lat, 0.0001)
+	assert.InDelta(t, 13.4939, plan.Departure.Position.Lon, 0.0001)
+	assert.Equal(t, 157.0, plan.Departure.Altitude)
+
+	require.NotNil(t, plan.Arrival)
+	assert.Equal(t, "EDDH", plan.Arrival.Ident)
+	assert.Equal(t, "Hamburg", plan.Arrival.Name)
+
+	require.Len(t, plan.Enroute, 1)
+	assert.Equal(t, flightplan.Waypoint{
+		Ident:    "LUROS",
+		Region:   "ED",
+		Type:     flightplan.TypeWaypoint,
+		Position: plan.Enroute[0].Position,
+		Altitude: 24000,
+	}, plan.Enroute[0])
+	assert.InDelta(t, 52.75, plan.Enroute[0].Position.Lat, 0.0001)
+	assert.InDelta(t, 12.5, plan.Enroute[0].Position.Lon, 0.0001)
+
+	assert.Equal(t, []string{"EDDB", "EDDH"}, plan.Airports())
+}
+
+func TestParse_MSFSHeaderOnly(t *testing.T) {
+	plan, err := flightplan.Parse([]byte(`<SimBase.Document><FlightPlan.FlightPlan>
+		<DepartureID>KJFK</DepartureID>
+		<DepartureLLA>N40° 38' 23.00",W73° 46' 44.00",+000013.00</DepartureLLA>
+		<DestinationID>EGLL</DestinationID>
+		<DestinationLLA>N51° 28' 39.00",W0° 27' 41.00",+000083.00</DestinationLLA>
+	</FlightPlan.FlightPlan></SimBase.Document>`))
+	require.NoError(t, err)
+
+	require.NotNil(t, plan.Departure)
+	assert.InDelta(t, -73.7789, plan.Departure.Position.Lon, 0.0001)
+	require.NotNil(t, plan.Arrival)
+	assert.InDelta(t, -0.4614, plan.Arrival.Position.Lon, 0.0001)
+	assert.Empty(t, plan.Enroute)
+	assert.Equal(t, []string{"KJFK", "EGLL"}, plan.Airports())
+}
+
+func TestParse_LittleNavmap(t *testing.T) {
+	plan, err := flightplan.Parse([]byte(lnmPlan))
+	require.NoError(t, err)
+
+	assert.Equal(t, "KLAX to KBUR", plan.Title)
+	assert.Equal(t, "VFR", plan.Type)
+	assert.Equal(t, 4500, plan.CruisingAltitude)
+
+	require.NotNil(t, plan.Departure)
+	assert.Equal(t, "KLAX", plan.Departure.Ident)
+	require.NotNil(t, plan.Arrival)
+	assert.Equal(t, "KBUR", plan.Arrival.Ident)
+	assert.Equal(t, 778.0, plan.Arrival.Altitude)
+
+	require.Len(t, plan.Enroute, 2)
+	assert.Equal(t, "SMO", plan.Enroute[0].Ident)
+	assert.Equal(t, flightplan.TypeVOR, plan.Enroute[0].Type)
+	assert.Equal(t, 4500.0, plan.Enroute[0].Altitude)
+	assert.InDelta(t, 34.010, plan.Enroute[0].Position.Lat, 0.0001)
+
+	require.Len(t, plan.Alternates, 1)
+	assert.Equal(t, "KONT", plan.Alternates[0].Ident)
+
+	// Enroute airports are included in route order, alternates last
+	assert.Equal(t, []string{"KLAX", "KVNY", "KBUR", "KONT"}, plan.Airports())
+	assert.Len(t, plan.Route(), 4)
+}
+
+func TestParse_Errors(t *testing.T) {
+	_, err := flightplan.Parse([]byte(`<gpx version="1.1"></gpx>`))
+	assert.ErrorIs(t, err, flightplan.ErrUnknownFormat)
+
+	_, err = flightplan.Parse([]byte("EDDB DCT EDDH"))
+	assert.ErrorIs(t, err, flightplan.ErrUnknownFormat)
+
+	_, err = flightplan.Parse([]byte(`<SimBase.Document><FlightPlan.FlightPlan>
+		<ATCWaypoint id="BAD"><WorldPosition>52.1,13.4</WorldPosition></ATCWaypoint>
+	</FlightPlan.FlightPlan></SimBase.Document>`))
+	assert.ErrorContains(t, err, "waypoint BAD")
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "route.pln")
+	require.NoError(t, os.WriteFile(path, []byte(msfsPlan), 0o600))
+
+	plan, err := flightplan.Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"EDDB", "EDDH"}, plan.Airports())
+
+	_, err = flightplan.Load(filepath.Join(t.TempDir(), "missing.pln"))
+	assert.Error(t, err)
+}
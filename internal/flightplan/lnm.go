@@ -0,0 +1,71 @@
+package flightplan
+
+import (
+	"atc_freq/internal/sim"
+	"encoding/xml"
+	"strings"
+)
+
+// lnmDocument is the .lnmpln document written by Little Navmap
+type lnmDocument struct {
+	Flightplan struct {
+		Header struct {
+			FlightplanType string  `xml:"FlightplanType"`
+			CruisingAlt    float64 `xml:"CruisingAlt"`
+		} `xml:"Header"`
+		Alternates []lnmWaypoint `xml:"Alternates>Alternate"`
+		Waypoints  []lnmWaypoint `xml:"Waypoints>Waypoint"`
+	} `xml:"Flightplan"`
+}
+
+type lnmWaypoint struct {
+	Name   string `xml:"Name"`
+	Ident  string `xml:"Ident"`
+	Region string `xml:"Region"`
+	Type   string `xml:"Type"`
+	Pos    struct {
+		Lon float64 `xml:"Lon,attr"`
+		Lat float64 `xml:"Lat,attr"`
+		Alt float64 `xml:"Alt,attr"`
+	} `xml:"Pos"`
+}
+
+func parseLNM(data []byte) (*Plan, error) {
+	var doc lnmDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	fp := doc.Flightplan
+
+	plan := &Plan{
+		Type:             strings.ToUpper(fp.Header.FlightplanType),
+		CruisingAltitude: int(fp.Header.CruisingAlt),
+	}
+
+	route := make([]Waypoint, len(fp.Waypoints))
+	for i, w := range fp.Waypoints {
+		route[i] = w.waypoint()
+	}
+	splitEnds(plan, route)
+
+	for _, w := range fp.Alternates {
+		plan.Alternates = append(plan.Alternates, w.waypoint())
+	}
+
+	if plan.Departure != nil && plan.Arrival != nil {
+		plan.Title = plan.Departure.Ident + " to " + plan.Arrival.Ident
+	}
+
+	return plan, nil
+}
+
+func (w lnmWaypoint) waypoint() Waypoint {
+	return Waypoint{
+		Ident:    w.Ident,
+		Region:   w.Region,
+		Name:     w.Name,
+		Type:     normalizeType(w.Type),
+		Position: sim.Coordinates{Lat: w.Pos.Lat, Lon: w.Pos.Lon},
+		Altitude: w.Pos.Alt,
+	}
+}
@@ -0,0 +1,154 @@
+package flightplan
+
+import (
+	"atc_freq/internal/sim"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// msfsDocument is the AceXML document written by the MSFS world map planner
+type msfsDocument struct {
+	FlightPlan struct {
+		Title           string         `xml:"Title"`
+		FPType          string         `xml:"FPType"`
+		CruisingAlt     float64        `xml:"CruisingAlt"`
+		DepartureID     string         `xml:"DepartureID"`
+		DepartureLLA    string         `xml:"DepartureLLA"`
+		DepartureName   string         `xml:"DepartureName"`
+		DestinationID   string         `xml:"DestinationID"`
+		DestinationLLA  string         `xml:"DestinationLLA"`
+		DestinationName string         `xml:"DestinationName"`
+		Waypoints       []msfsWaypoint `xml:"ATCWaypoint"`
+	} `xml:"FlightPlan.FlightPlan"`
+}
+
+type msfsWaypoint struct {
+	ID            string `xml:"id,attr"`
+	Type          string `xml:"ATCWaypointType"`
+	WorldPosition string `xml:"WorldPosition"`
+	ICAO          struct {
+		Region string `xml:"ICAORegion"`
+		Ident  string `xml:"ICAOIdent"`
+	} `xml:"ICAO"`
+}
+
+func parseMSFS(data []byte) (*Plan, error) {
+	var doc msfsDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	fp := doc.FlightPlan
+
+	plan := &Plan{
+		Title:            fp.Title,
+		Type:             strings.ToUpper(fp.FPType),
+		CruisingAltitude: int(fp.CruisingAlt),
+	}
+
+	route := make([]Waypoint, 0, len(fp.Waypoints))
+	for _, w := range fp.Waypoints {
+		position, altitude, err := parseLLA(w.WorldPosition)
+		if err != nil {
+			return nil, fmt.Errorf("waypoint %s: %w", w.ID, err)
+		}
+
+		ident := w.ICAO.Ident
+		if ident == "" {
+			ident = w.ID
+		}
+		route = append(route, Waypoint{
+			Ident:    ident,
+			Region:   w.ICAO.Region,
+			Type:     normalizeType(w.Type),
+			Position: position,
+			Altitude: altitude,
+		})
+	}
+	splitEnds(plan, route)
+
+	// Older plans only have the airports in the header and no airport waypoints
+	if plan.Departure == nil && fp.DepartureID != "" {
+		departure, err := headerAirport(fp.DepartureID, fp.DepartureName, fp.DepartureLLA)
+		if err != nil {
+			return nil, fmt.Errorf("departure: %w", err)
+		}
+		plan.Departure = departure
+	}
+	if plan.Arrival == nil && fp.DestinationID != "" {
+		arrival, err := headerAirport(fp.DestinationID, fp.DestinationName, fp.DestinationLLA)
+		if err != nil {
+			return nil, fmt.Errorf("destination: %w", err)
+		}
+		plan.Arrival = arrival
+	}
+	if plan.Departure != nil && plan.Departure.Name == "" {
+		plan.Departure.Name = fp.DepartureName
+	}
+	if plan.Arrival != nil && plan.Arrival.Name == "" {
+		plan.Arrival.Name = fp.DestinationName
+	}
+
+	return plan, nil
+}
+
+func headerAirport(ident, name, lla string) (*Waypoint, error) {
+	position, altitude, err := parseLLA(lla)
+	if err != nil {
+		return nil, err
+	}
+	return &Waypoint{Ident: ident, Name: name, Type: TypeAirport, Position: position, Altitude: altitude}, nil
+}
+
+// lla matches the degrees, minutes and seconds of one hemisphere: N52° 21' 4.92"
+var lla = regexp.MustCompile(`^([NSEW])\s*(\d+)°\s*(\d+)'\s*([\d.]+)"$`)
+
+// parseLLA decodes an MSFS position like N52° 21' 4.92",E13° 29' 37.92",+000157.00,
+// the altitude is in feet and may be missing
+func parseLLA(s string) (sim.Coordinates, float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) < 2 {
+		return sim.Coordinates{}, 0, fmt.Errorf("invalid position %q", s)
+	}
+
+	lat, err := parseDMS(parts[0], "N", "S")
+	if err != nil {
+		return sim.Coordinates{}, 0, fmt.Errorf("invalid position %q: %w", s, err)
+	}
+	lon, err := parseDMS(parts[1], "E", "W")
+	if err != nil {
+		return sim.Coordinates{}, 0, fmt.Errorf("invalid position %q: %w", s, err)
+	}
+
+	altitude := 0.0
+	if len(parts) > 2 {
+		altitude, err = strconv.ParseFloat(strings.TrimSpace(parts[2]), 64)
+		if err != nil {
+			return sim.Coordinates{}, 0, fmt.Errorf("invalid altitude in %q: %w", s, err)
+		}
+	}
+
+	return sim.Coordinates{Lat: lat, Lon: lon}, altitude, nil
+}
+
+func parseDMS(s, positive, negative string) (float64, error) {
+	m := lla.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || (m[1] != positive && m[1] != negative) {
+		return 0, fmt.Errorf("invalid coordinate %q", s)
+	}
+
+	degrees, _ := strconv.ParseFloat(m[2], 64)
+	minutes, _ := strconv.ParseFloat(m[3], 64)
+	seconds, err := strconv.ParseFloat(m[4], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid coordinate %q", s)
+	}
+
+	value := degrees + minutes/60 + seconds/3600
+	if m[1] == negative {
+		value = -value
+	}
+	return value, nil
+}
@@ -0,0 +1,266 @@
+package format
+
+import (
+	"atc_freq/internal/sim"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// WriteBriefing renders a route briefing. The table format is a plain text report, Markdown and
+// HTML are documents with one section per airport, JSON and YAML encode the briefing as is.
+// A briefing has several tables per airport, so there is no CSV form.
+func WriteBriefing(w io.Writer, f Format, briefing *sim.Briefing) error {
+	var doc document
+	switch f {
+	case JSON:
+		return writeJSON(w, briefing)
+	case YAML:
+		return writeYAML(w, briefing)
+	case Table:
+		doc = &textDocument{}
+	case Markdown:
+		doc = &markdownDocument{}
+	case HTML:
+		doc = &htmlDocument{}
+	default:
+		return fmt.Errorf("output format %q isn't supported for briefings", f)
+	}
+
+	airports := make([]string, len(briefing.Airports))
+	for i, airport := range briefing.Airports {
+		airports[i] = airport.ICAO
+	}
+
+	doc.begin("Briefing " + strings.Join(airports, ", "))
+	if len(briefing.Airports) > 0 {
+		doc.field("Worst category", string(briefing.Worst))
+	}
+	if len(briefing.Unknown) > 0 {
+		doc.field("Not airports", strings.Join(briefing.Unknown, ", "))
+	}
+
+	for _, airport := range briefing.Airports {
+		writeAirportBriefing(doc, airport)
+	}
+
+	_, err := w.Write(doc.end())
+	return err
+}
+
+func writeAirportBriefing(doc document, airport sim.AirportBriefing) {
+	title := airport.ICAO
+	if airport.Name != "" {
+		title += " " + airport.Name
+	}
+	if airport.Weather != nil {
+		title += " - " + string(airport.Weather.Category)
+	}
+	doc.heading(title)
+
+	if w := airport.Weather; w != nil {
+		doc.field("METAR", w.RawMetar)
+		var wind *sim.Wind
+		if w.Metar != nil {
+			wind = w.Metar.Wind
+		}
+		doc.field("Wind", DescribeWind(wind))
+		doc.field("Visibility", strconv.Itoa(w.Visibility)+" SM")
+		ceiling := "none"
+		if w.Ceiling != nil {
+			ceiling = strconv.Itoa(*w.Ceiling) + " ft"
+		}
+		doc.field("Ceiling", ceiling)
+	} else {
+		doc.field("METAR", "not available")
+	}
+
+	if airport.Runway != nil {
+		doc.field("Runway", describeRunway(airport.Runway))
+	}
+
+	doc.subheading("Frequencies")
+	if airport.FrequencyError != "" {
+		doc.field("Not answered", airport.FrequencyError)
+	} else if len(airport.Frequencies) == 0 {
+		doc.field("Frequencies", "none")
+	} else {
+		doc.table(FrequencyRows(airport.Frequencies))
+	}
+
+	if len(airport.Clouds) == 0 && len(airport.CloudFailures) == 0 {
+		return
+	}
+	doc.subheading("Clouds")
+	if len(airport.Clouds) > 0 {
+		rows := cloudLayerRows(airport.Clouds)
+		switch {
+		case len(rows.Rows) > 0:
+			doc.table(rows)
+		case !slices.ContainsFunc(airport.Clouds, failedLevel):
+			// Only a fully answered profile is clear, the levels that failed are listed below
+			doc.field("Clouds", fmt.Sprintf("clear up to %d ft", airport.Clouds[len(airport.Clouds)-1].MaxAlt))
+		}
+	}
+	for _, failure := range airport.CloudFailures {
+		doc.field("Not answered", fmt.Sprintf("%d-%d ft: %s", failure.MinAlt, failure.MaxAlt, failure.Error))
+	}
+}
+
+// cloudLayerRows lists the layers that aren't clear. Levels that failed have no coverage and are left out.
+func cloudLayerRows(layers []sim.CloudDensity) *Rows {
+	rows := &Rows{Header: []string{"MinAlt", "MaxAlt", "Coverage", "Percentage"}}
+	for _, layer := range layers {
+		if layer.Coverage == "CLR" || layer.Coverage == "" {
+			continue
+		}
+		rows.Rows = append(rows.Rows, []string{
+			strconv.Itoa(layer.MinAlt),
+			strconv.Itoa(layer.MaxAlt),
+			layer.Coverage,
+			fmt.Sprintf("%.1f", layer.Percentage),
+		})
+	}
+	return rows
+}
+
+// describeRunway formats a recommended runway end, e.g. 25L 245°, head 12 kt, cross 2 kt L, ILS IBEL 111.30
+func describeRunway(end *sim.RunwayWind) string {
+	text := fmt.Sprintf("%s %03.0f°, head %.0f kt, cross %.0f kt", end.End.Designator, end.End.MagneticHeading,
+		end.Headwind, math.Abs(end.Crosswind))
+	if side := CrosswindSide(end.Crosswind); side != "" {
+		text += " " + side
+	}
+	if end.End.ILS != nil && end.End.ILS.Hz != 0 {
+		text += fmt.Sprintf(", ILS %s %.2f", end.End.ILS.Ident, end.End.ILS.MHz)
+	}
+	if end.Tailwind {
+		text += ", tailwind"
+	}
+	if end.ExcessiveCrosswind {
+		text += ", strong crosswind"
+	}
+	return text
+}
+
+// DescribeWind formats a decoded wind group, e.g. 240° 12G25 kt
+func DescribeWind(wind *sim.Wind) string {
+	switch {
+	case wind == nil:
+		return "not reported"
+	case wind.Calm():
+		return "calm"
+	}
+
+	direction := fmt.Sprintf("%03d°", wind.Direction)
+	if wind.Variable {
+		direction = "variable"
+	}
+	speed := fmt.Sprintf("%.0f", wind.SpeedKnots())
+	if wind.Gust > 0 {
+		speed += fmt.Sprintf("G%.0f", wind.GustKnots())
+	}
+	return direction + " " + speed + " kt"
+}
+
+// document is the layout of a briefing in one output format
+type document interface {
+	begin(title string)
+	heading(text string)
+	subheading(text string)
+	field(name, value string)
+	table(rows *Rows)
+	end() []byte
+}
+
+type textDocument struct {
+	buf bytes.Buffer
+}
+
+func (d *textDocument) begin(title string) {
+	d.buf.WriteString(title + "\n")
+}
+
+func (d *textDocument) heading(text string) {
+	d.buf.WriteString("\n" + text + "\n" + strings.Repeat("=", len([]rune(text))) + "\n")
+}
+
+func (d *textDocument) subheading(text string) {
+	d.buf.WriteString("\n" + text + ":\n")
+}
+
+func (d *textDocument) field(name, value string) {
+	d.buf.WriteString(fmt.Sprintf("%-15s %s\n", name+":", value))
+}
+
+func (d *textDocument) table(rows *Rows) {
+	_ = writeTable(&d.buf, rows)
+}
+
+func (d *textDocument) end() []byte {
+	return d.buf.Bytes()
+}
+
+type markdownDocument struct {
+	buf bytes.Buffer
+}
+
+func (d *markdownDocument) begin(title string) {
+	d.buf.WriteString("# " + title + "\n\n")
+}
+
+func (d *markdownDocument) heading(text string) {
+	d.buf.WriteString("\n## " + text + "\n\n")
+}
+
+func (d *markdownDocument) subheading(text string) {
+	d.buf.WriteString("\n### " + text + "\n\n")
+}
+
+func (d *markdownDocument) field(name, value string) {
+	d.buf.WriteString("- **" + name + ":** " + value + "\n")
+}
+
+func (d *markdownDocument) table(rows *Rows) {
+	_ = writeMarkdown(&d.buf, rows)
+}
+
+func (d *markdownDocument) end() []byte {
+	return d.buf.Bytes()
+}
+
+type htmlDocument struct {
+	buf bytes.Buffer
+}
+
+func (d *htmlDocument) begin(title string) {
+	title = html.EscapeString(title)
+	d.buf.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>" + title + "</title>\n</head>\n<body>\n")
+	d.buf.WriteString("<h1>" + title + "</h1>\n")
+}
+
+func (d *htmlDocument) heading(text string) {
+	d.buf.WriteString("<h2>" + html.EscapeString(text) + "</h2>\n")
+}
+
+func (d *htmlDocument) subheading(text string) {
+	d.buf.WriteString("<h3>" + html.EscapeString(text) + "</h3>\n")
+}
+
+func (d *htmlDocument) field(name, value string) {
+	d.buf.WriteString("<p><strong>" + html.EscapeString(name) + ":</strong> " + html.EscapeString(value) + "</p>\n")
+}
+
+func (d *htmlDocument) table(rows *Rows) {
+	_ = writeHTML(&d.buf, rows)
+}
+
+func (d *htmlDocument) end() []byte {
+	d.buf.WriteString("</body>\n</html>\n")
+	return d.buf.Bytes()
+}
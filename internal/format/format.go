@@ -0,0 +1,208 @@
+// Package format renders results as JSON, YAML, CSV, Markdown, HTML or an aligned text table,
+// so scripts can consume them without scraping the human readable output.
+package format
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is an output format selected with --output
+type Format string
+
+const (
+	JSON     Format = "json"
+	YAML     Format = "yaml"
+	CSV      Format = "csv"
+	Table    Format = "table"
+	Markdown Format = "markdown"
+	HTML     Format = "html"
+)
+
+// Formats lists the supported formats in the order they are shown in help texts
+var Formats = []Format{Table, JSON, YAML, CSV, Markdown, HTML}
+
+// Parse returns the format with the given name, matching is case insensitive
+func Parse(name string) (Format, error) {
+	for _, f := range Formats {
+		if strings.EqualFold(name, string(f)) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output format %q, expected one of %s", name, strings.Join(names(), ", "))
+}
+
+func names() []string {
+	out := make([]string, len(Formats))
+	for i, f := range Formats {
+		out[i] = string(f)
+	}
+	return out
+}
+
+// Rows is the tabular form of a result used by the CSV and table formats
+type Rows struct {
+	Header []string
+	Rows   [][]string
+	// Highlight decorates the padded cells of a column in the table format, keyed by header.
+	// It's meant for terminal colours, which must not count towards the column width.
+	Highlight map[string]func(string) string
+}
+
+// Write renders a result in format f. JSON and YAML encode value, the other formats render rows.
+func Write(w io.Writer, f Format, value any, rows *Rows) error {
+	switch f {
+	case JSON:
+		return writeJSON(w, value)
+	case YAML:
+		return writeYAML(w, value)
+	case CSV:
+		return writeCSV(w, rows)
+	case Table:
+		return writeTable(w, rows)
+	case Markdown:
+		return writeMarkdown(w, rows)
+	case HTML:
+		return writeHTML(w, rows)
+	}
+	return fmt.Errorf("unknown output format %q", f)
+}
+
+func writeJSON(w io.Writer, value any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// writeYAML goes through JSON, so YAML has the same keys in the same order as the JSON output
+func writeYAML(w io.Writer, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// blockStyle drops the flow style and quotes that JSON input leaves on the nodes
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+func writeCSV(w io.Writer, rows *Rows) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(rows.Header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(rows.Rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+func writeTable(w io.Writer, rows *Rows) error {
+	widths := make([]int, len(rows.Header))
+	for _, row := range append([][]string{rows.Header}, rows.Rows...) {
+		for i, cell := range row {
+			if i < len(widths) {
+				widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	writeRow := func(row []string, highlight bool) {
+		var line strings.Builder
+		for i, cell := range row {
+			if i >= len(widths) {
+				break
+			}
+			if i > 0 {
+				line.WriteString("  ")
+			}
+
+			padding := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if decorate, ok := rows.Highlight[rows.Header[i]]; highlight && ok && cell != "" {
+				cell = decorate(cell)
+			}
+			line.WriteString(cell + padding)
+		}
+		buf.WriteString(strings.TrimRight(line.String(), " "))
+		buf.WriteString("\n")
+	}
+
+	writeRow(rows.Header, false)
+	for _, row := range rows.Rows {
+		writeRow(row, true)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeMarkdown(w io.Writer, rows *Rows) error {
+	var buf bytes.Buffer
+	writeRow := func(row []string) {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = strings.ReplaceAll(cell, "|", `\|`)
+		}
+		buf.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+
+	writeRow(rows.Header)
+	separator := make([]string, len(rows.Header))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	writeRow(separator)
+	for _, row := range rows.Rows {
+		writeRow(row)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeHTML(w io.Writer, rows *Rows) error {
+	var buf bytes.Buffer
+	writeRow := func(row []string, tag string) {
+		buf.WriteString("<tr>")
+		for _, cell := range row {
+			buf.WriteString("<" + tag + ">" + html.EscapeString(cell) + "</" + tag + ">")
+		}
+		buf.WriteString("</tr>\n")
+	}
+
+	buf.WriteString("<table>\n")
+	writeRow(rows.Header, "th")
+	for _, row := range rows.Rows {
+		writeRow(row, "td")
+	}
+	buf.WriteString("</table>\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
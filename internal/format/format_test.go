@@ -0,0 +1,284 @@
+package format_test
+
+import (
+	"atc_freq/internal/format"
+	"atc_freq/internal/sim"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFrequencies = []sim.AirportFrequency{
+	{Type: "ATIS", TypeCode: 1, Name: "Brandenburg ATIS", Hz: 123080000, MHz: 123.08, Source: sim.SourceSimulator},
+	{Type: "TOWER", TypeCode: 6, Name: "Tower, Main", Hz: 118800000, MHz: 118.8, Source: sim.SourceSimulator},
+}
+
+func TestParse(t *testing.T) {
+	for _, name := range []string{"json", "YAML", "Csv", "table", "Markdown", "HTML"} {
+		_, err := format.Parse(name)
+		assert.NoError(t, err, name)
+	}
+
+	f, err := format.Parse("JSON")
+	require.NoError(t, err)
+	assert.Equal(t, format.JSON, f)
+
+	_, err = format.Parse("xml")
+	assert.EqualError(t, err, `unknown output format "xml", expected one of table, json, yaml, csv, markdown, html`)
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   format.Format
+		expected string
+	}{
+		{
+			name:   "table",
+			format: format.Table,
+			expected: "" +
+				"Type   MHz      Name\n" +
+				"ATIS   123.080  Brandenburg ATIS\n" +
+				"TOWER  118.800  Tower, Main\n",
+		},
+		{
+			name:   "csv quotes separators",
+			format: format.CSV,
+			expected: "" +
+				"Type,MHz,Name\n" +
+				"ATIS,123.080,Brandenburg ATIS\n" +
+				"TOWER,118.800,\"Tower, Main\"\n",
+		},
+		{
+			name:   "markdown",
+			format: format.Markdown,
+			expected: "" +
+				"| Type | MHz | Name |\n" +
+				"| --- | --- | --- |\n" +
+				"| ATIS | 123.080 | Brandenburg ATIS |\n" +
+				"| TOWER | 118.800 | Tower, Main |\n",
+		},
+		{
+			name:   "html",
+			format: format.HTML,
+			expected: "" +
+				"<table>\n" +
+				"<tr><th>Type</th><th>MHz</th><th>Name</th></tr>\n" +
+				"<tr><td>ATIS</td><td>123.080</td><td>Brandenburg ATIS</td></tr>\n" +
+				"<tr><td>TOWER</td><td>118.800</td><td>Tower, Main</td></tr>\n" +
+				"</table>\n",
+		},
+		{
+			name:   "json",
+			format: format.JSON,
+			expected: `[
+  {
+    "type": "ATIS",
+    "type_code": 1,
+    "name": "Brandenburg ATIS",
+    "hz": 123080000,
+    "mhz": 123.08,
+    "source": "simulator"
+  },
+  {
+    "type": "TOWER",
+    "type_code": 6,
+    "name": "Tower, Main",
+    "hz": 118800000,
+    "mhz": 118.8,
+    "source": "simulator"
+  }
+]
+`,
+		},
+		{
+			name:   "yaml keeps the json keys and order",
+			format: format.YAML,
+			expected: `- type: ATIS
+  type_code: 1
+  name: Brandenburg ATIS
+  hz: 123080000
+  mhz: 123.08
+  source: simulator
+- type: TOWER
+  type_code: 6
+  name: Tower, Main
+  hz: 118800000
+  mhz: 118.8
+  source: simulator
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := format.Write(&buf, tt.format, testFrequencies, format.FrequencyRows(testFrequencies))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func TestWrite_TableHighlight(t *testing.T) {
+	rows := &format.Rows{
+		Header:    []string{"Waypoint", "Category", "Visibility"},
+		Rows:      [][]string{{"EDDB", "VFR", "10"}, {"KLAX", "LIFR", ""}},
+		Highlight: map[string]func(string) string{"Category": func(s string) string { return "<" + s + ">" }},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, format.Write(&buf, format.Table, nil, rows))
+
+	// Decorations don't count towards the column width and trailing blanks are trimmed
+	assert.Equal(t, ""+
+		"Waypoint  Category  Visibility\n"+
+		"EDDB      <VFR>       10\n"+
+		"KLAX      <LIFR>\n", buf.String())
+}
+
+func TestCloudRows_Order(t *testing.T) {
+	clouds := map[string][]sim.CloudDensity{
+		"EDDH": {{Coverage: "BKN", Percentage: 66.7, MinAlt: 0, MaxAlt: 500}},
+		"EDDB": {{Coverage: "CLR", MinAlt: 0, MaxAlt: 500}, {Coverage: "FEW", Percentage: 10, MinAlt: 500, MaxAlt: 1000}},
+		"KLAX": {{Coverage: "OVC", Percentage: 90.2, MinAlt: 0, MaxAlt: 500}},
+		"EGLL": {{Coverage: "CLR", MinAlt: 0, MaxAlt: 500}},
+	}
+
+	// Route order first, waypoints the caller didn't ask for follow sorted
+	rows := format.CloudRows([]string{"eddh", " EDDB"}, clouds)
+
+	var waypoints []string
+	for _, row := range rows.Rows {
+		waypoints = append(waypoints, row[0])
+	}
+	assert.Equal(t, []string{"EDDH", "EDDB", "EDDB", "EGLL", "KLAX"}, waypoints)
+	assert.Equal(t, []string{"EDDB", "500", "1000", "FEW", "10.0"}, rows.Rows[2])
+}
+
+func TestCloudLayerRows(t *testing.T) {
+	profiles := map[string]*sim.CloudProfile{
+		"EDDH": {Layers: []sim.CloudProfileLayer{
+			{Base: 1000, Top: 2500, Thickness: 1500, MaxValue: 170, Coverage: "BKN", Percentage: 66.7},
+			{Base: 4000, Top: 4500, Thickness: 500, MaxValue: 40, Coverage: "FEW", Percentage: 15.7},
+		}},
+		"EDDB": {Layers: []sim.CloudProfileLayer{}},
+		// A level that failed may be cloudy, the profile isn't clear
+		"EGLL": {
+			Levels: []sim.CloudDensity{{MinAlt: 0, MaxAlt: 500, Coverage: "CLR"}, {MinAlt: 500, MaxAlt: 1000}},
+			Layers: []sim.CloudProfileLayer{},
+		},
+	}
+
+	rows := format.CloudLayerRows([]string{"EDDB", "EDDH", "EGLL"}, profiles)
+	assert.Equal(t, [][]string{
+		{"EDDB", "", "", "", "CLR", ""},
+		{"EDDH", "1000", "2500", "1500", "BKN", "66.7"},
+		{"EDDH", "4000", "4500", "500", "FEW", "15.7"},
+	}, rows.Rows)
+}
+
+func TestRunwayRows(t *testing.T) {
+	recommendation := &sim.RunwayRecommendation{
+		ICAO: "EDDB",
+		Ends: []sim.RunwayWind{
+			{
+				End:       sim.RunwayEnd{Designator: "25L", MagneticHeading: 245, ILS: &sim.ILS{Ident: "IBEL", Hz: 111300000, MHz: 111.3}},
+				Length:    13123.4,
+				Headwind:  11.8,
+				Crosswind: -2.1,
+			},
+			{
+				End:                sim.RunwayEnd{Designator: "07R", MagneticHeading: 65},
+				Length:             13123.4,
+				Headwind:           -11.8,
+				Crosswind:          2.1,
+				Tailwind:           true,
+				ExcessiveCrosswind: true,
+			},
+		},
+	}
+
+	rows := format.RunwayRows(recommendation)
+	assert.Equal(t, []string{"25L", "245", "12", "2L", "13123", "IBEL 111.30", ""}, rows.Rows[0])
+	assert.Equal(t, []string{"07R", "065", "-12", "2R", "13123", "", "TAILWIND CROSSWIND"}, rows.Rows[1])
+}
+
+func TestWriteBriefing(t *testing.T) {
+	ceiling := 1200
+	briefing := &sim.Briefing{
+		Worst:   sim.CategoryMVFR,
+		Unknown: []string{"LUROS"},
+		Airports: []sim.AirportBriefing{
+			{
+				ICAO: "EDDH",
+				Name: "Hamburg",
+				Weather: &sim.Weather{
+					RawMetar:   "EDDH 171150Z 27015KT 6000 BKN012",
+					Category:   sim.CategoryMVFR,
+					Visibility: 3,
+					Ceiling:    &ceiling,
+					Metar:      &sim.Metar{Conditions: sim.Conditions{Wind: &sim.Wind{Direction: 270, Speed: 15, Unit: "KT"}}},
+				},
+				Runway: &sim.RunwayWind{
+					End:       sim.RunwayEnd{Designator: "23", MagneticHeading: 232},
+					Headwind:  11.5,
+					Crosswind: 8.4,
+				},
+				Frequencies: testFrequencies,
+				Clouds: []sim.CloudDensity{
+					{Coverage: "CLR", MinAlt: 0, MaxAlt: 500},
+					{Coverage: "BKN", Percentage: 66.7, MinAlt: 1000, MaxAlt: 1500},
+					{MinAlt: 1500, MaxAlt: 2000},
+				},
+				CloudFailures: []sim.CloudBandFailure{{MinAlt: 1500, MaxAlt: 2000, Error: "simulator didn't answer in time"}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, format.WriteBriefing(&buf, format.Markdown, briefing))
+	assert.Equal(t, `# Briefing EDDH
+
+- **Worst category:** MVFR
+- **Not airports:** LUROS
+
+## EDDH Hamburg - MVFR
+
+- **METAR:** EDDH 171150Z 27015KT 6000 BKN012
+- **Wind:** 270° 15 kt
+- **Visibility:** 3 SM
+- **Ceiling:** 1200 ft
+- **Runway:** 23 232°, head 12 kt, cross 8 kt R
+
+### Frequencies
+
+| Type | MHz | Name |
+| --- | --- | --- |
+| ATIS | 123.080 | Brandenburg ATIS |
+| TOWER | 118.800 | Tower, Main |
+
+### Clouds
+
+| MinAlt | MaxAlt | Coverage | Percentage |
+| --- | --- | --- | --- |
+| 1000 | 1500 | BKN | 66.7 |
+- **Not answered:** 1500-2000 ft: simulator didn't answer in time
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, format.WriteBriefing(&buf, format.HTML, briefing))
+	assert.Contains(t, buf.String(), "<h2>EDDH Hamburg - MVFR</h2>\n")
+	assert.Contains(t, buf.String(), "<td>Tower, Main</td>")
+
+	assert.Error(t, format.WriteBriefing(&buf, format.CSV, briefing))
+
+	// Frequencies the simulator didn't answer aren't listed as none
+	briefing.Airports[0].Frequencies = nil
+	briefing.Airports[0].FrequencyError = "timeout waiting for frequencies"
+	buf.Reset()
+	require.NoError(t, format.WriteBriefing(&buf, format.Markdown, briefing))
+	assert.Contains(t, buf.String(), "### Frequencies\n\n- **Not answered:** timeout waiting for frequencies\n")
+}
@@ -0,0 +1,226 @@
+package format
+
+import (
+	"atc_freq/internal/sim"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FrequencyRows lists airport frequencies in the order the simulator returned them
+func FrequencyRows(freqs []sim.AirportFrequency) *Rows {
+	rows := &Rows{Header: []string{"Type", "MHz", "Name"}}
+	for _, f := range freqs {
+		rows.Rows = append(rows.Rows, []string{f.Type, fmt.Sprintf("%.3f", f.MHz), f.Name})
+	}
+	return rows
+}
+
+// WeatherRows lists weather stations in the given order, one row per station
+func WeatherRows(stations []*sim.Weather) *Rows {
+	rows := &Rows{Header: []string{"Waypoint", "Category", "Visibility", "Ceiling", "Clouds", "METAR"}}
+	for _, w := range stations {
+		ceiling := ""
+		if w.Ceiling != nil {
+			ceiling = strconv.Itoa(*w.Ceiling)
+		}
+
+		clouds := make([]string, len(w.Clouds))
+		for i, cloud := range w.Clouds {
+			clouds[i] = fmt.Sprintf("%s%03d", cloud.Coverage, cloud.Base/100)
+		}
+
+		rows.Rows = append(rows.Rows, []string{
+			w.Waypoint,
+			string(w.Category),
+			strconv.Itoa(w.Visibility),
+			ceiling,
+			strings.Join(clouds, " "),
+			w.RawMetar,
+		})
+	}
+	return rows
+}
+
+// CloudRows lists the cloud density layers of every waypoint, waypoints in the given order
+// and layers from the lowest up. Waypoints missing from clouds are left out.
+func CloudRows(waypoints []string, clouds map[string][]sim.CloudDensity) *Rows {
+	rows := &Rows{Header: []string{"Waypoint", "MinAlt", "MaxAlt", "Coverage", "Percentage"}}
+	for _, wp := range orderedKeys(waypoints, clouds) {
+		for _, layer := range clouds[wp] {
+			rows.Rows = append(rows.Rows, []string{
+				wp,
+				strconv.Itoa(layer.MinAlt),
+				strconv.Itoa(layer.MaxAlt),
+				layer.Coverage,
+				fmt.Sprintf("%.1f", layer.Percentage),
+			})
+		}
+	}
+	return rows
+}
+
+// CloudLayerRows lists the cloud layers of every profile, waypoints in the given order and layers from
+// the lowest up. A waypoint without clouds has a single CLR row, unless some of its levels failed:
+// those weren't answered and may be cloudy.
+func CloudLayerRows(waypoints []string, profiles map[string]*sim.CloudProfile) *Rows {
+	rows := &Rows{Header: []string{"Waypoint", "Base", "Top", "Thickness", "Coverage", "Percentage"}}
+	for _, wp := range orderedKeys(waypoints, profiles) {
+		if len(profiles[wp].Layers) == 0 {
+			if !slices.ContainsFunc(profiles[wp].Levels, failedLevel) {
+				rows.Rows = append(rows.Rows, []string{wp, "", "", "", "CLR", ""})
+			}
+			continue
+		}
+		for _, layer := range profiles[wp].Layers {
+			rows.Rows = append(rows.Rows, []string{
+				wp,
+				strconv.Itoa(layer.Base),
+				strconv.Itoa(layer.Top),
+				strconv.Itoa(layer.Thickness),
+				layer.Coverage,
+				fmt.Sprintf("%.1f", layer.Percentage),
+			})
+		}
+	}
+	return rows
+}
+
+// RunwayRows lists the runway ends of a recommendation, best first
+func RunwayRows(recommendation *sim.RunwayRecommendation) *Rows {
+	rows := &Rows{Header: []string{"Runway", "Heading", "Headwind", "Crosswind", "Length", "ILS", "Flags"}}
+	for _, end := range recommendation.Ends {
+		ils := ""
+		if end.End.ILS != nil && end.End.ILS.Hz != 0 {
+			ils = fmt.Sprintf("%s %.2f", end.End.ILS.Ident, end.End.ILS.MHz)
+		}
+
+		var flags []string
+		if end.Tailwind {
+			flags = append(flags, "TAILWIND")
+		}
+		if end.ExcessiveCrosswind {
+			flags = append(flags, "CROSSWIND")
+		}
+
+		rows.Rows = append(rows.Rows, []string{
+			end.End.Designator,
+			fmt.Sprintf("%03.0f", end.End.MagneticHeading),
+			fmt.Sprintf("%.0f", end.Headwind),
+			fmt.Sprintf("%.0f%s", math.Abs(end.Crosswind), CrosswindSide(end.Crosswind)),
+			fmt.Sprintf("%.0f", end.Length),
+			ils,
+			strings.Join(flags, " "),
+		})
+	}
+	return rows
+}
+
+// NearbyRows lists nearby airports, nearest first
+func NearbyRows(airports []sim.NearbyAirport) *Rows {
+	rows := &Rows{Header: []string{"ICAO", "Distance", "Bearing", "Elevation", "Frequency", "Name"}}
+	for _, airport := range airports {
+		freq, name := "", ""
+		if airport.Frequency != nil {
+			freq = fmt.Sprintf("%s %.3f", airport.Frequency.Type, airport.Frequency.MHz)
+			name = airport.Frequency.Name
+		}
+
+		rows.Rows = append(rows.Rows, []string{
+			airport.ICAO,
+			fmt.Sprintf("%.1f", airport.DistanceNM),
+			fmt.Sprintf("%03.0f", airport.Bearing),
+			fmt.Sprintf("%.0f", airport.Altitude),
+			freq,
+			name,
+		})
+	}
+	return rows
+}
+
+// AircraftRows lists the aircraft position and radios as name and value pairs, followed by the nearest airport
+func AircraftRows(aircraft sim.AircraftState, nearest *sim.NearbyAirport) *Rows {
+	radio := func(r sim.Radio) string {
+		return fmt.Sprintf("%.3f / %.3f", r.ActiveMHz, r.StandbyMHz)
+	}
+
+	rows := &Rows{
+		Header: []string{"Item", "Value"},
+		Rows: [][]string{
+			{"Position", fmt.Sprintf("%.4f,%.4f", aircraft.Position.Lat, aircraft.Position.Lon)},
+			{"Altitude", fmt.Sprintf("%.0f ft", aircraft.Altitude)},
+			{"Heading", fmt.Sprintf("%03.0f°", aircraft.Heading)},
+			{"Ground speed", fmt.Sprintf("%.0f kt", aircraft.GroundSpeed)},
+			{"On ground", fmt.Sprintf("%t", aircraft.OnGround)},
+			{"COM1", radio(aircraft.COM1)},
+			{"COM2", radio(aircraft.COM2)},
+		},
+	}
+
+	if nearest != nil {
+		value := fmt.Sprintf("%s %.1f NM %03.0f°", nearest.ICAO, nearest.DistanceNM, nearest.Bearing)
+		if nearest.Frequency != nil {
+			value += fmt.Sprintf(", %s %.3f", nearest.Frequency.Type, nearest.Frequency.MHz)
+		}
+		rows.Rows = append(rows.Rows, []string{"Nearest airport", value})
+	}
+	return rows
+}
+
+// AdviceRows lists the phase of flight and the frequency advised for it
+func AdviceRows(advice *sim.FrequencyAdvice) *Rows {
+	rows := &Rows{Header: []string{"Phase", "Airport", "Type", "Frequency", "Name"}}
+	if advice != nil {
+		rows.Rows = append(rows.Rows, []string{
+			string(advice.Phase),
+			advice.ICAO,
+			advice.Frequency.Type,
+			fmt.Sprintf("%.3f", advice.Frequency.MHz),
+			advice.Frequency.Name,
+		})
+	}
+	return rows
+}
+
+// CrosswindSide returns R or L for the side the crosswind comes from, empty below half a knot
+func CrosswindSide(crosswind float64) string {
+	switch {
+	case math.Round(crosswind) > 0:
+		return "R"
+	case math.Round(crosswind) < 0:
+		return "L"
+	}
+	return ""
+}
+
+// orderedKeys returns the keys of m in the order of order, normalised like the sim package does.
+// Keys missing from order follow in sorted order, so the output never depends on map iteration.
+func orderedKeys[V any](order []string, m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	seen := make(map[string]bool)
+	for _, key := range order {
+		key = strings.ToUpper(strings.TrimSpace(key))
+		if _, ok := m[key]; ok && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	var rest []string
+	for key := range m {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+
+	return append(keys, rest...)
+}
+
+// failedLevel reports a level of a profile the simulator didn't answer, it has no coverage
+func failedLevel(level sim.CloudDensity) bool {
+	return level.Coverage == ""
+}
@@ -0,0 +1,165 @@
+package freqdb
+
+import (
+	"atc_freq/internal/sim"
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// apt.dat row codes, see the X-Plane apt.dat specification
+const (
+	rowAirport  = "1"
+	rowSeaplane = "16"
+	rowHeliport = "17"
+	rowRunway   = "100"
+	rowMetadata = "1302"
+	rowEnd      = "99"
+)
+
+// aptDatTypes maps the frequency row codes to the SimConnect names. Rows 50 to 56 give the
+// frequency in units of 10 kHz, rows 1050 to 1056 in kHz.
+var aptDatTypes = map[string]string{
+	"50":   "ATIS",
+	"51":   "UNICOM",
+	"52":   "CLEARANCE",
+	"53":   "GROUND",
+	"54":   "TOWER",
+	"55":   "APPROACH",
+	"56":   "DEPARTURE",
+	"1050": "ATIS",
+	"1051": "UNICOM",
+	"1052": "CLEARANCE",
+	"1053": "GROUND",
+	"1054": "TOWER",
+	"1055": "APPROACH",
+	"1056": "DEPARTURE",
+}
+
+// ImportAptDat builds a database from an X-Plane apt.dat file. Airports are keyed by their
+// icao_code metadata, or their ident where they have none, and positioned at their datum
+// or the middle of their first runway. Airports without frequencies are skipped.
+func ImportAptDat(r io.Reader) (*Database, error) {
+	db := New(SourceXPlane)
+
+	var airport *Airport
+	var positioned bool
+	finish := func() {
+		if airport != nil && len(airport.Frequencies) > 0 {
+			db.add(airport)
+		}
+		airport, positioned = nil, false
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch code := fields[0]; code {
+		case rowAirport, rowSeaplane, rowHeliport:
+			finish()
+			// 1 <elevation> <deprecated> <deprecated> <ident> <name...>
+			if len(fields) < 5 {
+				return nil, fmt.Errorf("apt.dat line %d: airport header needs an ident", line)
+			}
+			elevation, _ := strconv.Atoi(fields[1])
+			airport = &Airport{
+				ICAO:        strings.ToUpper(fields[4]),
+				Name:        strings.Join(fields[5:], " "),
+				ElevationFt: elevation,
+			}
+		case rowEnd:
+			finish()
+		case rowMetadata:
+			if airport == nil || len(fields) < 3 {
+				continue
+			}
+			positioned = applyMetadata(airport, fields[1], fields[2]) || positioned
+		case rowRunway:
+			// The datum is preferred, but older files only have runways
+			if airport == nil || positioned || len(fields) < 20 {
+				continue
+			}
+			if position, ok := runwayCenter(fields); ok {
+				airport.Position = position
+				positioned = true
+			}
+		default:
+			freqType, isFrequency := aptDatTypes[code]
+			if !isFrequency || airport == nil || len(fields) < 2 {
+				continue
+			}
+			value, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("apt.dat line %d: invalid frequency %q", line, fields[1])
+			}
+
+			hz := value * 1000
+			if len(code) == 2 {
+				hz = value * 10000
+			}
+			name := strings.Join(fields[2:], " ")
+			airport.Frequencies = append(airport.Frequencies, sim.NewAirportFrequency(refineType(freqType, name), hz, name, SourceXPlane))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("apt.dat line %d: %w", line, err)
+	}
+	finish()
+
+	return db, nil
+}
+
+// applyMetadata applies a 1302 metadata row and reports whether it positioned the airport
+func applyMetadata(airport *Airport, key, value string) bool {
+	switch key {
+	case "icao_code":
+		airport.ICAO = strings.ToUpper(value)
+	case "datum_lat":
+		if lat, err := strconv.ParseFloat(value, 64); err == nil {
+			airport.Position.Lat = lat
+			return true
+		}
+	case "datum_lon":
+		if lon, err := strconv.ParseFloat(value, 64); err == nil {
+			airport.Position.Lon = lon
+			return true
+		}
+	}
+	return false
+}
+
+// runwayCenter returns the middle of a land runway row, its ends are at fields 9-10 and 18-19
+func runwayCenter(fields []string) (sim.Coordinates, bool) {
+	var values [4]float64
+	for i, field := range []string{fields[9], fields[10], fields[18], fields[19]} {
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return sim.Coordinates{}, false
+		}
+		values[i] = value
+	}
+	return sim.Coordinates{Lat: (values[0] + values[2]) / 2, Lon: (values[1] + values[3]) / 2}, true
+}
+
+// refineType tells the weather stations and CTAF apart, apt.dat shares a row code between them
+func refineType(freqType, name string) string {
+	upper := strings.ToUpper(name)
+	switch {
+	case freqType == "ATIS" && strings.Contains(upper, "AWOS"):
+		return "AWOS"
+	case freqType == "ATIS" && strings.Contains(upper, "ASOS"):
+		return "ASOS"
+	case freqType == "UNICOM" && strings.Contains(upper, "CTAF"):
+		return "CTAF"
+	}
+	return freqType
+}
@@ -0,0 +1,130 @@
+// Package freqdb is an offline airport frequency database imported from OurAirports or
+// X-Plane apt.dat files. It answers frequency requests while the simulator isn't running,
+// see sim.FrequencySource.
+package freqdb
+
+import (
+	"atc_freq/internal/sim"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Names of the imported data, they tag the frequencies of the database
+const (
+	SourceOurAirports = "ourairports"
+	SourceXPlane      = "xplane"
+)
+
+// Airport is an airport of the database
+type Airport struct {
+	ICAO        string
+	Name        string
+	Position    sim.Coordinates
+	ElevationFt int
+	Frequencies []sim.AirportFrequency
+}
+
+// Database holds airports by upper case ICAO code
+type Database struct {
+	Source   string // One of the Source constants
+	Imported time.Time
+	Airports map[string]*Airport
+}
+
+// New creates an empty database of source
+func New(source string) *Database {
+	return &Database{
+		Source:   source,
+		Imported: time.Now().UTC(),
+		Airports: make(map[string]*Airport),
+	}
+}
+
+// Name returns the source of the database, it implements sim.FrequencySource
+func (db *Database) Name() string {
+	return db.Source
+}
+
+// Airport returns the airport with the ICAO code
+func (db *Database) Airport(icao string) (*Airport, bool) {
+	airport, found := db.Airports[strings.ToUpper(strings.TrimSpace(icao))]
+	return airport, found
+}
+
+// Frequencies returns the frequencies of the airport, it implements sim.FrequencySource
+func (db *Database) Frequencies(ctx context.Context, icao string) ([]sim.AirportFrequency, error) {
+	airport, found := db.Airport(icao)
+	if !found {
+		return nil, &sim.UnknownFacilityError{Idents: []string{strings.ToUpper(icao)}}
+	}
+	return slices.Clone(airport.Frequencies), nil
+}
+
+// add adds an airport with a frequency list of its own, frequencies listed twice are dropped.
+// Airports imported earlier under the same code are replaced.
+func (db *Database) add(airport *Airport) {
+	var freqs []sim.AirportFrequency
+	for _, f := range airport.Frequencies {
+		duplicate := slices.ContainsFunc(freqs, func(other sim.AirportFrequency) bool {
+			return other.Type == f.Type && other.Hz == f.Hz
+		})
+		if !duplicate {
+			freqs = append(freqs, f)
+		}
+	}
+	airport.Frequencies = freqs
+	db.Airports[airport.ICAO] = airport
+}
+
+// DefaultPath returns where the import command saves the database unless told otherwise
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "atc_freq", "frequencies.json"), nil
+}
+
+// Load reads a database written by Save
+func Load(path string) (*Database, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var db Database
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if db.Airports == nil {
+		db.Airports = make(map[string]*Airport)
+	}
+	// Frequencies saved before they had json tags keep TypeCode under a key that no longer matches
+	for _, airport := range db.Airports {
+		for i, freq := range airport.Frequencies {
+			if freq.TypeCode == 0 {
+				airport.Frequencies[i] = sim.NewAirportFrequency(freq.Type, freq.Hz, freq.Name, freq.Source)
+			}
+		}
+	}
+	return &db, nil
+}
+
+// Save writes the database as JSON, creating the directory of path
+func (db *Database) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(db)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
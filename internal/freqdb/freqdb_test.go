@@ -0,0 +1,158 @@
+package freqdb_test
+
+import (
+	"atc_freq/internal/freqdb"
+	"atc_freq/internal/sim"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ourAirportsAirports = `"id","ident","type","name","latitude_deg","longitude_deg","elevation_ft","continent","iso_country","iso_region","municipality","scheduled_service","gps_code","iata_code","local_code"
+2212,"EDDB","large_airport","Berlin Brandenburg Airport",52.351389,13.493889,157,"EU","DE","DE-BR","Berlin","yes","EDDB","BER",""
+2213,"EDDH","large_airport","Hamburg Helmut Schmidt Airport",53.630402,9.98823,53,"EU","DE","DE-HH","Hamburg","yes","EDDH","HAM",""
+28000,"DE-0001","small_airport","Strip Without Frequencies",52.1,13.1,,"EU","DE","DE-BR","","no","","",""
+2100,"EDBT","closed","Berlin Tegel",52.5597,13.2877,122,"EU","DE","DE-BE","Berlin","no","EDDT","TXL",""
+`
+
+const ourAirportsFrequencies = `"id","airport_ref","airport_ident","type","description","frequency_mhz"
+1,2212,"EDDB","ATIS","BRANDENBURG ATIS","123.08"
+2,2212,"EDDB","TWR","BRANDENBURG TOWER","118.8"
+3,2212,"EDDB","TWR","BRANDENBURG TOWER","118.800"
+4,2212,"EDDB","DEL","BRANDENBURG DELIVERY","121.6"
+5,2212,"EDDB","AFIS","INFO",""
+6,2213,"EDDH","GND","HAMBURG GROUND","121.705"
+7,2100,"EDBT","TWR","TEGEL TOWER","124.525"
+8,9999,"XXXX","TWR","ORPHAN","120.0"
+`
+
+func TestImportOurAirports(t *testing.T) {
+	db, err := freqdb.ImportOurAirports(strings.NewReader(ourAirportsAirports), strings.NewReader(ourAirportsFrequencies))
+	require.NoError(t, err)
+
+	// Closed airports and airports without frequencies are skipped
+	assert.Len(t, db.Airports, 2)
+	assert.Equal(t, freqdb.SourceOurAirports, db.Name())
+
+	eddb, found := db.Airport("eddb")
+	require.True(t, found)
+	assert.Equal(t, "Berlin Brandenburg Airport", eddb.Name)
+	assert.Equal(t, 157, eddb.ElevationFt)
+	assert.InDelta(t, 52.351389, eddb.Position.Lat, 1e-6)
+
+	// The duplicate tower is dropped, the types are translated to the SimConnect names
+	assert.Equal(t, []sim.AirportFrequency{
+		{Type: "ATIS", TypeCode: 1, Name: "BRANDENBURG ATIS", Hz: 123080000, MHz: 123.08, Source: freqdb.SourceOurAirports},
+		{Type: "TOWER", TypeCode: 6, Name: "BRANDENBURG TOWER", Hz: 118800000, MHz: 118.8, Source: freqdb.SourceOurAirports},
+		{Type: "CLEARANCE", TypeCode: 7, Name: "BRANDENBURG DELIVERY", Hz: 121600000, MHz: 121.6, Source: freqdb.SourceOurAirports},
+	}, eddb.Frequencies)
+}
+
+func TestImportOurAirports_MissingColumn(t *testing.T) {
+	_, err := freqdb.ImportOurAirports(strings.NewReader("ident,name\nEDDB,Berlin\n"), strings.NewReader(ourAirportsFrequencies))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `missing column "type"`)
+}
+
+const aptDat = `I
+1100 Version - data cycle 2023.08, build 20230830, metadata AptXP1200.
+
+1    157 0 0 XEDB Berlin Brandenburg
+1302 icao_code EDDB
+1302 datum_lat 52.362247
+1302 datum_lon 13.500672
+100 60.00 1 0 0.25 1 3 0 07L 52.3522 13.4710 0 0 3 0 0 0 25R 52.3651 13.5173 0 0 3 0 0 0
+1050 123080 ATIS
+1052 121600 DELIVERY
+1053 121880 GROUND
+1054 118800 TOWER
+1054 118800 TOWER
+1051 122700 CTAF
+
+1    53 0 0 EDDH Hamburg
+100 45.00 1 0 0.25 1 3 0 05 53.6200 9.9700 0 0 3 0 0 0 23 53.6400 10.0100 0 0 3 0 0 0
+50 12313 HAMBURG ATIS AWOS
+54 12128 HAMBURG TOWER
+
+17   0 0 0 EDHX Helipad Without Frequencies
+99
+`
+
+func TestImportAptDat(t *testing.T) {
+	db, err := freqdb.ImportAptDat(strings.NewReader(aptDat))
+	require.NoError(t, err)
+
+	assert.Len(t, db.Airports, 2)
+	assert.Equal(t, freqdb.SourceXPlane, db.Name())
+
+	// The icao_code metadata replaces the ident, the datum is used as position
+	eddb, found := db.Airport("EDDB")
+	require.True(t, found)
+	assert.Equal(t, "Berlin Brandenburg", eddb.Name)
+	assert.Equal(t, sim.Coordinates{Lat: 52.362247, Lon: 13.500672}, eddb.Position)
+	assert.Equal(t, []sim.AirportFrequency{
+		{Type: "ATIS", TypeCode: 1, Name: "ATIS", Hz: 123080000, MHz: 123.08, Source: freqdb.SourceXPlane},
+		{Type: "CLEARANCE", TypeCode: 7, Name: "DELIVERY", Hz: 121600000, MHz: 121.6, Source: freqdb.SourceXPlane},
+		{Type: "GROUND", TypeCode: 5, Name: "GROUND", Hz: 121880000, MHz: 121.88, Source: freqdb.SourceXPlane},
+		{Type: "TOWER", TypeCode: 6, Name: "TOWER", Hz: 118800000, MHz: 118.8, Source: freqdb.SourceXPlane},
+		{Type: "CTAF", TypeCode: 4, Name: "CTAF", Hz: 122700000, MHz: 122.7, Source: freqdb.SourceXPlane},
+	}, eddb.Frequencies)
+
+	// Old frequency rows are in 10 kHz, airports without a datum sit in the middle of the runway
+	eddh, found := db.Airport("EDDH")
+	require.True(t, found)
+	assert.InDelta(t, 53.63, eddh.Position.Lat, 1e-9)
+	assert.InDelta(t, 9.99, eddh.Position.Lon, 1e-9)
+	require.Len(t, eddh.Frequencies, 2)
+	assert.Equal(t, "AWOS", eddh.Frequencies[0].Type)
+	assert.Equal(t, 123130000, eddh.Frequencies[0].Hz)
+	assert.Equal(t, 121280000, eddh.Frequencies[1].Hz)
+}
+
+func TestImportAptDat_InvalidFrequency(t *testing.T) {
+	_, err := freqdb.ImportAptDat(strings.NewReader("1 157 0 0 EDDB Berlin\n1054 tower TOWER\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+}
+
+func TestDatabase_SaveLoad(t *testing.T) {
+	db, err := freqdb.ImportAptDat(strings.NewReader(aptDat))
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "atc_freq", "frequencies.json")
+	require.NoError(t, db.Save(path))
+
+	loaded, err := freqdb.Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, db.Source, loaded.Source)
+	assert.True(t, db.Imported.Equal(loaded.Imported))
+	assert.Equal(t, db.Airports, loaded.Airports)
+}
+
+func TestLoad_UntaggedFrequencies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frequencies.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"Source":"xplane","Airports":{"EDDB":{"ICAO":"EDDB",
+		"Frequencies":[{"Type":"TOWER","TypeCode":6,"Name":"Tower","Hz":118800000,"MHz":118.8,"Source":"xplane"}]}}}`), 0o644))
+
+	db, err := freqdb.Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []sim.AirportFrequency{sim.NewAirportFrequency("TOWER", 118800000, "Tower", "xplane")}, db.Airports["EDDB"].Frequencies)
+}
+
+func TestDatabase_Frequencies(t *testing.T) {
+	db, err := freqdb.ImportAptDat(strings.NewReader(aptDat))
+	require.NoError(t, err)
+
+	var source sim.FrequencySource = db
+	freqs, err := source.Frequencies(context.Background(), "EDDH")
+	require.NoError(t, err)
+	assert.Len(t, freqs, 2)
+
+	_, err = source.Frequencies(context.Background(), "XXXX")
+	assert.ErrorIs(t, err, sim.ErrUnknownFacility)
+}
@@ -0,0 +1,165 @@
+package freqdb
+
+import (
+	"atc_freq/internal/sim"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ourAirportsTypes maps the frequency types of OurAirports to the SimConnect names.
+// Other types are kept as they are, with TypeCode 0.
+var ourAirportsTypes = map[string]string{
+	"ATIS": "ATIS",
+	"AWOS": "AWOS",
+	"ASOS": "ASOS",
+	"CLD":  "CLEARANCE",
+	"CLNC": "CLEARANCE",
+	"DEL":  "CLEARANCE",
+	"GND":  "GROUND",
+	"TWR":  "TOWER",
+	"APP":  "APPROACH",
+	"DEP":  "DEPARTURE",
+	"CNTR": "CENTER",
+	"CTR":  "CENTER",
+	"CTAF": "CTAF",
+	"UNIC": "UNICOM",
+	"A/G":  "UNICOM",
+	"MULT": "MULTICOM",
+	"FSS":  "FSS",
+}
+
+// ImportOurAirports builds a database from the airports.csv and airport-frequencies.csv files
+// of OurAirports. Airports are keyed by ICAO code, or GPS code and ident where they have none.
+// Closed airports and airports without frequencies are skipped.
+func ImportOurAirports(airports, frequencies io.Reader) (*Database, error) {
+	db := New(SourceOurAirports)
+
+	// Frequencies reference airports by ident, order keeps the import deterministic
+	// when several airports share a code
+	byIdent := make(map[string]*Airport)
+	var order []*Airport
+	err := readCSV(airports, "airports.csv", []string{"ident", "type", "name", "latitude_deg", "longitude_deg"}, func(row csvRow) error {
+		if row.get("type") == "closed" {
+			return nil
+		}
+
+		icao := firstNonEmpty(row.get("icao_code"), row.get("gps_code"), row.get("ident"))
+		airport := &Airport{ICAO: strings.ToUpper(icao), Name: row.get("name")}
+
+		var err error
+		if airport.Position.Lat, err = strconv.ParseFloat(row.get("latitude_deg"), 64); err != nil {
+			return fmt.Errorf("invalid latitude_deg: %w", err)
+		}
+		if airport.Position.Lon, err = strconv.ParseFloat(row.get("longitude_deg"), 64); err != nil {
+			return fmt.Errorf("invalid longitude_deg: %w", err)
+		}
+		// Many small fields have no elevation
+		airport.ElevationFt, _ = strconv.Atoi(row.get("elevation_ft"))
+
+		byIdent[row.get("ident")] = airport
+		order = append(order, airport)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readCSV(frequencies, "airport-frequencies.csv", []string{"airport_ident", "type", "description", "frequency_mhz"}, func(row csvRow) error {
+		airport, found := byIdent[row.get("airport_ident")]
+		if !found {
+			return nil
+		}
+
+		mhz, err := strconv.ParseFloat(row.get("frequency_mhz"), 64)
+		if err != nil || mhz <= 0 {
+			// A few records have no usable frequency, they are skipped instead of failing the import
+			return nil
+		}
+
+		freqType := strings.ToUpper(row.get("type"))
+		if mapped, found := ourAirportsTypes[freqType]; found {
+			freqType = mapped
+		}
+
+		hz := int(math.Round(mhz * 1e6))
+		airport.Frequencies = append(airport.Frequencies, sim.NewAirportFrequency(freqType, hz, row.get("description"), SourceOurAirports))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, airport := range order {
+		if len(airport.Frequencies) > 0 {
+			db.add(airport)
+		}
+	}
+	return db, nil
+}
+
+// csvRow is a record of a CSV file with a header
+type csvRow struct {
+	columns map[string]int
+	record  []string
+}
+
+// get returns the value of the column, or "" when the file or the record doesn't have it
+func (row csvRow) get(column string) string {
+	i, found := row.columns[column]
+	if !found || i >= len(row.record) {
+		return ""
+	}
+	return strings.TrimSpace(row.record[i])
+}
+
+// readCSV calls fn for every record of r. Columns are found by the header, so the order of the
+// columns and additional ones don't matter, but required columns must be present.
+func readCSV(r io.Reader, name string, required []string, fn func(row csvRow) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("%s: failed to read header: %w", name, err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.TrimSpace(column)] = i
+	}
+	for _, column := range required {
+		if _, found := columns[column]; !found {
+			return fmt.Errorf("%s: missing column %q", name, column)
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		if err := fn(csvRow{columns: columns, record: record}); err != nil {
+			line, _ := reader.FieldPos(0)
+			return fmt.Errorf("%s line %d: %w", name, line, err)
+		}
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,14 @@
+package helpers
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+func CString(s string) (*byte, error) {
+	// Windows API expects null-terminated ANSI here (SimConnect uses LPCSTR).
+	b, err := windows.BytePtrFromString(s)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"atc_freq/internal/sim"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeTimeout is how long a WebSocket message may take to reach a slow client
+	writeTimeout = 10 * time.Second
+	// pingInterval keeps idle WebSockets open through proxies while the aircraft is parked
+	pingInterval = 30 * time.Second
+)
+
+// AircraftMessage is a message of the aircraft WebSocket, either a state of the user aircraft
+// or, as the last message, the error that ended the stream
+type AircraftMessage struct {
+	Aircraft *sim.AircraftState `json:"aircraft,omitempty"`
+	Error    *ErrorResponse     `json:"error,omitempty"`
+}
+
+// aircraftStream upgrades to a WebSocket and sends an AircraftMessage whenever the aircraft changes,
+// at most once a second. The stream ends when the client closes it or the simulator quits.
+// Every client has its own subscription, the simulator only sends the changed states.
+func (s *Server) aircraftStream(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return s.originAllowed(r.Header.Get("Origin")) },
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader answered with the error already
+		return
+	}
+	defer conn.Close()
+
+	// The client sends nothing, reading processes its close and pong frames
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	sub := s.service.SubscribeAircraftCtx(ctx)
+	defer sub.Close()
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case state, ok := <-sub.Updates():
+			if !ok {
+				closeStream(conn, sub.Err())
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteJSON(AircraftMessage{Aircraft: &state}); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// closeStream sends the error that ended the subscription, if any, and closes the WebSocket
+func closeStream(conn *websocket.Conn, err error) {
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	closeCode, reason := websocket.CloseNormalClosure, ""
+	if err != nil {
+		_, code := errorStatus(err)
+		conn.WriteJSON(AircraftMessage{Error: &ErrorResponse{Code: code, Message: err.Error()}})
+		closeCode, reason = websocket.CloseGoingAway, code
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, reason))
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"atc_freq/internal/sim"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error codes of ErrorResponse, clients should switch on them rather than on the message
+const (
+	CodeBadRequest         = "bad_request"         // 400, a parameter is missing or malformed
+	CodeUnknownFacility    = "unknown_facility"    // 404, the simulator has no airport or waypoint with the identifier
+	CodeNotConnected       = "not_connected"       // 503, the simulator is not running or no flight is loaded
+	CodeTimeout            = "timeout"             // 504, the simulator didn't answer in time
+	CodeSimulatorException = "simulator_exception" // 502, the simulator rejected the request
+	CodeInternal           = "internal"            // 500
+)
+
+// ErrorResponse is the body of every failed request
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// requestError is a parameter the client got wrong
+type requestError struct {
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...any) error {
+	return &requestError{message: fmt.Sprintf(format, args...)}
+}
+
+// errorStatus maps the sim errors to a status code and an error code
+func errorStatus(err error) (int, string) {
+	var request *requestError
+	var exception *sim.ExceptionError
+
+	switch {
+	case errors.As(err, &request), errors.Is(err, sim.ErrInvalidFrequency):
+		return http.StatusBadRequest, CodeBadRequest
+	case errors.Is(err, sim.ErrUnknownFacility):
+		return http.StatusNotFound, CodeUnknownFacility
+	case errors.Is(err, sim.ErrNotConnected):
+		return http.StatusServiceUnavailable, CodeNotConnected
+	case errors.Is(err, sim.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, CodeTimeout
+	case errors.As(err, &exception):
+		return http.StatusBadGateway, CodeSimulatorException
+	}
+	return http.StatusInternalServerError, CodeInternal
+}
+
+// writeError answers with the ErrorResponse for err. Nothing is written when the client went away.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		return
+	}
+
+	status, code := errorStatus(err)
+	writeJSON(w, status, ErrorResponse{Code: code, Message: err.Error()})
+}
+
+// writeJSON answers with value as JSON
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	// The status is sent already, a failed write means the client went away
+	_ = json.NewEncoder(w).Encode(value)
+}
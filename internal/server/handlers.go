@@ -0,0 +1,204 @@
+package server
+
+import (
+	"atc_freq/internal/sim"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultRadiusNM is the nearby search radius when the request has none, like the CLI
+	defaultRadiusNM = 25
+	// maxRadiusNM bounds the nearby search, the simulator only lists airports around the aircraft anyway
+	maxRadiusNM = 500
+	// maxCloudBoxKm bounds the cloud grid, the simulator only has weather around the aircraft
+	maxCloudBoxKm = 200
+)
+
+// routes registers the API endpoints. Responses are the sim types encoded as JSON,
+// failures are an ErrorResponse. The cloud endpoints answer with the levels the simulator
+// did answer, list the others as failures and the waypoints the simulator doesn't know as unknown.
+// They only fail when no level was answered.
+//
+//	GET /api/frequencies/{icao}                                        []sim.AirportFrequency
+//	GET /api/airports/{icao}                                           sim.Airport
+//	GET /api/weather?waypoints=EDDB,EDDH                               sim.RouteWeather
+//	GET /api/clouds?waypoints=EDDB,EDDH                                sim.CloudDensities
+//	GET /api/clouds/profile?waypoints=EDDB&min=0&max=10000&step=500    sim.CloudProfiles
+//	GET /api/clouds/grid?waypoint=EDDB&min=2000&max=2500&box=5         sim.CloudGrid
+//	GET /api/nearby?center=EDDB&radius=25&frequencies=true             []sim.NearbyAirport
+//	GET /api/aircraft                                                  sim.AircraftState
+//	GET /api/aircraft/ws                                               WebSocket of sim.AircraftState
+//	GET /api/cache                                                     map[sim.CacheKind]sim.CacheStats
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/frequencies/{icao}", s.handle(s.frequencies))
+	mux.HandleFunc("GET /api/airports/{icao}", s.handle(s.airport))
+	mux.HandleFunc("GET /api/weather", s.handle(s.weather))
+	mux.HandleFunc("GET /api/clouds", s.handle(s.clouds))
+	mux.HandleFunc("GET /api/clouds/profile", s.handle(s.cloudProfile))
+	mux.HandleFunc("GET /api/clouds/grid", s.handle(s.cloudGrid))
+	mux.HandleFunc("GET /api/nearby", s.handle(s.nearby))
+	mux.HandleFunc("GET /api/aircraft", s.handle(s.aircraft))
+	mux.HandleFunc("GET /api/aircraft/ws", s.aircraftStream)
+	mux.HandleFunc("GET /api/cache", s.handle(s.cacheStats))
+	return mux
+}
+
+// handle writes the result of a JSON endpoint
+func (s *Server) handle(endpoint func(r *http.Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, err := endpoint(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func (s *Server) frequencies(r *http.Request) (any, error) {
+	return s.service.GetFrequencyCtx(r.Context(), r.PathValue("icao"))
+}
+
+func (s *Server) airport(r *http.Request) (any, error) {
+	return s.service.GetAirportDetailsCtx(r.Context(), r.PathValue("icao"))
+}
+
+func (s *Server) weather(r *http.Request) (any, error) {
+	waypoints, err := waypointsParam(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.service.GetRouteWeatherCtx(r.Context(), waypoints)
+}
+
+func (s *Server) clouds(r *http.Request) (any, error) {
+	waypoints, err := waypointsParam(r)
+	if err != nil {
+		return nil, err
+	}
+	return sim.NewCloudDensities(s.service.GetCloudDensityCtx(r.Context(), waypoints))
+}
+
+// cloudProfile defaults the altitudes missing from the query to sim.DefaultCloudProfile
+func (s *Server) cloudProfile(r *http.Request) (any, error) {
+	waypoints, err := waypointsParam(r)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := sim.DefaultCloudProfile
+	query := r.URL.Query()
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{{"min", &opts.MinAlt}, {"max", &opts.MaxAlt}, {"step", &opts.Step}} {
+		if *param.value, err = intParam(query, param.name, *param.value); err != nil {
+			return nil, err
+		}
+	}
+	if err := opts.ValidateSweep(len(waypoints)); err != nil {
+		return nil, badRequest("%v", err)
+	}
+
+	return sim.NewCloudProfiles(s.service.GetCloudProfileCtx(r.Context(), waypoints, opts))
+}
+
+// cloudGrid returns the grid of one altitude range, by default the lowest level of sim.DefaultCloudProfile
+func (s *Server) cloudGrid(r *http.Request) (any, error) {
+	query := r.URL.Query()
+	waypoint := strings.TrimSpace(query.Get("waypoint"))
+	if waypoint == "" {
+		return nil, badRequest("waypoint is required, e.g. waypoint=EDDB")
+	}
+
+	minAlt, err := intParam(query, "min", sim.DefaultCloudProfile.MinAlt)
+	if err != nil {
+		return nil, err
+	}
+	maxAlt, err := intParam(query, "max", minAlt+sim.DefaultCloudProfile.Step)
+	if err != nil {
+		return nil, err
+	}
+	if maxAlt <= minAlt {
+		return nil, badRequest("max %d has to be above min %d", maxAlt, minAlt)
+	}
+
+	box := sim.DefaultCloudBoxKm
+	if value := query.Get("box"); value != "" {
+		box, err = strconv.ParseFloat(value, 64)
+		if err != nil || box <= 0 || box > maxCloudBoxKm {
+			return nil, badRequest("invalid box %q, expected kilometres up to %d", value, maxCloudBoxKm)
+		}
+	}
+
+	return s.service.GetCloudGridCtx(r.Context(), waypoint, box, minAlt, maxAlt)
+}
+
+// nearby searches around center, an ICAO code or "lat,lon", or around the aircraft without one
+func (s *Server) nearby(r *http.Request) (any, error) {
+	query := r.URL.Query()
+
+	center := query.Get("center")
+	if _, _, err := sim.ParsePosition(center); err != nil {
+		return nil, badRequest("%v", err)
+	}
+
+	radius := float64(defaultRadiusNM)
+	if value := query.Get("radius"); value != "" {
+		var err error
+		radius, err = strconv.ParseFloat(value, 64)
+		if err != nil || radius <= 0 || radius > maxRadiusNM {
+			return nil, badRequest("invalid radius %q, expected nautical miles up to %d", value, maxRadiusNM)
+		}
+	}
+
+	frequencies := true
+	if value := query.Get("frequencies"); value != "" {
+		var err error
+		if frequencies, err = strconv.ParseBool(value); err != nil {
+			return nil, badRequest("invalid frequencies %q, expected true or false", value)
+		}
+	}
+
+	return s.service.FindNearbyCtx(r.Context(), center, radius, frequencies)
+}
+
+func (s *Server) aircraft(r *http.Request) (any, error) {
+	return s.service.GetAircraftStateCtx(r.Context())
+}
+
+// cacheStats reports how many requests the cache of the service answered
+func (s *Server) cacheStats(r *http.Request) (any, error) {
+	return s.service.CacheStats(), nil
+}
+
+// intParam reads the integer query parameter name, fallback when it is missing
+func intParam(query url.Values, name string, fallback int) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, badRequest("invalid %s %q, expected feet", name, value)
+	}
+	return n, nil
+}
+
+// waypointsParam reads the comma separated waypoints query parameter
+func waypointsParam(r *http.Request) ([]string, error) {
+	var waypoints []string
+	for _, waypoint := range strings.Split(r.URL.Query().Get("waypoints"), ",") {
+		if waypoint = strings.TrimSpace(waypoint); waypoint != "" {
+			waypoints = append(waypoints, waypoint)
+		}
+	}
+	if len(waypoints) == 0 {
+		return nil, badRequest("waypoints is required, e.g. waypoints=EDDB,EDDH")
+	}
+	return waypoints, nil
+}
@@ -0,0 +1,103 @@
+// Package server exposes the simulator data over HTTP/JSON and streams the user aircraft over a WebSocket,
+// so kneeboards on a tablet or stream overlays can use what the desktop app and the CLI show.
+package server
+
+import (
+	"atc_freq/internal/sim"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// shutdownTimeout is how long ListenAndServe waits for requests in flight once its context is done
+const shutdownTimeout = 5 * time.Second
+
+// Options configures the server
+type Options struct {
+	Addr string // Address to listen on, e.g. ":8080"
+	// AllowedOrigins are the browser origins allowed to call the API and open the WebSocket,
+	// e.g. "http://localhost:5173". "*" allows every origin. Requests without an Origin header
+	// don't come from a browser and are always allowed.
+	AllowedOrigins []string
+}
+
+// Server serves the API of a sim.Service
+type Server struct {
+	service *sim.Service
+	options Options
+	handler http.Handler
+}
+
+// New creates a server for service, the service is not closed by the server
+func New(service *sim.Service, options Options) *Server {
+	s := &Server{service: service, options: options}
+	s.handler = s.cors(s.routes())
+	return s
+}
+
+// Handler returns the handler serving the API, for tests and embedding in another server
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// ListenAndServe serves the API on Options.Addr until ctx is done, then waits for the requests
+// in flight. WebSocket streams end with ctx.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.options.Addr,
+		Handler:           s.handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.ListenAndServe() }()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// originAllowed reports whether a browser on origin may use the API
+func (s *Server) originAllowed(origin string) bool {
+	return origin == "" || slices.Contains(s.options.AllowedOrigins, "*") || slices.Contains(s.options.AllowedOrigins, origin)
+}
+
+// cors adds the CORS headers for allowed origins and answers preflight requests.
+// Requests from other origins are still served, the browser keeps the response from the page.
+func (s *Server) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" && s.originAllowed(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if origin != "" && s.originAllowed(origin) {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+				w.Header().Set("Access-Control-Max-Age", "600")
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
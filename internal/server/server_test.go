@@ -0,0 +1,230 @@
+package server_test
+
+import (
+	"atc_freq/internal/server"
+	"atc_freq/internal/sim"
+	"atc_freq/internal/simfake"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, origins ...string) (*httptest.Server, *simfake.Connection) {
+	connection := simfake.NewConnection(nil)
+	service := sim.NewService(sim.NewClient(connection))
+	t.Cleanup(service.Close)
+
+	ts := httptest.NewServer(server.New(service, server.Options{AllowedOrigins: origins}).Handler())
+	t.Cleanup(ts.Close)
+	return ts, connection
+}
+
+// get requests path and decodes the JSON body into result
+func get(t *testing.T, ts *httptest.Server, path string, result any) *http.Response {
+	resp, err := http.Get(ts.URL + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+	return resp
+}
+
+func TestServer_Endpoints(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	var freqs []sim.AirportFrequency
+	resp := get(t, ts, "/api/frequencies/eddb", &freqs)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotEmpty(t, freqs)
+	assert.Equal(t, "ATIS", freqs[0].Type)
+
+	var airport sim.Airport
+	resp = get(t, ts, "/api/airports/EDDH", &airport)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Hamburg", airport.Name)
+
+	var route sim.RouteWeather
+	resp = get(t, ts, "/api/weather?waypoints=EDDB,EDDH", &route)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, route.Stations, 2)
+
+	var profiles sim.CloudProfiles
+	resp = get(t, ts, "/api/clouds/profile?waypoints=EDDH&max=3000&step=1000", &profiles)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, profiles.Profiles, "EDDH")
+	assert.Len(t, profiles.Profiles["EDDH"].Levels, 3)
+	assert.Equal(t, 1000, profiles.Profiles["EDDH"].Layers[0].Base)
+	assert.Empty(t, profiles.Failures)
+
+	var grid sim.CloudGrid
+	resp = get(t, ts, "/api/clouds/grid?waypoint=eddh&min=2000", &grid)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2500, grid.MaxAlt)
+	assert.Len(t, grid.Cells, sim.CloudGridSize*sim.CloudGridSize)
+	assert.Equal(t, 1.0, grid.Coverage)
+
+	var nearby []sim.NearbyAirport
+	resp = get(t, ts, "/api/nearby?center=EDDB&radius=30", &nearby)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotEmpty(t, nearby)
+	assert.NotEqual(t, "EDDB", nearby[0].ICAO)
+	assert.NotNil(t, nearby[0].Frequency)
+
+	var aircraft sim.AircraftState
+	resp = get(t, ts, "/api/aircraft", &aircraft)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 121880000, aircraft.COM1.ActiveHz)
+
+	var stats map[sim.CacheKind]sim.CacheStats
+	resp = get(t, ts, "/api/cache", &stats)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Positive(t, stats[sim.CacheFacilities].Misses)
+}
+
+func TestServer_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		code   string
+	}{
+		{"unknown airport", "/api/airports/XXXX", http.StatusNotFound, server.CodeUnknownFacility},
+		{"missing waypoints", "/api/clouds", http.StatusBadRequest, server.CodeBadRequest},
+		{"invalid profile step", "/api/clouds/profile?waypoints=EDDB&step=0", http.StatusBadRequest, server.CodeBadRequest},
+		{"invalid profile altitude", "/api/clouds/profile?waypoints=EDDB&max=high", http.StatusBadRequest, server.CodeBadRequest},
+		{"missing grid waypoint", "/api/clouds/grid", http.StatusBadRequest, server.CodeBadRequest},
+		{"invalid grid range", "/api/clouds/grid?waypoint=EDDB&min=3000&max=2000", http.StatusBadRequest, server.CodeBadRequest},
+		{"invalid grid box", "/api/clouds/grid?waypoint=EDDB&box=0", http.StatusBadRequest, server.CodeBadRequest},
+		{"unknown grid waypoint", "/api/clouds/grid?waypoint=XXXX", http.StatusNotFound, server.CodeUnknownFacility},
+		{"invalid radius", "/api/nearby?radius=-1", http.StatusBadRequest, server.CodeBadRequest},
+		{"invalid center", "/api/nearby?center=95,13", http.StatusBadRequest, server.CodeBadRequest},
+	}
+
+	ts, _ := newTestServer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body server.ErrorResponse
+			resp := get(t, ts, tt.path, &body)
+
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, tt.code, body.Code)
+			assert.NotEmpty(t, body.Message)
+		})
+	}
+}
+
+func TestServer_ResponseBody(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	// Clients read the fields by these names, renaming a field must not change them
+	for _, tt := range []struct {
+		path     string
+		expected string
+	}{
+		{"/api/aircraft", `{
+			"position": {"lat": 52.3622, "lon": 13.5122},
+			"altitude": 157, "heading": 245, "ground_speed": 0, "on_ground": true,
+			"com1": {"active_hz": 121880000, "standby_hz": 118800000, "active_mhz": 121.88, "standby_mhz": 118.8},
+			"com2": {"active_hz": 123080000, "standby_hz": 121600000, "active_mhz": 123.08, "standby_mhz": 121.6}
+		}`},
+		{"/api/airports/XXXX", `{"code": "unknown_facility", "message": "failed to get airport details for XXXX: unknown facility: [XXXX]"}`},
+	} {
+		resp, err := http.Get(ts.URL + tt.path)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.JSONEq(t, tt.expected, string(body), tt.path)
+	}
+}
+
+func TestServer_NotConnected(t *testing.T) {
+	ts, connection := newTestServer(t)
+	connection.Quit()
+
+	var body server.ErrorResponse
+	resp := get(t, ts, "/api/aircraft", &body)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, server.CodeNotConnected, body.Code)
+}
+
+func TestServer_CORS(t *testing.T) {
+	ts, _ := newTestServer(t, "http://kneeboard.local")
+
+	preflight := func(origin string) *http.Response {
+		req, err := http.NewRequest(http.MethodOptions, ts.URL+"/api/aircraft", nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := preflight("http://kneeboard.local")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "http://kneeboard.local", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, resp.Header.Get("Access-Control-Allow-Methods"), http.MethodGet)
+
+	resp = preflight("http://elsewhere.local")
+	assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+
+	// Browsers from other origins can't open the WebSocket either
+	header := http.Header{"Origin": {"http://elsewhere.local"}}
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL(ts), header)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func wsURL(ts *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/aircraft/ws"
+}
+
+// readMessage reads the next AircraftMessage, failing after a few seconds
+func readMessage(t *testing.T, conn *websocket.Conn) server.AircraftMessage {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(3*time.Second)))
+	var message server.AircraftMessage
+	require.NoError(t, conn.ReadJSON(&message))
+	return message
+}
+
+func TestServer_AircraftStream(t *testing.T) {
+	ts, connection := newTestServer(t)
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(ts), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	first := readMessage(t, conn)
+	require.NotNil(t, first.Aircraft)
+	assert.Equal(t, 121880000, first.Aircraft.COM1.ActiveHz)
+
+	retuned := simfake.DefaultFixtures().Aircraft
+	retuned.COM1Active = 118800000
+	connection.SetAircraft(retuned)
+
+	second := readMessage(t, conn)
+	require.NotNil(t, second.Aircraft)
+	assert.Equal(t, 118800000, second.Aircraft.COM1.ActiveHz)
+
+	// The stream ends with the reason when the simulator quits
+	connection.Quit()
+	last := readMessage(t, conn)
+	assert.Nil(t, last.Aircraft)
+	require.NotNil(t, last.Error)
+	assert.Equal(t, server.CodeNotConnected, last.Error.Code)
+
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "unexpected error %v", err)
+}
@@ -0,0 +1,201 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// FlightPhase is the part of the flight the aircraft is in, as seen by the FrequencyAdvisor
+type FlightPhase string
+
+const (
+	PhasePreflight FlightPhase = "preflight" // On the ground at the departure airport
+	PhaseDeparture FlightPhase = "departure" // Climbing out of the departure airport
+	PhaseEnroute   FlightPhase = "enroute"
+	PhaseApproach  FlightPhase = "approach" // Within approachRangeNM of the destination
+	PhaseLanding   FlightPhase = "landing"  // Within towerRangeNM of the destination
+	PhaseTaxiIn    FlightPhase = "taxi in"  // On the ground at the destination
+)
+
+const (
+	// departureRangeNM is how far from the departure airport departure control is expected
+	departureRangeNM = 40
+	// departureCeilingFt is the altitude above which departure control hands over to center
+	departureCeilingFt = 10000
+	// approachRangeNM is how far from the destination approach control takes over
+	approachRangeNM = 40
+	// towerRangeNM is how far from the destination the tower takes over
+	towerRangeNM = 10
+)
+
+// advisorRole tells which airport of the flight an advisorStep takes its frequency from
+type advisorRole int
+
+const (
+	roleDeparture advisorRole = iota
+	roleDestination
+	roleNearest // The nearer of the two airports, then the other one
+)
+
+// advisorStep is one frequency of the sequence a pilot works through. The first of types
+// the airport has is used, so airports without a tower fall back to CTAF or UNICOM.
+type advisorStep struct {
+	phase FlightPhase
+	role  advisorRole
+	types []string
+}
+
+// localTypes are the frequencies talked to around the runway, the tower or its replacements
+var localTypes = []string{"TOWER", "CTAF", "UNICOM", "MULTICOM"}
+
+// advisorSteps is the frequency sequence of a flight:
+// ATIS, clearance, ground, tower, departure, center, approach, tower, ground
+var advisorSteps = []advisorStep{
+	{PhasePreflight, roleDeparture, []string{"ATIS", "AWOS", "ASOS"}},
+	{PhasePreflight, roleDeparture, []string{"CLEARANCE"}},
+	{PhasePreflight, roleDeparture, []string{"GROUND"}},
+	{PhasePreflight, roleDeparture, localTypes},
+	{PhaseDeparture, roleDeparture, []string{"DEPARTURE", "APPROACH"}},
+	{PhaseEnroute, roleNearest, []string{"CENTER"}},
+	{PhaseApproach, roleDestination, []string{"APPROACH"}},
+	{PhaseLanding, roleDestination, localTypes},
+	{PhaseTaxiIn, roleDestination, []string{"GROUND"}},
+}
+
+// AdvisorAirport is an airport of the flight with its frequencies
+type AdvisorAirport struct {
+	ICAO        string             `json:"icao"`
+	Position    Coordinates        `json:"position"`
+	Frequencies []AirportFrequency `json:"frequencies"`
+}
+
+// FrequencyAdvisor suggests the next frequency a pilot needs on a flight between two airports
+type FrequencyAdvisor struct {
+	Departure   AdvisorAirport
+	Destination AdvisorAirport
+}
+
+// FrequencyAdvice is the frequency suggested for the current phase of flight
+type FrequencyAdvice struct {
+	Phase     FlightPhase      `json:"phase"`
+	ICAO      string           `json:"icao"` // Airport the frequency belongs to
+	Frequency AirportFrequency `json:"frequency"`
+}
+
+// NewFrequencyAdvisor creates an advisor for a flight from departure to destination
+func NewFrequencyAdvisor(departure, destination AdvisorAirport) *FrequencyAdvisor {
+	return &FrequencyAdvisor{Departure: departure, Destination: destination}
+}
+
+// Phase works out the phase of flight from the aircraft position relative to both airports.
+// Flights shorter than approachRangeNM go straight from the departure airport to approach.
+func (a *FrequencyAdvisor) Phase(state AircraftState) FlightPhase {
+	fromDeparture := DistanceNM(a.Departure.Position, state.Position)
+	toDestination := DistanceNM(state.Position, a.Destination.Position)
+
+	switch {
+	case state.OnGround && toDestination < fromDeparture:
+		return PhaseTaxiIn
+	case state.OnGround:
+		return PhasePreflight
+	case toDestination <= towerRangeNM:
+		return PhaseLanding
+	case toDestination <= approachRangeNM:
+		return PhaseApproach
+	case fromDeparture <= departureRangeNM && state.Altitude < departureCeilingFt:
+		return PhaseDeparture
+	}
+	return PhaseEnroute
+}
+
+// Next returns the frequency the pilot needs next. Within the current phase the sequence
+// continues after the frequency COM1 or COM2 is tuned to, once the last frequency of the
+// phase is tuned the first one of the following phase is suggested. Steps the airports have
+// no frequency for are skipped. Next returns nil when no frequency is left.
+func (a *FrequencyAdvisor) Next(state AircraftState) *FrequencyAdvice {
+	phase := a.Phase(state)
+
+	from := -1
+	for i, step := range advisorSteps {
+		if step.phase != phase {
+			continue
+		}
+		if from < 0 {
+			from = i
+		}
+		if _, freq, ok := a.frequency(step, state.Position); ok && state.Tuned(freq.Hz) {
+			from = i + 1
+		}
+	}
+
+	for i := from; i >= 0 && i < len(advisorSteps); i++ {
+		step := advisorSteps[i]
+		if icao, freq, ok := a.frequency(step, state.Position); ok {
+			return &FrequencyAdvice{Phase: step.phase, ICAO: icao, Frequency: freq}
+		}
+	}
+	return nil
+}
+
+// frequency returns the first frequency of the step's types at the step's airport
+func (a *FrequencyAdvisor) frequency(step advisorStep, position Coordinates) (string, AirportFrequency, bool) {
+	var airports []AdvisorAirport
+	switch step.role {
+	case roleDeparture:
+		airports = []AdvisorAirport{a.Departure}
+	case roleDestination:
+		airports = []AdvisorAirport{a.Destination}
+	case roleNearest:
+		airports = []AdvisorAirport{a.Departure, a.Destination}
+		if DistanceNM(position, a.Destination.Position) < DistanceNM(position, a.Departure.Position) {
+			airports[0], airports[1] = airports[1], airports[0]
+		}
+	}
+
+	for _, airport := range airports {
+		for _, freqType := range step.types {
+			for _, freq := range airport.Frequencies {
+				if freq.Type == freqType {
+					return airport.ICAO, freq, true
+				}
+			}
+		}
+	}
+	return "", AirportFrequency{}, false
+}
+
+// NewFrequencyAdvisor creates an advisor for a flight between two airports known to the simulator
+func (s *Service) NewFrequencyAdvisor(departure, destination string) (*FrequencyAdvisor, error) {
+	return s.NewFrequencyAdvisorCtx(context.Background(), departure, destination)
+}
+
+// NewFrequencyAdvisorCtx looks up the position and frequencies of both airports until ctx is done
+func (s *Service) NewFrequencyAdvisorCtx(ctx context.Context, departure, destination string) (*FrequencyAdvisor, error) {
+	departure = strings.ToUpper(strings.TrimSpace(departure))
+	destination = strings.ToUpper(strings.TrimSpace(destination))
+	if departure == "" || destination == "" {
+		return nil, fmt.Errorf("departure and destination airports are required")
+	}
+	icaos := []string{departure, destination}
+
+	positions, err := s.GetWaypointCoordinatesCtx(ctx, icaos)
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate %s and %s: %w", departure, destination, err)
+	}
+
+	freqs, err := s.GetFrequencyBatchCtx(ctx, icaos)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get frequencies of %s and %s: %w", departure, destination, err)
+	}
+
+	airports := make([]AdvisorAirport, len(icaos))
+	for i, icao := range icaos {
+		position, found := positions[icao]
+		if !found {
+			return nil, &UnknownFacilityError{Idents: []string{icao}}
+		}
+		airports[i] = AdvisorAirport{ICAO: icao, Position: position, Frequencies: freqs[icao]}
+	}
+	return NewFrequencyAdvisor(airports[0], airports[1]), nil
+}
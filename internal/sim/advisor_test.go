@@ -0,0 +1,110 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAdvisor() *sim.FrequencyAdvisor {
+	return sim.NewFrequencyAdvisor(
+		sim.AdvisorAirport{ICAO: "EDDB", Position: eddb, Frequencies: []sim.AirportFrequency{
+			{Type: "TOWER", Hz: 118800000},
+			{Type: "ATIS", Hz: 123080000},
+			{Type: "GROUND", Hz: 121880000},
+			{Type: "CLEARANCE", Hz: 121600000},
+			{Type: "DEPARTURE", Hz: 119620000},
+			{Type: "CENTER", Hz: 127725000},
+		}},
+		sim.AdvisorAirport{ICAO: "EDDH", Position: eddh, Frequencies: []sim.AirportFrequency{
+			{Type: "GROUND", Hz: 121805000},
+			{Type: "TOWER", Hz: 121275000},
+			{Type: "APPROACH", Hz: 120600000},
+		}},
+	)
+}
+
+// aircraftAt is an aircraft at position with COM1 tuned to hz
+func aircraftAt(position sim.Coordinates, onGround bool, altitude float64, hz int) sim.AircraftState {
+	return sim.AircraftState{
+		Position: position,
+		Altitude: altitude,
+		OnGround: onGround,
+		COM1:     sim.Radio{ActiveHz: hz},
+	}
+}
+
+func TestFrequencyAdvisor_Phase(t *testing.T) {
+	advisor := newTestAdvisor()
+	// 0.5° of latitude is 30 NM
+	south := func(from sim.Coordinates, degrees float64) sim.Coordinates {
+		return sim.Coordinates{Lat: from.Lat - degrees, Lon: from.Lon}
+	}
+
+	assert.Equal(t, sim.PhasePreflight, advisor.Phase(aircraftAt(eddb, true, 157, 0)))
+	assert.Equal(t, sim.PhaseDeparture, advisor.Phase(aircraftAt(south(eddb, 0.5), false, 6000, 0)))
+	assert.Equal(t, sim.PhaseEnroute, advisor.Phase(aircraftAt(south(eddb, 0.5), false, 12000, 0)))
+	assert.Equal(t, sim.PhaseEnroute, advisor.Phase(aircraftAt(sim.Coordinates{Lat: 53, Lon: 11.7}, false, 24000, 0)))
+	assert.Equal(t, sim.PhaseApproach, advisor.Phase(aircraftAt(south(eddh, 0.5), false, 5000, 0)))
+	assert.Equal(t, sim.PhaseLanding, advisor.Phase(aircraftAt(south(eddh, 0.1), false, 1500, 0)))
+	assert.Equal(t, sim.PhaseTaxiIn, advisor.Phase(aircraftAt(eddh, true, 53, 0)))
+}
+
+func TestFrequencyAdvisor_Next(t *testing.T) {
+	advisor := newTestAdvisor()
+	climbing := sim.Coordinates{Lat: eddb.Lat - 0.3, Lon: eddb.Lon}
+	cruising := sim.Coordinates{Lat: 53, Lon: 11.7}
+
+	tests := []struct {
+		name  string
+		state sim.AircraftState
+		phase sim.FlightPhase
+		icao  string
+		hz    int
+	}{
+		{"parked starts with ATIS", aircraftAt(eddb, true, 157, 0), sim.PhasePreflight, "EDDB", 123080000},
+		{"ATIS then clearance", aircraftAt(eddb, true, 157, 123080000), sim.PhasePreflight, "EDDB", 121600000},
+		{"clearance then ground", aircraftAt(eddb, true, 157, 121600000), sim.PhasePreflight, "EDDB", 121880000},
+		{"ground then tower", aircraftAt(eddb, true, 157, 121880000), sim.PhasePreflight, "EDDB", 118800000},
+		{"tower then departure", aircraftAt(eddb, true, 157, 118800000), sim.PhaseDeparture, "EDDB", 119620000},
+		{"airborne still on tower", aircraftAt(climbing, false, 3000, 118800000), sim.PhaseDeparture, "EDDB", 119620000},
+		{"departure then center", aircraftAt(climbing, false, 3000, 119620000), sim.PhaseEnroute, "EDDB", 127725000},
+		// The destination has no center, the departure one is used all the way
+		{"center then approach", aircraftAt(cruising, false, 24000, 127725000), sim.PhaseApproach, "EDDH", 120600000},
+		{"approach then tower", aircraftAt(sim.Coordinates{Lat: eddh.Lat - 0.1, Lon: eddh.Lon}, false, 1500, 120600000), sim.PhaseLanding, "EDDH", 121275000},
+		{"landed then ground", aircraftAt(eddh, true, 53, 121275000), sim.PhaseTaxiIn, "EDDH", 121805000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			advice := advisor.Next(tt.state)
+
+			require.NotNil(t, advice)
+			assert.Equal(t, tt.phase, advice.Phase)
+			assert.Equal(t, tt.icao, advice.ICAO)
+			assert.Equal(t, tt.hz, advice.Frequency.Hz)
+		})
+	}
+
+	// Nothing follows ground at the destination
+	assert.Nil(t, advisor.Next(aircraftAt(eddh, true, 53, 121805000)))
+}
+
+func TestFrequencyAdvisor_NextSkipsMissing(t *testing.T) {
+	advisor := sim.NewFrequencyAdvisor(
+		sim.AdvisorAirport{ICAO: "EDAZ", Position: eddb, Frequencies: []sim.AirportFrequency{
+			{Type: "UNICOM", Hz: 122100000},
+		}},
+		sim.AdvisorAirport{ICAO: "EDHL", Position: eddh},
+	)
+
+	// No ATIS, clearance or ground: the tower is replaced by UNICOM
+	advice := advisor.Next(aircraftAt(eddb, true, 100, 0))
+	require.NotNil(t, advice)
+	assert.Equal(t, 122100000, advice.Frequency.Hz)
+
+	// The destination has no frequencies at all
+	assert.Nil(t, advisor.Next(aircraftAt(eddb, true, 100, 122100000)))
+}
@@ -0,0 +1,272 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// tunedToleranceHz is how far a radio may be from a frequency to count as tuned to it.
+// It is below half the 8.33 kHz channel spacing, the simulator reports 8.33 channels
+// by their real frequency while facilities use the channel name (118.705 is 118.7083 MHz).
+const tunedToleranceHz = 4000
+
+// AircraftState is the position and radio setup of the user aircraft
+type AircraftState struct {
+	Position    Coordinates `json:"position"`
+	Altitude    float64     `json:"altitude"`     // Feet above mean sea level
+	Heading     float64     `json:"heading"`      // Degrees magnetic
+	GroundSpeed float64     `json:"ground_speed"` // Knots
+	OnGround    bool        `json:"on_ground"`
+	COM1        Radio       `json:"com1"`
+	COM2        Radio       `json:"com2"`
+}
+
+// Radio is the active and standby frequency of a COM radio
+type Radio struct {
+	ActiveHz   int     `json:"active_hz"`
+	StandbyHz  int     `json:"standby_hz"`
+	ActiveMHz  float64 `json:"active_mhz"`
+	StandbyMHz float64 `json:"standby_mhz"`
+}
+
+// aircraftData is the SIMOBJECT_DATA payload of aircraftDefinition, one FLOAT64 per variable in order
+type aircraftData struct {
+	Latitude    float64
+	Longitude   float64
+	Altitude    float64
+	Heading     float64
+	GroundSpeed float64
+	OnGround    float64
+	COM1Active  float64
+	COM1Standby float64
+	COM2Active  float64
+	COM2Standby float64
+}
+
+// aircraftDefinition is the data definition used by GetAircraftState and WatchAircraft
+var aircraftDefinition = dataDefinition{
+	name: "aircraft state",
+	variables: []dataVariable{
+		{"PLANE LATITUDE", "degrees"},
+		{"PLANE LONGITUDE", "degrees"},
+		{"PLANE ALTITUDE", "feet"},
+		{"PLANE HEADING DEGREES MAGNETIC", "degrees"},
+		{"GROUND VELOCITY", "knots"},
+		{"SIM ON GROUND", "bool"},
+		{"COM ACTIVE FREQUENCY:1", "Hz"},
+		{"COM STANDBY FREQUENCY:1", "Hz"},
+		{"COM ACTIVE FREQUENCY:2", "Hz"},
+		{"COM STANDBY FREQUENCY:2", "Hz"},
+	},
+}
+
+// Tuned reports whether the active frequency of the radio is hz
+func (r Radio) Tuned(hz int) bool {
+	return r.ActiveHz != 0 && math.Abs(float64(r.ActiveHz-hz)) < tunedToleranceHz
+}
+
+// Tuned reports whether COM1 or COM2 of the aircraft is tuned to hz
+func (a AircraftState) Tuned(hz int) bool {
+	return a.COM1.Tuned(hz) || a.COM2.Tuned(hz)
+}
+
+// GetAircraftState retrieves the state of the user aircraft once, waiting at most timeout
+func (client *Client) GetAircraftState(timeout time.Duration) (*AircraftState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return client.GetAircraftStateCtx(ctx)
+}
+
+// GetAircraftStateCtx retrieves the state of the user aircraft once until ctx is done
+func (client *Client) GetAircraftStateCtx(ctx context.Context) (*AircraftState, error) {
+	var state *AircraftState
+	err := client.requestAircraft(ctx, SIMCONNECT_PERIOD_ONCE, 0, func(recv AircraftState) bool {
+		state = &recv
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// WatchAircraftCtx calls update with the state of the user aircraft whenever it changes,
+// at most once a second, until ctx is done. It returns nil when ctx is done and an error
+// when the simulator quits or rejects the request. update runs on the goroutine that
+// receives the data and must return quickly.
+func (client *Client) WatchAircraftCtx(ctx context.Context, update func(AircraftState)) error {
+	return client.requestAircraft(ctx, SIMCONNECT_PERIOD_SECOND, SIMCONNECT_DATA_REQUEST_FLAG_CHANGED, func(state AircraftState) bool {
+		update(state)
+		return true
+	})
+}
+
+// requestAircraft requests aircraftDefinition for the user aircraft and passes every state
+// received to handle until it returns false or ctx is done. Periodic requests are stopped on return.
+func (client *Client) requestAircraft(ctx context.Context, period, flags uint32, handle func(AircraftState) bool) error {
+	session := client.session
+	sub, err := session.subscribe(1)
+	if err != nil {
+		return err
+	}
+	defer sub.cancel()
+
+	defineID, err := session.defineData(sub, aircraftDefinition)
+	if err != nil {
+		return err
+	}
+
+	requestID := sub.requestIDs[0]
+	_, err = session.send(sub, func() error {
+		return session.connection.RequestDataOnSimObject(requestID, defineID, SIMCONNECT_OBJECT_ID_USER, period, flags)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to request aircraft data: %w", err)
+	}
+	if period != SIMCONNECT_PERIOD_ONCE {
+		// Fails harmlessly when the simulator quit and the connection is closed already
+		defer session.send(nil, func() error {
+			return session.connection.RequestDataOnSimObject(requestID, defineID, SIMCONNECT_OBJECT_ID_USER, SIMCONNECT_PERIOD_NEVER, 0)
+		})
+	}
+
+	for {
+		var d dispatch
+		select {
+		case d = <-sub.recv:
+		case <-ctx.Done():
+			if period == SIMCONNECT_PERIOD_ONCE {
+				return doneError(ctx, &TimeoutError{Waiting: "aircraft state"})
+			}
+			return nil
+		}
+
+		switch d.id {
+		case SIMCONNECT_RECV_ID_QUIT:
+			return errSimulatorQuit
+		case SIMCONNECT_RECV_ID_EXCEPTION:
+			return newExceptionError(d)
+		case SIMCONNECT_RECV_ID_SIMOBJECT_DATA:
+			state, err := decodeAircraft(d)
+			if err != nil {
+				return err
+			}
+			if !handle(state) {
+				return nil
+			}
+		}
+	}
+}
+
+// decodeAircraft decodes the aircraftData following the SIMCONNECT_RECV_SIMOBJECT_DATA header
+func decodeAircraft(d dispatch) (AircraftState, error) {
+	_, payload, err := decodeSimObjectData(d)
+	if err != nil {
+		return AircraftState{}, err
+	}
+	data, err := decodeFull[aircraftData](payload, "aircraft data")
+	if err != nil {
+		return AircraftState{}, err
+	}
+
+	return AircraftState{
+		Position:    Coordinates{Lat: data.Latitude, Lon: data.Longitude},
+		Altitude:    data.Altitude,
+		Heading:     data.Heading,
+		GroundSpeed: data.GroundSpeed,
+		OnGround:    data.OnGround != 0,
+		COM1:        newRadio(data.COM1Active, data.COM1Standby),
+		COM2:        newRadio(data.COM2Active, data.COM2Standby),
+	}, nil
+}
+
+func newRadio(active, standby float64) Radio {
+	activeHz, standbyHz := int(math.Round(active)), int(math.Round(standby))
+	return Radio{
+		ActiveHz:   activeHz,
+		StandbyHz:  standbyHz,
+		ActiveMHz:  float64(activeHz) / 1e6,
+		StandbyMHz: float64(standbyHz) / 1e6,
+	}
+}
+
+// AircraftSubscription delivers the latest state of the user aircraft until it ends
+type AircraftSubscription struct {
+	updates chan AircraftState
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error
+}
+
+// GetAircraftState retrieves the position and radios of the user aircraft
+func (s *Service) GetAircraftState() (*AircraftState, error) {
+	return s.GetAircraftStateCtx(context.Background())
+}
+
+// GetAircraftStateCtx retrieves the position and radios of the user aircraft until ctx is done
+func (s *Service) GetAircraftStateCtx(ctx context.Context) (*AircraftState, error) {
+	ctx, cancel := context.WithTimeout(ctx, clientTimeout)
+	defer cancel()
+
+	state, err := s.client.GetAircraftStateCtx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the aircraft state: %w", err)
+	}
+	return state, nil
+}
+
+// SubscribeAircraft streams the state of the user aircraft until the subscription is closed
+func (s *Service) SubscribeAircraft() *AircraftSubscription {
+	return s.SubscribeAircraftCtx(context.Background())
+}
+
+// SubscribeAircraftCtx streams the state of the user aircraft until ctx is done, the subscription
+// is closed or the simulator quits. Updates only keeps the latest state, a slow reader misses
+// states instead of holding up the other requests of the session.
+func (s *Service) SubscribeAircraftCtx(ctx context.Context) *AircraftSubscription {
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &AircraftSubscription{
+		updates: make(chan AircraftState, 1),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		defer close(sub.done)
+		defer close(sub.updates)
+
+		err := s.client.WatchAircraftCtx(ctx, func(state AircraftState) {
+			// Only this goroutine sends, after dropping a stale state there is room for the new one
+			select {
+			case <-sub.updates:
+			default:
+			}
+			sub.updates <- state
+		})
+		if err != nil {
+			sub.err = fmt.Errorf("failed to watch the aircraft: %w", err)
+		}
+	}()
+
+	return sub
+}
+
+// Updates returns the channel receiving the aircraft states, it is closed when the subscription ends
+func (sub *AircraftSubscription) Updates() <-chan AircraftState {
+	return sub.updates
+}
+
+// Err waits for the subscription to end and returns why it ended, nil when it was closed or its context is done
+func (sub *AircraftSubscription) Err() error {
+	<-sub.done
+	return sub.err
+}
+
+// Close ends the subscription and waits until the simulator stopped sending data
+func (sub *AircraftSubscription) Close() {
+	sub.cancel()
+	<-sub.done
+}
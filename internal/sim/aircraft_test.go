@@ -0,0 +1,137 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"atc_freq/internal/testutil"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRadio_Tuned(t *testing.T) {
+	radio := sim.Radio{ActiveHz: 118708333, StandbyHz: 121600000}
+
+	// The 8.33 kHz channel 118.705 is reported by its real frequency
+	assert.True(t, radio.Tuned(118705000))
+	assert.False(t, radio.Tuned(118700000))
+	assert.False(t, radio.Tuned(121600000), "standby doesn't count")
+	assert.False(t, sim.Radio{}.Tuned(0))
+
+	aircraft := sim.AircraftState{COM1: sim.Radio{ActiveHz: 121880000}, COM2: sim.Radio{ActiveHz: 123080000}}
+	assert.True(t, aircraft.Tuned(123080000))
+	assert.False(t, aircraft.Tuned(118800000))
+}
+
+func expectAircraftDefinition(m *sim.MockConnection) {
+	m.On("AddToDataDefinition", uint32(sim.FirstDefineID), mock.Anything, mock.Anything, uint32(sim.SIMCONNECT_DATATYPE_FLOAT64)).Return(nil).Times(10)
+}
+
+func TestClient_GetAircraftState(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	expectAircraftDefinition(mockConn)
+	mockConn.On("RequestDataOnSimObject", uint32(sim.FirstRequestID), uint32(sim.FirstDefineID), uint32(sim.SIMCONNECT_OBJECT_ID_USER), uint32(sim.SIMCONNECT_PERIOD_ONCE), uint32(0)).Return(nil).Once()
+	mockConn.On("GetNextDispatch").Return(testutil.CreateSimObjectDataResponse(sim.FirstRequestID, sim.FirstDefineID,
+		52.3622, 13.5122, 157, 245, 12.4, 1, 121880000, 118800000, 123080000, 121600000), true).Once()
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	state, err := client.GetAircraftState(5 * time.Second)
+	client.Close()
+
+	require.NoError(t, err)
+	assert.Equal(t, sim.AircraftState{
+		Position:    sim.Coordinates{Lat: 52.3622, Lon: 13.5122},
+		Altitude:    157,
+		Heading:     245,
+		GroundSpeed: 12.4,
+		OnGround:    true,
+		COM1:        sim.Radio{ActiveHz: 121880000, StandbyHz: 118800000, ActiveMHz: 121.88, StandbyMHz: 118.8},
+		COM2:        sim.Radio{ActiveHz: 123080000, StandbyHz: 121600000, ActiveMHz: 123.08, StandbyMHz: 121.6},
+	}, *state)
+	mockConn.AssertExpectations(t)
+}
+
+func TestClient_GetAircraftState_ShortData(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	expectAircraftDefinition(mockConn)
+	mockConn.On("RequestDataOnSimObject", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	mockConn.On("GetNextDispatch").Return(testutil.CreateSimObjectDataResponse(sim.FirstRequestID, sim.FirstDefineID, 52.3622, 13.5122), true).Once()
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	_, err := client.GetAircraftState(5 * time.Second)
+	client.Close()
+
+	assert.ErrorIs(t, err, sim.ErrMalformedDispatch)
+	var decodeErr *sim.DecodeError
+	require.ErrorAs(t, err, &decodeErr)
+	assert.Equal(t, 16, decodeErr.Size)
+}
+
+func TestClient_WatchAircraftCtx(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	expectAircraftDefinition(mockConn)
+	mockConn.On("RequestDataOnSimObject", uint32(sim.FirstRequestID), uint32(sim.FirstDefineID), uint32(sim.SIMCONNECT_OBJECT_ID_USER),
+		uint32(sim.SIMCONNECT_PERIOD_SECOND), uint32(sim.SIMCONNECT_DATA_REQUEST_FLAG_CHANGED)).Return(nil).Once()
+	for _, lat := range []float64{52.1, 52.2} {
+		mockConn.On("GetNextDispatch").Return(testutil.CreateSimObjectDataResponse(sim.FirstRequestID, sim.FirstDefineID,
+			lat, 13.5, 3000, 90, 100, 0, 118800000, 0, 0, 0), true).Once()
+	}
+	// An exception about a packet the watch didn't send is not its own
+	mockConn.On("GetNextDispatch").Return(testutil.CreateExceptionResponse(3, 99, 1), true).Once()
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	// The periodic request is stopped when the watch ends
+	mockConn.On("RequestDataOnSimObject", uint32(sim.FirstRequestID), uint32(sim.FirstDefineID), uint32(sim.SIMCONNECT_OBJECT_ID_USER),
+		uint32(sim.SIMCONNECT_PERIOD_NEVER), uint32(0)).Return(nil).Once()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	var latitudes []float64
+	err := client.WatchAircraftCtx(ctx, func(state sim.AircraftState) {
+		latitudes = append(latitudes, state.Position.Lat)
+		if len(latitudes) == 2 {
+			// Give the exception time to arrive before the watch ends
+			time.AfterFunc(50*time.Millisecond, cancel)
+		}
+	})
+	client.Close()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{52.1, 52.2}, latitudes)
+	mockConn.AssertExpectations(t)
+}
+
+func TestClient_WatchAircraftCtx_Quit(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	expectAircraftDefinition(mockConn)
+	mockConn.On("RequestDataOnSimObject", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockConn.On("GetNextDispatch").Return(testutil.CreateQuitResponse(), true).Once()
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	err := client.WatchAircraftCtx(context.Background(), func(sim.AircraftState) {})
+	client.Close()
+
+	assert.ErrorIs(t, err, sim.ErrNotConnected)
+}
@@ -0,0 +1,357 @@
+package sim
+
+import (
+	"atc_freq/internal/helpers"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	feetPerMeter = 3.28084
+)
+
+// FACILITY_AIRPORT_DATA is the layout of the AIRPORT record of airportDetailsDefinition.
+// SimConnect packs the fields in the order they were added, 8 byte fields come first
+// so the Go struct has no padding.
+type FACILITY_AIRPORT_DATA struct {
+	LATITUDE        float64  `facility:"LATITUDE"`
+	LONGITUDE       float64  `facility:"LONGITUDE"`
+	ALTITUDE        float64  `facility:"ALTITUDE"` // Meters
+	TOWER_LATITUDE  float64  `facility:"TOWER_LATITUDE"`
+	TOWER_LONGITUDE float64  `facility:"TOWER_LONGITUDE"`
+	TOWER_ALTITUDE  float64  `facility:"TOWER_ALTITUDE"` // Meters
+	MAGVAR          float32  `facility:"MAGVAR"`         // Degrees
+	N_RUNWAYS       int32    `facility:"N_RUNWAYS"`
+	ICAO            [8]byte  `facility:"ICAO"`
+	NAME64          [64]byte `facility:"NAME64"`
+}
+
+// FACILITY_RUNWAY_DATA is the layout of the RUNWAY records of airportDetailsDefinition
+type FACILITY_RUNWAY_DATA struct {
+	LATITUDE             float64 `facility:"LATITUDE"`
+	LONGITUDE            float64 `facility:"LONGITUDE"`
+	ALTITUDE             float64 `facility:"ALTITUDE"` // Meters
+	HEADING              float32 `facility:"HEADING"`  // Degrees true of the primary end
+	LENGTH               float32 `facility:"LENGTH"`   // Meters
+	WIDTH                float32 `facility:"WIDTH"`    // Meters
+	SURFACE              int32   `facility:"SURFACE"`
+	PRIMARY_NUMBER       int32   `facility:"PRIMARY_NUMBER"`
+	PRIMARY_DESIGNATOR   int32   `facility:"PRIMARY_DESIGNATOR"`
+	SECONDARY_NUMBER     int32   `facility:"SECONDARY_NUMBER"`
+	SECONDARY_DESIGNATOR int32   `facility:"SECONDARY_DESIGNATOR"`
+	PRIMARY_ILS_ICAO     [8]byte `facility:"PRIMARY_ILS_ICAO"`
+	PRIMARY_ILS_REGION   [8]byte `facility:"PRIMARY_ILS_REGION"`
+	SECONDARY_ILS_ICAO   [8]byte `facility:"SECONDARY_ILS_ICAO"`
+	SECONDARY_ILS_REGION [8]byte `facility:"SECONDARY_ILS_REGION"`
+}
+
+// FACILITY_VOR_DATA is the layout of the VOR record of ilsDefinition
+type FACILITY_VOR_DATA struct {
+	FREQUENCY         int32    `facility:"FREQUENCY"`         // Hz
+	LOCALIZER         int32    `facility:"LOCALIZER"`         // Non-zero when the navaid has a localizer
+	LOCALIZER_HEADING float32  `facility:"LOCALIZER_HEADING"` // Degrees true
+	HAS_GLIDE_SLOPE   int32    `facility:"HAS_GLIDE_SLOPE"`
+	GLIDE_SLOPE       float32  `facility:"GLIDE_SLOPE"` // Degrees
+	NAME              [64]byte `facility:"NAME"`
+}
+
+// Airport holds the details of an airport facility
+type Airport struct {
+	ICAO      string         `json:"icao"`
+	Name      string         `json:"name"`
+	Position  Coordinates    `json:"position"`
+	Elevation float64        `json:"elevation"` // Feet
+	MagVar    float64        `json:"magvar"`    // Magnetic variation in degrees, east positive
+	Tower     *TowerPosition `json:"tower"`     // nil when the airport has no tower
+	Runways   []Runway       `json:"runways"`
+}
+
+// TowerPosition is the location of the control tower
+type TowerPosition struct {
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	Altitude float64 `json:"altitude"` // Feet
+}
+
+// Runway is a physical runway with its two ends
+type Runway struct {
+	Designator  string      `json:"designator"` // Both ends, e.g. 07L/25R
+	Primary     RunwayEnd   `json:"primary"`
+	Secondary   RunwayEnd   `json:"secondary"`
+	Position    Coordinates `json:"position"`  // Center of the runway
+	Elevation   float64     `json:"elevation"` // Feet
+	Length      float64     `json:"length"`    // Feet
+	Width       float64     `json:"width"`     // Feet
+	Surface     string      `json:"surface"`
+	SurfaceCode int32       `json:"surface_code"`
+}
+
+// RunwayEnd is one landing direction of a runway
+type RunwayEnd struct {
+	Designator      string  `json:"designator"`       // e.g. 07L
+	Heading         float64 `json:"heading"`          // Degrees true
+	MagneticHeading float64 `json:"magnetic_heading"` // Degrees magnetic
+	ILS             *ILS    `json:"ils"`              // nil when the end has no ILS
+}
+
+// ILS is the instrument landing system serving a runway end
+type ILS struct {
+	Ident         string  `json:"ident"`
+	Name          string  `json:"name"`
+	Hz            int     `json:"hz"`
+	MHz           float64 `json:"mhz"`
+	Course        float64 `json:"course"` // Localizer course in degrees magnetic
+	HasGlideSlope bool    `json:"has_glide_slope"`
+	GlideSlope    float64 `json:"glide_slope"` // Glide slope angle in degrees
+}
+
+// airportDetails is the tree of airportDetailsDefinition
+type airportDetails struct {
+	FACILITY_AIRPORT_DATA
+	Runways []FACILITY_RUNWAY_DATA `facility:"RUNWAY"`
+}
+
+// airportDetailsDefinition is the facility definition used by GetAirportDetails
+var airportDetailsDefinition = MustFacilityDefinition[airportDetails]("airport details", "AIRPORT")
+
+// ilsDefinition is the facility definition used to look up the ILS of a runway end
+var ilsDefinition = MustFacilityDefinition[FACILITY_VOR_DATA]("ils", "VOR")
+
+// runwayDesignators maps the SimConnect runway designator enum to its suffix
+var runwayDesignators = map[int32]string{
+	0: "",
+	1: "L",
+	2: "R",
+	3: "C",
+	4: "W",
+	5: "A",
+	6: "B",
+}
+
+// runwayCompassNumbers maps the runway numbers above 36 to compass directions
+var runwayCompassNumbers = map[int32]string{
+	37: "N",
+	38: "NE",
+	39: "E",
+	40: "SE",
+	41: "S",
+	42: "SW",
+	43: "W",
+	44: "NW",
+}
+
+var runwaySurfaceMap = map[int32]string{
+	0:  "CONCRETE",
+	1:  "GRASS",
+	2:  "WATER",
+	3:  "GRASS_BUMPY",
+	4:  "ASPHALT",
+	5:  "SHORT_GRASS",
+	6:  "LONG_GRASS",
+	7:  "HARD_TURF",
+	8:  "SNOW",
+	9:  "ICE",
+	10: "URBAN",
+	11: "FOREST",
+	12: "DIRT",
+	13: "CORAL",
+	14: "GRAVEL",
+	15: "OIL_TREATED",
+	16: "STEEL_MATS",
+	17: "BITUMINOUS",
+	18: "BRICK",
+	19: "MACADAM",
+	20: "PLANKS",
+	21: "SAND",
+	22: "SHALE",
+	23: "TARMAC",
+}
+
+// GetAirportDetails retrieves name, elevation, tower and runways of an airport, waiting at most timeout
+func (client *Client) GetAirportDetails(icao string, timeout time.Duration) (*Airport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return client.GetAirportDetailsCtx(ctx, icao)
+}
+
+// GetAirportDetailsCtx retrieves name, elevation, tower and runways of an airport until ctx is done.
+// The ILS of every runway end is looked up with a second request.
+func (client *Client) GetAirportDetailsCtx(ctx context.Context, icao string) (*Airport, error) {
+	icao = strings.ToUpper(strings.TrimSpace(icao))
+	if icao == "" {
+		return nil, fmt.Errorf("icao is empty")
+	}
+
+	airport, ilsRefs, err := client.requestAirport(ctx, icao)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ilsRefs) == 0 {
+		return airport, nil
+	}
+
+	ils, err := client.requestILS(ctx, ilsRefs, airport.MagVar)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range airport.Runways {
+		for _, end := range []*RunwayEnd{&airport.Runways[i].Primary, &airport.Runways[i].Secondary} {
+			if end.ILS == nil {
+				continue
+			}
+			if found, ok := ils[end.ILS.Ident]; ok {
+				found := *found
+				end.ILS = &found
+			}
+		}
+	}
+
+	return airport, nil
+}
+
+// requestAirport requests the airport and runway records. Runway ends with an ILS get an
+// ILS holding only its ident, the returned refs list the ILS facilities to look up.
+func (client *Client) requestAirport(ctx context.Context, icao string) (*Airport, []FacilityRef, error) {
+	details, err := RequestFacility(ctx, client, airportDetailsDefinition, icao, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	airport := decodeAirport(&details.FACILITY_AIRPORT_DATA)
+
+	var refs []FacilityRef
+	seen := make(map[string]bool)
+	for i := range details.Runways {
+		data := &details.Runways[i]
+		airport.Runways = append(airport.Runways, decodeRunway(data, airport.MagVar))
+
+		for _, ref := range []FacilityRef{
+			{Ident: helpers.TrimCString(data.PRIMARY_ILS_ICAO[:]), Region: helpers.TrimCString(data.PRIMARY_ILS_REGION[:])},
+			{Ident: helpers.TrimCString(data.SECONDARY_ILS_ICAO[:]), Region: helpers.TrimCString(data.SECONDARY_ILS_REGION[:])},
+		} {
+			if ref.Ident != "" && !seen[ref.Ident] {
+				seen[ref.Ident] = true
+				refs = append(refs, ref)
+			}
+		}
+	}
+
+	return airport, refs, nil
+}
+
+// requestILS looks up the frequency and course of the ILS facilities, ILS the simulator doesn't know are left out
+func (client *Client) requestILS(ctx context.Context, refs []FacilityRef, magVar float64) (map[string]*ILS, error) {
+	records, err := RequestFacilities(ctx, client, ilsDefinition, refs)
+	var unknown *UnknownFacilityError
+	if err != nil && !errors.As(err, &unknown) {
+		return nil, err
+	}
+
+	result := make(map[string]*ILS, len(records))
+	for ident, data := range records {
+		result[ident] = decodeILS(ident, data, magVar)
+	}
+	return result, nil
+}
+
+func decodeAirport(data *FACILITY_AIRPORT_DATA) *Airport {
+	airport := &Airport{
+		ICAO:      helpers.TrimCString(data.ICAO[:]),
+		Name:      helpers.TrimCString(data.NAME64[:]),
+		Position:  Coordinates{Lat: data.LATITUDE, Lon: data.LONGITUDE},
+		Elevation: data.ALTITUDE * feetPerMeter,
+		MagVar:    float64(data.MAGVAR),
+		Runways:   []Runway{},
+	}
+
+	// Airports without a tower report it at 0,0
+	if data.TOWER_LATITUDE != 0 || data.TOWER_LONGITUDE != 0 {
+		airport.Tower = &TowerPosition{
+			Lat:      data.TOWER_LATITUDE,
+			Lon:      data.TOWER_LONGITUDE,
+			Altitude: data.TOWER_ALTITUDE * feetPerMeter,
+		}
+	}
+
+	return airport
+}
+
+func decodeRunway(data *FACILITY_RUNWAY_DATA, magVar float64) Runway {
+	heading := normalizeHeading(float64(data.HEADING))
+	primary := runwayEndDesignator(data.PRIMARY_NUMBER, data.PRIMARY_DESIGNATOR)
+	secondary := runwayEndDesignator(data.SECONDARY_NUMBER, data.SECONDARY_DESIGNATOR)
+
+	surface := runwaySurfaceMap[data.SURFACE]
+	if surface == "" {
+		surface = fmt.Sprintf("UNKNOWN_%d", data.SURFACE)
+	}
+
+	runway := Runway{
+		Designator: primary + "/" + secondary,
+		Primary: RunwayEnd{
+			Designator:      primary,
+			Heading:         heading,
+			MagneticHeading: normalizeHeading(heading - magVar),
+		},
+		Secondary: RunwayEnd{
+			Designator:      secondary,
+			Heading:         normalizeHeading(heading + 180),
+			MagneticHeading: normalizeHeading(heading + 180 - magVar),
+		},
+		Position:    Coordinates{Lat: data.LATITUDE, Lon: data.LONGITUDE},
+		Elevation:   data.ALTITUDE * feetPerMeter,
+		Length:      float64(data.LENGTH) * feetPerMeter,
+		Width:       float64(data.WIDTH) * feetPerMeter,
+		Surface:     surface,
+		SurfaceCode: data.SURFACE,
+	}
+
+	if ident := helpers.TrimCString(data.PRIMARY_ILS_ICAO[:]); ident != "" {
+		runway.Primary.ILS = &ILS{Ident: ident}
+	}
+	if ident := helpers.TrimCString(data.SECONDARY_ILS_ICAO[:]); ident != "" {
+		runway.Secondary.ILS = &ILS{Ident: ident}
+	}
+
+	return runway
+}
+
+func decodeILS(ident string, data *FACILITY_VOR_DATA, magVar float64) *ILS {
+	hz := int(data.FREQUENCY)
+	ils := &ILS{
+		Ident:         ident,
+		Name:          helpers.TrimCString(data.NAME[:]),
+		Hz:            hz,
+		MHz:           helpers.HzToMHz(hz),
+		HasGlideSlope: data.HAS_GLIDE_SLOPE != 0,
+		GlideSlope:    float64(data.GLIDE_SLOPE),
+	}
+	if data.LOCALIZER != 0 {
+		ils.Course = normalizeHeading(float64(data.LOCALIZER_HEADING) - magVar)
+	}
+	return ils
+}
+
+// runwayEndDesignator formats a runway number and designator, e.g. 7 and LEFT as 07L
+func runwayEndDesignator(number, designator int32) string {
+	if compass, ok := runwayCompassNumbers[number]; ok {
+		return compass
+	}
+	return fmt.Sprintf("%02d%s", number, runwayDesignators[designator])
+}
+
+// normalizeHeading returns heading in [0, 360)
+func normalizeHeading(heading float64) float64 {
+	heading = math.Mod(heading, 360)
+	if heading < 0 {
+		heading += 360
+	}
+	return heading
+}
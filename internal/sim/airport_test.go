@@ -0,0 +1,214 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"atc_freq/internal/testutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var eddbAirport = testutil.Airport{
+	ICAO:      "EDDB",
+	Name:      "Berlin Brandenburg",
+	Lat:       52.3514,
+	Lon:       13.4939,
+	AltitudeM: 48,
+	MagVar:    4.5,
+	TowerLat:  52.3625,
+	TowerLon:  13.5008,
+	TowerAltM: 120,
+	NRunways:  2,
+}
+
+var eddbRunway07L = testutil.Runway{
+	Lat:                 52.3622,
+	Lon:                 13.4896,
+	AltitudeM:           45,
+	Heading:             69.5,
+	LengthM:             3600,
+	WidthM:              45,
+	Surface:             4,
+	PrimaryNumber:       7,
+	PrimaryDesignator:   1,
+	SecondaryNumber:     25,
+	SecondaryDesignator: 2,
+	PrimaryILS:          "IBWL",
+	SecondaryILS:        "IBER",
+	Region:              "ED",
+}
+
+var eddbRunway07R = testutil.Runway{
+	Lat:                 52.3422,
+	Lon:                 13.5235,
+	AltitudeM:           47,
+	Heading:             69.5,
+	LengthM:             4000,
+	WidthM:              60,
+	Surface:             0,
+	PrimaryNumber:       7,
+	PrimaryDesignator:   2,
+	SecondaryNumber:     25,
+	SecondaryDesignator: 1,
+}
+
+func TestClient_GetAirportDetails(t *testing.T) {
+	tests := []struct {
+		name            string
+		icao            string
+		mockSetup       func(*sim.MockConnection)
+		expectedAirport func(*testing.T, *sim.Airport)
+		expectedError   string
+	}{
+		{
+			name: "airport with runways and ILS",
+			icao: "eddb",
+			mockSetup: func(m *sim.MockConnection) {
+				m.On("Open", "atc-freq").Return(nil).Once()
+
+				// Airport and runway definition, then the ILS definition
+				m.On("AddField", mock.Anything, uint32(sim.FirstDefineID)).Return(nil).Times(29)
+				m.On("AddField", mock.Anything, uint32(sim.FirstDefineID+1)).Return(nil).Times(8)
+
+				m.On("RequestFacilityData", "EDDB", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once()
+
+				// ILS data is only delivered after both ILS were requested
+				ilsRequested := make(chan time.Time)
+				m.On("RequestFacilityData", "IBWL", "ED", uint32(sim.FirstDefineID+1), uint32(sim.FirstRequestID+1)).Return(nil).Once()
+				m.On("RequestFacilityData", "IBER", "ED", uint32(sim.FirstDefineID+1), uint32(sim.FirstRequestID+2)).Return(nil).Once().
+					Run(func(mock.Arguments) { close(ilsRequested) })
+
+				// Runways arrive out of order, they are sorted by their list index
+				m.On("GetNextDispatch").Return(testutil.CreateAirportDataResponse(sim.FirstRequestID, eddbAirport), true).Once()
+				m.On("GetNextDispatch").Return(testutil.CreateRunwayDataResponse(sim.FirstRequestID, 1, 2, eddbRunway07R), true).Once()
+				m.On("GetNextDispatch").Return(testutil.CreateRunwayDataResponse(sim.FirstRequestID, 0, 2, eddbRunway07L), true).Once()
+				m.On("GetNextDispatch").Return(testutil.CreateFacilityDataEndResponse(sim.FirstRequestID), true).Once()
+
+				m.On("GetNextDispatch").Return(testutil.CreateILSDataResponse(sim.FirstRequestID+1, testutil.ILS{
+					Hz: 109500000, LocalizerHeading: 69.5, GlideSlope: 3, Name: "ILS RW07L",
+				}), true).Once().WaitUntil(ilsRequested)
+				m.On("GetNextDispatch").Return(testutil.CreateFacilityDataEndResponse(sim.FirstRequestID+1), true).Once()
+				m.On("GetNextDispatch").Return(testutil.CreateILSDataResponse(sim.FirstRequestID+2, testutil.ILS{
+					Hz: 110100000, LocalizerHeading: 249.5, Name: "ILS RW25R",
+				}), true).Once()
+				m.On("GetNextDispatch").Return(testutil.CreateFacilityDataEndResponse(sim.FirstRequestID+2), true).Once()
+				m.On("GetNextDispatch").Return(nil, false).Maybe()
+
+				m.On("Close").Return().Once()
+			},
+			expectedAirport: func(t *testing.T, airport *sim.Airport) {
+				assert.Equal(t, "EDDB", airport.ICAO)
+				assert.Equal(t, "Berlin Brandenburg", airport.Name)
+				assert.Equal(t, sim.Coordinates{Lat: 52.3514, Lon: 13.4939}, airport.Position)
+				assert.InDelta(t, 157.5, airport.Elevation, 0.1)
+				assert.InDelta(t, 4.5, airport.MagVar, 0.001)
+				require.NotNil(t, airport.Tower)
+				assert.InDelta(t, 52.3625, airport.Tower.Lat, 0.0001)
+				assert.InDelta(t, 393.7, airport.Tower.Altitude, 0.1)
+
+				require.Len(t, airport.Runways, 2)
+
+				rwy := airport.Runways[0]
+				assert.Equal(t, "07L/25R", rwy.Designator)
+				assert.Equal(t, "ASPHALT", rwy.Surface)
+				assert.InDelta(t, 11811, rwy.Length, 1)
+				assert.InDelta(t, 147.6, rwy.Width, 0.1)
+				assert.Equal(t, "07L", rwy.Primary.Designator)
+				assert.InDelta(t, 69.5, rwy.Primary.Heading, 0.001)
+				assert.InDelta(t, 65, rwy.Primary.MagneticHeading, 0.001)
+				assert.Equal(t, "25R", rwy.Secondary.Designator)
+				assert.InDelta(t, 249.5, rwy.Secondary.Heading, 0.001)
+				assert.InDelta(t, 245, rwy.Secondary.MagneticHeading, 0.001)
+
+				require.NotNil(t, rwy.Primary.ILS)
+				assert.Equal(t, sim.ILS{Ident: "IBWL", Name: "ILS RW07L", Hz: 109500000, MHz: 109.5, Course: 65, HasGlideSlope: true, GlideSlope: 3}, *rwy.Primary.ILS)
+				require.NotNil(t, rwy.Secondary.ILS)
+				assert.Equal(t, "IBER", rwy.Secondary.ILS.Ident)
+				assert.InDelta(t, 110.1, rwy.Secondary.ILS.MHz, 0.0001)
+				assert.InDelta(t, 245, rwy.Secondary.ILS.Course, 0.001)
+				assert.False(t, rwy.Secondary.ILS.HasGlideSlope)
+
+				rwy = airport.Runways[1]
+				assert.Equal(t, "07R/25L", rwy.Designator)
+				assert.Equal(t, "CONCRETE", rwy.Surface)
+				assert.Nil(t, rwy.Primary.ILS)
+				assert.Nil(t, rwy.Secondary.ILS)
+			},
+		},
+		{
+			name: "airport without ILS or tower",
+			icao: "EDAZ",
+			mockSetup: func(m *sim.MockConnection) {
+				m.On("Open", "atc-freq").Return(nil).Once()
+				m.On("AddField", mock.Anything, uint32(sim.FirstDefineID)).Return(nil).Times(29)
+				m.On("RequestFacilityData", "EDAZ", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once()
+
+				m.On("GetNextDispatch").Return(testutil.CreateAirportDataResponse(sim.FirstRequestID, testutil.Airport{
+					ICAO: "EDAZ", Name: "Schonhagen", Lat: 52.2036, Lon: 13.1586, AltitudeM: 40, MagVar: 4, NRunways: 1,
+				}), true).Once()
+				m.On("GetNextDispatch").Return(testutil.CreateRunwayDataResponse(sim.FirstRequestID, 0, 1, testutil.Runway{
+					Heading: 250, LengthM: 800, WidthM: 30, Surface: 1, PrimaryNumber: 25, SecondaryNumber: 7,
+				}), true).Once()
+				m.On("GetNextDispatch").Return(testutil.CreateFacilityDataEndResponse(sim.FirstRequestID), true).Once()
+				m.On("GetNextDispatch").Return(nil, false).Maybe()
+
+				m.On("Close").Return().Once()
+			},
+			expectedAirport: func(t *testing.T, airport *sim.Airport) {
+				assert.Equal(t, "Schonhagen", airport.Name)
+				assert.Nil(t, airport.Tower)
+				require.Len(t, airport.Runways, 1)
+				assert.Equal(t, "25/07", airport.Runways[0].Designator)
+				assert.Equal(t, "GRASS", airport.Runways[0].Surface)
+				assert.InDelta(t, 70, airport.Runways[0].Secondary.Heading, 0.001)
+				assert.InDelta(t, 66, airport.Runways[0].Secondary.MagneticHeading, 0.001)
+			},
+		},
+		{
+			name: "unknown icao",
+			icao: "XXXX",
+			mockSetup: func(m *sim.MockConnection) {
+				m.On("Open", "atc-freq").Return(nil).Once()
+				m.On("AddField", mock.Anything, uint32(sim.FirstDefineID)).Return(nil).Times(29)
+				m.On("RequestFacilityData", "XXXX", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once()
+				m.On("GetNextDispatch").Return(testutil.CreateFacilityDataEndResponse(sim.FirstRequestID), true).Once()
+				m.On("GetNextDispatch").Return(nil, false).Maybe()
+				m.On("Close").Return().Once()
+			},
+			expectedError: "unknown facility: [XXXX]",
+		},
+		{
+			name: "empty icao",
+			icao: " ",
+			mockSetup: func(m *sim.MockConnection) {
+				// No expectations - should fail before any calls
+			},
+			expectedError: "icao is empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockConn := new(sim.MockConnection)
+			tt.mockSetup(mockConn)
+
+			client := sim.NewClient(mockConn)
+
+			airport, err := client.GetAirportDetails(tt.icao, 5*time.Second)
+			client.Close()
+
+			if tt.expectedError != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+			} else {
+				require.NoError(t, err)
+				tt.expectedAirport(t, airport)
+			}
+
+			mockConn.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package sim
+
+import (
+	"sort"
+)
+
+// Briefing is a pre-flight briefing for the airports of a route
+type Briefing struct {
+	Airports []AirportBriefing `json:"airports"` // In route order
+	Unknown  []string          `json:"unknown"`  // Route entries the simulator has no airport for
+	Worst    FlightCategory    `json:"worst"`    // Worst flight category of the airports
+}
+
+// AirportBriefing collects what a crew needs to know about one airport of the route
+type AirportBriefing struct {
+	ICAO           string             `json:"icao"`
+	Name           string             `json:"name"`
+	Weather        *Weather           `json:"weather"`                   // nil when the airport has no weather station
+	Runway         *RunwayWind        `json:"runway"`                    // Recommended runway end, nil when the airport has no runways
+	Frequencies    []AirportFrequency `json:"frequencies"`               // In phase of flight order, see SortByPhase
+	FrequencyError string             `json:"frequency_error,omitempty"` // Why the simulator didn't answer Frequencies
+	Clouds         []CloudDensity     `json:"clouds"`                    // From the ground up
+	CloudFailures  []CloudBandFailure `json:"cloud_failures,omitempty"`  // Levels of Clouds the simulator didn't answer
+}
+
+// phaseRank orders frequency types the way they are used from departure to arrival.
+// Types not listed here follow in the order the simulator returned them.
+var phaseRank = map[string]int{
+	"ATIS":      1,
+	"AWOS":      2,
+	"ASOS":      3,
+	"CLEARANCE": 4,
+	"GROUND":    5,
+	"TOWER":     6,
+	"CTAF":      7,
+	"UNICOM":    8,
+	"MULTICOM":  9,
+	"DEPARTURE": 10,
+	"CENTER":    11,
+	"APPROACH":  12,
+}
+
+// SortByPhase orders frequencies in phase of flight order: ATIS, clearance, ground, tower,
+// departure and approach. The input slice is not modified.
+func SortByPhase(freqs []AirportFrequency) []AirportFrequency {
+	sorted := append([]AirportFrequency(nil), freqs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return rank(sorted[i].Type) < rank(sorted[j].Type)
+	})
+	return sorted
+}
+
+func rank(freqType string) int {
+	if r, ok := phaseRank[freqType]; ok {
+		return r
+	}
+	return len(phaseRank) + 1
+}
@@ -0,0 +1,30 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortByPhase(t *testing.T) {
+	freqs := []sim.AirportFrequency{
+		{Type: "APPROACH", Name: "Director"},
+		{Type: "TOWER", Name: "Tower"},
+		{Type: "FSS", Name: "Radio"},
+		{Type: "DEPARTURE", Name: "Departure"},
+		{Type: "ATIS", Name: "ATIS"},
+		{Type: "GROUND", Name: "Ground"},
+		{Type: "CLEARANCE", Name: "Delivery"},
+		{Type: "TOWER", Name: "Tower 2"},
+	}
+
+	var names []string
+	for _, f := range sim.SortByPhase(freqs) {
+		names = append(names, f.Name)
+	}
+
+	// Types without a phase go last, equal types keep the simulator order
+	assert.Equal(t, []string{"ATIS", "Delivery", "Ground", "Tower", "Tower 2", "Departure", "Director", "Radio"}, names)
+	assert.Equal(t, "Director", freqs[0].Name, "input is not modified")
+}
@@ -0,0 +1,277 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheKind groups the cached responses that share a TTL
+type CacheKind string
+
+const (
+	CacheFacilities CacheKind = "facilities" // Frequencies, airport details and waypoint positions
+	CacheWeather    CacheKind = "weather"    // METARs
+	CacheClouds     CacheKind = "clouds"     // Cloud density layers
+)
+
+// CacheForever keeps entries until they are invalidated, a TTL of zero or less disables the cache
+const CacheForever time.Duration = math.MaxInt64
+
+// DefaultCacheTTLs keeps facility data for the whole session, it doesn't change while the simulator
+// runs. METARs are updated every few minutes and clouds drift, so they expire sooner.
+var DefaultCacheTTLs = map[CacheKind]time.Duration{
+	CacheFacilities: CacheForever,
+	CacheWeather:    5 * time.Minute,
+	CacheClouds:     time.Minute,
+}
+
+// CacheStats counts how the requests of one CacheKind were answered. Batch requests count every
+// identifier on its own.
+type CacheStats struct {
+	Hits      int `json:"hits"`      // Answered from the cache
+	Misses    int `json:"misses"`    // Asked the simulator
+	Coalesced int `json:"coalesced"` // Waited for an identical request in flight instead of asking again
+	Entries   int `json:"entries"`   // Entries held, expired ones included until they are replaced
+}
+
+type cacheKey struct {
+	kind CacheKind
+	key  string
+}
+
+type cacheEntry struct {
+	value   any
+	expires time.Time // Zero for CacheForever
+}
+
+// cacheCall is a request in flight, identical requests wait for it instead of asking again
+type cacheCall struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// cache holds Service responses by kind and key and coalesces identical concurrent requests.
+// Cached values are shared between callers and must not be modified.
+type cache struct {
+	mu          sync.Mutex
+	ttls        map[CacheKind]time.Duration
+	entries     map[cacheKey]cacheEntry
+	calls       map[cacheKey]*cacheCall
+	stats       map[CacheKind]*CacheStats
+	generations map[CacheKind]int // Bumped by invalidate, so requests in flight don't store stale data
+	now         func() time.Time
+}
+
+func newCache(ttls map[CacheKind]time.Duration) *cache {
+	c := &cache{
+		ttls:        make(map[CacheKind]time.Duration),
+		entries:     make(map[cacheKey]cacheEntry),
+		calls:       make(map[cacheKey]*cacheCall),
+		stats:       make(map[CacheKind]*CacheStats),
+		generations: make(map[CacheKind]int),
+		now:         time.Now,
+	}
+	for kind, ttl := range ttls {
+		c.ttls[kind] = ttl
+	}
+	return c
+}
+
+// setTTL changes the TTL of kind, entries already cached keep their expiry
+func (c *cache) setTTL(kind CacheKind, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ttls[kind] = ttl
+}
+
+// invalidate drops the entries of kinds, of every kind when none is given
+func (c *cache) invalidate(kinds ...CacheKind) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if len(kinds) == 0 || slices.Contains(kinds, key.kind) {
+			delete(c.entries, key)
+		}
+	}
+	for kind := range c.ttls {
+		if len(kinds) == 0 || slices.Contains(kinds, kind) {
+			c.generations[kind]++
+		}
+	}
+}
+
+// snapshot returns the stats of every kind with a TTL
+func (c *cache) snapshot() map[CacheKind]CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make(map[CacheKind]CacheStats, len(c.ttls))
+	for kind := range c.ttls {
+		result[kind] = *c.statsOf(kind)
+	}
+	for key := range c.entries {
+		stats := result[key.kind]
+		stats.Entries++
+		result[key.kind] = stats
+	}
+	return result
+}
+
+// statsOf returns the stats of kind, c.mu must be held
+func (c *cache) statsOf(kind CacheKind) *CacheStats {
+	stats, ok := c.stats[kind]
+	if !ok {
+		stats = &CacheStats{}
+		c.stats[kind] = stats
+	}
+	return stats
+}
+
+// lookup returns the entry of key unless it expired, c.mu must be held
+func (c *cache) lookup(key cacheKey) (any, bool) {
+	entry, ok := c.entries[key]
+	if !ok || (!entry.expires.IsZero() && !c.now().Before(entry.expires)) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// store caches value under key unless the kind was invalidated since generation, c.mu must be held
+func (c *cache) store(key cacheKey, value any, generation int) {
+	ttl := c.ttls[key.kind]
+	if ttl <= 0 || c.generations[key.kind] != generation {
+		return
+	}
+
+	entry := cacheEntry{value: value}
+	if ttl != CacheForever {
+		entry.expires = c.now().Add(ttl)
+	}
+	c.entries[key] = entry
+}
+
+// do runs fetch once for all concurrent callers of the same key. It returns what fetch returned,
+// store is called with its results under c.mu before the waiting callers are released.
+// Callers that waited for a request whose caller gave up ask again with their own context.
+func (c *cache) do(ctx context.Context, key cacheKey, items int, fetch func(context.Context) (any, error), store func(value any, err error, generation int)) (any, error) {
+	for {
+		c.mu.Lock()
+		if call, inFlight := c.calls[key]; inFlight {
+			c.statsOf(key.kind).Coalesced += items
+			c.mu.Unlock()
+
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if isContextError(call.err) && ctx.Err() == nil {
+				continue
+			}
+			return call.value, call.err
+		}
+
+		call := &cacheCall{done: make(chan struct{})}
+		c.calls[key] = call
+		c.statsOf(key.kind).Misses += items
+		generation := c.generations[key.kind]
+		c.mu.Unlock()
+
+		call.value, call.err = fetch(ctx)
+
+		c.mu.Lock()
+		store(call.value, call.err, generation)
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(call.done)
+
+		return call.value, call.err
+	}
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// cached returns the value of key from the cache or fetches it, failed requests are not cached
+func cached[T any](ctx context.Context, c *cache, kind CacheKind, key string, fetch func(context.Context) (T, error)) (T, error) {
+	k := cacheKey{kind: kind, key: key}
+
+	c.mu.Lock()
+	if value, ok := c.lookup(k); ok {
+		c.statsOf(kind).Hits++
+		c.mu.Unlock()
+		return value.(T), nil
+	}
+	c.mu.Unlock()
+
+	value, err := c.do(ctx, k, 1,
+		func(ctx context.Context) (any, error) { return fetch(ctx) },
+		func(value any, err error, generation int) {
+			if err == nil {
+				c.store(k, value, generation)
+			}
+		})
+	if value == nil {
+		var zero T
+		return zero, err
+	}
+	return value.(T), err
+}
+
+// cachedBatch returns the values of idents found in the cache and fetches the others in one request.
+// Entries are stored under prefix and the ident. fetch may return the values it got together with
+// an error. Only the values returned with a *BatchError are cached, except the ones of the
+// identifiers it reports. Values returned with any other error are returned but not cached.
+func cachedBatch[T any](ctx context.Context, c *cache, kind CacheKind, prefix string, idents []string, fetch func(context.Context, []string) (map[string]T, error)) (map[string]T, error) {
+	result := make(map[string]T, len(idents))
+	var missing []string
+
+	c.mu.Lock()
+	for _, ident := range idents {
+		if value, ok := c.lookup(cacheKey{kind: kind, key: prefix + ident}); ok {
+			c.statsOf(kind).Hits++
+			result[ident] = value.(T)
+		} else {
+			missing = append(missing, ident)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	key := cacheKey{kind: kind, key: prefix + strings.Join(missing, ",")}
+	value, err := c.do(ctx, key, len(missing),
+		func(ctx context.Context) (any, error) { return fetch(ctx, missing) },
+		func(value any, err error, generation int) {
+			var batchErr *BatchError
+			if err != nil && !errors.As(err, &batchErr) {
+				// A timeout or an error of the whole batch may leave the values incomplete
+				return
+			}
+			fetched, _ := value.(map[string]T)
+			for ident, v := range fetched {
+				// A value returned with an error of its own is incomplete
+				if batchErr != nil && batchErr.Errors[ident] != nil {
+					continue
+				}
+				c.store(cacheKey{kind: kind, key: prefix + ident}, v, generation)
+			}
+		})
+
+	fetched, _ := value.(map[string]T)
+	for ident, v := range fetched {
+		result[ident] = v
+	}
+	return result, err
+}
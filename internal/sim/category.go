@@ -0,0 +1,152 @@
+package sim
+
+import (
+	"strings"
+)
+
+// FlightCategory is the FAA flight category derived from ceiling and visibility
+type FlightCategory string
+
+const (
+	CategoryUnknown FlightCategory = "UNKNOWN"
+	CategoryVFR     FlightCategory = "VFR"  // Ceiling above 3000 ft and visibility above 5 SM
+	CategoryMVFR    FlightCategory = "MVFR" // Ceiling 1000-3000 ft or visibility 3-5 SM
+	CategoryIFR     FlightCategory = "IFR"  // Ceiling 500 to below 1000 ft or visibility 1 to below 3 SM
+	CategoryLIFR    FlightCategory = "LIFR" // Ceiling below 500 ft or visibility below 1 SM
+)
+
+// severity orders categories from the least to the most restrictive
+func (c FlightCategory) severity() int {
+	switch c {
+	case CategoryVFR:
+		return 1
+	case CategoryMVFR:
+		return 2
+	case CategoryIFR:
+		return 3
+	case CategoryLIFR:
+		return 4
+	}
+	return 0
+}
+
+// WorseThan reports whether c is more restrictive than other. A known category is always
+// worse than CategoryUnknown.
+func (c FlightCategory) WorseThan(other FlightCategory) bool {
+	return c.severity() > other.severity()
+}
+
+// Ceiling returns the base of the lowest broken, overcast or vertical visibility layer in feet
+func (m *Metar) Ceiling() (int, bool) {
+	for _, sky := range m.Sky {
+		if sky.Base < 0 {
+			continue
+		}
+		if sky.Coverage == "BKN" || sky.Coverage == "OVC" || sky.Coverage == "VV" {
+			return sky.Base, true
+		}
+	}
+	return 0, false
+}
+
+// FlightCategory returns the FAA flight category of the report. A report without
+// visibility and sky condition is CategoryUnknown.
+func (m *Metar) FlightCategory() FlightCategory {
+	ceiling, hasCeiling := m.Ceiling()
+	skyReported := m.CAVOK || m.SkyClear != "" || len(m.Sky) > 0
+
+	if m.Visibility == nil && !skyReported {
+		return CategoryUnknown
+	}
+
+	category := CategoryVFR
+	if hasCeiling {
+		category = worst(category, ceilingCategory(ceiling))
+	}
+	if m.Visibility != nil {
+		category = worst(category, visibilityCategory(m.Visibility.Miles))
+	}
+	return category
+}
+
+func ceilingCategory(ceiling int) FlightCategory {
+	switch {
+	case ceiling < 500:
+		return CategoryLIFR
+	case ceiling < 1000:
+		return CategoryIFR
+	case ceiling <= 3000:
+		return CategoryMVFR
+	}
+	return CategoryVFR
+}
+
+func visibilityCategory(miles float64) FlightCategory {
+	switch {
+	case miles < 1:
+		return CategoryLIFR
+	case miles < 3:
+		return CategoryIFR
+	case miles <= 5:
+		return CategoryMVFR
+	}
+	return CategoryVFR
+}
+
+func worst(a, b FlightCategory) FlightCategory {
+	if b.WorseThan(a) {
+		return b
+	}
+	return a
+}
+
+// classify fills in the ceiling and flight category from the decoded METAR
+func (w *Weather) classify() {
+	w.Category = CategoryUnknown
+	w.Ceiling = nil
+	if w.Metar == nil {
+		return
+	}
+
+	if ceiling, ok := w.Metar.Ceiling(); ok {
+		w.Ceiling = &ceiling
+	}
+	w.Category = w.Metar.FlightCategory()
+}
+
+// RouteWeather is the weather along a route with the most restrictive flight category
+type RouteWeather struct {
+	Stations []*Weather     `json:"stations"` // In route order, waypoints without a report are left out
+	Worst    FlightCategory `json:"worst"`    // Worst category along the route
+	WorstAt  []string       `json:"worst_at"` // Waypoints reporting the worst category
+}
+
+// SummarizeRoute orders weather by the waypoints of the route and finds the worst flight category
+func SummarizeRoute(waypoints []string, weather map[string]*Weather) *RouteWeather {
+	route := &RouteWeather{
+		Stations: []*Weather{},
+		Worst:    CategoryUnknown,
+		WorstAt:  []string{},
+	}
+
+	seen := make(map[string]bool)
+	for _, wp := range waypoints {
+		wp = strings.ToUpper(strings.TrimSpace(wp))
+		station, ok := weather[wp]
+		if !ok || seen[wp] {
+			continue
+		}
+		seen[wp] = true
+		route.Stations = append(route.Stations, station)
+
+		switch {
+		case station.Category.WorseThan(route.Worst):
+			route.Worst = station.Category
+			route.WorstAt = []string{wp}
+		case station.Category == route.Worst && route.Worst != CategoryUnknown:
+			route.WorstAt = append(route.WorstAt, wp)
+		}
+	}
+
+	return route
+}
@@ -0,0 +1,119 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetar_FlightCategory(t *testing.T) {
+	tests := []struct {
+		name             string
+		metar            string
+		expectedCeiling  int
+		expectedHasCeil  bool
+		expectedCategory sim.FlightCategory
+	}{
+		{name: "clear and unlimited", metar: "KDEN 171153Z VRB04KT P6SM FEW120 24/M03 A3021", expectedCategory: sim.CategoryVFR},
+		{name: "CAVOK", metar: "EGLL 171150Z 22008KT CAVOK 15/09 Q1020", expectedCategory: sim.CategoryVFR},
+		{name: "high broken layer", metar: "KJFK 171151Z 31008KT 10SM BKN035 18/06 A3002", expectedCeiling: 3500, expectedHasCeil: true, expectedCategory: sim.CategoryVFR},
+		{name: "scattered layers are no ceiling", metar: "KJFK 171151Z 31008KT 10SM SCT005 18/06 A3002", expectedCategory: sim.CategoryVFR},
+		{name: "ceiling at 3000 ft", metar: "KJFK 171151Z 31008KT 10SM OVC030 18/06 A3002", expectedCeiling: 3000, expectedHasCeil: true, expectedCategory: sim.CategoryMVFR},
+		{name: "ceiling at 1000 ft", metar: "KJFK 171151Z 31008KT 10SM BKN010 18/06 A3002", expectedCeiling: 1000, expectedHasCeil: true, expectedCategory: sim.CategoryMVFR},
+		{name: "visibility 5 SM", metar: "KJFK 171151Z 31008KT 5SM HZ FEW050 18/06 A3002", expectedCategory: sim.CategoryMVFR},
+		{name: "visibility 3 SM", metar: "KJFK 171151Z 31008KT 3SM BR SCT050 18/06 A3002", expectedCategory: sim.CategoryMVFR},
+		{name: "ceiling below 1000 ft", metar: "KLAX 171153Z 25010KT 3SM BR OVC008 16/14 A2992", expectedCeiling: 800, expectedHasCeil: true, expectedCategory: sim.CategoryIFR},
+		{name: "ceiling at 500 ft", metar: "KLAX 171153Z 25010KT 10SM OVC005 16/14 A2992", expectedCeiling: 500, expectedHasCeil: true, expectedCategory: sim.CategoryIFR},
+		{name: "fractional visibility above 1 SM", metar: "KORD 171151Z 36012KT 1 1/4SM -SN SCT060 M02/M04 A2985", expectedCategory: sim.CategoryIFR},
+		{name: "metric visibility", metar: "EDDH 171150Z 27015KT 2000 RA BKN040 10/08 Q1009", expectedCeiling: 4000, expectedHasCeil: true, expectedCategory: sim.CategoryIFR},
+		{name: "ceiling below 500 ft", metar: "KSFO 171156Z 28005KT 4SM BR OVC004 14/13 A3001", expectedCeiling: 400, expectedHasCeil: true, expectedCategory: sim.CategoryLIFR},
+		{name: "visibility below 1 SM", metar: "PANC 171153Z 00000KT 1/2SM FZFG SCT030 M18/M19 A3012", expectedCategory: sim.CategoryLIFR},
+		{name: "vertical visibility", metar: "EDDF 171150Z 24004KT 0400 FG VV002 08/08 Q1020", expectedCeiling: 200, expectedHasCeil: true, expectedCategory: sim.CategoryLIFR},
+		{name: "lowest ceiling counts", metar: "KMIA 171153Z 09014KT 10SM FEW005 BKN020CB OVC045 27/24 A2996", expectedCeiling: 2000, expectedHasCeil: true, expectedCategory: sim.CategoryMVFR},
+		{name: "unknown layer height is skipped", metar: "LFPG 171200Z AUTO 25008KT 9999 BKN/// OVC080 11/08 Q1018", expectedCeiling: 8000, expectedHasCeil: true, expectedCategory: sim.CategoryVFR},
+		{name: "nothing reported", metar: "UUMI 171200Z NIL", expectedCategory: sim.CategoryUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metar, err := sim.ParseMetar(tt.metar)
+			require.NoError(t, err)
+
+			ceiling, hasCeiling := metar.Ceiling()
+			assert.Equal(t, tt.expectedHasCeil, hasCeiling)
+			assert.Equal(t, tt.expectedCeiling, ceiling)
+			assert.Equal(t, tt.expectedCategory, metar.FlightCategory())
+		})
+	}
+}
+
+func TestFlightCategory_WorseThan(t *testing.T) {
+	assert.True(t, sim.CategoryLIFR.WorseThan(sim.CategoryIFR))
+	assert.True(t, sim.CategoryIFR.WorseThan(sim.CategoryMVFR))
+	assert.True(t, sim.CategoryMVFR.WorseThan(sim.CategoryVFR))
+	assert.True(t, sim.CategoryVFR.WorseThan(sim.CategoryUnknown))
+	assert.False(t, sim.CategoryVFR.WorseThan(sim.CategoryVFR))
+	assert.False(t, sim.CategoryUnknown.WorseThan(sim.CategoryLIFR))
+}
+
+func TestSummarizeRoute(t *testing.T) {
+	weather := map[string]*sim.Weather{
+		"EDDB": {Waypoint: "EDDB", Category: sim.CategoryVFR},
+		"EDDH": {Waypoint: "EDDH", Category: sim.CategoryIFR},
+		"KLAX": {Waypoint: "KLAX", Category: sim.CategoryIFR},
+		"UUMI": {Waypoint: "UUMI", Category: sim.CategoryUnknown},
+	}
+
+	tests := []struct {
+		name             string
+		waypoints        []string
+		expectedStations []string
+		expectedWorst    sim.FlightCategory
+		expectedWorstAt  []string
+	}{
+		{
+			name:             "worst category in route order",
+			waypoints:        []string{"klax", "EDDB", " EDDH "},
+			expectedStations: []string{"KLAX", "EDDB", "EDDH"},
+			expectedWorst:    sim.CategoryIFR,
+			expectedWorstAt:  []string{"KLAX", "EDDH"},
+		},
+		{
+			name:             "waypoints without weather and duplicates are skipped",
+			waypoints:        []string{"EDDB", "XXXX", "EDDB"},
+			expectedStations: []string{"EDDB"},
+			expectedWorst:    sim.CategoryVFR,
+			expectedWorstAt:  []string{"EDDB"},
+		},
+		{
+			name:             "unknown category",
+			waypoints:        []string{"UUMI"},
+			expectedStations: []string{"UUMI"},
+			expectedWorst:    sim.CategoryUnknown,
+			expectedWorstAt:  []string{},
+		},
+		{
+			name:             "known category beats unknown",
+			waypoints:        []string{"UUMI", "EDDB"},
+			expectedStations: []string{"UUMI", "EDDB"},
+			expectedWorst:    sim.CategoryVFR,
+			expectedWorstAt:  []string{"EDDB"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := sim.SummarizeRoute(tt.waypoints, weather)
+
+			var stations []string
+			for _, station := range route.Stations {
+				stations = append(stations, station.Waypoint)
+			}
+			assert.Equal(t, tt.expectedStations, stations)
+			assert.Equal(t, tt.expectedWorst, route.Worst)
+			assert.Equal(t, tt.expectedWorstAt, route.WorstAt)
+		})
+	}
+}
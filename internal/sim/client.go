@@ -2,54 +2,58 @@ package sim
 
 import (
 	"atc_freq/internal/helpers"
+	"context"
+	"errors"
 	"fmt"
-	"math"
 	"strings"
 	"time"
-	"unsafe"
 )
 
 type FACILITY_FREQUENCY_DATA struct {
-	TYPE      int32
-	FREQUENCY int32    // Hz
-	NAME      [64]byte // C char[64]
+	TYPE      int32    `facility:"TYPE"`
+	FREQUENCY int32    `facility:"FREQUENCY"` // Hz
+	NAME      [64]byte `facility:"NAME"`      // C char[64]
 }
 
 type AirportFrequency struct {
-	Type     string
-	TypeCode int32
-	Name     string
-	Hz       int
-	MHz      float64
+	Type     string  `json:"type"`
+	TypeCode int32   `json:"type_code"`
+	Name     string  `json:"name"`
+	Hz       int     `json:"hz"`
+	MHz      float64 `json:"mhz"`
+	Source   string  `json:"source"` // Where the frequency comes from, SourceSimulator or the name of a FrequencySource
 }
 
 // CloudLayer represents a single cloud layer with base altitude and coverage
 type CloudLayer struct {
-	Base     int    // Base altitude in feet
-	Coverage string // Cloud coverage (FEW, SCT, BKN, OVC)
+	Base     int    `json:"base"`     // Base altitude in feet
+	Coverage string `json:"coverage"` // Cloud coverage (FEW, SCT, BKN, OVC)
 }
 
 // Weather contains weather information for a waypoint
 type Weather struct {
-	Waypoint   string
-	Visibility int // Visibility in statute miles (0-10+)
-	Clouds     []CloudLayer
-	RawMetar   string // Raw METAR string from sim
+	Waypoint   string         `json:"waypoint"`
+	Visibility int            `json:"visibility"` // Visibility in statute miles (0-10+)
+	Clouds     []CloudLayer   `json:"clouds"`
+	RawMetar   string         `json:"raw_metar"` // Raw METAR string from sim
+	Metar      *Metar         `json:"metar"`     // Decoded METAR, nil when the report couldn't be decoded
+	Ceiling    *int           `json:"ceiling"`   // Lowest BKN, OVC or VV layer in feet, nil without a ceiling
+	Category   FlightCategory `json:"category"`  // FAA flight category
 }
 
 // CloudDensity represents interpreted cloud density at a grid point
 type CloudDensity struct {
-	Value      byte    // Raw density value (0-255)
-	Percentage float64 // Density as percentage (0-100)
-	Coverage   string  // Human-readable coverage level
-	MinAlt     int     // Minimum altitude in feet
-	MaxAlt     int     // Maximum altitude in feet
+	Value      byte    `json:"value"`      // Raw density value (0-255)
+	Percentage float64 `json:"percentage"` // Density as percentage (0-100)
+	Coverage   string  `json:"coverage"`   // Human-readable coverage level
+	MinAlt     int     `json:"min_alt"`    // Minimum altitude in feet
+	MaxAlt     int     `json:"max_alt"`    // Maximum altitude in feet
 }
 
 // Coordinates represents geographic coordinates
 type Coordinates struct {
-	Lat float64
-	Lon float64
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
 }
 
 var freqTypeMap = map[int32]string{
@@ -71,354 +75,488 @@ var freqTypeMap = map[int32]string{
 	15: "GCO",
 }
 
+// sessionName is the application name reported to SimConnect
+const sessionName = "atc-freq"
+
+// airportFrequencies is the tree of airportFrequencyDefinition
+type airportFrequencies struct {
+	Frequencies []FACILITY_FREQUENCY_DATA `facility:"FREQUENCY"`
+}
+
+// airportFrequencyDefinition is the facility definition used by GetAirportFrequencies:
+// OPEN AIRPORT -> OPEN FREQUENCY -> TYPE/FREQUENCY/NAME -> CLOSE -> CLOSE.
+// The batch request matches the FREQUENCY records to their airport itself.
+var airportFrequencyDefinition = MustFacilityDefinition[airportFrequencies]("airport frequencies", "AIRPORT")
+
+// waypointCoordinatesData is the record of waypointCoordinatesDefinition
+type waypointCoordinatesData struct {
+	Latitude  float64 `facility:"LATITUDE"`
+	Longitude float64 `facility:"LONGITUDE"`
+}
+
+// waypointCoordinatesDefinition is the facility definition used by GetWaypointCoordinates
+var waypointCoordinatesDefinition = MustFacilityDefinition[waypointCoordinatesData]("waypoint coordinates", "AIRPORT")
+
 type Client struct {
-	simConnection Connection
+	session *Session
 }
 
 func NewClient(conn Connection) *Client {
-	return &Client{simConnection: conn}
+	return &Client{session: NewSession(conn, sessionName)}
+}
+
+// Close closes the underlying SimConnect session
+func (client *Client) Close() {
+	client.session.Close()
 }
 
+// GetAirportFrequencies retrieves all frequencies of an airport, waiting at most timeout
 func (client *Client) GetAirportFrequencies(icao string, timeout time.Duration) ([]AirportFrequency, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return client.GetAirportFrequenciesCtx(ctx, icao)
+}
+
+// GetAirportFrequenciesCtx retrieves all frequencies of an airport until ctx is done
+func (client *Client) GetAirportFrequenciesCtx(ctx context.Context, icao string) ([]AirportFrequency, error) {
 	icao = strings.ToUpper(strings.TrimSpace(icao))
 	if icao == "" {
 		return nil, fmt.Errorf("icao is empty")
 	}
 
-	connection := client.simConnection
-	err := connection.Open("go-freq-client")
+	session := client.session
+	sub, err := session.subscribe(1)
 	if err != nil {
 		return nil, err
 	}
-	defer connection.Close()
+	defer sub.cancel()
 
-	// Facility definition: OPEN AIRPORT -> OPEN FREQUENCY -> TYPE/FREQUENCY/NAME -> CLOSE -> CLOSE
-	if err := connection.AddField("OPEN AIRPORT", DEFINE_ID); err != nil {
-		return nil, err
-	}
-	if err := connection.AddField("OPEN FREQUENCY", DEFINE_ID); err != nil {
-		return nil, err
-	}
-	if err := connection.AddField("TYPE", DEFINE_ID); err != nil {
-		return nil, err
-	}
-	if err := connection.AddField("FREQUENCY", DEFINE_ID); err != nil {
-		return nil, err
-	}
-	if err := connection.AddField("NAME", DEFINE_ID); err != nil {
-		return nil, err
-	}
-	if err := connection.AddField("CLOSE FREQUENCY", DEFINE_ID); err != nil {
-		return nil, err
-	}
-	if err := connection.AddField("CLOSE AIRPORT", DEFINE_ID); err != nil {
+	defineID, err := session.define(sub, airportFrequencyDefinition.definition)
+	if err != nil {
 		return nil, err
 	}
 
-	err = connection.RequestFacilityData(icao, "", DEFINE_ID, REQUEST_ID)
+	_, err = session.send(sub, func() error {
+		return session.connection.RequestFacilityData(icao, "", defineID, sub.requestIDs[0])
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	var out []AirportFrequency
-	deadline := time.Now().Add(timeout)
-
-	for time.Now().Before(deadline) {
-		ppData, ok := connection.GetNextDispatch()
-		if !ok {
-			time.Sleep(10 * time.Millisecond)
-			continue
+	records := 0
+
+	for {
+		var d dispatch
+		select {
+		case d = <-sub.recv:
+		case <-ctx.Done():
+			return out, doneError(ctx, &TimeoutError{Waiting: "frequencies", Received: len(out)})
 		}
 
-		fmt.Printf("dispatch: %#v\n", ppData)
-
-		switch ppData.DwID {
+		switch d.id {
+		case SIMCONNECT_RECV_ID_QUIT:
+			return nil, errSimulatorQuit
 		case SIMCONNECT_RECV_ID_EXCEPTION:
-			exception := (*SIMCONNECT_RECV_EXCEPTION)(unsafe.Pointer(ppData))
-			return nil, fmt.Errorf("connection exception received: %d (sendID: %d, index: %d)", exception.DwException, exception.DwSendID, exception.DwIndex)
+			return nil, newExceptionError(d)
 		case SIMCONNECT_RECV_ID_FACILITY_DATA:
-			facData := (*SIMCONNECT_RECV_FACILITY_DATA)(unsafe.Pointer(ppData))
-
-			if facData.UserRequestId != REQUEST_ID {
-				continue
+			facData, payload, err := decodeFacilityData(d)
+			if err != nil {
+				return nil, err
 			}
+			records++
 
 			if facData.Type != SIMCONNECT_FACILITY_DATA_FREQUENCY {
 				continue
 			}
 
-			fmt.Println("Found Frequency Data!")
-
-			// Frequency data starts at the Data field
-			dataPtr := unsafe.Pointer(&facData.Data)
-			freq := (*FACILITY_FREQUENCY_DATA)(dataPtr)
-
-			name := helpers.TrimCString(freq.NAME[:])
-			hz := int(freq.FREQUENCY)
-			tcode := freq.TYPE
-			tname := freqTypeMap[tcode]
-			if tname == "" {
-				tname = fmt.Sprintf("UNKNOWN_%d", tcode)
+			freq, err := decodeFrequency(payload)
+			if err != nil {
+				return nil, err
 			}
-
-			out = append(out, AirportFrequency{
-				Type:     tname,
-				TypeCode: tcode,
-				Name:     name,
-				Hz:       hz,
-				MHz:      helpers.HzToMHz(hz),
-			})
+			out = append(out, freq)
 
 		case SIMCONNECT_RECV_ID_FACILITY_DATA_END:
-			fmt.Println("got facility data end")
-			end := (*SIMCONNECT_RECV_FACILITY_DATA_END)(unsafe.Pointer(ppData))
-			if end.RequestId == REQUEST_ID {
-				return out, nil
+			// An unknown ICAO ends the request without sending any facility record
+			if records == 0 {
+				return nil, &UnknownFacilityError{Idents: []string{icao}}
 			}
+			return out, nil
 		}
 	}
-
-	return out, fmt.Errorf("timeout waiting for facility data end (got %d frequencies so far)", len(out))
 }
 
-const (
-	WEATHER_REQUEST_ID_BASE     = 0x3001
-	CLOUD_STATE_REQUEST_ID_BASE = 0x4001
-	WAYPOINT_DEFINE_ID          = 0x1002
-	WAYPOINT_REQUEST_ID         = 0x2002
-)
+// GetAirportFrequenciesBatch retrieves the frequencies of several airports in one round trip, waiting at most timeout
+func (client *Client) GetAirportFrequenciesBatch(icaos []string, timeout time.Duration) (map[string][]AirportFrequency, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-// GetWeather retrieves weather information for the specified waypoints
-func (client *Client) GetWeather(waypoints []string, timeout time.Duration) (map[string]*Weather, error) {
-	if len(waypoints) == 0 {
-		return nil, fmt.Errorf("no waypoints provided")
+	return client.GetAirportFrequenciesBatchCtx(ctx, icaos)
+}
+
+// GetAirportFrequenciesBatchCtx retrieves the frequencies of several airports until ctx is done.
+// All requests are sent at once and the frequency records are matched to their airport by the
+// unique request ID of the parent AIRPORT record. Airports that failed, were rejected with an
+// exception or couldn't be decoded are reported in a *BatchError returned together with the
+// frequencies of the others.
+func (client *Client) GetAirportFrequenciesBatchCtx(ctx context.Context, icaos []string) (map[string][]AirportFrequency, error) {
+	icaos = uniqueWaypoints(normalizeWaypoints(icaos))
+	if len(icaos) == 0 {
+		return nil, fmt.Errorf("no ICAO codes provided")
 	}
 
-	connection := client.simConnection
-	err := connection.Open("go-weather-client")
+	session := client.session
+	sub, err := session.subscribe(len(icaos))
 	if err != nil {
 		return nil, err
 	}
-	defer connection.Close()
+	defer sub.cancel()
 
-	// Request weather for each waypoint
-	requestIDToWaypoint := make(map[uint32]string)
-	for i, wp := range waypoints {
-		wp = strings.ToUpper(strings.TrimSpace(wp))
-		if wp == "" {
-			continue
-		}
-		requestID := uint32(WEATHER_REQUEST_ID_BASE + i)
-		requestIDToWaypoint[requestID] = wp
+	defineID, err := session.define(sub, airportFrequencyDefinition.definition)
+	if err != nil {
+		return nil, err
+	}
 
-		err = connection.RequestWeatherObservation(wp, requestID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to request weather for %s: %w", wp, err)
+	// Airports stay pending until their request ends or fails, failed ones are reported in the *BatchError
+	pending := make(map[string]bool, len(icaos))
+	batchErr := &BatchError{Errors: make(map[string]error)}
+	fail := func(icao string, err error) {
+		if pending[icao] {
+			delete(pending, icao)
+			batchErr.Errors[icao] = err
 		}
 	}
 
-	result := make(map[string]*Weather)
-	pendingRequests := len(requestIDToWaypoint)
-	deadline := time.Now().Add(timeout)
+	requestIDToICAO := make(map[uint32]string)
+	sendIDToICAO := make(map[uint32]string)
+	for i, icao := range icaos {
+		requestID := sub.requestIDs[i]
+		requestIDToICAO[requestID] = icao
 
-	for time.Now().Before(deadline) && pendingRequests > 0 {
-		ppData, ok := connection.GetNextDispatch()
-		if !ok {
-			time.Sleep(10 * time.Millisecond)
+		sendID, err := session.send(sub, func() error {
+			return session.connection.RequestFacilityData(icao, "", defineID, requestID)
+		})
+		if err != nil {
+			batchErr.Errors[icao] = fmt.Errorf("failed to request frequencies for %s: %w", icao, err)
+			continue
+		}
+		pending[icao] = true
+		sendIDToICAO[sendID] = icao
+	}
+
+	// uniqueIDToICAO maps the unique request ID of every AIRPORT record to its airport
+	uniqueIDToICAO := make(map[uint32]string)
+	freqs := make(map[string][]AirportFrequency)
+	records := make(map[string]int)
+	done := make(map[string]bool)
+
+	for len(pending) > 0 {
+		var d dispatch
+		select {
+		case d = <-sub.recv:
+		case <-ctx.Done():
+			for icao := range pending {
+				fail(icao, doneError(ctx, &TimeoutError{Waiting: "frequencies of " + icao, Received: len(freqs[icao])}))
+			}
 			continue
 		}
 
-		switch ppData.DwID {
+		// The airport of a message that can't be decoded is found by its request ID
+		requestID, _ := d.requestID()
+		switch d.id {
+		case SIMCONNECT_RECV_ID_QUIT:
+			return nil, errSimulatorQuit
 		case SIMCONNECT_RECV_ID_EXCEPTION:
-			return nil, fmt.Errorf("connection exception received, ID: %d", ppData.DwID)
-		case SIMCONNECT_RECV_ID_WEATHER_OBSERVATION:
-			weatherData := (*SIMCONNECT_RECV_WEATHER_OBSERVATION)(unsafe.Pointer(ppData))
-
-			wp, exists := requestIDToWaypoint[weatherData.DwRequestID]
-			if !exists {
+			err := newExceptionError(d)
+			exception, ok := err.(*ExceptionError)
+			if !ok {
+				continue
+			}
+			if icao, exists := sendIDToICAO[exception.SendID]; exists {
+				fail(icao, err)
+				continue
+			}
+			// A field of the definition was rejected, every airport waiting for it fails
+			for icao := range pending {
+				fail(icao, err)
+			}
+		case SIMCONNECT_RECV_ID_FACILITY_DATA:
+			facData, payload, err := decodeFacilityData(d)
+			if err != nil {
+				fail(requestIDToICAO[requestID], err)
+				continue
+			}
+			icao, exists := requestIDToICAO[facData.UserRequestId]
+			if !exists || !pending[icao] {
 				continue
 			}
 
-			// Extract METAR string - starts at SzMetar field and goes to end of struct
-			metarPtr := unsafe.Pointer(&weatherData.SzMetar[0])
-			metar := helpers.TrimCString((*[512]byte)(metarPtr)[:])
+			switch facData.Type {
+			case SIMCONNECT_FACILITY_DATA_AIRPORT:
+				uniqueIDToICAO[facData.UniqueRequestId] = icao
+			case SIMCONNECT_FACILITY_DATA_FREQUENCY:
+				if parent, ok := uniqueIDToICAO[facData.ParentUniqueRequestId]; ok {
+					icao = parent
+				}
+				freq, err := decodeFrequency(payload)
+				if err != nil {
+					fail(icao, err)
+					continue
+				}
+				freqs[icao] = append(freqs[icao], freq)
+			}
+			records[icao]++
 
-			weather := parseMetar(wp, metar)
-			result[wp] = weather
-			pendingRequests--
+		case SIMCONNECT_RECV_ID_FACILITY_DATA_END:
+			end, err := decodeFacilityDataEnd(d)
+			if err != nil {
+				fail(requestIDToICAO[requestID], err)
+				continue
+			}
+			icao, exists := requestIDToICAO[end.RequestId]
+			if !exists || !pending[icao] {
+				continue
+			}
+			delete(pending, icao)
+			// An unknown ICAO ends the request without sending any facility record
+			if records[icao] == 0 {
+				batchErr.Errors[icao] = &UnknownFacilityError{Idents: []string{icao}}
+				continue
+			}
+			done[icao] = true
 		}
 	}
 
-	if pendingRequests > 0 {
-		return result, fmt.Errorf("timeout: received %d of %d weather responses", len(result), len(requestIDToWaypoint))
+	result := completedFrequencies(freqs, done)
+	if len(batchErr.Errors) > 0 {
+		return result, batchErr
 	}
-
 	return result, nil
 }
 
-// GetWaypointCoordinates retrieves coordinates for the specified waypoints/airports
-func (client *Client) GetWaypointCoordinates(waypoints []string, timeout time.Duration) (map[string]Coordinates, error) {
-	if len(waypoints) == 0 {
-		return nil, fmt.Errorf("no waypoints provided")
+// completedFrequencies returns the frequencies of the airports whose request has ended.
+// Airports without frequency records get an empty list.
+func completedFrequencies(freqs map[string][]AirportFrequency, done map[string]bool) map[string][]AirportFrequency {
+	result := make(map[string][]AirportFrequency, len(done))
+	for icao := range done {
+		result[icao] = freqs[icao]
+		if result[icao] == nil {
+			result[icao] = []AirportFrequency{}
+		}
 	}
+	return result
+}
 
-	connection := client.simConnection
-	err := connection.Open("go-coords-client")
+// decodeFrequency decodes a FREQUENCY record of the airport frequency definition
+func decodeFrequency(payload []byte) (AirportFrequency, error) {
+	freq, err := decodeFull[FACILITY_FREQUENCY_DATA](payload, "frequency record")
 	if err != nil {
-		return nil, err
+		return AirportFrequency{}, err
 	}
-	defer connection.Close()
 
-	// Define facility structure to get lat/lon
-	if err := connection.AddField("OPEN AIRPORT", WAYPOINT_DEFINE_ID); err != nil {
-		return nil, err
+	hz := int(freq.FREQUENCY)
+	tcode := freq.TYPE
+	tname := freqTypeMap[tcode]
+	if tname == "" {
+		tname = fmt.Sprintf("UNKNOWN_%d", tcode)
 	}
-	if err := connection.AddField("LATITUDE", WAYPOINT_DEFINE_ID); err != nil {
-		return nil, err
+
+	return AirportFrequency{
+		Type:     tname,
+		TypeCode: tcode,
+		Name:     helpers.TrimCString(freq.NAME[:]),
+		Hz:       hz,
+		MHz:      helpers.HzToMHz(hz),
+		Source:   SourceSimulator,
+	}, nil
+}
+
+// GetWeather retrieves weather information for the specified waypoints, waiting at most timeout
+func (client *Client) GetWeather(waypoints []string, timeout time.Duration) (map[string]*Weather, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return client.GetWeatherCtx(ctx, waypoints)
+}
+
+// GetWeatherCtx retrieves weather information for the specified waypoints until ctx is done.
+// All requests are sent at once. Waypoints that failed, were rejected with an exception, like
+// the ones without a weather station, or couldn't be decoded are reported in a *BatchError
+// returned together with the weather of the others.
+func (client *Client) GetWeatherCtx(ctx context.Context, waypoints []string) (map[string]*Weather, error) {
+	if len(waypoints) == 0 {
+		return nil, fmt.Errorf("no waypoints provided")
 	}
-	if err := connection.AddField("LONGITUDE", WAYPOINT_DEFINE_ID); err != nil {
+
+	waypoints = normalizeWaypoints(waypoints)
+
+	session := client.session
+	sub, err := session.subscribe(len(waypoints))
+	if err != nil {
 		return nil, err
 	}
-	if err := connection.AddField("CLOSE AIRPORT", WAYPOINT_DEFINE_ID); err != nil {
-		return nil, err
+	defer sub.cancel()
+
+	// Waypoints stay pending until their observation arrives or fails, failed ones are reported in the *BatchError
+	pending := make(map[string]bool, len(waypoints))
+	batchErr := &BatchError{Errors: make(map[string]error)}
+	fail := func(wp string, err error) {
+		if pending[wp] {
+			delete(pending, wp)
+			batchErr.Errors[wp] = err
+		}
 	}
 
-	// Request facility data for each waypoint to get coordinates
 	requestIDToWaypoint := make(map[uint32]string)
+	sendIDToWaypoint := make(map[uint32]string)
 	for i, wp := range waypoints {
-		wp = strings.ToUpper(strings.TrimSpace(wp))
-		if wp == "" {
-			continue
-		}
-		requestID := uint32(WAYPOINT_REQUEST_ID + i)
+		requestID := sub.requestIDs[i]
 		requestIDToWaypoint[requestID] = wp
 
-		err = connection.RequestFacilityData(wp, "", WAYPOINT_DEFINE_ID, requestID)
+		sendID, err := session.send(sub, func() error {
+			return session.connection.RequestWeatherObservation(wp, requestID)
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to request facility data for %s: %w", wp, err)
+			batchErr.Errors[wp] = fmt.Errorf("failed to request weather for %s: %w", wp, err)
+			continue
 		}
+		pending[wp] = true
+		sendIDToWaypoint[sendID] = wp
 	}
 
-	result := make(map[string]Coordinates)
-	pendingRequests := len(requestIDToWaypoint)
-	deadline := time.Now().Add(timeout)
-
-	for time.Now().Before(deadline) && pendingRequests > 0 {
-		ppData, ok := connection.GetNextDispatch()
-		if !ok {
-			time.Sleep(10 * time.Millisecond)
+	result := make(map[string]*Weather)
+	for len(pending) > 0 {
+		var d dispatch
+		select {
+		case d = <-sub.recv:
+		case <-ctx.Done():
+			for wp := range pending {
+				fail(wp, doneError(ctx, &TimeoutError{Waiting: "weather observation of " + wp}))
+			}
 			continue
 		}
 
-		switch ppData.DwID {
+		switch d.id {
+		case SIMCONNECT_RECV_ID_QUIT:
+			return nil, errSimulatorQuit
 		case SIMCONNECT_RECV_ID_EXCEPTION:
-			return nil, fmt.Errorf("connection exception during facility request")
-		case SIMCONNECT_RECV_ID_FACILITY_DATA:
-			facData := (*SIMCONNECT_RECV_FACILITY_DATA)(unsafe.Pointer(ppData))
-			wp, exists := requestIDToWaypoint[facData.UserRequestId]
-			if !exists {
+			err := newExceptionError(d)
+			exception, ok := err.(*ExceptionError)
+			if !ok {
 				continue
 			}
-
-			// Extract lat/lon from facility data
-			// When using AddField with LATITUDE/LONGITUDE, data contains only requested fields
-			dataPtr := unsafe.Pointer(&facData.Data)
-			latPtr := (*float64)(dataPtr)                              // LATITUDE at offset 0
-			lonPtr := (*float64)(unsafe.Pointer(uintptr(dataPtr) + 8)) // LONGITUDE at offset 8
-
-			result[wp] = Coordinates{
-				Lat: *latPtr,
-				Lon: *lonPtr,
+			if wp, exists := sendIDToWaypoint[exception.SendID]; exists {
+				fail(wp, err)
+			}
+		case SIMCONNECT_RECV_ID_WEATHER_OBSERVATION:
+			requestID, _ := d.requestID()
+			weatherData, metar, err := decodeWeatherObservation(d)
+			if err != nil {
+				fail(requestIDToWaypoint[requestID], err)
+				continue
 			}
 
-		case SIMCONNECT_RECV_ID_FACILITY_DATA_END:
-			end := (*SIMCONNECT_RECV_FACILITY_DATA_END)(unsafe.Pointer(ppData))
-			if _, exists := requestIDToWaypoint[end.RequestId]; exists {
-				pendingRequests--
+			wp, exists := requestIDToWaypoint[weatherData.DwRequestID]
+			if !exists || !pending[wp] {
+				continue
 			}
+
+			result[wp] = parseMetar(wp, helpers.TrimCString(metar))
+			delete(pending, wp)
 		}
 	}
 
-	if pendingRequests > 0 {
-		return nil, fmt.Errorf("timeout getting waypoint coordinates: %d/%d received", len(result), len(requestIDToWaypoint))
+	if len(batchErr.Errors) > 0 {
+		return result, batchErr
 	}
-
 	return result, nil
 }
 
-// GetCloudDensityByCoordinates retrieves cloud density at the center of a grid for specified coordinates and altitude range
-func (client *Client) GetCloudDensityByCoordinates(coords Coordinates, minAlt, maxAlt float32, timeout time.Duration) (CloudDensity, error) {
-	connection := client.simConnection
-	err := connection.Open("go-cloud-density-client")
-	if err != nil {
-		return CloudDensity{}, err
-	}
-	defer connection.Close()
-
-	requestID := uint32(CLOUD_STATE_REQUEST_ID_BASE)
+// GetWaypointCoordinates retrieves coordinates for the specified waypoints/airports, waiting at most timeout
+func (client *Client) GetWaypointCoordinates(waypoints []string, timeout time.Duration) (map[string]Coordinates, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	// Calculate offsets for 5x5 km box (±2.5 km from center)
-	// 1 degree of latitude ≈ 111 km
-	// 1 degree of longitude ≈ 111 km * cos(latitude)
-	const kmPerDegreeLat = 111.0
-	const halfBoxKm = 2.5
+	return client.GetWaypointCoordinatesCtx(ctx, waypoints)
+}
 
-	latOffset := halfBoxKm / kmPerDegreeLat
-	lonOffset := halfBoxKm / (kmPerDegreeLat * math.Cos(coords.Lat*math.Pi/180))
+// GetWaypointCoordinatesCtx retrieves coordinates for the specified waypoints/airports until ctx is done
+func (client *Client) GetWaypointCoordinatesCtx(ctx context.Context, waypoints []string) (map[string]Coordinates, error) {
+	if len(waypoints) == 0 {
+		return nil, fmt.Errorf("no waypoints provided")
+	}
 
-	err = connection.RequestCloudState(
-		requestID,
-		float32(coords.Lat-latOffset), float32(coords.Lon-lonOffset), minAlt,
-		float32(coords.Lat+latOffset), float32(coords.Lon+lonOffset), maxAlt,
-	)
-	if err != nil {
-		return CloudDensity{}, fmt.Errorf("failed to request cloud state: %w", err)
+	waypoints = normalizeWaypoints(waypoints)
+	refs := make([]FacilityRef, len(waypoints))
+	for i, wp := range waypoints {
+		refs[i] = FacilityRef{Ident: wp}
 	}
 
-	deadline := time.Now().Add(timeout)
+	records, err := RequestFacilities(ctx, client, waypointCoordinatesDefinition, refs)
+	var unknown *UnknownFacilityError
+	if err != nil && !errors.As(err, &unknown) {
+		return nil, err
+	}
 
-	for time.Now().Before(deadline) {
-		ppData, ok := connection.GetNextDispatch()
-		if !ok {
-			time.Sleep(10 * time.Millisecond)
-			continue
-		}
+	result := make(map[string]Coordinates, len(records))
+	for wp, data := range records {
+		result[wp] = Coordinates{Lat: data.Latitude, Lon: data.Longitude}
+	}
+	return result, err
+}
 
-		switch ppData.DwID {
-		case SIMCONNECT_RECV_ID_EXCEPTION:
-			return CloudDensity{}, fmt.Errorf("connection exception during cloud state request")
-		case SIMCONNECT_RECV_ID_CLOUD_STATE:
-			cloudData := (*SIMCONNECT_RECV_CLOUD_STATE)(unsafe.Pointer(ppData))
-			if cloudData.DwRequestID != requestID {
-				continue
-			}
+// GetCloudDensityByCoordinates retrieves cloud density at the center of a grid for specified coordinates and altitude range,
+// waiting at most timeout
+func (client *Client) GetCloudDensityByCoordinates(coords Coordinates, minAlt, maxAlt float32, timeout time.Duration) (CloudDensity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-			// Extract raw cloud data
-			//dataPtr := unsafe.Pointer(uintptr(unsafe.Pointer(cloudData)) + unsafe.Sizeof(*cloudData))
-			dataPtr := unsafe.Pointer(&cloudData.RgbData[0])
-			rawData := make([]byte, cloudData.DwArraySize)
-			for i := uint32(0); i < cloudData.DwArraySize; i++ {
-				rawData[i] = *(*byte)(unsafe.Pointer(uintptr(dataPtr) + uintptr(i)))
-			}
+	return client.GetCloudDensityByCoordinatesCtx(ctx, coords, minAlt, maxAlt)
+}
 
-			fmt.Printf("raw cloud data between %f0.1 - %f0.1", minAlt, maxAlt)
-			for _, val := range rawData {
-				density := interpretCloudDensity(val)
-				fmt.Printf(" %s - %.2f%%, ", density.Coverage, density.Percentage)
-			}
+// GetCloudDensityByCoordinatesCtx retrieves cloud density at the center of a grid for specified coordinates and altitude range
+// until ctx is done
+func (client *Client) GetCloudDensityByCoordinatesCtx(ctx context.Context, coords Coordinates, minAlt, maxAlt float32) (CloudDensity, error) {
+	grid, err := client.GetCloudGridCtx(ctx, coords, DefaultCloudBoxKm, int(minAlt), int(maxAlt))
+	if err != nil {
+		return CloudDensity{}, err
+	}
+	return grid.Center(), nil
+}
 
-			// Return density at center of 64x64 grid (position 32,32)
-			const gridSize = 64
-			centerIndex := (gridSize/2)*gridSize + (gridSize / 2)
-			if centerIndex < len(rawData) {
-				return interpretCloudDensity(rawData[centerIndex]), nil
-			}
+// doneError returns timeoutErr when the context deadline passed and the
+// context error when the caller cancelled the request
+func doneError(ctx context.Context, timeoutErr error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return timeoutErr
+	}
+	return ctx.Err()
+}
 
-			return CloudDensity{}, nil
+// normalizeWaypoints upper-cases waypoint identifiers and drops empty ones
+func normalizeWaypoints(waypoints []string) []string {
+	normalized := make([]string, 0, len(waypoints))
+	for _, wp := range waypoints {
+		wp = strings.ToUpper(strings.TrimSpace(wp))
+		if wp != "" {
+			normalized = append(normalized, wp)
 		}
 	}
+	return normalized
+}
 
-	return CloudDensity{}, fmt.Errorf("timeout waiting for cloud state response")
+// uniqueWaypoints drops repeated waypoints, keeping the first occurrence
+func uniqueWaypoints(waypoints []string) []string {
+	unique := make([]string, 0, len(waypoints))
+	seen := make(map[string]bool)
+	for _, wp := range waypoints {
+		if !seen[wp] {
+			seen[wp] = true
+			unique = append(unique, wp)
+		}
+	}
+	return unique
 }
 
 // interpretCloudDensity converts a raw density byte into a CloudDensity struct
@@ -446,73 +584,35 @@ func interpretCloudDensity(value byte) CloudDensity {
 	}
 }
 
-// parseMetar parses a METAR string and extracts visibility and cloud layers
-func parseMetar(waypoint, metar string) *Weather {
+// parseMetar decodes a METAR string and fills in the visibility and cloud layer summary
+func parseMetar(waypoint, raw string) *Weather {
 	weather := &Weather{
 		Waypoint: waypoint,
-		RawMetar: metar,
+		RawMetar: raw,
 		Clouds:   []CloudLayer{},
 	}
 
-	parts := strings.Fields(metar)
-	for i, part := range parts {
-		// Parse visibility (format: XXXXSM where XXXX is visibility in SM)
-		if strings.HasSuffix(part, "SM") {
-			visStr := strings.TrimSuffix(part, "SM")
-			// Handle fractional visibility like "1/2SM" or "1 1/2SM"
-			if strings.Contains(visStr, "/") {
-				// Fractional - treat as less than 1
-				weather.Visibility = 0
-			} else {
-				var vis int
-				fmt.Sscanf(visStr, "%d", &vis)
-				weather.Visibility = vis
-			}
-		}
-
-		// Parse cloud layers (format: XXXnnn where XXX is coverage, nnn is altitude in hundreds of feet)
-		if len(part) >= 6 {
-			coverage := part[:3]
-			if coverage == "FEW" || coverage == "SCT" || coverage == "BKN" || coverage == "OVC" {
-				altStr := part[3:]
-				// Remove any suffix like CB (cumulonimbus)
-				altStr = strings.TrimRight(altStr, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
-				var alt int
-				if _, err := fmt.Sscanf(altStr, "%d", &alt); err == nil {
-					weather.Clouds = append(weather.Clouds, CloudLayer{
-						Base:     alt * 100, // Convert from hundreds to feet
-						Coverage: coverage,
-					})
-				}
-			}
-		}
-
-		// Also check for CLR or SKC (clear sky)
-		if part == "CLR" || part == "SKC" {
-			// No clouds
-		}
-
-		// Check for CAVOK (visibility > 10km, no clouds below 5000ft)
-		if part == "CAVOK" {
-			weather.Visibility = 10
-		}
+	metar, err := ParseMetar(raw)
+	if err != nil {
+		return weather
+	}
+	weather.Metar = metar
 
-		// Handle P6SM (visibility greater than 6 SM - used in US METAR)
-		if part == "P6SM" {
+	if vis := metar.Visibility; vis != nil {
+		weather.Visibility = min(int(vis.Miles), 10)
+		if vis.GreaterThan {
 			weather.Visibility = 10
 		}
+	}
 
-		// Handle visibility in meters (4 digits, typically European format)
-		if len(part) == 4 && i > 0 {
-			var visMeters int
-			if _, err := fmt.Sscanf(part, "%d", &visMeters); err == nil && visMeters >= 0 && visMeters <= 9999 {
-				// Convert meters to statute miles (roughly)
-				weather.Visibility = visMeters / 1609
-				if weather.Visibility > 10 {
-					weather.Visibility = 10
-				}
-			}
+	for _, sky := range metar.Sky {
+		if sky.Coverage == "VV" || sky.Base < 0 {
+			continue
 		}
+		weather.Clouds = append(weather.Clouds, CloudLayer{
+			Base:     sky.Base,
+			Coverage: sky.Coverage,
+		})
 	}
 
 	return weather
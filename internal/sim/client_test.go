@@ -3,11 +3,13 @@ package sim_test
 import (
 	"atc_freq/internal/sim"
 	"atc_freq/internal/testutil"
+	"context"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestClient_GetAirportFrequencies(t *testing.T) {
@@ -25,27 +27,28 @@ func TestClient_GetAirportFrequencies(t *testing.T) {
 			timeout: 5000 * time.Second,
 			mockSetup: func(m *sim.MockConnection) {
 				// Expect Open call
-				m.On("Open", "go-freq-client").Return(nil).Once()
+				m.On("Open", "atc-freq").Return(nil).Once()
 
 				// Expect all AddField calls
-				m.On("AddField", "OPEN AIRPORT", uint32(sim.DEFINE_ID)).Return(nil).Once()
-				m.On("AddField", "OPEN FREQUENCY", uint32(sim.DEFINE_ID)).Return(nil).Once()
-				m.On("AddField", "TYPE", uint32(sim.DEFINE_ID)).Return(nil).Once()
-				m.On("AddField", "FREQUENCY", uint32(sim.DEFINE_ID)).Return(nil).Once()
-				m.On("AddField", "NAME", uint32(sim.DEFINE_ID)).Return(nil).Once()
-				m.On("AddField", "CLOSE FREQUENCY", uint32(sim.DEFINE_ID)).Return(nil).Once()
-				m.On("AddField", "CLOSE AIRPORT", uint32(sim.DEFINE_ID)).Return(nil).Once()
+				m.On("AddField", "OPEN AIRPORT", uint32(sim.FirstDefineID)).Return(nil).Once()
+				m.On("AddField", "OPEN FREQUENCY", uint32(sim.FirstDefineID)).Return(nil).Once()
+				m.On("AddField", "TYPE", uint32(sim.FirstDefineID)).Return(nil).Once()
+				m.On("AddField", "FREQUENCY", uint32(sim.FirstDefineID)).Return(nil).Once()
+				m.On("AddField", "NAME", uint32(sim.FirstDefineID)).Return(nil).Once()
+				m.On("AddField", "CLOSE FREQUENCY", uint32(sim.FirstDefineID)).Return(nil).Once()
+				m.On("AddField", "CLOSE AIRPORT", uint32(sim.FirstDefineID)).Return(nil).Once()
 
 				// Expect RequestFacilityData
-				m.On("RequestFacilityData", "KJFK", "", uint32(sim.DEFINE_ID), uint32(sim.REQUEST_ID)).Return(nil).Once()
+				m.On("RequestFacilityData", "KJFK", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once()
 
 				// Mock frequency data response
-				freqData := testutil.CreateFacilityDataResponse(6, 118700000, "Tower")
+				freqData := testutil.CreateFacilityDataResponse(sim.FirstRequestID, 6, 118700000, "Tower")
 				m.On("GetNextDispatch").Return(freqData, true).Once()
 
 				// Mock facility data end
-				endData := testutil.CreateFacilityDataEndResponse()
+				endData := testutil.CreateFacilityDataEndResponse(sim.FirstRequestID)
 				m.On("GetNextDispatch").Return(endData, true).Once()
+				m.On("GetNextDispatch").Return(nil, false).Maybe()
 
 				// Expect Close call
 				m.On("Close").Return().Once()
@@ -57,6 +60,7 @@ func TestClient_GetAirportFrequencies(t *testing.T) {
 					Name:     "Tower",
 					Hz:       118700000,
 					MHz:      118.7,
+					Source:   sim.SourceSimulator,
 				},
 			},
 			expectedError: "",
@@ -76,9 +80,9 @@ func TestClient_GetAirportFrequencies(t *testing.T) {
 			icao:    "KLAX",
 			timeout: 100 * time.Millisecond,
 			mockSetup: func(m *sim.MockConnection) {
-				m.On("Open", "go-freq-client").Return(nil).Once()
+				m.On("Open", "atc-freq").Return(nil).Once()
 				m.On("AddField", mock.Anything, mock.Anything).Return(nil).Times(7)
-				m.On("RequestFacilityData", "KLAX", "", uint32(sim.DEFINE_ID), uint32(sim.REQUEST_ID)).Return(nil).Once()
+				m.On("RequestFacilityData", "KLAX", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once()
 
 				// Never return valid data, causing timeout
 				m.On("GetNextDispatch").Return(nil, false).Maybe()
@@ -86,7 +90,43 @@ func TestClient_GetAirportFrequencies(t *testing.T) {
 				m.On("Close").Return().Once()
 			},
 			expectedFreqs: []sim.AirportFrequency{},
-			expectedError: "timeout waiting for facility data end (got 0 frequencies so far)",
+			expectedError: "timeout waiting for frequencies (got 0 so far)",
+		},
+		{
+			name:    "unknown icao",
+			icao:    "XXXX",
+			timeout: 5 * time.Second,
+			mockSetup: func(m *sim.MockConnection) {
+				m.On("Open", "atc-freq").Return(nil).Once()
+				m.On("AddField", mock.Anything, mock.Anything).Return(nil).Times(7)
+				m.On("RequestFacilityData", "XXXX", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once()
+
+				// The sim ends the request without sending any facility record
+				m.On("GetNextDispatch").Return(testutil.CreateFacilityDataEndResponse(sim.FirstRequestID), true).Once()
+				m.On("GetNextDispatch").Return(nil, false).Maybe()
+
+				m.On("Close").Return().Once()
+			},
+			expectedError: "unknown facility: [XXXX]",
+		},
+		{
+			name:    "exception from simulator",
+			icao:    "EDDB",
+			timeout: 5 * time.Second,
+			mockSetup: func(m *sim.MockConnection) {
+				m.On("Open", "atc-freq").Return(nil).Once()
+				m.On("AddField", mock.Anything, mock.Anything).Return(nil).Times(7)
+				sent := make(chan time.Time)
+				m.On("RequestFacilityData", "EDDB", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once().
+					Run(func(mock.Arguments) { close(sent) })
+
+				// The request is the 8th packet, after the 7 fields of the definition
+				m.On("GetNextDispatch").Return(testutil.CreateExceptionResponse(3, 8, 1), true).Once().WaitUntil(sent)
+				m.On("GetNextDispatch").Return(nil, false).Maybe()
+
+				m.On("Close").Return().Once()
+			},
+			expectedError: "SimConnect exception SIMCONNECT_EXCEPTION_UNRECOGNIZED_ID (sendID: 8, index: 1)",
 		},
 	}
 
@@ -98,6 +138,7 @@ func TestClient_GetAirportFrequencies(t *testing.T) {
 			client := sim.NewClient(mockConn)
 
 			freqs, err := client.GetAirportFrequencies(tt.icao, tt.timeout)
+			client.Close()
 
 			if tt.expectedError != "" {
 				assert.Error(t, err)
@@ -111,3 +152,172 @@ func TestClient_GetAirportFrequencies(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_GetAirportFrequenciesCtx_Cancelled(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	mockConn.On("AddField", mock.Anything, mock.Anything).Return(nil).Times(7)
+
+	// The user cancels right after the request was sent, the sim never answers
+	mockConn.On("RequestFacilityData", "EDDB", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once().
+		Run(func(mock.Arguments) { cancel() })
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	freqs, err := client.GetAirportFrequenciesCtx(ctx, "EDDB")
+	client.Close()
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, freqs)
+	mockConn.AssertExpectations(t)
+}
+
+func TestClient_GetAirportFrequenciesBatch(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	mockConn.On("AddField", mock.Anything, uint32(sim.FirstDefineID)).Return(nil).Times(7)
+
+	// All requests share one definition, repeated airports are requested once
+	mockConn.On("RequestFacilityData", "EDDB", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once()
+	mockConn.On("RequestFacilityData", "XXXX", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID+1)).Return(nil).Once()
+	mockConn.On("RequestFacilityData", "EDDH", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID+2)).Return(nil).Once()
+
+	// The answers interleave, frequencies belong to the AIRPORT record named by their parent ID
+	for _, recv := range [][]byte{
+		testutil.CreateAirportRecordResponse(sim.FirstRequestID, 10),
+		testutil.CreateAirportRecordResponse(sim.FirstRequestID+2, 11),
+		testutil.CreateFrequencyRecordResponse(sim.FirstRequestID+2, 12, 11, 6, 121280000, "Hamburg Tower"),
+		testutil.CreateFrequencyRecordResponse(sim.FirstRequestID, 13, 10, 1, 123080000, "Brandenburg ATIS"),
+		testutil.CreateFacilityDataEndResponse(sim.FirstRequestID + 1),
+		testutil.CreateFrequencyRecordResponse(sim.FirstRequestID, 14, 10, 6, 118800000, "Brandenburg Tower"),
+		testutil.CreateFacilityDataEndResponse(sim.FirstRequestID + 2),
+		testutil.CreateFacilityDataEndResponse(sim.FirstRequestID),
+	} {
+		mockConn.On("GetNextDispatch").Return(recv, true).Once()
+	}
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	freqs, err := client.GetAirportFrequenciesBatch([]string{"eddb", "XXXX", "EDDH", "EDDB"}, 5*time.Second)
+	client.Close()
+
+	var batchErr *sim.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Len(t, batchErr.Errors, 1)
+	assert.ErrorIs(t, batchErr.Errors["XXXX"], sim.ErrUnknownFacility)
+	assert.ErrorIs(t, err, sim.ErrUnknownFacility)
+
+	require.Len(t, freqs, 2)
+	assert.Equal(t, []sim.AirportFrequency{
+		{Type: "ATIS", TypeCode: 1, Name: "Brandenburg ATIS", Hz: 123080000, MHz: 123.08, Source: sim.SourceSimulator},
+		{Type: "TOWER", TypeCode: 6, Name: "Brandenburg Tower", Hz: 118800000, MHz: 118.8, Source: sim.SourceSimulator},
+	}, freqs["EDDB"])
+	assert.Equal(t, []sim.AirportFrequency{
+		{Type: "TOWER", TypeCode: 6, Name: "Hamburg Tower", Hz: 121280000, MHz: 121.28, Source: sim.SourceSimulator},
+	}, freqs["EDDH"])
+	mockConn.AssertExpectations(t)
+}
+
+func TestClient_GetAirportFrequenciesBatch_PartialFailure(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+
+	// The 7 fields of the definition are packets 1-7, the requests packets 8-10
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	mockConn.On("AddField", mock.Anything, uint32(sim.FirstDefineID)).Return(nil).Times(7)
+	mockConn.On("RequestFacilityData", "EDDB", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once()
+	mockConn.On("RequestFacilityData", "KLAX", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID+1)).Return(nil).Once()
+	sent := make(chan time.Time)
+	mockConn.On("RequestFacilityData", "EDDH", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID+2)).Return(nil).Once().
+		Run(func(mock.Arguments) { close(sent) })
+
+	// KLAX is rejected and the frequency record of EDDH is truncated, EDDB still arrives
+	for i, recv := range [][]byte{
+		testutil.CreateAirportRecordResponse(sim.FirstRequestID, 10),
+		testutil.CreateExceptionResponse(3, 9, 1),
+		testutil.CreateAirportRecordResponse(sim.FirstRequestID+2, 11),
+		testutil.CreateFacilityRecordResponse(sim.FirstRequestID+2, 12, 11, sim.SIMCONNECT_FACILITY_DATA_FREQUENCY, 0, uint32(6)),
+		testutil.CreateFrequencyRecordResponse(sim.FirstRequestID, 13, 10, 6, 118800000, "Brandenburg Tower"),
+		testutil.CreateFacilityDataEndResponse(sim.FirstRequestID + 2),
+		testutil.CreateFacilityDataEndResponse(sim.FirstRequestID),
+	} {
+		call := mockConn.On("GetNextDispatch").Return(recv, true).Once()
+		if i == 0 {
+			call.WaitUntil(sent)
+		}
+	}
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	freqs, err := client.GetAirportFrequenciesBatch([]string{"EDDB", "KLAX", "EDDH"}, 5*time.Second)
+	client.Close()
+
+	var batchErr *sim.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Len(t, batchErr.Errors, 2)
+	var exception *sim.ExceptionError
+	assert.ErrorAs(t, batchErr.Errors["KLAX"], &exception)
+	assert.ErrorIs(t, batchErr.Errors["EDDH"], sim.ErrMalformedDispatch)
+
+	assert.Equal(t, map[string][]sim.AirportFrequency{
+		"EDDB": {{Type: "TOWER", TypeCode: 6, Name: "Brandenburg Tower", Hz: 118800000, MHz: 118.8, Source: sim.SourceSimulator}},
+	}, freqs)
+	mockConn.AssertExpectations(t)
+}
+
+func TestClient_GetAirportFrequenciesBatchCtx_Cancelled(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	mockConn.On("AddField", mock.Anything, mock.Anything).Return(nil).Times(7)
+	mockConn.On("RequestFacilityData", "EDDB", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once()
+	mockConn.On("RequestFacilityData", "EDDH", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID+1)).Return(nil).Once().
+		Run(func(mock.Arguments) { cancel() })
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	freqs, err := client.GetAirportFrequenciesBatchCtx(ctx, []string{"EDDB", "EDDH"})
+	client.Close()
+
+	// Every airport still waiting gets its own error
+	var batchErr *sim.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Len(t, batchErr.Errors, 2)
+	assert.ErrorIs(t, batchErr.Errors["EDDH"], context.Canceled)
+	assert.Empty(t, freqs)
+	mockConn.AssertExpectations(t)
+}
+
+func TestClient_GetWeatherCtx_Cancelled(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	mockConn.On("RequestWeatherObservation", "EDDB", uint32(sim.FirstRequestID)).Return(nil).Once()
+	mockConn.On("RequestWeatherObservation", "EDDH", uint32(sim.FirstRequestID+1)).Return(nil).Once().
+		Run(func(mock.Arguments) { cancel() })
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	start := time.Now()
+	weather, err := client.GetWeatherCtx(ctx, []string{"eddb", "eddh"})
+	client.Close()
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, weather)
+	assert.Less(t, time.Since(start), time.Second)
+	mockConn.AssertExpectations(t)
+}
@@ -0,0 +1,504 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	// CloudGridSize is the number of rows and columns of the cloud state grid
+	CloudGridSize = 64
+	// DefaultCloudBoxKm is the side of the square requested around a position
+	DefaultCloudBoxKm = 5.0
+	// maxCloudProfileLevels bounds the cloud state requests of one profile
+	maxCloudProfileLevels = 200
+	// maxCloudSweepRequests bounds the cloud state requests of the profiles of all positions of a sweep
+	maxCloudSweepRequests = 1000
+)
+
+// kmPerDegreeLat is the length of a degree of latitude, a degree of longitude is shorter by cos(latitude)
+const kmPerDegreeLat = 111.0
+
+// CloudGrid is the cloud density of an area between two altitudes. Cells are stored row by row,
+// rows run from the south edge of the area to the north edge and columns from west to east.
+type CloudGrid struct {
+	Min    Coordinates `json:"min"`     // South west corner
+	Max    Coordinates `json:"max"`     // North east corner
+	MinAlt int         `json:"min_alt"` // Feet
+	MaxAlt int         `json:"max_alt"` // Feet
+	Cells  []byte      `json:"cells"`   // CloudGridSize*CloudGridSize raw densities (0-255), base64 in JSON
+
+	MaxValue byte    `json:"max_value"` // Densest cell
+	Mean     float64 `json:"mean"`      // Mean density (0-255)
+	Coverage float64 `json:"coverage"`  // Fraction of cells with any cloud (0-1)
+}
+
+// newCloudGrid computes the statistics of the cells of the grid
+func newCloudGrid(minCoords, maxCoords Coordinates, minAlt, maxAlt int, cells []byte) *CloudGrid {
+	grid := &CloudGrid{Min: minCoords, Max: maxCoords, MinAlt: minAlt, MaxAlt: maxAlt, Cells: cells}
+	if len(cells) == 0 {
+		return grid
+	}
+
+	sum, cloudy := 0, 0
+	for _, value := range cells {
+		sum += int(value)
+		if value > 0 {
+			cloudy++
+		}
+		grid.MaxValue = max(grid.MaxValue, value)
+	}
+	grid.Mean = float64(sum) / float64(len(cells))
+	grid.Coverage = float64(cloudy) / float64(len(cells))
+	return grid
+}
+
+// Cell returns the density of the cell at row and col, the range of the grid as its altitudes
+func (grid *CloudGrid) Cell(row, col int) CloudDensity {
+	index := row*CloudGridSize + col
+	if row < 0 || col < 0 || col >= CloudGridSize || index >= len(grid.Cells) {
+		return CloudDensity{MinAlt: grid.MinAlt, MaxAlt: grid.MaxAlt}
+	}
+	density := interpretCloudDensity(grid.Cells[index])
+	density.MinAlt = grid.MinAlt
+	density.MaxAlt = grid.MaxAlt
+	return density
+}
+
+// CellCoordinates returns the centre of the cell at row and col
+func (grid *CloudGrid) CellCoordinates(row, col int) Coordinates {
+	return Coordinates{
+		Lat: grid.Min.Lat + (grid.Max.Lat-grid.Min.Lat)*(float64(row)+0.5)/CloudGridSize,
+		Lon: grid.Min.Lon + (grid.Max.Lon-grid.Min.Lon)*(float64(col)+0.5)/CloudGridSize,
+	}
+}
+
+// Center returns the density of the cell at the centre of the grid
+func (grid *CloudGrid) Center() CloudDensity {
+	return grid.Cell(CloudGridSize/2, CloudGridSize/2)
+}
+
+// cloudBox returns the south west and north east corners of a square of boxKm around coords
+func cloudBox(coords Coordinates, boxKm float64) (Coordinates, Coordinates) {
+	latOffset := boxKm / 2 / kmPerDegreeLat
+	lonOffset := boxKm / 2 / (kmPerDegreeLat * math.Cos(coords.Lat*math.Pi/180))
+	return Coordinates{Lat: coords.Lat - latOffset, Lon: coords.Lon - lonOffset},
+		Coordinates{Lat: coords.Lat + latOffset, Lon: coords.Lon + lonOffset}
+}
+
+// GetCloudGrid retrieves the cloud density of a square of boxKm around coords between minAlt and maxAlt feet,
+// waiting at most timeout
+func (client *Client) GetCloudGrid(coords Coordinates, boxKm float64, minAlt, maxAlt int, timeout time.Duration) (*CloudGrid, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return client.GetCloudGridCtx(ctx, coords, boxKm, minAlt, maxAlt)
+}
+
+// GetCloudGridCtx retrieves the cloud density of a square of boxKm around coords between minAlt and maxAlt feet
+// until ctx is done
+func (client *Client) GetCloudGridCtx(ctx context.Context, coords Coordinates, boxKm float64, minAlt, maxAlt int) (*CloudGrid, error) {
+	if boxKm <= 0 {
+		return nil, fmt.Errorf("invalid cloud box of %g km", boxKm)
+	}
+	if maxAlt <= minAlt {
+		return nil, fmt.Errorf("invalid cloud altitudes %d-%d ft", minAlt, maxAlt)
+	}
+
+	session := client.session
+	sub, err := session.subscribe(1)
+	if err != nil {
+		return nil, err
+	}
+	defer sub.cancel()
+	requestID := sub.requestIDs[0]
+
+	minCoords, maxCoords := cloudBox(coords, boxKm)
+	_, err = session.send(sub, func() error {
+		return session.connection.RequestCloudState(
+			requestID,
+			float32(minCoords.Lat), float32(minCoords.Lon), float32(minAlt),
+			float32(maxCoords.Lat), float32(maxCoords.Lon), float32(maxAlt),
+		)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to request cloud state: %w", err)
+	}
+
+	for {
+		var d dispatch
+		select {
+		case d = <-sub.recv:
+		case <-ctx.Done():
+			return nil, doneError(ctx, &TimeoutError{Waiting: "cloud state"})
+		}
+
+		switch d.id {
+		case SIMCONNECT_RECV_ID_QUIT:
+			return nil, errSimulatorQuit
+		case SIMCONNECT_RECV_ID_EXCEPTION:
+			return nil, newExceptionError(d)
+		case SIMCONNECT_RECV_ID_CLOUD_STATE:
+			cloudData, rawData, err := decodeCloudState(d)
+			if err != nil {
+				return nil, err
+			}
+			if cloudData.DwRequestID != requestID {
+				continue
+			}
+			// rawData points into the message, the grid keeps its own copy
+			cells := make([]byte, len(rawData))
+			copy(cells, rawData)
+			return newCloudGrid(minCoords, maxCoords, minAlt, maxAlt, cells), nil
+		}
+	}
+}
+
+// CloudProfileOptions selects the altitudes of a CloudProfile, from MinAlt up to MaxAlt feet in levels of Step feet
+type CloudProfileOptions struct {
+	MinAlt int
+	MaxAlt int
+	Step   int
+}
+
+// DefaultCloudProfile covers the ground up to 10000 ft in 500 ft levels
+var DefaultCloudProfile = CloudProfileOptions{MinAlt: 0, MaxAlt: 10000, Step: 500}
+
+// Validate checks the range and that it doesn't need too many cloud state requests
+func (opts CloudProfileOptions) Validate() error {
+	if opts.Step <= 0 || opts.MaxAlt <= opts.MinAlt {
+		return fmt.Errorf("invalid cloud profile of %d-%d ft in %d ft steps", opts.MinAlt, opts.MaxAlt, opts.Step)
+	}
+	if levels := opts.levels(); levels > maxCloudProfileLevels {
+		return fmt.Errorf("cloud profile of %d-%d ft in %d ft steps needs %d levels, at most %d are allowed",
+			opts.MinAlt, opts.MaxAlt, opts.Step, levels, maxCloudProfileLevels)
+	}
+	return nil
+}
+
+// ValidateSweep checks opts like Validate and that the profiles of positions don't need too many
+// cloud state requests together
+func (opts CloudProfileOptions) ValidateSweep(positions int) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if requests := positions * opts.levels(); requests > maxCloudSweepRequests {
+		return fmt.Errorf("cloud profiles of %d positions in %d levels need %d requests, at most %d are allowed",
+			positions, opts.levels(), requests, maxCloudSweepRequests)
+	}
+	return nil
+}
+
+// levels returns the number of levels, the last one is cut at MaxAlt
+func (opts CloudProfileOptions) levels() int {
+	return (opts.MaxAlt - opts.MinAlt + opts.Step - 1) / opts.Step
+}
+
+// CloudProfile is the cloud density above a position level by level
+type CloudProfile struct {
+	Levels []CloudDensity      `json:"levels"` // Density at the position, from MinAlt up. Levels that failed have no Coverage.
+	Layers []CloudProfileLayer `json:"layers"` // Adjacent cloudy levels merged, from the lowest up
+}
+
+// CloudProfileLayer is a cloud layer of a CloudProfile
+type CloudProfileLayer struct {
+	Base       int     `json:"base"`       // Feet
+	Top        int     `json:"top"`        // Feet
+	Thickness  int     `json:"thickness"`  // Feet
+	MaxValue   byte    `json:"max_value"`  // Densest level of the layer (0-255)
+	Coverage   string  `json:"coverage"`   // Coverage of the densest level
+	Percentage float64 `json:"percentage"` // Density of the densest level (0-100)
+}
+
+// CloudDensities is the cloud density of the waypoints that answered, with the levels that failed
+type CloudDensities struct {
+	Clouds   map[string][]CloudDensity     `json:"clouds"`
+	Failures map[string][]CloudBandFailure `json:"failures,omitempty"` // By waypoint, nil when every level was answered
+	Unknown  []string                      `json:"unknown,omitempty"`  // Waypoints the simulator doesn't know
+}
+
+// CloudProfiles is the cloud profile of the waypoints that answered, with the levels that failed
+type CloudProfiles struct {
+	Profiles map[string]*CloudProfile      `json:"profiles"`
+	Failures map[string][]CloudBandFailure `json:"failures,omitempty"` // By waypoint, nil when every level was answered
+	Unknown  []string                      `json:"unknown,omitempty"`  // Waypoints the simulator doesn't know
+}
+
+// CloudBandFailure is a level the simulator didn't answer, the *CloudBandError for clients that get it as data
+type CloudBandFailure struct {
+	MinAlt int    `json:"min_alt"` // Feet
+	MaxAlt int    `json:"max_alt"` // Feet
+	Error  string `json:"error"`
+}
+
+// NewCloudDensities keeps the clouds GetCloudDensityCtx returned together with the levels that failed
+// and the unknown waypoints. It returns err when no level was answered or err is more than that.
+func NewCloudDensities(clouds map[string][]CloudDensity, err error) (*CloudDensities, error) {
+	failures, unknown, err := cloudBandFailures(len(clouds), err)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudDensities{Clouds: clouds, Failures: failures, Unknown: unknown}, nil
+}
+
+// NewCloudProfiles keeps the profiles GetCloudProfileCtx returned together with the levels that failed
+// and the unknown waypoints. It returns err when no level was answered or err is more than that.
+func NewCloudProfiles(profiles map[string]*CloudProfile, err error) (*CloudProfiles, error) {
+	failures, unknown, err := cloudBandFailures(len(profiles), err)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudProfiles{Profiles: profiles, Failures: failures, Unknown: unknown}, nil
+}
+
+// cloudBandFailures lists the *CloudBandError of every waypoint and the unknown waypoints of the
+// *BatchError returned with answered partial results, any other error fails the request
+func cloudBandFailures(answered int, err error) (map[string][]CloudBandFailure, []string, error) {
+	if err == nil {
+		return nil, nil, nil
+	}
+	var batchErr *BatchError
+	if answered == 0 || !errors.As(err, &batchErr) {
+		return nil, nil, err
+	}
+
+	var failures map[string][]CloudBandFailure
+	var unknown []string
+	for _, wp := range batchErr.idents() {
+		wpErr := batchErr.Errors[wp]
+		var unknownErr *UnknownFacilityError
+		if errors.As(wpErr, &unknownErr) {
+			unknown = append(unknown, wp)
+			continue
+		}
+
+		// The bands of a waypoint are joined
+		bandErrs := []error{wpErr}
+		if joined, ok := wpErr.(interface{ Unwrap() []error }); ok {
+			bandErrs = joined.Unwrap()
+		}
+		for _, bandErr := range bandErrs {
+			var band *CloudBandError
+			if !errors.As(bandErr, &band) {
+				return nil, nil, err
+			}
+			if failures == nil {
+				failures = make(map[string][]CloudBandFailure)
+			}
+			failures[wp] = append(failures[wp], CloudBandFailure{MinAlt: band.MinAlt, MaxAlt: band.MaxAlt, Error: band.Err.Error()})
+		}
+	}
+	return failures, unknown, nil
+}
+
+// newCloudProfile merges the adjacent levels with any cloud into layers. Levels that failed have no
+// Coverage, they are never part of a layer and end the one below them.
+func newCloudProfile(levels []CloudDensity) *CloudProfile {
+	profile := &CloudProfile{Levels: levels, Layers: []CloudProfileLayer{}}
+
+	var layer *CloudProfileLayer
+	for _, level := range levels {
+		if level.Value == 0 || level.Coverage == "" {
+			layer = nil
+			continue
+		}
+		if layer == nil {
+			profile.Layers = append(profile.Layers, CloudProfileLayer{Base: level.MinAlt})
+			layer = &profile.Layers[len(profile.Layers)-1]
+		}
+		layer.Top = level.MaxAlt
+		layer.Thickness = layer.Top - layer.Base
+		if level.Value > layer.MaxValue {
+			layer.MaxValue = level.Value
+			layer.Coverage = level.Coverage
+			layer.Percentage = level.Percentage
+		}
+	}
+	return profile
+}
+
+// GetCloudProfile retrieves the cloud density above coords for the levels of opts, waiting at most timeout
+func (client *Client) GetCloudProfile(coords Coordinates, opts CloudProfileOptions, timeout time.Duration) (*CloudProfile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return client.GetCloudProfileCtx(ctx, coords, opts)
+}
+
+// GetCloudProfileCtx retrieves the cloud density above coords for the levels of opts until ctx is done.
+// The density of a level is the one of the centre cell of its DefaultCloudBoxKm grid. Levels that
+// failed are reported as *CloudBandError, joined and returned together with the profile.
+func (client *Client) GetCloudProfileCtx(ctx context.Context, coords Coordinates, opts CloudProfileOptions) (*CloudProfile, error) {
+	profiles, bandErrs, err := client.sweepClouds(ctx, []Coordinates{coords}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(bandErrs[0]) == len(profiles[0].Levels) {
+		return nil, errors.Join(bandErrs[0]...)
+	}
+	return profiles[0], errors.Join(bandErrs[0]...)
+}
+
+// GetCloudProfiles retrieves the cloud profiles of several waypoints at once, waiting at most timeout
+func (client *Client) GetCloudProfiles(coords map[string]Coordinates, opts CloudProfileOptions, timeout time.Duration) (map[string]*CloudProfile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return client.GetCloudProfilesCtx(ctx, coords, opts)
+}
+
+// GetCloudProfilesCtx retrieves the cloud profiles of several waypoints until ctx is done. The levels of
+// every waypoint are requested at once and the replies collected in any order. Waypoints with levels that
+// failed are reported in a *BatchError returned together with the profiles, their profile is left out
+// only when no level was answered.
+func (client *Client) GetCloudProfilesCtx(ctx context.Context, coords map[string]Coordinates, opts CloudProfileOptions) (map[string]*CloudProfile, error) {
+	if len(coords) == 0 {
+		return nil, fmt.Errorf("no waypoints provided")
+	}
+
+	waypoints := slices.Sorted(maps.Keys(coords))
+	positions := make([]Coordinates, len(waypoints))
+	for i, wp := range waypoints {
+		positions[i] = coords[wp]
+	}
+
+	profiles, bandErrs, err := client.sweepClouds(ctx, positions, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*CloudProfile, len(waypoints))
+	batchErr := &BatchError{Errors: make(map[string]error)}
+	for i, wp := range waypoints {
+		if len(bandErrs[i]) > 0 {
+			batchErr.Errors[wp] = errors.Join(bandErrs[i]...)
+		}
+		if len(bandErrs[i]) < len(profiles[i].Levels) {
+			result[wp] = profiles[i]
+		}
+	}
+	if len(batchErr.Errors) > 0 {
+		return result, batchErr
+	}
+	return result, nil
+}
+
+// cloudBand is a level of the profile of a position requested by a cloud sweep
+type cloudBand struct {
+	position int
+	level    int
+	minAlt   int
+	maxAlt   int
+}
+
+// sweepClouds requests every level of opts above every position on the one connection, each with a
+// request ID of its own, and collects the replies in any order. The profiles and the *CloudBandError
+// of the levels that failed, from the lowest up, are returned by position.
+func (client *Client) sweepClouds(ctx context.Context, positions []Coordinates, opts CloudProfileOptions) ([]*CloudProfile, [][]error, error) {
+	if err := opts.ValidateSweep(len(positions)); err != nil {
+		return nil, nil, err
+	}
+
+	levels := opts.levels()
+	session := client.session
+	sub, err := session.subscribe(len(positions) * levels)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer sub.cancel()
+
+	densities := make([][]CloudDensity, len(positions))
+	bandErrs := make([][]error, len(positions))
+	pending := make(map[uint32]cloudBand, len(sub.requestIDs))
+	// sendIDToRequestID matches exceptions to the band whose request caused them
+	sendIDToRequestID := make(map[uint32]uint32, len(sub.requestIDs))
+	for i, coords := range positions {
+		minCoords, maxCoords := cloudBox(coords, DefaultCloudBoxKm)
+		densities[i] = make([]CloudDensity, levels)
+		for level := range levels {
+			band := cloudBand{position: i, level: level, minAlt: opts.MinAlt + level*opts.Step}
+			band.maxAlt = min(band.minAlt+opts.Step, opts.MaxAlt)
+			densities[i][level] = CloudDensity{MinAlt: band.minAlt, MaxAlt: band.maxAlt}
+
+			requestID := sub.requestIDs[i*levels+level]
+			sendID, err := session.send(sub, func() error {
+				return session.connection.RequestCloudState(
+					requestID,
+					float32(minCoords.Lat), float32(minCoords.Lon), float32(band.minAlt),
+					float32(maxCoords.Lat), float32(maxCoords.Lon), float32(band.maxAlt),
+				)
+			})
+			if err != nil {
+				bandErrs[i] = append(bandErrs[i], &CloudBandError{MinAlt: band.minAlt, MaxAlt: band.maxAlt, Err: fmt.Errorf("failed to request cloud state: %w", err)})
+				continue
+			}
+			pending[requestID] = band
+			sendIDToRequestID[sendID] = requestID
+		}
+	}
+
+	expected := len(pending)
+	timedOut := false
+	for len(pending) > 0 && !timedOut {
+		var d dispatch
+		select {
+		case d = <-sub.recv:
+		case <-ctx.Done():
+			timedOut = true
+			continue
+		}
+
+		var requestID uint32
+		var bandErr error
+		switch d.id {
+		case SIMCONNECT_RECV_ID_QUIT:
+			return nil, nil, errSimulatorQuit
+		case SIMCONNECT_RECV_ID_EXCEPTION:
+			exception, ok := newExceptionError(d).(*ExceptionError)
+			if !ok {
+				continue
+			}
+			requestID, bandErr = sendIDToRequestID[exception.SendID], exception
+		case SIMCONNECT_RECV_ID_CLOUD_STATE:
+			requestID, _ = d.requestID()
+		default:
+			continue
+		}
+
+		band, exists := pending[requestID]
+		if !exists {
+			continue
+		}
+		delete(pending, requestID)
+
+		if bandErr == nil {
+			var rawData []byte
+			_, rawData, bandErr = decodeCloudState(d)
+			if bandErr == nil {
+				grid := CloudGrid{MinAlt: band.minAlt, MaxAlt: band.maxAlt, Cells: rawData}
+				densities[band.position][band.level] = grid.Center()
+				continue
+			}
+		}
+		bandErrs[band.position] = append(bandErrs[band.position], &CloudBandError{MinAlt: band.minAlt, MaxAlt: band.maxAlt, Err: bandErr})
+	}
+
+	for _, band := range pending {
+		err := doneError(ctx, &TimeoutError{Waiting: "cloud state", Received: expected - len(pending), Expected: expected})
+		bandErrs[band.position] = append(bandErrs[band.position], &CloudBandError{MinAlt: band.minAlt, MaxAlt: band.maxAlt, Err: err})
+	}
+
+	profiles := make([]*CloudProfile, len(positions))
+	for i := range positions {
+		profiles[i] = newCloudProfile(densities[i])
+		slices.SortFunc(bandErrs[i], func(a, b error) int {
+			return a.(*CloudBandError).MinAlt - b.(*CloudBandError).MinAlt
+		})
+	}
+	return profiles, bandErrs, nil
+}
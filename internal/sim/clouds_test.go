@@ -0,0 +1,229 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"atc_freq/internal/testutil"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_GetCloudGrid(t *testing.T) {
+	// A cloud in the north east quarter of the grid
+	cells := make([]byte, sim.CloudGridSize*sim.CloudGridSize)
+	for row := sim.CloudGridSize / 2; row < sim.CloudGridSize; row++ {
+		for col := sim.CloudGridSize / 2; col < sim.CloudGridSize; col++ {
+			cells[row*sim.CloudGridSize+col] = 200
+		}
+	}
+	cells[0] = 20
+
+	mockConn := new(sim.MockConnection)
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	mockConn.On("RequestCloudState", uint32(sim.FirstRequestID),
+		mock.AnythingOfType("float32"), mock.AnythingOfType("float32"), float32(2000),
+		mock.AnythingOfType("float32"), mock.AnythingOfType("float32"), float32(2500)).Return(nil).Once()
+	mockConn.On("GetNextDispatch").Return(testutil.CreateCloudStateResponse(sim.FirstRequestID, cells), true).Once()
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+	grid, err := client.GetCloudGrid(sim.Coordinates{Lat: 60, Lon: 10}, 10, 2000, 2500, 5*time.Second)
+	client.Close()
+	require.NoError(t, err)
+	mockConn.AssertExpectations(t)
+
+	// 10 km are 0.09 degrees of latitude and twice as many of longitude at 60 degrees north
+	assert.InDelta(t, 59.955, grid.Min.Lat, 0.001)
+	assert.InDelta(t, 60.045, grid.Max.Lat, 0.001)
+	assert.InDelta(t, 9.910, grid.Min.Lon, 0.001)
+	assert.InDelta(t, 10.090, grid.Max.Lon, 0.001)
+
+	assert.Equal(t, byte(200), grid.MaxValue)
+	assert.InDelta(t, (1024*200+20)/4096.0, grid.Mean, 1e-9)
+	assert.InDelta(t, 1025/4096.0, grid.Coverage, 1e-9)
+
+	assert.Equal(t, sim.CloudDensity{Value: 200, Percentage: 200 / 255.0 * 100, Coverage: "OVC", MinAlt: 2000, MaxAlt: 2500}, grid.Center())
+	assert.Equal(t, "FEW", grid.Cell(0, 0).Coverage)
+	assert.Equal(t, "CLR", grid.Cell(sim.CloudGridSize-1, 0).Coverage)
+
+	southWest := grid.CellCoordinates(0, 0)
+	assert.Greater(t, southWest.Lat, grid.Min.Lat)
+	assert.Less(t, southWest.Lat, grid.CellCoordinates(1, 0).Lat)
+	assert.Less(t, southWest.Lon, grid.CellCoordinates(0, 1).Lon)
+	center := grid.CellCoordinates(sim.CloudGridSize/2, sim.CloudGridSize/2)
+	assert.InDelta(t, 60, center.Lat, 0.001)
+	assert.InDelta(t, 10, center.Lon, 0.002)
+}
+
+func TestClient_GetCloudGrid_Invalid(t *testing.T) {
+	client := sim.NewClient(new(sim.MockConnection))
+
+	_, err := client.GetCloudGrid(sim.Coordinates{}, 0, 0, 500, time.Second)
+	assert.ErrorContains(t, err, "invalid cloud box")
+
+	_, err = client.GetCloudGrid(sim.Coordinates{}, 5, 500, 500, time.Second)
+	assert.ErrorContains(t, err, "invalid cloud altitudes 500-500 ft")
+}
+
+func TestCloudProfileOptions_Validate(t *testing.T) {
+	assert.NoError(t, sim.DefaultCloudProfile.Validate())
+	assert.NoError(t, sim.CloudProfileOptions{MinAlt: 1000, MaxAlt: 1100, Step: 250}.Validate())
+
+	assert.Error(t, sim.CloudProfileOptions{MinAlt: 0, MaxAlt: 10000, Step: 0}.Validate())
+	assert.Error(t, sim.CloudProfileOptions{MinAlt: 5000, MaxAlt: 5000, Step: 500}.Validate())
+	assert.ErrorContains(t, sim.CloudProfileOptions{MinAlt: 0, MaxAlt: 45000, Step: 100}.Validate(), "needs 450 levels")
+
+	// The profiles of a sweep are bounded together, 50 default profiles are 1000 requests
+	assert.NoError(t, sim.DefaultCloudProfile.ValidateSweep(50))
+	assert.ErrorContains(t, sim.DefaultCloudProfile.ValidateSweep(51), "need 1020 requests")
+	assert.Error(t, sim.CloudProfileOptions{MinAlt: 0, MaxAlt: 10000, Step: 0}.ValidateSweep(1))
+}
+
+func TestClient_GetCloudProfiles(t *testing.T) {
+	// The centre cell of a grid of density
+	grid := func(density byte) []byte {
+		cells := make([]byte, sim.CloudGridSize*sim.CloudGridSize)
+		cells[sim.CloudGridSize/2*sim.CloudGridSize+sim.CloudGridSize/2] = density
+		return cells
+	}
+	// EDDB gets request IDs 0-2 for 0-1500 ft, EDDH 3-5
+	requestID := func(i int) uint32 { return uint32(sim.FirstRequestID + i) }
+	mockConn := new(sim.MockConnection)
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	sent := make(chan time.Time)
+	for i := range 6 {
+		call := mockConn.On("RequestCloudState", requestID(i), mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		if i == 4 {
+			call.Return(sim.ErrNotConnected).Once()
+		} else {
+			call.Return(nil).Once()
+		}
+		if i == 5 {
+			call.Run(func(mock.Arguments) { close(sent) })
+		}
+	}
+	// The replies arrive out of order once every band was sent. EDDB 1000-1500 ft, the 3rd packet,
+	// is rejected and an exception about a packet of another client is ignored.
+	for i, message := range [][]byte{
+		testutil.CreateCloudStateResponse(requestID(5), grid(0)),
+		testutil.CreateCloudStateResponse(requestID(1), grid(120)),
+		testutil.CreateExceptionResponse(3, 3, 1),
+		testutil.CreateExceptionResponse(3, 99, 1),
+		testutil.CreateCloudStateResponse(requestID(3), grid(200)),
+		testutil.CreateCloudStateResponse(requestID(0), grid(0)),
+	} {
+		call := mockConn.On("GetNextDispatch").Return(message, true).Once()
+		if i == 0 {
+			call.WaitUntil(sent)
+		}
+	}
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+	profiles, err := client.GetCloudProfiles(map[string]sim.Coordinates{
+		"EDDH": {Lat: 53.6304, Lon: 9.9882},
+		"EDDB": {Lat: 52.3514, Lon: 13.4939},
+	}, sim.CloudProfileOptions{MinAlt: 0, MaxAlt: 1500, Step: 500}, 5*time.Second)
+	client.Close()
+	mockConn.AssertExpectations(t)
+
+	var batchErr *sim.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.Len(t, batchErr.Errors, 2)
+
+	var bandErr *sim.CloudBandError
+	require.ErrorAs(t, batchErr.Errors["EDDB"], &bandErr)
+	assert.Equal(t, 1000, bandErr.MinAlt)
+	var exception *sim.ExceptionError
+	assert.ErrorAs(t, bandErr, &exception)
+
+	require.ErrorAs(t, batchErr.Errors["EDDH"], &bandErr)
+	assert.Equal(t, 500, bandErr.MinAlt)
+	assert.ErrorIs(t, bandErr, sim.ErrNotConnected)
+
+	require.Len(t, profiles, 2)
+	eddb := profiles["EDDB"]
+	assert.Equal(t, []string{"CLR", "SCT", ""}, coverages(eddb.Levels))
+	assert.Equal(t, []sim.CloudProfileLayer{{Base: 500, Top: 1000, Thickness: 500, MaxValue: 120, Coverage: "SCT", Percentage: percentage(120)}}, eddb.Layers)
+	assert.Equal(t, []string{"OVC", "", "CLR"}, coverages(profiles["EDDH"].Levels))
+
+	// Served to clients the profiles come with the levels that failed
+	result, err := sim.NewCloudProfiles(profiles, err)
+	require.NoError(t, err)
+	assert.Equal(t, profiles, result.Profiles)
+	require.Len(t, result.Failures["EDDB"], 1)
+	assert.Equal(t, 1000, result.Failures["EDDB"][0].MinAlt)
+	assert.Equal(t, 1500, result.Failures["EDDB"][0].MaxAlt)
+	assert.Equal(t, []sim.CloudBandFailure{{MinAlt: 500, MaxAlt: 1000, Error: "failed to request cloud state: " + sim.ErrNotConnected.Error()}}, result.Failures["EDDH"])
+}
+
+func TestNewCloudDensities(t *testing.T) {
+	clouds := map[string][]sim.CloudDensity{"EDDB": {{MinAlt: 0, MaxAlt: 500, Coverage: "CLR"}, {MinAlt: 500, MaxAlt: 1000}}}
+	bandErr := &sim.BatchError{Errors: map[string]error{
+		"EDDB": errors.Join(&sim.CloudBandError{MinAlt: 500, MaxAlt: 1000, Err: sim.ErrTimeout}),
+	}}
+
+	result, err := sim.NewCloudDensities(clouds, bandErr)
+	require.NoError(t, err)
+	assert.Equal(t, &sim.CloudDensities{
+		Clouds:   clouds,
+		Failures: map[string][]sim.CloudBandFailure{"EDDB": {{MinAlt: 500, MaxAlt: 1000, Error: sim.ErrTimeout.Error()}}},
+	}, result)
+
+	result, err = sim.NewCloudDensities(clouds, nil)
+	require.NoError(t, err)
+	assert.Nil(t, result.Failures)
+
+	// Without any level answered, or with a failure other than levels, the request fails
+	_, err = sim.NewCloudDensities(map[string][]sim.CloudDensity{}, bandErr)
+	assert.ErrorIs(t, err, sim.ErrTimeout)
+	_, err = sim.NewCloudDensities(clouds, sim.ErrNotConnected)
+	assert.ErrorIs(t, err, sim.ErrNotConnected)
+	_, err = sim.NewCloudDensities(clouds, &sim.BatchError{Errors: map[string]error{"EDDH": sim.ErrNotConnected}})
+	assert.ErrorIs(t, err, sim.ErrNotConnected)
+
+	// Waypoints the simulator doesn't know are listed apart from the levels
+	result, err = sim.NewCloudDensities(clouds, &sim.BatchError{Errors: map[string]error{"LUROS": &sim.UnknownFacilityError{Idents: []string{"LUROS"}}}})
+	require.NoError(t, err)
+	assert.Equal(t, &sim.CloudDensities{Clouds: clouds, Unknown: []string{"LUROS"}}, result)
+}
+
+func TestClient_GetCloudProfiles_Timeout(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	mockConn.On("RequestCloudState", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Times(2)
+	mockConn.On("GetNextDispatch").Return(testutil.CreateCloudStateResponse(sim.FirstRequestID+1, make([]byte, sim.CloudGridSize*sim.CloudGridSize)), true).Once()
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+	profile, err := client.GetCloudProfile(sim.Coordinates{Lat: 52, Lon: 13}, sim.CloudProfileOptions{MinAlt: 0, MaxAlt: 1000, Step: 500}, 100*time.Millisecond)
+	client.Close()
+
+	// The profile of the band that was answered comes with the timeout of the other one
+	var bandErr *sim.CloudBandError
+	require.ErrorAs(t, err, &bandErr)
+	assert.Equal(t, 0, bandErr.MinAlt)
+	assert.ErrorIs(t, err, sim.ErrTimeout)
+	require.NotNil(t, profile)
+	assert.Equal(t, []string{"", "CLR"}, coverages(profile.Levels))
+}
+
+func coverages(levels []sim.CloudDensity) []string {
+	result := make([]string, len(levels))
+	for i, level := range levels {
+		result[i] = level.Coverage
+	}
+	return result
+}
+
+// percentage converts a density the way the client does
+func percentage(value byte) float64 {
+	return float64(value) / 255.0 * 100.0
+}
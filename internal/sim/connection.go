@@ -1,3 +1,5 @@
+//go:build windows
+
 package sim
 
 import (
@@ -12,11 +14,6 @@ const (
 	S_OK = 0
 )
 
-const (
-	DEFINE_ID  = 0x1001
-	REQUEST_ID = 0x2001
-)
-
 type DllConnection struct {
 	dll *windows.DLL
 
@@ -26,6 +23,12 @@ type DllConnection struct {
 	requestFacilityData       *windows.Proc
 	requestWeatherObservation *windows.Proc
 	requestCloudState         *windows.Proc
+	requestFacilitiesList     *windows.Proc
+	addToDataDefinition       *windows.Proc
+	requestDataOnSimObject    *windows.Proc
+	mapClientEvent            *windows.Proc
+	transmitClientEvent       *windows.Proc
+	getLastSentPacketID       *windows.Proc
 	getNextDispatch           *windows.Proc
 
 	handler uintptr
@@ -70,12 +73,35 @@ func NewConnection() (*DllConnection, error) {
 	if err != nil {
 		return nil, err
 	}
+	reqFacList, err := mustProc("SimConnect_RequestFacilitiesList_EX1")
+	if err != nil {
+		return nil, err
+	}
+	addDataDef, err := mustProc("SimConnect_AddToDataDefinition")
+	if err != nil {
+		return nil, err
+	}
+	reqData, err := mustProc("SimConnect_RequestDataOnSimObject")
+	if err != nil {
+		return nil, err
+	}
+	mapEvent, err := mustProc("SimConnect_MapClientEventToSimEvent")
+	if err != nil {
+		return nil, err
+	}
+	transmitEvent, err := mustProc("SimConnect_TransmitClientEvent")
+	if err != nil {
+		return nil, err
+	}
+	lastSent, err := mustProc("SimConnect_GetLastSentPacketID")
+	if err != nil {
+		return nil, err
+	}
 	getDisp, err := mustProc("SimConnect_GetNextDispatch")
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Println("Connection initialized")
 	return &DllConnection{
 		dll:                       dll,
 		open:                      open,
@@ -84,6 +110,12 @@ func NewConnection() (*DllConnection, error) {
 		requestFacilityData:       reqFac,
 		requestWeatherObservation: reqWeather,
 		requestCloudState:         reqCloudState,
+		requestFacilitiesList:     reqFacList,
+		addToDataDefinition:       addDataDef,
+		requestDataOnSimObject:    reqData,
+		mapClientEvent:            mapEvent,
+		transmitClientEvent:       transmitEvent,
+		getLastSentPacketID:       lastSent,
 		getNextDispatch:           getDisp,
 	}, nil
 }
@@ -96,12 +128,15 @@ func (connection *DllConnection) Open(name string) error {
 		0, 0, 0, 0,
 	)
 	if int32(r1) != S_OK || connection.handler == 0 {
-		return fmt.Errorf("SimConnect_Open failed HRESULT=0x%08X", uint32(r1))
+		return fmt.Errorf("%w: %w", ErrNotConnected, &HResultError{Call: "SimConnect_Open", HResult: uint32(r1)})
 	}
 	return nil
 }
 
 func (connection *DllConnection) AddField(field string, defineID uint32) error {
+	if connection.handler == 0 {
+		return ErrNotConnected
+	}
 	fptr, err := helpers.CString(field)
 	if err != nil {
 		return err
@@ -112,12 +147,15 @@ func (connection *DllConnection) AddField(field string, defineID uint32) error {
 		uintptr(unsafe.Pointer(fptr)),
 	)
 	if int32(handlerResult) != S_OK {
-		return fmt.Errorf("AddToFacilityDefinition(%q) failed HRESULT=0x%08X", field, uint32(handlerResult))
+		return fmt.Errorf("add field %q: %w", field, &HResultError{Call: "SimConnect_AddToFacilityDefinition", HResult: uint32(handlerResult)})
 	}
 	return nil
 }
 
 func (connection *DllConnection) RequestFacilityData(icao string, region string, defineID uint32, requestID uint32) error {
+	if connection.handler == 0 {
+		return ErrNotConnected
+	}
 	icaoPtr, _ := helpers.CString(icao)
 	regionPtr, _ := helpers.CString(region)
 
@@ -129,13 +167,16 @@ func (connection *DllConnection) RequestFacilityData(icao string, region string,
 		uintptr(unsafe.Pointer(regionPtr)),
 	)
 	if int32(handlerResult) != S_OK {
-		return fmt.Errorf("RequestFacilityData failed HRESULT=0x%08X", uint32(handlerResult))
+		return &HResultError{Call: "SimConnect_RequestFacilityData", HResult: uint32(handlerResult)}
 	}
 
 	return nil
 }
 
 func (connection *DllConnection) RequestWeatherObservation(icao string, requestID uint32) error {
+	if connection.handler == 0 {
+		return ErrNotConnected
+	}
 	icaoPtr, _ := helpers.CString(icao)
 
 	handlerResult, _, _ := connection.requestWeatherObservation.Call(
@@ -144,13 +185,16 @@ func (connection *DllConnection) RequestWeatherObservation(icao string, requestI
 		uintptr(unsafe.Pointer(icaoPtr)),
 	)
 	if int32(handlerResult) != S_OK {
-		return fmt.Errorf("RequestWeatherObservation failed HRESULT=0x%08X", uint32(handlerResult))
+		return &HResultError{Call: "SimConnect_WeatherRequestObservationAtStation", HResult: uint32(handlerResult)}
 	}
 
 	return nil
 }
 
 func (connection *DllConnection) RequestCloudState(requestID uint32, minLat, minLon, minAlt, maxLat, maxLon, maxAlt float32) error {
+	if connection.handler == 0 {
+		return ErrNotConnected
+	}
 	handlerResult, _, _ := connection.requestCloudState.Call(
 		connection.handler,
 		uintptr(requestID),
@@ -163,17 +207,141 @@ func (connection *DllConnection) RequestCloudState(requestID uint32, minLat, min
 		0, // dwFlags
 	)
 	if int32(handlerResult) != S_OK {
-		return fmt.Errorf("RequestCloudState failed HRESULT=0x%08X", uint32(handlerResult))
+		return &HResultError{Call: "SimConnect_WeatherRequestCloudState", HResult: uint32(handlerResult)}
 	}
 
 	return nil
 }
 
+func (connection *DllConnection) RequestFacilitiesList(listType uint32, requestID uint32) error {
+	if connection.handler == 0 {
+		return ErrNotConnected
+	}
+	handlerResult, _, _ := connection.requestFacilitiesList.Call(
+		connection.handler,
+		uintptr(listType),
+		uintptr(requestID),
+	)
+	if int32(handlerResult) != S_OK {
+		return &HResultError{Call: "SimConnect_RequestFacilitiesList_EX1", HResult: uint32(handlerResult)}
+	}
+
+	return nil
+}
+
+func (connection *DllConnection) AddToDataDefinition(defineID uint32, datumName string, unitsName string, datumType uint32) error {
+	if connection.handler == 0 {
+		return ErrNotConnected
+	}
+	datumPtr, err := helpers.CString(datumName)
+	if err != nil {
+		return err
+	}
+	unitsPtr, err := helpers.CString(unitsName)
+	if err != nil {
+		return err
+	}
+	handlerResult, _, _ := connection.addToDataDefinition.Call(
+		connection.handler,
+		uintptr(defineID),
+		uintptr(unsafe.Pointer(datumPtr)),
+		uintptr(unsafe.Pointer(unitsPtr)),
+		uintptr(datumType),
+		0,          // fEpsilon
+		0xFFFFFFFF, // DatumID, SIMCONNECT_UNUSED
+	)
+	if int32(handlerResult) != S_OK {
+		return fmt.Errorf("add datum %q: %w", datumName, &HResultError{Call: "SimConnect_AddToDataDefinition", HResult: uint32(handlerResult)})
+	}
+	return nil
+}
+
+func (connection *DllConnection) RequestDataOnSimObject(requestID uint32, defineID uint32, objectID uint32, period uint32, flags uint32) error {
+	if connection.handler == 0 {
+		return ErrNotConnected
+	}
+	handlerResult, _, _ := connection.requestDataOnSimObject.Call(
+		connection.handler,
+		uintptr(requestID),
+		uintptr(defineID),
+		uintptr(objectID),
+		uintptr(period),
+		uintptr(flags),
+		0, // origin
+		0, // interval
+		0, // limit
+	)
+	if int32(handlerResult) != S_OK {
+		return &HResultError{Call: "SimConnect_RequestDataOnSimObject", HResult: uint32(handlerResult)}
+	}
+
+	return nil
+}
+
+func (connection *DllConnection) MapClientEventToSimEvent(eventID uint32, eventName string) error {
+	if connection.handler == 0 {
+		return ErrNotConnected
+	}
+	namePtr, err := helpers.CString(eventName)
+	if err != nil {
+		return err
+	}
+	handlerResult, _, _ := connection.mapClientEvent.Call(
+		connection.handler,
+		uintptr(eventID),
+		uintptr(unsafe.Pointer(namePtr)),
+	)
+	if int32(handlerResult) != S_OK {
+		return fmt.Errorf("map event %q: %w", eventName, &HResultError{Call: "SimConnect_MapClientEventToSimEvent", HResult: uint32(handlerResult)})
+	}
+	return nil
+}
+
+func (connection *DllConnection) TransmitClientEvent(objectID uint32, eventID uint32, data uint32, groupID uint32, flags uint32) error {
+	if connection.handler == 0 {
+		return ErrNotConnected
+	}
+	handlerResult, _, _ := connection.transmitClientEvent.Call(
+		connection.handler,
+		uintptr(objectID),
+		uintptr(eventID),
+		uintptr(data),
+		uintptr(groupID),
+		uintptr(flags),
+	)
+	if int32(handlerResult) != S_OK {
+		return &HResultError{Call: "SimConnect_TransmitClientEvent", HResult: uint32(handlerResult)}
+	}
+
+	return nil
+}
+
+func (connection *DllConnection) GetLastSentPacketID() (uint32, error) {
+	if connection.handler == 0 {
+		return 0, ErrNotConnected
+	}
+	var sendID uint32
+	handlerResult, _, _ := connection.getLastSentPacketID.Call(
+		connection.handler,
+		uintptr(unsafe.Pointer(&sendID)),
+	)
+	if int32(handlerResult) != S_OK {
+		return 0, &HResultError{Call: "SimConnect_GetLastSentPacketID", HResult: uint32(handlerResult)}
+	}
+	return sendID, nil
+}
+
 func (connection *DllConnection) Close() {
-	//todo connection.close.Call(connection.handler)
+	if connection.handler == 0 {
+		return
+	}
+	connection.close.Call(connection.handler)
+	connection.handler = 0
 }
 
-func (connection *DllConnection) GetNextDispatch() (*SIMCONNECT_RECV, bool) {
+// GetNextDispatch copies the cbData bytes of the next message out of the SimConnect receive
+// buffer, which is reused by the next call
+func (connection *DllConnection) GetNextDispatch() ([]byte, bool) {
 	var ppData *SIMCONNECT_RECV
 	var cbData uint32
 
@@ -187,5 +355,5 @@ func (connection *DllConnection) GetNextDispatch() (*SIMCONNECT_RECV, bool) {
 		return nil, false
 	}
 
-	return ppData, true
+	return append([]byte(nil), unsafe.Slice((*byte)(unsafe.Pointer(ppData)), cbData)...), true
 }
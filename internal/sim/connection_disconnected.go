@@ -0,0 +1,72 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+)
+
+// disconnectedConnection is a Connection that can't be opened, every request fails with
+// ErrNotConnected and the reason the simulator is unavailable
+type disconnectedConnection struct {
+	err error
+}
+
+// NewDisconnectedConnection creates a Connection for when SimConnect can't be loaded,
+// so the Service still answers from its FrequencySource
+func NewDisconnectedConnection(reason error) Connection {
+	err := reason
+	if !errors.Is(err, ErrNotConnected) {
+		err = fmt.Errorf("%w: %w", ErrNotConnected, reason)
+	}
+	return &disconnectedConnection{err: err}
+}
+
+func (c *disconnectedConnection) Open(name string) error {
+	return c.err
+}
+
+func (c *disconnectedConnection) Close() {}
+
+func (c *disconnectedConnection) AddField(field string, defineID uint32) error {
+	return c.err
+}
+
+func (c *disconnectedConnection) RequestFacilityData(icao string, region string, defineID uint32, requestID uint32) error {
+	return c.err
+}
+
+func (c *disconnectedConnection) RequestWeatherObservation(icao string, requestID uint32) error {
+	return c.err
+}
+
+func (c *disconnectedConnection) RequestCloudState(requestID uint32, minLat, minLon, minAlt, maxLat, maxLon, maxAlt float32) error {
+	return c.err
+}
+
+func (c *disconnectedConnection) RequestFacilitiesList(listType uint32, requestID uint32) error {
+	return c.err
+}
+
+func (c *disconnectedConnection) AddToDataDefinition(defineID uint32, datumName string, unitsName string, datumType uint32) error {
+	return c.err
+}
+
+func (c *disconnectedConnection) RequestDataOnSimObject(requestID uint32, defineID uint32, objectID uint32, period uint32, flags uint32) error {
+	return c.err
+}
+
+func (c *disconnectedConnection) MapClientEventToSimEvent(eventID uint32, eventName string) error {
+	return c.err
+}
+
+func (c *disconnectedConnection) TransmitClientEvent(objectID uint32, eventID uint32, data uint32, groupID uint32, flags uint32) error {
+	return c.err
+}
+
+func (c *disconnectedConnection) GetLastSentPacketID() (uint32, error) {
+	return 0, c.err
+}
+
+func (c *disconnectedConnection) GetNextDispatch() ([]byte, bool) {
+	return nil, false
+}
@@ -7,5 +7,15 @@ type Connection interface {
 	RequestFacilityData(icao string, region string, defineID uint32, requestID uint32) error
 	RequestWeatherObservation(icao string, requestID uint32) error
 	RequestCloudState(requestID uint32, minLat, minLon, minAlt, maxLat, maxLon, maxAlt float32) error
-	GetNextDispatch() (*SIMCONNECT_RECV, bool)
+	RequestFacilitiesList(listType uint32, requestID uint32) error
+	AddToDataDefinition(defineID uint32, datumName string, unitsName string, datumType uint32) error
+	RequestDataOnSimObject(requestID uint32, defineID uint32, objectID uint32, period uint32, flags uint32) error
+	MapClientEventToSimEvent(eventID uint32, eventName string) error
+	TransmitClientEvent(objectID uint32, eventID uint32, data uint32, groupID uint32, flags uint32) error
+	// GetLastSentPacketID returns the send ID of the packet sent last. Exceptions name the
+	// packet that caused them by this ID in DwSendID.
+	GetLastSentPacketID() (uint32, error)
+	// GetNextDispatch returns a copy of the next message, starting with its SIMCONNECT_RECV header.
+	// The session checks the sizes in the message before decoding it.
+	GetNextDispatch() ([]byte, bool)
 }
@@ -1,11 +1,17 @@
 package sim
 
 import (
+	"sync/atomic"
+
 	"github.com/stretchr/testify/mock"
 )
 
+// MockConnection numbers the packets it is sent like SimConnect, starting at 1, so
+// GetLastSentPacketID needs no expectation
 type MockConnection struct {
 	mock.Mock
+
+	sendID atomic.Uint32
 }
 
 func (m *MockConnection) Open(name string) error {
@@ -18,29 +24,67 @@ func (m *MockConnection) Close() {
 }
 
 func (m *MockConnection) AddField(field string, defineID uint32) error {
+	m.sendID.Add(1)
 	args := m.Called(field, defineID)
 	return args.Error(0)
 }
 
 func (m *MockConnection) RequestFacilityData(icao string, region string, defineID uint32, requestID uint32) error {
+	m.sendID.Add(1)
 	args := m.Called(icao, region, defineID, requestID)
 	return args.Error(0)
 }
 
 func (m *MockConnection) RequestWeatherObservation(icao string, requestID uint32) error {
+	m.sendID.Add(1)
 	args := m.Called(icao, requestID)
 	return args.Error(0)
 }
 
 func (m *MockConnection) RequestCloudState(requestID uint32, minLat, minLon, minAlt, maxLat, maxLon, maxAlt float32) error {
+	m.sendID.Add(1)
 	args := m.Called(requestID, minLat, minLon, minAlt, maxLat, maxLon, maxAlt)
 	return args.Error(0)
 }
 
-func (m *MockConnection) GetNextDispatch() (*SIMCONNECT_RECV, bool) {
+func (m *MockConnection) RequestFacilitiesList(listType uint32, requestID uint32) error {
+	m.sendID.Add(1)
+	args := m.Called(listType, requestID)
+	return args.Error(0)
+}
+
+func (m *MockConnection) AddToDataDefinition(defineID uint32, datumName string, unitsName string, datumType uint32) error {
+	m.sendID.Add(1)
+	args := m.Called(defineID, datumName, unitsName, datumType)
+	return args.Error(0)
+}
+
+func (m *MockConnection) RequestDataOnSimObject(requestID uint32, defineID uint32, objectID uint32, period uint32, flags uint32) error {
+	m.sendID.Add(1)
+	args := m.Called(requestID, defineID, objectID, period, flags)
+	return args.Error(0)
+}
+
+func (m *MockConnection) MapClientEventToSimEvent(eventID uint32, eventName string) error {
+	m.sendID.Add(1)
+	args := m.Called(eventID, eventName)
+	return args.Error(0)
+}
+
+func (m *MockConnection) TransmitClientEvent(objectID uint32, eventID uint32, data uint32, groupID uint32, flags uint32) error {
+	m.sendID.Add(1)
+	args := m.Called(objectID, eventID, data, groupID, flags)
+	return args.Error(0)
+}
+
+func (m *MockConnection) GetLastSentPacketID() (uint32, error) {
+	return m.sendID.Load(), nil
+}
+
+func (m *MockConnection) GetNextDispatch() ([]byte, bool) {
 	args := m.Called()
 	if args.Get(0) == nil {
 		return nil, args.Bool(1)
 	}
-	return args.Get(0).(*SIMCONNECT_RECV), args.Bool(1)
+	return args.Get(0).([]byte), args.Bool(1)
 }
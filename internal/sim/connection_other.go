@@ -0,0 +1,13 @@
+//go:build !windows
+
+package sim
+
+import (
+	"fmt"
+)
+
+// NewConnection is only available on Windows, where SimConnect.dll can be loaded.
+// Use the fake simulator from package simfake on other platforms.
+func NewConnection() (Connection, error) {
+	return nil, fmt.Errorf("%w: SimConnect is only available on Windows", ErrNotConnected)
+}
@@ -0,0 +1,195 @@
+package sim
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"unsafe"
+)
+
+// Sizes of the SimConnect message headers, the payload of the message follows them.
+// unsafe.Offsetof only reads the layout of the generated structs, they have no padding.
+const (
+	recvHeaderSize         = int(unsafe.Sizeof(SIMCONNECT_RECV{}))
+	facilityDataHeaderSize = int(unsafe.Offsetof(SIMCONNECT_RECV_FACILITY_DATA{}.Data))
+	weatherHeaderSize      = int(unsafe.Offsetof(SIMCONNECT_RECV_WEATHER_OBSERVATION{}.SzMetar))
+	cloudStateHeaderSize   = int(unsafe.Offsetof(SIMCONNECT_RECV_CLOUD_STATE{}.RgbData))
+	facilityListHeaderSize = int(unsafe.Sizeof(SIMCONNECT_RECV_FACILITIES_LIST{}))
+	simObjectHeaderSize    = int(unsafe.Offsetof(SIMCONNECT_RECV_SIMOBJECT_DATA{}.DwData))
+
+	// requestIDOffset is where every message answering a request has its request ID
+	requestIDOffset = recvHeaderSize
+	// sendIDOffset is where an exception names the packet that caused it
+	sendIDOffset = int(unsafe.Offsetof(SIMCONNECT_RECV_EXCEPTION{}.DwSendID))
+)
+
+// ErrMalformedDispatch is matched by every *DecodeError
+var ErrMalformedDispatch = errors.New("malformed dispatch")
+
+// DecodeError is returned when a message from the simulator is shorter than the data it announces
+type DecodeError struct {
+	What string // What was being decoded
+	Size int    // Bytes available
+	Need int    // Bytes needed
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("malformed dispatch: %s needs %d bytes, got %d", e.What, e.Need, e.Size)
+}
+
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrMalformedDispatch
+}
+
+// dispatch is a message received from the simulator
+type dispatch struct {
+	id   uint32 // SIMCONNECT_RECV_ID
+	data []byte // The message including its SIMCONNECT_RECV header, cut to DwSize
+	err  error  // DwSize doesn't match the message, returned by every decoder
+}
+
+// newDispatch checks the SIMCONNECT_RECV header of a message returned by GetNextDispatch.
+// Messages too short for the header can't be routed and fail, a DwSize that doesn't match the
+// message is reported by the decoder of the request the message answers.
+func newDispatch(data []byte) (dispatch, error) {
+	header, err := decodeStruct[SIMCONNECT_RECV](data, recvHeaderSize, "message header")
+	if err != nil {
+		return dispatch{}, err
+	}
+
+	d := dispatch{id: header.DwID, data: data}
+	if size := int(header.DwSize); size < recvHeaderSize || size > len(data) {
+		d.err = &DecodeError{What: fmt.Sprintf("message of DwSize %d", size), Size: len(data), Need: max(size, recvHeaderSize)}
+	} else {
+		d.data = data[:size]
+	}
+	return d, nil
+}
+
+// requestID returns the request ID of messages answering a request
+func (d dispatch) requestID() (uint32, bool) {
+	switch d.id {
+	case SIMCONNECT_RECV_ID_FACILITY_DATA, SIMCONNECT_RECV_ID_FACILITY_DATA_END,
+		SIMCONNECT_RECV_ID_WEATHER_OBSERVATION, SIMCONNECT_RECV_ID_CLOUD_STATE,
+		SIMCONNECT_RECV_ID_AIRPORT_LIST, SIMCONNECT_RECV_ID_SIMOBJECT_DATA:
+		if len(d.data) < requestIDOffset+4 {
+			return 0, false
+		}
+		return binary.LittleEndian.Uint32(d.data[requestIDOffset:]), true
+	}
+	return 0, false
+}
+
+// sendID returns the send ID of the packet an exception is about
+func (d dispatch) sendID() (uint32, bool) {
+	if d.id != SIMCONNECT_RECV_ID_EXCEPTION || len(d.data) < sendIDOffset+4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(d.data[sendIDOffset:]), true
+}
+
+// decodeStruct decodes a T from the start of data, little endian and without padding like the
+// SimConnect structs. Only need bytes have to be present: structs ending with a flexible array
+// member, like SzMetar, need less than their size and decode the missing bytes as zero.
+func decodeStruct[T any](data []byte, need int, what string) (T, error) {
+	var value T
+	if len(data) < need {
+		return value, &DecodeError{What: what, Size: len(data), Need: need}
+	}
+	if size := binary.Size(value); len(data) < size {
+		data = append(data[:len(data):len(data)], make([]byte, size-len(data))...)
+	}
+	if _, err := binary.Decode(data, binary.LittleEndian, &value); err != nil {
+		return value, fmt.Errorf("%s: %w", what, err)
+	}
+	return value, nil
+}
+
+// decodeFull decodes a T that has to be present completely
+func decodeFull[T any](data []byte, what string) (T, error) {
+	var value T
+	return decodeStruct[T](data, binary.Size(value), what)
+}
+
+// decodeFacilityData decodes a SIMCONNECT_RECV_FACILITY_DATA header, the payload holds the fields
+// of the facility definition
+func decodeFacilityData(d dispatch) (SIMCONNECT_RECV_FACILITY_DATA, []byte, error) {
+	if d.err != nil {
+		return SIMCONNECT_RECV_FACILITY_DATA{}, nil, d.err
+	}
+	header, err := decodeStruct[SIMCONNECT_RECV_FACILITY_DATA](d.data, facilityDataHeaderSize, "facility data")
+	if err != nil {
+		return header, nil, err
+	}
+	return header, d.data[facilityDataHeaderSize:], nil
+}
+
+// decodeFacilityDataEnd decodes a SIMCONNECT_RECV_FACILITY_DATA_END
+func decodeFacilityDataEnd(d dispatch) (SIMCONNECT_RECV_FACILITY_DATA_END, error) {
+	if d.err != nil {
+		return SIMCONNECT_RECV_FACILITY_DATA_END{}, d.err
+	}
+	return decodeFull[SIMCONNECT_RECV_FACILITY_DATA_END](d.data, "facility data end")
+}
+
+// decodeWeatherObservation decodes a SIMCONNECT_RECV_WEATHER_OBSERVATION and its METAR,
+// which runs to the end of the message
+func decodeWeatherObservation(d dispatch) (SIMCONNECT_RECV_WEATHER_OBSERVATION, []byte, error) {
+	if d.err != nil {
+		return SIMCONNECT_RECV_WEATHER_OBSERVATION{}, nil, d.err
+	}
+	header, err := decodeStruct[SIMCONNECT_RECV_WEATHER_OBSERVATION](d.data, weatherHeaderSize, "weather observation")
+	if err != nil {
+		return header, nil, err
+	}
+	return header, d.data[weatherHeaderSize:], nil
+}
+
+// decodeCloudState decodes a SIMCONNECT_RECV_CLOUD_STATE and its DwArraySize density bytes
+func decodeCloudState(d dispatch) (SIMCONNECT_RECV_CLOUD_STATE, []byte, error) {
+	if d.err != nil {
+		return SIMCONNECT_RECV_CLOUD_STATE{}, nil, d.err
+	}
+	header, err := decodeStruct[SIMCONNECT_RECV_CLOUD_STATE](d.data, cloudStateHeaderSize, "cloud state")
+	if err != nil {
+		return header, nil, err
+	}
+
+	need := cloudStateHeaderSize + int(header.DwArraySize)
+	if len(d.data) < need {
+		return header, nil, &DecodeError{What: fmt.Sprintf("cloud state of %d cells", header.DwArraySize), Size: len(d.data), Need: need}
+	}
+	return header, d.data[cloudStateHeaderSize:need], nil
+}
+
+// decodeFacilitiesList decodes a SIMCONNECT_RECV_FACILITIES_LIST and the DwArraySize entries of
+// entrySize bytes following it
+func decodeFacilitiesList(d dispatch, entrySize int) (SIMCONNECT_RECV_FACILITIES_LIST, []byte, error) {
+	if d.err != nil {
+		return SIMCONNECT_RECV_FACILITIES_LIST{}, nil, d.err
+	}
+	header, err := decodeFull[SIMCONNECT_RECV_FACILITIES_LIST](d.data, "facilities list")
+	if err != nil {
+		return header, nil, err
+	}
+
+	need := facilityListHeaderSize + int(header.DwArraySize)*entrySize
+	if header.DwArraySize > math.MaxInt32/uint32(entrySize) || len(d.data) < need {
+		return header, nil, &DecodeError{What: fmt.Sprintf("facilities list of %d entries", header.DwArraySize), Size: len(d.data), Need: need}
+	}
+	return header, d.data[facilityListHeaderSize:need], nil
+}
+
+// decodeSimObjectData decodes a SIMCONNECT_RECV_SIMOBJECT_DATA, the payload holds the variables
+// of the data definition
+func decodeSimObjectData(d dispatch) (SIMCONNECT_RECV_SIMOBJECT_DATA, []byte, error) {
+	if d.err != nil {
+		return SIMCONNECT_RECV_SIMOBJECT_DATA{}, nil, d.err
+	}
+	header, err := decodeStruct[SIMCONNECT_RECV_SIMOBJECT_DATA](d.data, simObjectHeaderSize, "simobject data")
+	if err != nil {
+		return header, nil, err
+	}
+	return header, d.data[simObjectHeaderSize:], nil
+}
@@ -0,0 +1,223 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"atc_freq/internal/testutil"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// decoder runs the decoders the request receiving a message uses on it
+type decoder func(d sim.Dispatch) error
+
+var (
+	decodeException = func(d sim.Dispatch) error {
+		// Decoding an exception returns it as an error
+		err := sim.NewExceptionError(d)
+		var exception *sim.ExceptionError
+		if errors.As(err, &exception) {
+			return nil
+		}
+		return err
+	}
+	decodeFrequency = func(d sim.Dispatch) error {
+		_, payload, err := sim.DecodeFacilityData(d)
+		if err != nil {
+			return err
+		}
+		_, err = sim.DecodeFrequency(payload)
+		return err
+	}
+	decodeAirport = func(d sim.Dispatch) error {
+		return sim.AddFacilityRecord(sim.NewFacilityTree(), sim.AirportDetailsDefinition, d)
+	}
+	decodeRunway = func(d sim.Dispatch) error {
+		// Runway records are only decoded below the airport record they belong to
+		tree := sim.NewFacilityTree()
+		airport, err := sim.NewDispatch(testutil.CreateAirportDataResponse(sim.FirstRequestID, testutil.Airport{ICAO: "EDDB"}))
+		if err != nil {
+			return err
+		}
+		if err := sim.AddFacilityRecord(tree, sim.AirportDetailsDefinition, airport); err != nil {
+			return err
+		}
+		return sim.AddFacilityRecord(tree, sim.AirportDetailsDefinition, d)
+	}
+	decodeILS = func(d sim.Dispatch) error {
+		return sim.AddFacilityRecord(sim.NewFacilityTree(), sim.ILSDefinition, d)
+	}
+	decodeWaypoint = func(d sim.Dispatch) error {
+		return sim.AddFacilityRecord(sim.NewFacilityTree(), sim.WaypointCoordinatesDefinition, d)
+	}
+	decodeFacilityDataEnd = func(d sim.Dispatch) error {
+		_, err := sim.DecodeFacilityDataEnd(d)
+		return err
+	}
+	decodeWeather = func(d sim.Dispatch) error {
+		_, _, err := sim.DecodeWeatherObservation(d)
+		return err
+	}
+	decodeCloudState = func(d sim.Dispatch) error {
+		_, _, err := sim.DecodeCloudState(d)
+		return err
+	}
+	decodeAirportList = func(d sim.Dispatch) error {
+		_, entries, err := sim.DecodeFacilitiesList(d, sim.AirportListEntrySize)
+		if err != nil {
+			return err
+		}
+		_, err = sim.DecodeAirportList(entries)
+		return err
+	}
+	decodeAircraft = func(d sim.Dispatch) error {
+		_, err := sim.DecodeAircraft(d)
+		return err
+	}
+	decodeQuit = func(d sim.Dispatch) error {
+		// Nothing is decoded, the dispatch only has to be routed
+		d.RequestID()
+		d.SendID()
+		return nil
+	}
+)
+
+// decoders are every decoder of the requests, the fuzz target runs all of them on every message
+var decoders = []decoder{
+	decodeException, decodeFrequency, decodeAirport, decodeRunway, decodeILS, decodeWaypoint, decodeFacilityDataEnd,
+	decodeWeather, decodeCloudState, decodeAirportList, decodeAircraft, decodeQuit,
+}
+
+// decodeMessage checks the header of a message like the session, then runs decode on it
+func decodeMessage(data []byte, decode decoder) error {
+	d, err := sim.NewDispatch(data)
+	if err != nil {
+		return err
+	}
+	return decode(d)
+}
+
+// validMessage is a well formed message and the decoder of the request receiving it
+type validMessage struct {
+	message []byte
+	decode  decoder
+}
+
+// validMessages are well formed messages of every kind the clients decode
+func validMessages() []validMessage {
+	return []validMessage{
+		{testutil.CreateFacilityDataResponse(sim.FirstRequestID, 6, 118700000, "Tower"), decodeFrequency},
+		{testutil.CreateAirportDataResponse(sim.FirstRequestID, testutil.Airport{ICAO: "EDDB", Name: "Berlin"}), decodeAirport},
+		{testutil.CreateRunwayDataResponse(sim.FirstRequestID, 0, 1, testutil.Runway{PrimaryNumber: 7}), decodeRunway},
+		{testutil.CreateILSDataResponse(sim.FirstRequestID, testutil.ILS{Hz: 110300000, Name: "IBBE"}), decodeILS},
+		{testutil.CreateFacilityRecordResponse(sim.FirstRequestID, 0, 0, sim.SIMCONNECT_FACILITY_DATA_AIRPORT, 0, [2]float64{52.36, 13.51}), decodeWaypoint},
+		{testutil.CreateFacilityDataEndResponse(sim.FirstRequestID), decodeFacilityDataEnd},
+		{testutil.CreateWeatherResponse(sim.FirstRequestID, "EDDB 121250Z 27010KT 9999 FEW030 12/06 Q1015"), decodeWeather},
+		{testutil.CreateCloudStateResponse(sim.FirstRequestID, make([]byte, 64*64)), decodeCloudState},
+		{testutil.CreateAirportListResponse(sim.FirstRequestID, 0, 1, testutil.ListAirport{ICAO: "EDDB", Region: "ED"}), decodeAirportList},
+		{testutil.CreateSimObjectDataResponse(sim.FirstRequestID, sim.FirstDefineID, make([]float64, 10)...), decodeAircraft},
+		{testutil.CreateExceptionResponse(3, 5, 1), decodeException},
+		{testutil.CreateQuitResponse(), decodeQuit},
+	}
+}
+
+func TestDecode_Truncated(t *testing.T) {
+	for _, valid := range validMessages() {
+		message := valid.message
+		id := binary.LittleEndian.Uint32(message[8:])
+		require.NoError(t, decodeMessage(message, valid.decode), "message %d", id)
+
+		// Cutting a message short without fixing DwSize is caught by the header check
+		for size := range len(message) {
+			assert.ErrorIs(t, decodeMessage(message[:size], valid.decode), sim.ErrMalformedDispatch, "message %d cut to %d bytes", id, size)
+		}
+	}
+}
+
+func TestDecode_ShortPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		message []byte
+		decode  decoder
+		size    int // DwSize and length the message is cut to
+	}{
+		{name: "frequency record", message: testutil.CreateFacilityDataResponse(sim.FirstRequestID, 6, 118700000, "Tower"), decode: decodeFrequency, size: 60},
+		{name: "airport record", message: testutil.CreateAirportDataResponse(sim.FirstRequestID, testutil.Airport{}), decode: decodeAirport, size: 100},
+		{name: "runway record", message: testutil.CreateRunwayDataResponse(sim.FirstRequestID, 0, 1, testutil.Runway{}), decode: decodeRunway, size: 100},
+		{name: "cloud state", message: testutil.CreateCloudStateResponse(sim.FirstRequestID, make([]byte, 64*64)), decode: decodeCloudState, size: 1000},
+		{name: "airport list", message: testutil.CreateAirportListResponse(sim.FirstRequestID, 0, 1, testutil.ListAirport{}, testutil.ListAirport{}), decode: decodeAirportList, size: 50},
+		{name: "aircraft data", message: testutil.CreateSimObjectDataResponse(sim.FirstRequestID, sim.FirstDefineID, make([]float64, 10)...), decode: decodeAircraft, size: 60},
+		{name: "exception", message: testutil.CreateExceptionResponse(3, 5, 1), decode: decodeException, size: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := tt.message[:tt.size]
+			binary.LittleEndian.PutUint32(message, uint32(tt.size))
+
+			err := decodeMessage(message, tt.decode)
+			var decodeErr *sim.DecodeError
+			require.ErrorAs(t, err, &decodeErr)
+			assert.ErrorIs(t, err, sim.ErrMalformedDispatch)
+			assert.LessOrEqual(t, decodeErr.Size, tt.size)
+			assert.Greater(t, decodeErr.Need, decodeErr.Size)
+		})
+	}
+}
+
+func TestClient_GetAirportFrequencies_Malformed(t *testing.T) {
+	record := testutil.CreateFacilityDataResponse(sim.FirstRequestID, 6, 118700000, "Tower")
+
+	// A frequency record announcing fewer bytes than FACILITY_FREQUENCY_DATA
+	short := append([]byte(nil), record[:48]...)
+	binary.LittleEndian.PutUint32(short, 48)
+
+	tests := []struct {
+		name    string
+		message []byte
+		wantErr string
+	}{
+		{name: "short record", message: short, wantErr: "frequency record needs 72 bytes, got 8"},
+		{name: "truncated message", message: record[:48], wantErr: "message of DwSize 112 needs 112 bytes, got 48"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockConn := new(sim.MockConnection)
+			mockConn.On("Open", "atc-freq").Return(nil).Once()
+			mockConn.On("AddField", mock.Anything, mock.Anything).Return(nil)
+			mockConn.On("RequestFacilityData", "EDDB", "", mock.Anything, mock.Anything).Return(nil).Once()
+			mockConn.On("GetNextDispatch").Return(tt.message, true).Once()
+			mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+			mockConn.On("Close").Return().Once()
+
+			client := sim.NewClient(mockConn)
+			_, err := client.GetAirportFrequencies("EDDB", time.Second)
+			client.Close()
+
+			assert.ErrorIs(t, err, sim.ErrMalformedDispatch)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, valid := range validMessages() {
+		f.Add(valid.message)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Decoding never reads past data, every size problem is a *DecodeError. The decoders
+		// don't look at the message ID, every one of them gets to decode every message.
+		for _, decode := range decoders {
+			if err := decodeMessage(data, decode); err != nil {
+				assert.ErrorIs(t, err, sim.ErrMalformedDispatch)
+			}
+		}
+	})
+}
@@ -5,6 +5,10 @@ package sim
 
 //go:generate go tool cgo -godefs defs.go
 
+// Only types of SimConnect.h are declared here. The FACILITY_* record layouts follow the fields
+// their facility definition adds, not a C struct, so they live next to the definition: the
+// frequency record in client.go, the airport, runway and VOR records in airport.go.
+
 /*
 #define WIN32_LEAN_AND_MEAN
 #include <windows.h>
@@ -18,13 +22,45 @@ type SIMCONNECT_RECV_FACILITY_DATA_END C.struct_SIMCONNECT_RECV_FACILITY_DATA_EN
 type SIMCONNECT_RECV_WEATHER_OBSERVATION C.struct_SIMCONNECT_RECV_WEATHER_OBSERVATION
 type SIMCONNECT_RECV_CLOUD_STATE C.struct_SIMCONNECT_RECV_CLOUD_STATE
 type SIMCONNECT_RECV_EXCEPTION C.struct_SIMCONNECT_RECV_EXCEPTION
+type SIMCONNECT_RECV_FACILITIES_LIST C.struct_SIMCONNECT_RECV_FACILITIES_LIST
+type SIMCONNECT_DATA_FACILITY_AIRPORT C.struct_SIMCONNECT_DATA_FACILITY_AIRPORT
+type SIMCONNECT_RECV_SIMOBJECT_DATA C.struct_SIMCONNECT_RECV_SIMOBJECT_DATA
 
 const (
 	SIMCONNECT_RECV_ID_EXCEPTION           = C.SIMCONNECT_RECV_ID_EXCEPTION
+	SIMCONNECT_RECV_ID_QUIT                = C.SIMCONNECT_RECV_ID_QUIT
 	SIMCONNECT_RECV_ID_CLOUD_STATE         = C.SIMCONNECT_RECV_ID_CLOUD_STATE
 	SIMCONNECT_RECV_ID_FACILITY_DATA       = C.SIMCONNECT_RECV_ID_FACILITY_DATA
 	SIMCONNECT_RECV_ID_FACILITY_DATA_END   = C.SIMCONNECT_RECV_ID_FACILITY_DATA_END
 	SIMCONNECT_RECV_ID_WEATHER_OBSERVATION = C.SIMCONNECT_RECV_ID_WEATHER_OBSERVATION
+	SIMCONNECT_RECV_ID_AIRPORT_LIST        = C.SIMCONNECT_RECV_ID_AIRPORT_LIST
+	SIMCONNECT_RECV_ID_SIMOBJECT_DATA      = C.SIMCONNECT_RECV_ID_SIMOBJECT_DATA
 
+	SIMCONNECT_FACILITY_DATA_AIRPORT   = C.SIMCONNECT_FACILITY_DATA_AIRPORT
+	SIMCONNECT_FACILITY_DATA_RUNWAY    = C.SIMCONNECT_FACILITY_DATA_RUNWAY
+	SIMCONNECT_FACILITY_DATA_START     = C.SIMCONNECT_FACILITY_DATA_START
 	SIMCONNECT_FACILITY_DATA_FREQUENCY = C.SIMCONNECT_FACILITY_DATA_FREQUENCY
+	SIMCONNECT_FACILITY_DATA_HELIPAD   = C.SIMCONNECT_FACILITY_DATA_HELIPAD
+	SIMCONNECT_FACILITY_DATA_APPROACH  = C.SIMCONNECT_FACILITY_DATA_APPROACH
+	SIMCONNECT_FACILITY_DATA_DEPARTURE = C.SIMCONNECT_FACILITY_DATA_DEPARTURE
+	SIMCONNECT_FACILITY_DATA_ARRIVAL   = C.SIMCONNECT_FACILITY_DATA_ARRIVAL
+	SIMCONNECT_FACILITY_DATA_VOR       = C.SIMCONNECT_FACILITY_DATA_VOR
+	SIMCONNECT_FACILITY_DATA_NDB       = C.SIMCONNECT_FACILITY_DATA_NDB
+	SIMCONNECT_FACILITY_DATA_WAYPOINT  = C.SIMCONNECT_FACILITY_DATA_WAYPOINT
+
+	SIMCONNECT_FACILITY_LIST_TYPE_AIRPORT = C.SIMCONNECT_FACILITY_LIST_TYPE_AIRPORT
+
+	SIMCONNECT_DATATYPE_FLOAT64 = C.SIMCONNECT_DATATYPE_FLOAT64
+	SIMCONNECT_OBJECT_ID_USER   = C.SIMCONNECT_OBJECT_ID_USER
+
+	SIMCONNECT_PERIOD_NEVER  = C.SIMCONNECT_PERIOD_NEVER
+	SIMCONNECT_PERIOD_ONCE   = C.SIMCONNECT_PERIOD_ONCE
+	SIMCONNECT_PERIOD_SECOND = C.SIMCONNECT_PERIOD_SECOND
+
+	SIMCONNECT_DATA_REQUEST_FLAG_CHANGED = C.SIMCONNECT_DATA_REQUEST_FLAG_CHANGED
+
+	SIMCONNECT_GROUP_PRIORITY_HIGHEST         = C.SIMCONNECT_GROUP_PRIORITY_HIGHEST
+	SIMCONNECT_EVENT_FLAG_GROUPID_IS_PRIORITY = C.SIMCONNECT_EVENT_FLAG_GROUPID_IS_PRIORITY
+
+	SIMCONNECT_EXCEPTION_WEATHER_UNABLE_TO_GET_OBSERVATION = C.SIMCONNECT_EXCEPTION_WEATHER_UNABLE_TO_GET_OBSERVATION
 )
@@ -0,0 +1,214 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrNotConnected is returned when the simulator is not running or closed the connection
+	ErrNotConnected = errors.New("not connected to the simulator")
+	// ErrTimeout is matched by every *TimeoutError
+	ErrTimeout = errors.New("timeout")
+	// ErrUnknownFacility is returned when the simulator has no facility with the requested identifier
+	ErrUnknownFacility = errors.New("unknown facility")
+)
+
+// errSimulatorQuit is returned to requests in flight when the simulator shuts down
+var errSimulatorQuit = fmt.Errorf("simulator closed the connection: %w", ErrNotConnected)
+
+// TimeoutError is returned when the simulator did not answer before the deadline.
+// Requests that wait for several responses return the results received so far together with it.
+type TimeoutError struct {
+	Waiting  string // What the request was waiting for
+	Received int    // Number of responses received before the deadline
+	Expected int    // Number of responses expected, 0 when unknown
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Expected > 0 {
+		return fmt.Sprintf("timeout waiting for %s: received %d of %d", e.Waiting, e.Received, e.Expected)
+	}
+	return fmt.Sprintf("timeout waiting for %s (got %d so far)", e.Waiting, e.Received)
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// UnknownFacilityError is returned when the simulator has no data for the requested identifiers
+type UnknownFacilityError struct {
+	Idents []string
+}
+
+func (e *UnknownFacilityError) Error() string {
+	return fmt.Sprintf("unknown facility: %v", e.Idents)
+}
+
+func (e *UnknownFacilityError) Is(target error) bool {
+	return target == ErrUnknownFacility
+}
+
+// BatchError is returned by batch requests when some identifiers failed.
+// The results of the other identifiers are returned together with it.
+type BatchError struct {
+	Errors map[string]error // Keyed by identifier
+}
+
+func (e *BatchError) Error() string {
+	idents := e.idents()
+	messages := make([]string, len(idents))
+	for i, ident := range idents {
+		messages[i] = fmt.Sprintf("%s: %v", ident, e.Errors[ident])
+	}
+	return fmt.Sprintf("%d requests failed: %s", len(idents), strings.Join(messages, "; "))
+}
+
+// Unwrap lets errors.Is and errors.As match the error of any identifier
+func (e *BatchError) Unwrap() []error {
+	idents := e.idents()
+	errs := make([]error, len(idents))
+	for i, ident := range idents {
+		errs[i] = e.Errors[ident]
+	}
+	return errs
+}
+
+func (e *BatchError) idents() []string {
+	idents := make([]string, 0, len(e.Errors))
+	for ident := range e.Errors {
+		idents = append(idents, ident)
+	}
+	sort.Strings(idents)
+	return idents
+}
+
+// CloudBandError is returned for an altitude band of a cloud sweep the simulator didn't answer.
+// The profile holds the band as a level without coverage.
+type CloudBandError struct {
+	MinAlt int // Feet
+	MaxAlt int // Feet
+	Err    error
+}
+
+func (e *CloudBandError) Error() string {
+	return fmt.Sprintf("cloud state at %d-%d ft: %v", e.MinAlt, e.MaxAlt, e.Err)
+}
+
+func (e *CloudBandError) Unwrap() error {
+	return e.Err
+}
+
+// IgnoreUnknownFacilities returns nil when err is a *BatchError in which every identifier
+// failed only because the simulator doesn't know it, and err otherwise
+func IgnoreUnknownFacilities(err error) error {
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		return err
+	}
+	for _, identErr := range batchErr.Errors {
+		if !errors.Is(identErr, ErrUnknownFacility) {
+			return err
+		}
+	}
+	return nil
+}
+
+// HResultError is returned when a SimConnect API call fails
+type HResultError struct {
+	Call    string // Name of the SimConnect call
+	HResult uint32
+}
+
+func (e *HResultError) Error() string {
+	return fmt.Sprintf("%s failed HRESULT=0x%08X", e.Call, e.HResult)
+}
+
+// ExceptionError is returned when SimConnect answers a request with SIMCONNECT_RECV_EXCEPTION
+type ExceptionError struct {
+	Exception uint32 // SIMCONNECT_EXCEPTION code
+	SendID    uint32 // ID of the packet that caused the exception
+	Index     uint32 // Index of the parameter that caused the exception
+}
+
+// newExceptionError decodes a SIMCONNECT_RECV_EXCEPTION, a truncated one is a *DecodeError
+func newExceptionError(d dispatch) error {
+	if d.err != nil {
+		return d.err
+	}
+	exception, err := decodeFull[SIMCONNECT_RECV_EXCEPTION](d.data, "exception")
+	if err != nil {
+		return err
+	}
+	return &ExceptionError{
+		Exception: exception.DwException,
+		SendID:    exception.DwSendID,
+		Index:     exception.DwIndex,
+	}
+}
+
+func (e *ExceptionError) Error() string {
+	return fmt.Sprintf("SimConnect exception %s (sendID: %d, index: %d)", e.Name(), e.SendID, e.Index)
+}
+
+// Name returns the SDK name of the exception, e.g. SIMCONNECT_EXCEPTION_UNRECOGNIZED_ID
+func (e *ExceptionError) Name() string {
+	if int(e.Exception) < len(exceptionNames) {
+		return exceptionNames[e.Exception]
+	}
+	return fmt.Sprintf("SIMCONNECT_EXCEPTION_%d", e.Exception)
+}
+
+func (e *ExceptionError) Is(target error) bool {
+	return target == ErrUnknownFacility && e.Exception == SIMCONNECT_EXCEPTION_WEATHER_UNABLE_TO_GET_OBSERVATION
+}
+
+// exceptionNames lists the SIMCONNECT_EXCEPTION enum in SDK order
+var exceptionNames = []string{
+	"SIMCONNECT_EXCEPTION_NONE",
+	"SIMCONNECT_EXCEPTION_ERROR",
+	"SIMCONNECT_EXCEPTION_SIZE_MISMATCH",
+	"SIMCONNECT_EXCEPTION_UNRECOGNIZED_ID",
+	"SIMCONNECT_EXCEPTION_UNOPENED",
+	"SIMCONNECT_EXCEPTION_VERSION_MISMATCH",
+	"SIMCONNECT_EXCEPTION_TOO_MANY_GROUPS",
+	"SIMCONNECT_EXCEPTION_NAME_UNRECOGNIZED",
+	"SIMCONNECT_EXCEPTION_TOO_MANY_EVENT_NAMES",
+	"SIMCONNECT_EXCEPTION_EVENT_ID_DUPLICATE",
+	"SIMCONNECT_EXCEPTION_TOO_MANY_MAPS",
+	"SIMCONNECT_EXCEPTION_TOO_MANY_OBJECTS",
+	"SIMCONNECT_EXCEPTION_TOO_MANY_REQUESTS",
+	"SIMCONNECT_EXCEPTION_WEATHER_INVALID_PORT",
+	"SIMCONNECT_EXCEPTION_WEATHER_INVALID_METAR",
+	"SIMCONNECT_EXCEPTION_WEATHER_UNABLE_TO_GET_OBSERVATION",
+	"SIMCONNECT_EXCEPTION_WEATHER_UNABLE_TO_CREATE_STATION",
+	"SIMCONNECT_EXCEPTION_WEATHER_UNABLE_TO_REMOVE_STATION",
+	"SIMCONNECT_EXCEPTION_INVALID_DATA_TYPE",
+	"SIMCONNECT_EXCEPTION_INVALID_DATA_SIZE",
+	"SIMCONNECT_EXCEPTION_DATA_ERROR",
+	"SIMCONNECT_EXCEPTION_INVALID_ARRAY",
+	"SIMCONNECT_EXCEPTION_CREATE_OBJECT_FAILED",
+	"SIMCONNECT_EXCEPTION_LOAD_FLIGHTPLAN_FAILED",
+	"SIMCONNECT_EXCEPTION_OPERATION_INVALID_FOR_OBJECT_TYPE",
+	"SIMCONNECT_EXCEPTION_ILLEGAL_OPERATION",
+	"SIMCONNECT_EXCEPTION_ALREADY_SUBSCRIBED",
+	"SIMCONNECT_EXCEPTION_INVALID_ENUM",
+	"SIMCONNECT_EXCEPTION_DEFINITION_ERROR",
+	"SIMCONNECT_EXCEPTION_DUPLICATE_ID",
+	"SIMCONNECT_EXCEPTION_DATUM_ID",
+	"SIMCONNECT_EXCEPTION_OUT_OF_BOUNDS",
+	"SIMCONNECT_EXCEPTION_ALREADY_CREATED",
+	"SIMCONNECT_EXCEPTION_OBJECT_OUTSIDE_REALITY_BUBBLE",
+	"SIMCONNECT_EXCEPTION_OBJECT_CONTAINER",
+	"SIMCONNECT_EXCEPTION_OBJECT_AI",
+	"SIMCONNECT_EXCEPTION_OBJECT_ATC",
+	"SIMCONNECT_EXCEPTION_OBJECT_SCHEDULE",
+	"SIMCONNECT_EXCEPTION_JETWAY_DATA",
+	"SIMCONNECT_EXCEPTION_ACTION_NOT_FOUND",
+	"SIMCONNECT_EXCEPTION_NOT_AN_ACTION",
+	"SIMCONNECT_EXCEPTION_INCORRECT_ACTION_PARAMS",
+	"SIMCONNECT_EXCEPTION_GET_INPUT_EVENT_FAILED",
+	"SIMCONNECT_EXCEPTION_SET_INPUT_EVENT_FAILED",
+}
@@ -0,0 +1,81 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutError(t *testing.T) {
+	var err error = &sim.TimeoutError{Waiting: "weather observations", Received: 2, Expected: 3}
+
+	assert.EqualError(t, err, "timeout waiting for weather observations: received 2 of 3")
+	assert.ErrorIs(t, fmt.Errorf("wrapped: %w", err), sim.ErrTimeout)
+
+	var timeout *sim.TimeoutError
+	assert.True(t, errors.As(fmt.Errorf("wrapped: %w", err), &timeout))
+	assert.Equal(t, 2, timeout.Received)
+
+	assert.EqualError(t, &sim.TimeoutError{Waiting: "frequencies", Received: 4}, "timeout waiting for frequencies (got 4 so far)")
+}
+
+func TestExceptionError(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          *sim.ExceptionError
+		expectedName string
+		unknown      bool
+	}{
+		{
+			name:         "unrecognized id",
+			err:          &sim.ExceptionError{Exception: 3, SendID: 7, Index: 1},
+			expectedName: "SIMCONNECT_EXCEPTION_UNRECOGNIZED_ID",
+		},
+		{
+			name:         "unknown weather station",
+			err:          &sim.ExceptionError{Exception: 15},
+			expectedName: "SIMCONNECT_EXCEPTION_WEATHER_UNABLE_TO_GET_OBSERVATION",
+			unknown:      true,
+		},
+		{
+			name:         "code newer than the SDK",
+			err:          &sim.ExceptionError{Exception: 200},
+			expectedName: "SIMCONNECT_EXCEPTION_200",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedName, tt.err.Name())
+			assert.Contains(t, tt.err.Error(), tt.expectedName)
+			assert.Equal(t, tt.unknown, errors.Is(tt.err, sim.ErrUnknownFacility))
+		})
+	}
+}
+
+func TestHResultError(t *testing.T) {
+	err := fmt.Errorf("%w: %w", sim.ErrNotConnected, &sim.HResultError{Call: "SimConnect_Open", HResult: 0x80004005})
+
+	assert.EqualError(t, err, "not connected to the simulator: SimConnect_Open failed HRESULT=0x80004005")
+	assert.ErrorIs(t, err, sim.ErrNotConnected)
+
+	var hresult *sim.HResultError
+	assert.True(t, errors.As(err, &hresult))
+	assert.Equal(t, uint32(0x80004005), hresult.HResult)
+}
+
+func TestBatchError(t *testing.T) {
+	err := &sim.BatchError{Errors: map[string]error{
+		"XXXX": &sim.UnknownFacilityError{Idents: []string{"XXXX"}},
+		"EDDH": &sim.TimeoutError{Waiting: "frequencies of EDDH"},
+	}}
+
+	// Identifiers are listed in sorted order, so the message doesn't depend on map iteration
+	assert.EqualError(t, err, "2 requests failed: EDDH: timeout waiting for frequencies of EDDH (got 0 so far); XXXX: unknown facility: [XXXX]")
+	assert.ErrorIs(t, fmt.Errorf("wrapped: %w", err), sim.ErrUnknownFacility)
+	assert.ErrorIs(t, err, sim.ErrTimeout)
+	assert.NotErrorIs(t, err, sim.ErrNotConnected)
+}
@@ -0,0 +1,52 @@
+package sim
+
+// The decoders the requests run on the messages they receive. They are exported as they are,
+// so the decode and fuzz tests exercise the code the clients use.
+
+type Dispatch = dispatch
+
+type FacilityTree = facilityTree
+
+var (
+	AirportListEntrySize = airportListEntrySize
+
+	NewDispatch              = newDispatch
+	NewExceptionError        = newExceptionError
+	DecodeFacilityData       = decodeFacilityData
+	DecodeFacilityDataEnd    = decodeFacilityDataEnd
+	DecodeFrequency          = decodeFrequency
+	DecodeWeatherObservation = decodeWeatherObservation
+	DecodeCloudState         = decodeCloudState
+	DecodeFacilitiesList     = decodeFacilitiesList
+	DecodeAirportList        = decodeAirportList
+	DecodeAircraft           = decodeAircraft
+	NewFacilityTree          = newFacilityTree
+
+	AirportDetailsDefinition      = airportDetailsDefinition
+	ILSDefinition                 = ilsDefinition
+	WaypointCoordinatesDefinition = waypointCoordinatesDefinition
+)
+
+// RequestID returns the request ID the session routes the message by
+func (d dispatch) RequestID() (uint32, bool) {
+	return d.requestID()
+}
+
+// SendID returns the send ID the session routes an exception by
+func (d dispatch) SendID() (uint32, bool) {
+	return d.sendID()
+}
+
+// AddFacilityRecord adds the record of a FACILITY_DATA message to tree like RequestFacilities with def
+func AddFacilityRecord[T any](tree *FacilityTree, def *FacilityDefinition[T], d Dispatch) error {
+	header, payload, err := decodeFacilityData(d)
+	if err != nil {
+		return err
+	}
+	return tree.add(def.root, header, payload)
+}
+
+// BuildFacility returns the T built from the records of tree, nil when it has no root record
+func BuildFacility[T any](tree *FacilityTree) *T {
+	return buildFacility[T](tree)
+}
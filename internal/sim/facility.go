@@ -0,0 +1,417 @@
+package sim
+
+import (
+	"atc_freq/internal/helpers"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// facilityDataTypes maps the facility types a definition can open to the
+// SIMCONNECT_FACILITY_DATA_TYPE of their records
+var facilityDataTypes = map[string]uint32{
+	"AIRPORT":   SIMCONNECT_FACILITY_DATA_AIRPORT,
+	"RUNWAY":    SIMCONNECT_FACILITY_DATA_RUNWAY,
+	"START":     SIMCONNECT_FACILITY_DATA_START,
+	"FREQUENCY": SIMCONNECT_FACILITY_DATA_FREQUENCY,
+	"HELIPAD":   SIMCONNECT_FACILITY_DATA_HELIPAD,
+	"APPROACH":  SIMCONNECT_FACILITY_DATA_APPROACH,
+	"DEPARTURE": SIMCONNECT_FACILITY_DATA_DEPARTURE,
+	"ARRIVAL":   SIMCONNECT_FACILITY_DATA_ARRIVAL,
+	"VOR":       SIMCONNECT_FACILITY_DATA_VOR,
+	"NDB":       SIMCONNECT_FACILITY_DATA_NDB,
+	"WAYPOINT":  SIMCONNECT_FACILITY_DATA_WAYPOINT,
+}
+
+// FacilityDefinition is a facility definition described by the `facility` struct tags of T.
+//
+// A field tagged with a SimConnect field name is read from the records of its facility, in the
+// order of the struct. Numbers and byte arrays are read with their size, strings need the size
+// of the C string in the tag. A slice of structs tagged with a facility type opens that facility
+// as a child, its elements are the child records in list order. The fields of embedded structs
+// without a tag belong to the embedding struct.
+//
+//	type airport struct {
+//		ICAO    string   `facility:"ICAO,8"`
+//		Lat     float64  `facility:"LATITUDE"`
+//		Runways []runway `facility:"RUNWAY"`
+//	}
+//
+//	var airportDefinition = sim.MustFacilityDefinition[airport]("airport with runways", "AIRPORT")
+type FacilityDefinition[T any] struct {
+	definition facilityDefinition
+	root       *facilityNode
+}
+
+// facilityNode is a facility opened by a definition and the struct its records decode into
+type facilityNode struct {
+	facility string // Facility type, e.g. RUNWAY
+	dataType uint32 // SIMCONNECT_FACILITY_DATA_TYPE of its records
+	typ      reflect.Type
+	fields   []facilityField
+	size     int // Bytes of the fields in a record
+	children []facilityChild
+}
+
+// facilityField is a field read from the records of a facility
+type facilityField struct {
+	name   string
+	index  []int // Index of the struct field for reflect.Value.FieldByIndex
+	size   int
+	string bool // Read from a C string of size bytes
+}
+
+// facilityChild is a facility opened inside another one, its records are appended to a slice
+type facilityChild struct {
+	index []int
+	node  *facilityNode
+}
+
+// NewFacilityDefinition creates the definition called name of the facility type opened at its
+// root, e.g. AIRPORT, from the struct tags of T. The name identifies the definition in the
+// session, definitions of different layout need different names.
+func NewFacilityDefinition[T any](name, facility string) (*FacilityDefinition[T], error) {
+	root, err := newFacilityNode(facility, reflect.TypeFor[T]())
+	if err != nil {
+		return nil, fmt.Errorf("facility definition %s: %w", name, err)
+	}
+
+	return &FacilityDefinition[T]{
+		definition: facilityDefinition{name: name, fields: root.definitionFields()},
+		root:       root,
+	}, nil
+}
+
+// MustFacilityDefinition is NewFacilityDefinition for package level definitions, it panics
+// when the struct tags of T are invalid
+func MustFacilityDefinition[T any](name, facility string) *FacilityDefinition[T] {
+	def, err := NewFacilityDefinition[T](name, facility)
+	if err != nil {
+		panic(err)
+	}
+	return def
+}
+
+// Name returns the name of the definition
+func (def *FacilityDefinition[T]) Name() string {
+	return def.definition.name
+}
+
+// Fields returns the fields added to SimConnect for the definition, from OPEN to CLOSE of the root
+func (def *FacilityDefinition[T]) Fields() []string {
+	return slices.Clone(def.definition.fields)
+}
+
+func newFacilityNode(facility string, typ reflect.Type) (*facilityNode, error) {
+	dataType, known := facilityDataTypes[facility]
+	if !known {
+		return nil, fmt.Errorf("unknown facility type %q", facility)
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s records need a struct, got %s", facility, typ)
+	}
+
+	node := &facilityNode{facility: facility, dataType: dataType, typ: typ}
+	if err := node.collect(typ, nil); err != nil {
+		return nil, fmt.Errorf("%s: %w", facility, err)
+	}
+	return node, nil
+}
+
+// collect adds the tagged fields of typ, index is the position of typ in the record struct
+func (node *facilityNode) collect(typ reflect.Type, index []int) error {
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		fieldIndex := append(slices.Clip(index), i)
+
+		tag, tagged := field.Tag.Lookup("facility")
+		if !tagged {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				if err := node.collect(field.Type, fieldIndex); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !field.IsExported() {
+			return fmt.Errorf("field %s is not exported", field.Name)
+		}
+
+		name, size, sized := strings.Cut(tag, ",")
+		if field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct {
+			child, err := newFacilityNode(name, field.Type.Elem())
+			if err != nil {
+				return err
+			}
+			node.children = append(node.children, facilityChild{index: fieldIndex, node: child})
+			continue
+		}
+
+		f := facilityField{name: name, index: fieldIndex}
+		switch field.Type.Kind() {
+		case reflect.String:
+			n, err := strconv.Atoi(size)
+			if !sized || err != nil || n <= 0 {
+				return fmt.Errorf("string field %s needs the size of the C string, e.g. `facility:\"%s,8\"`", field.Name, name)
+			}
+			f.string, f.size = true, n
+		case reflect.Bool:
+			// binary reads bools as one byte, SimConnect sends them as int32
+			return fmt.Errorf("field %s: use int32 for SimConnect booleans", field.Name)
+		default:
+			f.size = binary.Size(reflect.Zero(field.Type).Interface())
+			if f.size <= 0 {
+				return fmt.Errorf("field %s: %s has no fixed size", field.Name, field.Type)
+			}
+		}
+		node.fields = append(node.fields, f)
+		node.size += f.size
+	}
+	return nil
+}
+
+// definitionFields returns the AddField calls that open the facility, add its fields and children and close it
+func (node *facilityNode) definitionFields() []string {
+	fields := []string{"OPEN " + node.facility}
+	for _, f := range node.fields {
+		fields = append(fields, f.name)
+	}
+	for _, child := range node.children {
+		fields = append(fields, child.node.definitionFields()...)
+	}
+	return append(fields, "CLOSE "+node.facility)
+}
+
+// child returns the child facility whose records have dataType
+func (node *facilityNode) child(dataType uint32) *facilityChild {
+	for i := range node.children {
+		if node.children[i].node.dataType == dataType {
+			return &node.children[i]
+		}
+	}
+	return nil
+}
+
+// decode decodes the fields of a record into a new value of the struct of the facility
+func (node *facilityNode) decode(payload []byte) (reflect.Value, error) {
+	if len(payload) < node.size {
+		return reflect.Value{}, &DecodeError{What: node.facility + " record", Size: len(payload), Need: node.size}
+	}
+
+	value := reflect.New(node.typ).Elem()
+	offset := 0
+	for _, f := range node.fields {
+		data := payload[offset : offset+f.size]
+		offset += f.size
+
+		field := value.FieldByIndex(f.index)
+		if f.string {
+			field.SetString(helpers.TrimCString(data))
+			continue
+		}
+		if _, err := binary.Decode(data, binary.LittleEndian, field.Addr().Interface()); err != nil {
+			return reflect.Value{}, fmt.Errorf("%s record field %s: %w", node.facility, f.name, err)
+		}
+	}
+	return value, nil
+}
+
+// facilityTree rebuilds the records answering one request into the tree of the definition
+type facilityTree struct {
+	root    *facilityEntry
+	entries []*facilityEntry // In the order received
+	byID    map[uint32]*facilityEntry
+	done    bool
+}
+
+// facilityEntry is a decoded record and the records of its children
+type facilityEntry struct {
+	node     *facilityNode
+	value    reflect.Value
+	index    uint32 // ItemIndex in the list of the parent
+	children []*facilityEntry
+}
+
+func newFacilityTree() *facilityTree {
+	return &facilityTree{byID: make(map[uint32]*facilityEntry)}
+}
+
+// add decodes a record into the tree of root, records that don't fit the definition are ignored
+func (tree *facilityTree) add(root *facilityNode, header SIMCONNECT_RECV_FACILITY_DATA, payload []byte) error {
+	parent := tree.parent(header)
+
+	node := root
+	if parent != nil {
+		node = parent.node.child(header.Type).node
+	} else if tree.root != nil || header.Type != root.dataType {
+		return nil
+	}
+
+	value, err := node.decode(payload)
+	if err != nil {
+		return err
+	}
+
+	entry := &facilityEntry{node: node, value: value, index: header.ItemIndex}
+	if parent != nil {
+		parent.children = append(parent.children, entry)
+	} else {
+		tree.root = entry
+	}
+	tree.entries = append(tree.entries, entry)
+	if header.UniqueRequestId != 0 {
+		tree.byID[header.UniqueRequestId] = entry
+	}
+	return nil
+}
+
+// parent returns the entry a record is a child of, found by the unique request ID of the parent.
+// Records without one go to the latest entry that has children of their type.
+func (tree *facilityTree) parent(header SIMCONNECT_RECV_FACILITY_DATA) *facilityEntry {
+	if parent, ok := tree.byID[header.ParentUniqueRequestId]; ok && parent.node.child(header.Type) != nil {
+		return parent
+	}
+	for _, entry := range slices.Backward(tree.entries) {
+		if entry.node.child(header.Type) != nil {
+			return entry
+		}
+	}
+	return nil
+}
+
+// build fills the child slices of the entry, children are ordered by their list index
+func (entry *facilityEntry) build() reflect.Value {
+	for _, child := range entry.node.children {
+		var items []*facilityEntry
+		for _, item := range entry.children {
+			if item.node == child.node {
+				items = append(items, item)
+			}
+		}
+		slices.SortStableFunc(items, func(a, b *facilityEntry) int { return int(a.index) - int(b.index) })
+
+		field := entry.value.FieldByIndex(child.index)
+		slice := reflect.MakeSlice(field.Type(), 0, len(items))
+		for _, item := range items {
+			slice = reflect.Append(slice, item.build())
+		}
+		field.Set(slice)
+	}
+	return entry.value
+}
+
+// buildFacility returns the T built from the records of tree, nil when it has no root record
+func buildFacility[T any](tree *facilityTree) *T {
+	if tree.root == nil {
+		return nil
+	}
+	return tree.root.build().Addr().Interface().(*T)
+}
+
+// FacilityRef identifies a facility, Region may be empty where the ident is unique
+type FacilityRef struct {
+	Ident  string
+	Region string
+}
+
+// RequestFacility requests a facility with def and decodes its records into a T until ctx is done
+func RequestFacility[T any](ctx context.Context, client *Client, def *FacilityDefinition[T], ident, region string) (*T, error) {
+	result, err := RequestFacilities(ctx, client, def, []FacilityRef{{Ident: ident, Region: region}})
+	if err != nil {
+		return nil, err
+	}
+	return result[ident], nil
+}
+
+// RequestFacilities requests several facilities with def at once and decodes their records
+// until ctx is done. The result is keyed by ident. Facilities the simulator doesn't know are
+// reported in an *UnknownFacilityError returned together with the others.
+func RequestFacilities[T any](ctx context.Context, client *Client, def *FacilityDefinition[T], refs []FacilityRef) (map[string]*T, error) {
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("no facilities provided")
+	}
+
+	session := client.session
+	sub, err := session.subscribe(len(refs))
+	if err != nil {
+		return nil, err
+	}
+	defer sub.cancel()
+
+	defineID, err := session.define(sub, def.definition)
+	if err != nil {
+		return nil, err
+	}
+
+	trees := make(map[uint32]*facilityTree, len(refs))
+	for i, ref := range refs {
+		requestID := sub.requestIDs[i]
+		trees[requestID] = newFacilityTree()
+
+		_, err = session.send(sub, func() error {
+			return session.connection.RequestFacilityData(ref.Ident, ref.Region, defineID, requestID)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to request %s of %s: %w", def.definition.name, ref.Ident, err)
+		}
+	}
+
+	pendingRequests := len(refs)
+	for pendingRequests > 0 {
+		var d dispatch
+		select {
+		case d = <-sub.recv:
+		case <-ctx.Done():
+			return nil, doneError(ctx, &TimeoutError{Waiting: def.definition.name, Received: len(refs) - pendingRequests, Expected: len(refs)})
+		}
+
+		switch d.id {
+		case SIMCONNECT_RECV_ID_QUIT:
+			return nil, errSimulatorQuit
+		case SIMCONNECT_RECV_ID_EXCEPTION:
+			return nil, newExceptionError(d)
+		case SIMCONNECT_RECV_ID_FACILITY_DATA:
+			facData, payload, err := decodeFacilityData(d)
+			if err != nil {
+				return nil, err
+			}
+			tree, exists := trees[facData.UserRequestId]
+			if !exists || tree.done {
+				continue
+			}
+			if err := tree.add(def.root, facData, payload); err != nil {
+				return nil, err
+			}
+
+		case SIMCONNECT_RECV_ID_FACILITY_DATA_END:
+			end, err := decodeFacilityDataEnd(d)
+			if err != nil {
+				return nil, err
+			}
+			if tree, exists := trees[end.RequestId]; exists && !tree.done {
+				tree.done = true
+				pendingRequests--
+			}
+		}
+	}
+
+	result := make(map[string]*T, len(refs))
+	var unknown []string
+	for i, ref := range refs {
+		// An unknown ident ends the request without sending any facility record
+		record := buildFacility[T](trees[sub.requestIDs[i]])
+		if record == nil {
+			unknown = append(unknown, ref.Ident)
+			continue
+		}
+		result[ref.Ident] = record
+	}
+	if len(unknown) > 0 {
+		return result, &UnknownFacilityError{Idents: unknown}
+	}
+	return result, nil
+}
@@ -0,0 +1,234 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"atc_freq/internal/testutil"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type taggedRunway struct {
+	Number  int32   `facility:"PRIMARY_NUMBER"`
+	Heading float32 `facility:"HEADING"`
+}
+
+type taggedFrequency struct {
+	Type int32  `facility:"TYPE"`
+	Hz   int32  `facility:"FREQUENCY"`
+	Name string `facility:"NAME,64"`
+}
+
+type taggedAirport struct {
+	taggedPosition
+	ICAO        string            `facility:"ICAO,8"`
+	Runways     []taggedRunway    `facility:"RUNWAY"`
+	Frequencies []taggedFrequency `facility:"FREQUENCY"`
+	Note        string            // Not read from the simulator
+}
+
+type taggedPosition struct {
+	Lat float64 `facility:"LATITUDE"`
+	Lon float64 `facility:"LONGITUDE"`
+}
+
+func TestNewFacilityDefinition(t *testing.T) {
+	def, err := sim.NewFacilityDefinition[taggedAirport]("test airport", "AIRPORT")
+	require.NoError(t, err)
+
+	assert.Equal(t, "test airport", def.Name())
+	assert.Equal(t, []string{
+		"OPEN AIRPORT",
+		"LATITUDE",
+		"LONGITUDE",
+		"ICAO",
+		"OPEN RUNWAY",
+		"PRIMARY_NUMBER",
+		"HEADING",
+		"CLOSE RUNWAY",
+		"OPEN FREQUENCY",
+		"TYPE",
+		"FREQUENCY",
+		"NAME",
+		"CLOSE FREQUENCY",
+		"CLOSE AIRPORT",
+	}, def.Fields())
+}
+
+func TestNewFacilityDefinition_Invalid(t *testing.T) {
+	_, err := sim.NewFacilityDefinition[taggedAirport]("test", "AIRFIELD")
+	assert.ErrorContains(t, err, `unknown facility type "AIRFIELD"`)
+
+	_, err = sim.NewFacilityDefinition[struct {
+		Name string `facility:"NAME"`
+	}]("test", "AIRPORT")
+	assert.ErrorContains(t, err, "string field Name needs the size of the C string")
+
+	_, err = sim.NewFacilityDefinition[struct {
+		Tower bool `facility:"TOWER"`
+	}]("test", "AIRPORT")
+	assert.ErrorContains(t, err, "use int32 for SimConnect booleans")
+
+	_, err = sim.NewFacilityDefinition[struct {
+		Runways []struct {
+			Length int `facility:"LENGTH"`
+		} `facility:"RUNWAY"`
+	}]("test", "AIRPORT")
+	assert.ErrorContains(t, err, "RUNWAY: field Length: int has no fixed size")
+
+	assert.Panics(t, func() { sim.MustFacilityDefinition[int]("test", "AIRPORT") })
+}
+
+func TestRequestFacility(t *testing.T) {
+	def := sim.MustFacilityDefinition[taggedILS]("test ils", "VOR")
+
+	mockConn := new(sim.MockConnection)
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	for _, field := range def.Fields() {
+		mockConn.On("AddField", field, uint32(sim.FirstDefineID)).Return(nil).Once()
+	}
+	mockConn.On("RequestFacilityData", "IBBE", "ED", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once()
+	mockConn.On("GetNextDispatch").Return(testutil.CreateILSDataResponse(sim.FirstRequestID, testutil.ILS{
+		Hz: 110300000, LocalizerHeading: 72.5, GlideSlope: 3, Name: "ILS 07R",
+	}), true).Once()
+	mockConn.On("GetNextDispatch").Return(testutil.CreateFacilityDataEndResponse(sim.FirstRequestID), true).Once()
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+	ils, err := sim.RequestFacility(context.Background(), client, def, "IBBE", "ED")
+	client.Close()
+
+	require.NoError(t, err)
+	assert.Equal(t, &taggedILS{Hz: 110300000, Localizer: 1, Heading: 72.5, HasGlideSlope: 1, GlideSlope: 3, Name: "ILS 07R"}, ils)
+	mockConn.AssertExpectations(t)
+}
+
+// taggedILS reads the VOR record testutil.CreateILSDataResponse creates
+type taggedILS struct {
+	Hz            int32   `facility:"FREQUENCY"`
+	Localizer     int32   `facility:"LOCALIZER"`
+	Heading       float32 `facility:"LOCALIZER_HEADING"`
+	HasGlideSlope int32   `facility:"HAS_GLIDE_SLOPE"`
+	GlideSlope    float32 `facility:"GLIDE_SLOPE"`
+	Name          string  `facility:"NAME,64"`
+}
+
+func TestRequestFacilities_Tree(t *testing.T) {
+	type runway struct {
+		Number int32 `facility:"PRIMARY_NUMBER"`
+	}
+	type airport struct {
+		ICAO    string   `facility:"ICAO,8"`
+		Runways []runway `facility:"RUNWAY"`
+	}
+	def := sim.MustFacilityDefinition[airport]("test tree", "AIRPORT")
+
+	record := func(requestID, uniqueID, parentID, dataType, index uint32, data any) []byte {
+		return testutil.CreateFacilityRecordResponse(requestID, uniqueID, parentID, dataType, index, data)
+	}
+	icao := func(s string) [8]byte {
+		var b [8]byte
+		copy(b[:], s)
+		return b
+	}
+
+	mockConn := new(sim.MockConnection)
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	mockConn.On("AddField", mock.Anything, mock.Anything).Return(nil)
+	mockConn.On("RequestFacilityData", mock.Anything, "", mock.Anything, mock.Anything).Return(nil).Times(3)
+	// The records of both airports interleave, runways are matched by the unique ID of their
+	// airport and arrive out of list order
+	for _, message := range [][]byte{
+		record(sim.FirstRequestID, 1, 0, sim.SIMCONNECT_FACILITY_DATA_AIRPORT, 0, icao("EDDB")),
+		record(sim.FirstRequestID+1, 2, 0, sim.SIMCONNECT_FACILITY_DATA_AIRPORT, 0, icao("EDDH")),
+		record(sim.FirstRequestID, 3, 1, sim.SIMCONNECT_FACILITY_DATA_RUNWAY, 1, int32(25)),
+		record(sim.FirstRequestID+1, 4, 2, sim.SIMCONNECT_FACILITY_DATA_RUNWAY, 0, int32(5)),
+		record(sim.FirstRequestID, 5, 1, sim.SIMCONNECT_FACILITY_DATA_RUNWAY, 0, int32(7)),
+		testutil.CreateFacilityDataEndResponse(sim.FirstRequestID),
+		testutil.CreateFacilityDataEndResponse(sim.FirstRequestID + 1),
+		testutil.CreateFacilityDataEndResponse(sim.FirstRequestID + 2),
+	} {
+		mockConn.On("GetNextDispatch").Return(message, true).Once()
+	}
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	airports, err := sim.RequestFacilities(ctx, client, def, []sim.FacilityRef{{Ident: "EDDB"}, {Ident: "EDDH"}, {Ident: "XXXX"}})
+	client.Close()
+
+	var unknown *sim.UnknownFacilityError
+	require.ErrorAs(t, err, &unknown)
+	assert.Equal(t, []string{"XXXX"}, unknown.Idents)
+	assert.Equal(t, map[string]*airport{
+		"EDDB": {ICAO: "EDDB", Runways: []runway{{Number: 7}, {Number: 25}}},
+		"EDDH": {ICAO: "EDDH", Runways: []runway{{Number: 5}}},
+	}, airports)
+}
+
+func TestRequestFacility_ShortRecord(t *testing.T) {
+	def := sim.MustFacilityDefinition[taggedILS]("test ils", "VOR")
+
+	mockConn := new(sim.MockConnection)
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	mockConn.On("AddField", mock.Anything, mock.Anything).Return(nil)
+	mockConn.On("RequestFacilityData", "IBBE", "", mock.Anything, mock.Anything).Return(nil).Once()
+	mockConn.On("GetNextDispatch").Return(testutil.CreateFacilityRecordResponse(sim.FirstRequestID, 1, 0, sim.SIMCONNECT_FACILITY_DATA_VOR, 0, int32(110300000)), true).Once()
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+	_, err := sim.RequestFacility(context.Background(), client, def, "IBBE", "")
+	client.Close()
+
+	assert.ErrorIs(t, err, sim.ErrMalformedDispatch)
+	assert.ErrorContains(t, err, "VOR record needs 84 bytes, got 4")
+}
+
+func FuzzFacilityTree(f *testing.F) {
+	airport := func(uniqueID uint32) []byte {
+		return testutil.CreateFacilityRecordResponse(sim.FirstRequestID, uniqueID, 0, sim.SIMCONNECT_FACILITY_DATA_AIRPORT, 0, sim.FACILITY_AIRPORT_DATA{N_RUNWAYS: 2})
+	}
+	runway := func(uniqueID, parentID, index uint32) []byte {
+		return testutil.CreateFacilityRecordResponse(sim.FirstRequestID, uniqueID, parentID, sim.SIMCONNECT_FACILITY_DATA_RUNWAY, index, sim.FACILITY_RUNWAY_DATA{PRIMARY_NUMBER: 7})
+	}
+	f.Add(airport(1), runway(2, 1, 1), runway(3, 1, 0))
+	f.Add(airport(0), runway(0, 0, 0), testutil.CreateFrequencyRecordResponse(sim.FirstRequestID, 0, 0, 6, 118700000, "Tower"))
+	f.Add(runway(2, 1, 0), airport(1), testutil.CreateFacilityDataEndResponse(sim.FirstRequestID))
+
+	f.Fuzz(func(t *testing.T, first, second, third []byte) {
+		messages := [][]byte{first, second, third}
+		fuzzFacilityTree(t, sim.AirportDetailsDefinition, messages)
+		fuzzFacilityTree(t, sim.MustFacilityDefinition[taggedAirport]("test airport", "AIRPORT"), messages)
+	})
+}
+
+// fuzzFacilityTree adds the records of messages to a tree of def like RequestFacilities and builds the
+// result. Records that don't fit are ignored or fail with a *DecodeError, building never panics.
+func fuzzFacilityTree[T any](t *testing.T, def *sim.FacilityDefinition[T], messages [][]byte) {
+	tree := sim.NewFacilityTree()
+	added := 0
+	for _, message := range messages {
+		d, err := sim.NewDispatch(message)
+		if err == nil {
+			err = sim.AddFacilityRecord(tree, def, d)
+		}
+		if err != nil {
+			assert.ErrorIs(t, err, sim.ErrMalformedDispatch)
+			continue
+		}
+		added++
+	}
+
+	record := sim.BuildFacility[T](tree)
+	if added == 0 {
+		assert.Nil(t, record)
+	}
+}
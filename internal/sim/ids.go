@@ -0,0 +1,108 @@
+package sim
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// FirstDefineID is the first definition ID handed out by a new Session
+	FirstDefineID = 1
+	// FirstRequestID is the first request ID handed out by a new Session
+	FirstRequestID = 1
+	// FirstEventID is the first client event ID handed out by a new Session
+	FirstEventID = 1
+
+	// maxID is the largest usable ID, SIMCONNECT_UNUSED (0xFFFFFFFF) is reserved by SimConnect
+	maxID = 0xFFFFFFFE
+)
+
+// IDAllocator hands out and reclaims SimConnect define, request and event IDs.
+// Fresh IDs are preferred over released ones, and released IDs are reused
+// oldest first, so a late reply to an abandoned request is unlikely to reach
+// the request that reuses its ID.
+type IDAllocator struct {
+	mu    sync.Mutex
+	next  uint64
+	last  uint64
+	free  []uint32
+	inUse map[uint32]bool
+}
+
+// NewIDAllocator creates an allocator for the IDs in [first, last]
+func NewIDAllocator(first, last uint32) *IDAllocator {
+	return &IDAllocator{
+		next:  uint64(first),
+		last:  uint64(last),
+		inUse: make(map[uint32]bool),
+	}
+}
+
+// Acquire returns an unused ID
+func (a *IDAllocator) Acquire() (uint32, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.acquire()
+}
+
+// AcquireN returns n unused IDs. Either all of them are acquired or none.
+func (a *IDAllocator) AcquireN(n int) ([]uint32, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ids := make([]uint32, 0, n)
+	for i := 0; i < n; i++ {
+		id, err := a.acquire()
+		if err != nil {
+			a.release(ids...)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// Release returns IDs to the allocator so they can be handed out again
+func (a *IDAllocator) Release(ids ...uint32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.release(ids...)
+}
+
+// InUse returns the number of IDs currently handed out
+func (a *IDAllocator) InUse() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.inUse)
+}
+
+func (a *IDAllocator) acquire() (uint32, error) {
+	var id uint32
+	switch {
+	case a.next <= a.last:
+		id = uint32(a.next)
+		a.next++
+	case len(a.free) > 0:
+		id = a.free[0]
+		a.free = a.free[1:]
+	default:
+		return 0, fmt.Errorf("no free IDs left (%d in use)", len(a.inUse))
+	}
+
+	a.inUse[id] = true
+	return id, nil
+}
+
+func (a *IDAllocator) release(ids ...uint32) {
+	for _, id := range ids {
+		if !a.inUse[id] {
+			continue
+		}
+		delete(a.inUse, id)
+		a.free = append(a.free, id)
+	}
+}
@@ -0,0 +1,80 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIDAllocator_Acquire(t *testing.T) {
+	allocator := sim.NewIDAllocator(1, 3)
+
+	ids, err := allocator.AcquireN(3)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{1, 2, 3}, ids)
+
+	_, err = allocator.Acquire()
+	assert.EqualError(t, err, "no free IDs left (3 in use)")
+
+	// Released IDs are reused oldest first
+	allocator.Release(2)
+	allocator.Release(1)
+	ids, err = allocator.AcquireN(2)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{2, 1}, ids)
+}
+
+func TestIDAllocator_AcquireNIsAllOrNothing(t *testing.T) {
+	allocator := sim.NewIDAllocator(1, 3)
+
+	_, err := allocator.AcquireN(4)
+	assert.Error(t, err)
+	assert.Equal(t, 0, allocator.InUse())
+
+	ids, err := allocator.AcquireN(3)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []uint32{1, 2, 3}, ids)
+}
+
+func TestIDAllocator_ReleaseIgnoresUnknownIDs(t *testing.T) {
+	allocator := sim.NewIDAllocator(1, 1)
+
+	allocator.Release(1, 42)
+
+	id, err := allocator.Acquire()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), id)
+
+	_, err = allocator.Acquire()
+	assert.Error(t, err)
+}
+
+func TestIDAllocator_Concurrent(t *testing.T) {
+	allocator := sim.NewIDAllocator(sim.FirstRequestID, 1000)
+
+	var mu sync.Mutex
+	seen := make(map[uint32]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids, err := allocator.AcquireN(10)
+			assert.NoError(t, err)
+
+			mu.Lock()
+			for _, id := range ids {
+				assert.False(t, seen[id], "ID %d handed out twice", id)
+				seen[id] = true
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, 500)
+	assert.Equal(t, 500, allocator.InUse())
+}
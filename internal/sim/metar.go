@@ -0,0 +1,435 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	metersPerStatuteMile = 1609.344
+	hPaPerInHg           = 33.8639
+	knotsPerMPS          = 1.943844
+	knotsPerKMH          = 0.539957
+)
+
+// Metar is a decoded METAR or SPECI report
+type Metar struct {
+	Raw       string          `json:"raw"`
+	Type      string          `json:"type"` // METAR or SPECI, METAR when the report doesn't say
+	Station   string          `json:"station"`
+	Observed  ObservationTime `json:"observed"`
+	Auto      bool            `json:"auto"`      // Fully automated report
+	Corrected bool            `json:"corrected"` // COR, corrected report
+	Missing   bool            `json:"missing"`   // NIL, the report is missing
+
+	Conditions
+
+	RunwayVisualRange []RunwayVisualRange `json:"runway_visual_range"`
+	RecentWeather     []WeatherPhenomenon `json:"recent_weather"` // RE groups, weather that ended during the last hour
+	WindShear         []string            `json:"wind_shear"`     // Runways with wind shear, ALL for all runways
+	Temperature       *int                `json:"temperature"`    // Degrees Celsius
+	Dewpoint          *int                `json:"dewpoint"`       // Degrees Celsius
+	Altimeter         *Altimeter          `json:"altimeter"`
+	Trends            []Trend             `json:"trends"`
+	Remarks           string              `json:"remarks"`  // Everything after RMK, not decoded
+	Unparsed          []string            `json:"unparsed"` // Groups the decoder didn't recognise
+}
+
+// ObservationTime is the day of month and UTC time of the observation
+type ObservationTime struct {
+	Day    int `json:"day"`
+	Hour   int `json:"hour"`
+	Minute int `json:"minute"`
+}
+
+// Conditions are the groups shared by the report body and its trends
+type Conditions struct {
+	Wind       *Wind               `json:"wind"`
+	Visibility *Visibility         `json:"visibility"`
+	CAVOK      bool                `json:"cavok"` // Ceiling and visibility OK
+	NSW        bool                `json:"nsw"`   // No significant weather, only used in trends
+	Weather    []WeatherPhenomenon `json:"weather"`
+	Sky        []SkyCondition      `json:"sky"`
+	SkyClear   string              `json:"sky_clear"` // SKC, CLR, NSC or NCD when no cloud layers are reported
+}
+
+// Wind is the surface wind group, e.g. 24012G25KT 210V270
+type Wind struct {
+	Direction    int    `json:"direction"`     // Degrees true, 0 when variable
+	Variable     bool   `json:"variable"`      // VRB, the direction varies
+	Speed        int    `json:"speed"`         // In Unit
+	Gust         int    `json:"gust"`          // In Unit, 0 without gusts
+	Unit         string `json:"unit"`          // KT, MPS or KMH
+	VariableFrom int    `json:"variable_from"` // Variable sector, both 0 when not reported
+	VariableTo   int    `json:"variable_to"`
+}
+
+// Calm reports whether the wind is calm (00000KT)
+func (w Wind) Calm() bool {
+	return w.Speed == 0 && !w.Variable
+}
+
+// SpeedKnots returns the wind speed in knots
+func (w Wind) SpeedKnots() float64 {
+	return toKnots(w.Speed, w.Unit)
+}
+
+// GustKnots returns the gust speed in knots, 0 without gusts
+func (w Wind) GustKnots() float64 {
+	return toKnots(w.Gust, w.Unit)
+}
+
+// Visibility is the prevailing visibility, e.g. 9999, 1 1/2SM, M1/4SM
+type Visibility struct {
+	Meters       float64 `json:"meters"`
+	Miles        float64 `json:"miles"`        // Statute miles
+	Unit         string  `json:"unit"`         // SM or M as reported
+	LessThan     bool    `json:"less_than"`    // The visibility is below the reported value
+	GreaterThan  bool    `json:"greater_than"` // The visibility is above the reported value
+	NDV          bool    `json:"ndv"`          // No directional variation
+	MinMeters    float64 `json:"min_meters"`   // Lowest visibility in MinDirection, 0 when not reported
+	MinDirection string  `json:"min_direction"`
+}
+
+// RunwayVisualRange is an RVR group, e.g. R24L/1200FT or R06/0600V1000U
+type RunwayVisualRange struct {
+	Runway      string `json:"runway"`
+	Range       int    `json:"range"`     // In Unit, the lower bound when the range varies
+	MaxRange    int    `json:"max_range"` // Upper bound of a varying range, 0 otherwise
+	Unit        string `json:"unit"`
+	LessThan    bool   `json:"less_than"`    // M, below the lowest value the system measures
+	GreaterThan bool   `json:"greater_than"` // P, above the highest value the system measures
+	Tendency    string `json:"tendency"`     // U up, D down, N no change
+}
+
+// WeatherPhenomenon is a present weather group, e.g. -SHRA, +TSRAGR, VCFG
+type WeatherPhenomenon struct {
+	Intensity  string   `json:"intensity"`  // - light, + heavy, empty for moderate
+	Vicinity   bool     `json:"vicinity"`   // VC, in the vicinity of the station
+	Descriptor string   `json:"descriptor"` // MI, PR, BC, DR, BL, SH, TS or FZ
+	Phenomena  []string `json:"phenomena"`
+}
+
+func (w WeatherPhenomenon) String() string {
+	var b strings.Builder
+	b.WriteString(w.Intensity)
+	if w.Vicinity {
+		b.WriteString("VC")
+	}
+	b.WriteString(w.Descriptor)
+	for _, p := range w.Phenomena {
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// SkyCondition is a cloud layer or vertical visibility group, e.g. BKN012CB, VV002
+type SkyCondition struct {
+	Coverage string `json:"coverage"` // FEW, SCT, BKN, OVC or VV for vertical visibility
+	Base     int    `json:"base"`     // Feet above ground, -1 when not reported
+	Cloud    string `json:"cloud"`    // CB or TCU
+}
+
+// Altimeter is the pressure setting, reported as Q1013 or A2992
+type Altimeter struct {
+	HPa  float64 `json:"hpa"`
+	InHg float64 `json:"inhg"`
+	Unit string  `json:"unit"` // hPa or inHg as reported
+}
+
+// Trend is a NOSIG, BECMG or TEMPO forecast appended to the report
+type Trend struct {
+	Type  string `json:"type"`  // NOSIG, BECMG or TEMPO
+	From  string `json:"from"`  // HHMM of an FM group
+	Until string `json:"until"` // HHMM of a TL group
+	At    string `json:"at"`    // HHMM of an AT group
+
+	Conditions
+}
+
+var (
+	stationPattern      = regexp.MustCompile(`^[A-Z][A-Z0-9]{3}$`)
+	timePattern         = regexp.MustCompile(`^(\d{2})(\d{2})(\d{2})Z$`)
+	windPattern         = regexp.MustCompile(`^(VRB|\d{3})(\d{2,3})(?:G(\d{2,3}))?(KT|MPS|KMH)$`)
+	windVariablePattern = regexp.MustCompile(`^(\d{3})V(\d{3})$`)
+	visibilitySMPattern = regexp.MustCompile(`^([MP])?(?:(\d+)|(\d+)/(\d+))SM$`)
+	visibilityMPattern  = regexp.MustCompile(`^(\d{4})(NDV)?$`)
+	visibilityMinimum   = regexp.MustCompile(`^(\d{4})(N|NE|E|SE|S|SW|W|NW)$`)
+	rvrPattern          = regexp.MustCompile(`^R(\d{2}[LCR]?)/([PM])?(\d{4})(?:V([PM])?(\d{4}))?(FT)?/?([UDN])?$`)
+	weatherPattern      = regexp.MustCompile(`^(-|\+)?(VC)?(MI|PR|BC|DR|BL|SH|TS|FZ)?((?:DZ|RA|SN|SG|IC|PL|GR|GS|UP|BR|FG|FU|VA|DU|SA|HZ|PY|PO|SQ|FC|SS|DS)*)$`)
+	skyPattern          = regexp.MustCompile(`^(FEW|SCT|BKN|OVC|VV)(\d{3}|///)(CB|TCU|///)?$`)
+	temperaturePattern  = regexp.MustCompile(`^(M?\d{2})/(M?\d{2})?$`)
+	altimeterPattern    = regexp.MustCompile(`^([QA])(\d{4})$`)
+	trendTimePattern    = regexp.MustCompile(`^(FM|TL|AT)(\d{4})$`)
+	wholeNumberPattern  = regexp.MustCompile(`^\d{1,2}$`)
+	fractionSMPattern   = regexp.MustCompile(`^\d/\d{1,2}SM$`)
+)
+
+// ParseMetar decodes a METAR or SPECI report. Groups that can't be decoded are
+// collected in Unparsed, an error is only returned when the report has no station.
+func ParseMetar(raw string) (*Metar, error) {
+	raw = strings.TrimSpace(raw)
+	tokens := strings.Fields(strings.TrimSuffix(raw, "="))
+	if len(tokens) == 0 {
+		return nil, errors.New("empty METAR")
+	}
+
+	metar := &Metar{Raw: raw, Type: "METAR"}
+
+	if tokens[0] == "METAR" || tokens[0] == "SPECI" {
+		metar.Type = tokens[0]
+		tokens = tokens[1:]
+	}
+	if len(tokens) > 0 && tokens[0] == "COR" {
+		metar.Corrected = true
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 || !stationPattern.MatchString(tokens[0]) {
+		return nil, fmt.Errorf("METAR has no station: %q", raw)
+	}
+	metar.Station = tokens[0]
+	tokens = tokens[1:]
+
+	// Groups are decoded into the report until the first trend starts
+	conditions := &metar.Conditions
+	var trend *Trend
+
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+
+		switch {
+		case token == "RMK":
+			metar.Remarks = strings.Join(tokens[i+1:], " ")
+			return metar, nil
+
+		case token == "NOSIG" || token == "BECMG" || token == "TEMPO":
+			metar.Trends = append(metar.Trends, Trend{Type: token})
+			trend = &metar.Trends[len(metar.Trends)-1]
+			conditions = &trend.Conditions
+
+		case trend != nil && trendTimePattern.MatchString(token):
+			m := trendTimePattern.FindStringSubmatch(token)
+			switch m[1] {
+			case "FM":
+				trend.From = m[2]
+			case "TL":
+				trend.Until = m[2]
+			case "AT":
+				trend.At = m[2]
+			}
+
+		case trend == nil && metar.Observed == (ObservationTime{}) && timePattern.MatchString(token):
+			m := timePattern.FindStringSubmatch(token)
+			metar.Observed = ObservationTime{Day: atoi(m[1]), Hour: atoi(m[2]), Minute: atoi(m[3])}
+
+		case token == "AUTO":
+			metar.Auto = true
+		case token == "COR":
+			metar.Corrected = true
+		case token == "NIL":
+			metar.Missing = true
+
+		case windPattern.MatchString(token):
+			conditions.Wind = parseWind(windPattern.FindStringSubmatch(token))
+
+		case windVariablePattern.MatchString(token) && conditions.Wind != nil:
+			m := windVariablePattern.FindStringSubmatch(token)
+			conditions.Wind.VariableFrom = atoi(m[1])
+			conditions.Wind.VariableTo = atoi(m[2])
+
+		case token == "CAVOK":
+			conditions.CAVOK = true
+			conditions.Visibility = &Visibility{Meters: 10000, Miles: 10000 / metersPerStatuteMile, Unit: "M", GreaterThan: true}
+
+		case wholeNumberPattern.MatchString(token) && i+1 < len(tokens) && fractionSMPattern.MatchString(tokens[i+1]):
+			// Whole and fractional part are separate groups: 1 1/2SM
+			conditions.Visibility = parseVisibilitySM(visibilitySMPattern.FindStringSubmatch(tokens[i+1]))
+			conditions.Visibility.Miles += float64(atoi(token))
+			conditions.Visibility.Meters = conditions.Visibility.Miles * metersPerStatuteMile
+			i++
+
+		case visibilitySMPattern.MatchString(token):
+			conditions.Visibility = parseVisibilitySM(visibilitySMPattern.FindStringSubmatch(token))
+
+		case conditions.Visibility == nil && visibilityMPattern.MatchString(token):
+			m := visibilityMPattern.FindStringSubmatch(token)
+			meters := float64(atoi(m[1]))
+			visibility := &Visibility{Meters: meters, Unit: "M", NDV: m[2] != ""}
+			if m[1] == "9999" {
+				visibility.Meters = 10000
+				visibility.GreaterThan = true
+			}
+			visibility.Miles = visibility.Meters / metersPerStatuteMile
+			conditions.Visibility = visibility
+
+		case conditions.Visibility != nil && visibilityMinimum.MatchString(token):
+			m := visibilityMinimum.FindStringSubmatch(token)
+			conditions.Visibility.MinMeters = float64(atoi(m[1]))
+			conditions.Visibility.MinDirection = m[2]
+
+		case trend == nil && rvrPattern.MatchString(token):
+			metar.RunwayVisualRange = append(metar.RunwayVisualRange, parseRVR(rvrPattern.FindStringSubmatch(token)))
+
+		case skyPattern.MatchString(token):
+			conditions.Sky = append(conditions.Sky, parseSky(skyPattern.FindStringSubmatch(token)))
+
+		case token == "SKC" || token == "CLR" || token == "NSC" || token == "NCD":
+			conditions.SkyClear = token
+
+		case token == "NSW":
+			conditions.NSW = true
+
+		case strings.HasPrefix(token, "RE") && len(token) > 2 && isWeather(token[2:]):
+			metar.RecentWeather = append(metar.RecentWeather, parseWeather(weatherPattern.FindStringSubmatch(token[2:])))
+
+		case isWeather(token):
+			conditions.Weather = append(conditions.Weather, parseWeather(weatherPattern.FindStringSubmatch(token)))
+
+		case trend == nil && temperaturePattern.MatchString(token):
+			m := temperaturePattern.FindStringSubmatch(token)
+			temperature := parseTemperature(m[1])
+			metar.Temperature = &temperature
+			if m[2] != "" {
+				dewpoint := parseTemperature(m[2])
+				metar.Dewpoint = &dewpoint
+			}
+
+		case trend == nil && altimeterPattern.MatchString(token):
+			metar.Altimeter = parseAltimeter(altimeterPattern.FindStringSubmatch(token))
+
+		case token == "WS" && i+1 < len(tokens):
+			// WS R24 or WS ALL RWY
+			if tokens[i+1] == "ALL" && i+2 < len(tokens) && tokens[i+2] == "RWY" {
+				metar.WindShear = append(metar.WindShear, "ALL")
+				i += 2
+			} else if strings.HasPrefix(tokens[i+1], "R") {
+				metar.WindShear = append(metar.WindShear, strings.TrimPrefix(strings.TrimPrefix(tokens[i+1], "RWY"), "R"))
+				i++
+			} else {
+				metar.Unparsed = append(metar.Unparsed, token)
+			}
+
+		case strings.Trim(token, "/") == "":
+			// Group not reported by an automated station
+
+		default:
+			metar.Unparsed = append(metar.Unparsed, token)
+		}
+	}
+
+	return metar, nil
+}
+
+func parseWind(m []string) *Wind {
+	wind := &Wind{
+		Speed: atoi(m[2]),
+		Unit:  m[4],
+	}
+	if m[1] == "VRB" {
+		wind.Variable = true
+	} else {
+		wind.Direction = atoi(m[1])
+	}
+	if m[3] != "" {
+		wind.Gust = atoi(m[3])
+	}
+	return wind
+}
+
+func parseVisibilitySM(m []string) *Visibility {
+	visibility := &Visibility{
+		Unit:        "SM",
+		LessThan:    m[1] == "M",
+		GreaterThan: m[1] == "P",
+	}
+	if m[2] != "" {
+		visibility.Miles = float64(atoi(m[2]))
+	} else if denominator := atoi(m[4]); denominator > 0 {
+		visibility.Miles = float64(atoi(m[3])) / float64(denominator)
+	}
+	visibility.Meters = visibility.Miles * metersPerStatuteMile
+	return visibility
+}
+
+func parseRVR(m []string) RunwayVisualRange {
+	rvr := RunwayVisualRange{
+		Runway:      m[1],
+		Range:       atoi(m[3]),
+		Unit:        "M",
+		LessThan:    m[2] == "M",
+		GreaterThan: m[2] == "P" || m[4] == "P",
+		Tendency:    m[7],
+	}
+	if m[5] != "" {
+		rvr.MaxRange = atoi(m[5])
+	}
+	if m[6] != "" {
+		rvr.Unit = "FT"
+	}
+	return rvr
+}
+
+func parseSky(m []string) SkyCondition {
+	sky := SkyCondition{Coverage: m[1], Base: -1}
+	if m[2] != "///" {
+		sky.Base = atoi(m[2]) * 100
+	}
+	if m[3] != "///" {
+		sky.Cloud = m[3]
+	}
+	return sky
+}
+
+// isWeather reports whether token is a present weather group. A lone intensity
+// or vicinity prefix is not.
+func isWeather(token string) bool {
+	m := weatherPattern.FindStringSubmatch(token)
+	return m != nil && (m[3] != "" || m[4] != "")
+}
+
+func parseWeather(m []string) WeatherPhenomenon {
+	weather := WeatherPhenomenon{
+		Intensity:  m[1],
+		Vicinity:   m[2] != "",
+		Descriptor: m[3],
+	}
+	for i := 0; i+2 <= len(m[4]); i += 2 {
+		weather.Phenomena = append(weather.Phenomena, m[4][i:i+2])
+	}
+	return weather
+}
+
+func parseTemperature(value string) int {
+	if strings.HasPrefix(value, "M") {
+		return -atoi(value[1:])
+	}
+	return atoi(value)
+}
+
+func parseAltimeter(m []string) *Altimeter {
+	value := float64(atoi(m[2]))
+	if m[1] == "Q" {
+		return &Altimeter{HPa: value, InHg: value / hPaPerInHg, Unit: "hPa"}
+	}
+	inHg := value / 100
+	return &Altimeter{HPa: inHg * hPaPerInHg, InHg: inHg, Unit: "inHg"}
+}
+
+func toKnots(speed int, unit string) float64 {
+	switch unit {
+	case "MPS":
+		return float64(speed) * knotsPerMPS
+	case "KMH":
+		return float64(speed) * knotsPerKMH
+	}
+	return float64(speed)
+}
+
+// atoi converts a group the patterns already checked to be digits
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,738 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestParseMetar_Header(t *testing.T) {
+	tests := []struct {
+		name              string
+		metar             string
+		expectedType      string
+		expectedStation   string
+		expectedTime      sim.ObservationTime
+		expectedAuto      bool
+		expectedCorrected bool
+		expectedMissing   bool
+	}{
+		{
+			name:            "station and time",
+			metar:           "EDDB 171150Z 24012KT 9999 FEW025 12/07 Q1015",
+			expectedType:    "METAR",
+			expectedStation: "EDDB",
+			expectedTime:    sim.ObservationTime{Day: 17, Hour: 11, Minute: 50},
+		},
+		{
+			name:            "report type prefix",
+			metar:           "METAR KJFK 010051Z 31008KT 10SM FEW050 18/06 A3002",
+			expectedType:    "METAR",
+			expectedStation: "KJFK",
+			expectedTime:    sim.ObservationTime{Day: 1, Hour: 0, Minute: 51},
+		},
+		{
+			name:            "special report",
+			metar:           "SPECI KLAX 172312Z 25010KT 2SM BR OVC004 16/14 A2992",
+			expectedType:    "SPECI",
+			expectedStation: "KLAX",
+			expectedTime:    sim.ObservationTime{Day: 17, Hour: 23, Minute: 12},
+		},
+		{
+			name:            "automated report",
+			metar:           "KSFO 171156Z AUTO 28015KT 10SM CLR 17/09 A3001",
+			expectedType:    "METAR",
+			expectedStation: "KSFO",
+			expectedTime:    sim.ObservationTime{Day: 17, Hour: 11, Minute: 56},
+			expectedAuto:    true,
+		},
+		{
+			name:              "corrected report",
+			metar:             "METAR COR EGLL 171150Z 22008KT CAVOK 15/09 Q1020",
+			expectedType:      "METAR",
+			expectedStation:   "EGLL",
+			expectedTime:      sim.ObservationTime{Day: 17, Hour: 11, Minute: 50},
+			expectedCorrected: true,
+		},
+		{
+			name:              "corrected after time",
+			metar:             "EGLL 171150Z COR 22008KT CAVOK 15/09 Q1020",
+			expectedType:      "METAR",
+			expectedStation:   "EGLL",
+			expectedTime:      sim.ObservationTime{Day: 17, Hour: 11, Minute: 50},
+			expectedCorrected: true,
+		},
+		{
+			name:            "missing report",
+			metar:           "UUMI 171200Z NIL",
+			expectedType:    "METAR",
+			expectedStation: "UUMI",
+			expectedTime:    sim.ObservationTime{Day: 17, Hour: 12},
+			expectedMissing: true,
+		},
+		{
+			name:            "station with digit and trailing terminator",
+			metar:           "K1G4 171155Z 00000KT 10SM SKC 20/05 A3010=",
+			expectedType:    "METAR",
+			expectedStation: "K1G4",
+			expectedTime:    sim.ObservationTime{Day: 17, Hour: 11, Minute: 55},
+		},
+		{
+			name:            "no time group",
+			metar:           "EDDH 27015KT 6000 BKN012",
+			expectedType:    "METAR",
+			expectedStation: "EDDH",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metar, err := sim.ParseMetar(tt.metar)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedType, metar.Type)
+			assert.Equal(t, tt.expectedStation, metar.Station)
+			assert.Equal(t, tt.expectedTime, metar.Observed)
+			assert.Equal(t, tt.expectedAuto, metar.Auto)
+			assert.Equal(t, tt.expectedCorrected, metar.Corrected)
+			assert.Equal(t, tt.expectedMissing, metar.Missing)
+			assert.Empty(t, metar.Unparsed)
+		})
+	}
+}
+
+func TestParseMetar_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		metar string
+	}{
+		{name: "empty", metar: ""},
+		{name: "blank", metar: "   "},
+		{name: "only report type", metar: "METAR"},
+		{name: "no station", metar: "171150Z 24012KT 9999"},
+		{name: "lower case station", metar: "eddb 171150Z 24012KT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metar, err := sim.ParseMetar(tt.metar)
+			assert.Error(t, err)
+			assert.Nil(t, metar)
+		})
+	}
+}
+
+func TestParseMetar_Wind(t *testing.T) {
+	tests := []struct {
+		name          string
+		group         string
+		expectedWind  *sim.Wind
+		expectedKnots float64
+		expectedGusts float64
+		expectedCalm  bool
+	}{
+		{
+			name:          "knots",
+			group:         "24012KT",
+			expectedWind:  &sim.Wind{Direction: 240, Speed: 12, Unit: "KT"},
+			expectedKnots: 12,
+		},
+		{
+			name:          "gusts",
+			group:         "27015G25KT",
+			expectedWind:  &sim.Wind{Direction: 270, Speed: 15, Gust: 25, Unit: "KT"},
+			expectedKnots: 15,
+			expectedGusts: 25,
+		},
+		{
+			name:          "three digit speed",
+			group:         "090105G130KT",
+			expectedWind:  &sim.Wind{Direction: 90, Speed: 105, Gust: 130, Unit: "KT"},
+			expectedKnots: 105,
+			expectedGusts: 130,
+		},
+		{
+			name:          "metres per second",
+			group:         "18004MPS",
+			expectedWind:  &sim.Wind{Direction: 180, Speed: 4, Unit: "MPS"},
+			expectedKnots: 7.78,
+		},
+		{
+			name:          "kilometres per hour",
+			group:         "36020KMH",
+			expectedWind:  &sim.Wind{Direction: 360, Speed: 20, Unit: "KMH"},
+			expectedKnots: 10.8,
+		},
+		{
+			name:          "variable direction",
+			group:         "VRB03KT",
+			expectedWind:  &sim.Wind{Variable: true, Speed: 3, Unit: "KT"},
+			expectedKnots: 3,
+		},
+		{
+			name:         "calm",
+			group:        "00000KT",
+			expectedWind: &sim.Wind{Unit: "KT"},
+			expectedCalm: true,
+		},
+		{
+			name:          "variable sector",
+			group:         "24012KT 210V270",
+			expectedWind:  &sim.Wind{Direction: 240, Speed: 12, Unit: "KT", VariableFrom: 210, VariableTo: 270},
+			expectedKnots: 12,
+		},
+		{
+			name:  "not reported",
+			group: "/////KT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metar, err := sim.ParseMetar("EDDB 171150Z " + tt.group + " 9999 FEW025 12/07 Q1015")
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedWind, metar.Wind)
+			if tt.expectedWind != nil {
+				assert.InDelta(t, tt.expectedKnots, metar.Wind.SpeedKnots(), 0.01)
+				assert.InDelta(t, tt.expectedGusts, metar.Wind.GustKnots(), 0.01)
+				assert.Equal(t, tt.expectedCalm, metar.Wind.Calm())
+			}
+		})
+	}
+}
+
+func TestParseMetar_Visibility(t *testing.T) {
+	tests := []struct {
+		name               string
+		group              string
+		expectedMiles      float64
+		expectedMeters     float64
+		expectedUnit       string
+		expectedLess       bool
+		expectedGreater    bool
+		expectedNDV        bool
+		expectedMinMeters  float64
+		expectedMinDir     string
+		expectedCAVOK      bool
+		expectedVisibility bool
+	}{
+		{name: "statute miles", group: "10SM", expectedMiles: 10, expectedMeters: 16093.44, expectedUnit: "SM", expectedVisibility: true},
+		{name: "single digit miles", group: "3SM", expectedMiles: 3, expectedMeters: 4828.03, expectedUnit: "SM", expectedVisibility: true},
+		{name: "fraction", group: "1/2SM", expectedMiles: 0.5, expectedMeters: 804.67, expectedUnit: "SM", expectedVisibility: true},
+		{name: "sixteenths", group: "3/16SM", expectedMiles: 0.1875, expectedMeters: 301.75, expectedUnit: "SM", expectedVisibility: true},
+		{name: "whole and fraction", group: "1 1/2SM", expectedMiles: 1.5, expectedMeters: 2414.02, expectedUnit: "SM", expectedVisibility: true},
+		{name: "two and a quarter", group: "2 1/4SM", expectedMiles: 2.25, expectedMeters: 3621.02, expectedUnit: "SM", expectedVisibility: true},
+		{name: "less than", group: "M1/4SM", expectedMiles: 0.25, expectedMeters: 402.34, expectedUnit: "SM", expectedLess: true, expectedVisibility: true},
+		{name: "greater than", group: "P6SM", expectedMiles: 6, expectedMeters: 9656.06, expectedUnit: "SM", expectedGreater: true, expectedVisibility: true},
+		{name: "metres", group: "6000", expectedMiles: 3.73, expectedMeters: 6000, expectedUnit: "M", expectedVisibility: true},
+		{name: "low metres", group: "0800", expectedMiles: 0.5, expectedMeters: 800, expectedUnit: "M", expectedVisibility: true},
+		{name: "zero", group: "0000", expectedMiles: 0, expectedMeters: 0, expectedUnit: "M", expectedVisibility: true},
+		{name: "10 km or more", group: "9999", expectedMiles: 6.21, expectedMeters: 10000, expectedUnit: "M", expectedGreater: true, expectedVisibility: true},
+		{name: "no directional variation", group: "9999NDV", expectedMiles: 6.21, expectedMeters: 10000, expectedUnit: "M", expectedGreater: true, expectedNDV: true, expectedVisibility: true},
+		{name: "directional minimum", group: "4000 1500SW", expectedMiles: 2.49, expectedMeters: 4000, expectedUnit: "M", expectedMinMeters: 1500, expectedMinDir: "SW", expectedVisibility: true},
+		{name: "CAVOK", group: "CAVOK", expectedMiles: 6.21, expectedMeters: 10000, expectedUnit: "M", expectedGreater: true, expectedCAVOK: true, expectedVisibility: true},
+		{name: "not reported", group: "////"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metar, err := sim.ParseMetar("KJFK 171151Z 31008KT " + tt.group + " 18/06 A3002")
+			require.NoError(t, err)
+			assert.Empty(t, metar.Unparsed)
+			assert.Equal(t, tt.expectedCAVOK, metar.CAVOK)
+
+			if !tt.expectedVisibility {
+				assert.Nil(t, metar.Visibility)
+				return
+			}
+			require.NotNil(t, metar.Visibility)
+			assert.InDelta(t, tt.expectedMiles, metar.Visibility.Miles, 0.01)
+			assert.InDelta(t, tt.expectedMeters, metar.Visibility.Meters, 0.01)
+			assert.Equal(t, tt.expectedUnit, metar.Visibility.Unit)
+			assert.Equal(t, tt.expectedLess, metar.Visibility.LessThan)
+			assert.Equal(t, tt.expectedGreater, metar.Visibility.GreaterThan)
+			assert.Equal(t, tt.expectedNDV, metar.Visibility.NDV)
+			assert.Equal(t, tt.expectedMinMeters, metar.Visibility.MinMeters)
+			assert.Equal(t, tt.expectedMinDir, metar.Visibility.MinDirection)
+		})
+	}
+}
+
+func TestParseMetar_RunwayVisualRange(t *testing.T) {
+	tests := []struct {
+		name        string
+		groups      string
+		expectedRVR []sim.RunwayVisualRange
+	}{
+		{
+			name:        "metres",
+			groups:      "R24/0600",
+			expectedRVR: []sim.RunwayVisualRange{{Runway: "24", Range: 600, Unit: "M"}},
+		},
+		{
+			name:        "feet with parallel runway",
+			groups:      "R04R/2000FT",
+			expectedRVR: []sim.RunwayVisualRange{{Runway: "04R", Range: 2000, Unit: "FT"}},
+		},
+		{
+			name:        "tendency",
+			groups:      "R27L/0550U",
+			expectedRVR: []sim.RunwayVisualRange{{Runway: "27L", Range: 550, Unit: "M", Tendency: "U"}},
+		},
+		{
+			name:        "tendency after slash",
+			groups:      "R28L/M0600FT/D",
+			expectedRVR: []sim.RunwayVisualRange{{Runway: "28L", Range: 600, Unit: "FT", LessThan: true, Tendency: "D"}},
+		},
+		{
+			name:        "above maximum",
+			groups:      "R09/P1500N",
+			expectedRVR: []sim.RunwayVisualRange{{Runway: "09", Range: 1500, Unit: "M", GreaterThan: true, Tendency: "N"}},
+		},
+		{
+			name:        "varying",
+			groups:      "R06/0600V1000U",
+			expectedRVR: []sim.RunwayVisualRange{{Runway: "06", Range: 600, MaxRange: 1000, Unit: "M", Tendency: "U"}},
+		},
+		{
+			name:        "varying above maximum in feet",
+			groups:      "R22L/1200VP6000FT",
+			expectedRVR: []sim.RunwayVisualRange{{Runway: "22L", Range: 1200, MaxRange: 6000, Unit: "FT", GreaterThan: true}},
+		},
+		{
+			name:   "several runways",
+			groups: "R24/0600 R25C/0800N",
+			expectedRVR: []sim.RunwayVisualRange{
+				{Runway: "24", Range: 600, Unit: "M"},
+				{Runway: "25C", Range: 800, Unit: "M", Tendency: "N"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metar, err := sim.ParseMetar("EDDF 171150Z 24004KT 0400 " + tt.groups + " FG VV002 08/08 Q1020")
+			require.NoError(t, err)
+			assert.Empty(t, metar.Unparsed)
+			assert.Equal(t, tt.expectedRVR, metar.RunwayVisualRange)
+		})
+	}
+}
+
+func TestParseMetar_Weather(t *testing.T) {
+	tests := []struct {
+		name            string
+		groups          string
+		expectedWeather []sim.WeatherPhenomenon
+		expectedStrings []string
+	}{
+		{
+			name:            "moderate rain",
+			groups:          "RA",
+			expectedWeather: []sim.WeatherPhenomenon{{Phenomena: []string{"RA"}}},
+			expectedStrings: []string{"RA"},
+		},
+		{
+			name:            "light rain",
+			groups:          "-RA",
+			expectedWeather: []sim.WeatherPhenomenon{{Intensity: "-", Phenomena: []string{"RA"}}},
+			expectedStrings: []string{"-RA"},
+		},
+		{
+			name:            "heavy thunderstorm with rain and hail",
+			groups:          "+TSRAGR",
+			expectedWeather: []sim.WeatherPhenomenon{{Intensity: "+", Descriptor: "TS", Phenomena: []string{"RA", "GR"}}},
+			expectedStrings: []string{"+TSRAGR"},
+		},
+		{
+			name:            "showers in the vicinity",
+			groups:          "VCSH",
+			expectedWeather: []sim.WeatherPhenomenon{{Vicinity: true, Descriptor: "SH"}},
+			expectedStrings: []string{"VCSH"},
+		},
+		{
+			name:            "thunderstorm without precipitation",
+			groups:          "TS",
+			expectedWeather: []sim.WeatherPhenomenon{{Descriptor: "TS"}},
+			expectedStrings: []string{"TS"},
+		},
+		{
+			name:            "freezing fog",
+			groups:          "FZFG",
+			expectedWeather: []sim.WeatherPhenomenon{{Descriptor: "FZ", Phenomena: []string{"FG"}}},
+			expectedStrings: []string{"FZFG"},
+		},
+		{
+			name:            "mixed precipitation",
+			groups:          "-SHRASN",
+			expectedWeather: []sim.WeatherPhenomenon{{Intensity: "-", Descriptor: "SH", Phenomena: []string{"RA", "SN"}}},
+			expectedStrings: []string{"-SHRASN"},
+		},
+		{
+			name:   "several groups",
+			groups: "-DZ BR",
+			expectedWeather: []sim.WeatherPhenomenon{
+				{Intensity: "-", Phenomena: []string{"DZ"}},
+				{Phenomena: []string{"BR"}},
+			},
+			expectedStrings: []string{"-DZ", "BR"},
+		},
+		{
+			name:            "blowing snow",
+			groups:          "BLSN",
+			expectedWeather: []sim.WeatherPhenomenon{{Descriptor: "BL", Phenomena: []string{"SN"}}},
+			expectedStrings: []string{"BLSN"},
+		},
+		{
+			name:            "heavy funnel cloud",
+			groups:          "+FC",
+			expectedWeather: []sim.WeatherPhenomenon{{Intensity: "+", Phenomena: []string{"FC"}}},
+			expectedStrings: []string{"+FC"},
+		},
+		{
+			name:            "haze and smoke",
+			groups:          "HZ FU",
+			expectedWeather: []sim.WeatherPhenomenon{{Phenomena: []string{"HZ"}}, {Phenomena: []string{"FU"}}},
+			expectedStrings: []string{"HZ", "FU"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metar, err := sim.ParseMetar("EDDH 171150Z 27015KT 4000 " + tt.groups + " BKN012 10/08 Q1009")
+			require.NoError(t, err)
+			assert.Empty(t, metar.Unparsed)
+			assert.Equal(t, tt.expectedWeather, metar.Weather)
+
+			var codes []string
+			for _, w := range metar.Weather {
+				codes = append(codes, w.String())
+			}
+			assert.Equal(t, tt.expectedStrings, codes)
+		})
+	}
+}
+
+func TestParseMetar_RecentWeatherAndWindShear(t *testing.T) {
+	metar, err := sim.ParseMetar("EDDM 171150Z 25010KT 9999 SCT030 14/09 Q1012 RETSRA WS R26L")
+	require.NoError(t, err)
+
+	assert.Empty(t, metar.Unparsed)
+	assert.Empty(t, metar.Weather)
+	assert.Equal(t, []sim.WeatherPhenomenon{{Descriptor: "TS", Phenomena: []string{"RA"}}}, metar.RecentWeather)
+	assert.Equal(t, []string{"26L"}, metar.WindShear)
+
+	metar, err = sim.ParseMetar("LFPG 171150Z 25010KT 9999 SCT030 14/09 Q1012 WS ALL RWY")
+	require.NoError(t, err)
+	assert.Empty(t, metar.Unparsed)
+	assert.Equal(t, []string{"ALL"}, metar.WindShear)
+}
+
+func TestParseMetar_Sky(t *testing.T) {
+	tests := []struct {
+		name             string
+		groups           string
+		expectedSky      []sim.SkyCondition
+		expectedSkyClear string
+	}{
+		{
+			name:        "single layer",
+			groups:      "FEW025",
+			expectedSky: []sim.SkyCondition{{Coverage: "FEW", Base: 2500}},
+		},
+		{
+			name:   "several layers",
+			groups: "FEW008 SCT025 BKN040 OVC100",
+			expectedSky: []sim.SkyCondition{
+				{Coverage: "FEW", Base: 800},
+				{Coverage: "SCT", Base: 2500},
+				{Coverage: "BKN", Base: 4000},
+				{Coverage: "OVC", Base: 10000},
+			},
+		},
+		{
+			name:        "cumulonimbus",
+			groups:      "BKN012CB",
+			expectedSky: []sim.SkyCondition{{Coverage: "BKN", Base: 1200, Cloud: "CB"}},
+		},
+		{
+			name:   "towering cumulus",
+			groups: "SCT030TCU OVC080",
+			expectedSky: []sim.SkyCondition{
+				{Coverage: "SCT", Base: 3000, Cloud: "TCU"},
+				{Coverage: "OVC", Base: 8000},
+			},
+		},
+		{
+			name:        "vertical visibility",
+			groups:      "VV002",
+			expectedSky: []sim.SkyCondition{{Coverage: "VV", Base: 200}},
+		},
+		{
+			name:        "unknown vertical visibility",
+			groups:      "VV///",
+			expectedSky: []sim.SkyCondition{{Coverage: "VV", Base: -1}},
+		},
+		{
+			name:        "automated cloud type not reported",
+			groups:      "BKN015///",
+			expectedSky: []sim.SkyCondition{{Coverage: "BKN", Base: 1500}},
+		},
+		{
+			name:             "clear",
+			groups:           "CLR",
+			expectedSkyClear: "CLR",
+		},
+		{
+			name:             "sky clear",
+			groups:           "SKC",
+			expectedSkyClear: "SKC",
+		},
+		{
+			name:             "no significant cloud",
+			groups:           "NSC",
+			expectedSkyClear: "NSC",
+		},
+		{
+			name:             "no cloud detected",
+			groups:           "NCD",
+			expectedSkyClear: "NCD",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := "KBOS 171154Z 04012KT 5SM -RA " + tt.groups + " 09/07 A2990"
+			metar, err := sim.ParseMetar(raw)
+			require.NoError(t, err)
+			assert.Empty(t, metar.Unparsed)
+			assert.Equal(t, tt.expectedSky, metar.Sky)
+			assert.Equal(t, tt.expectedSkyClear, metar.SkyClear)
+		})
+	}
+}
+
+func TestParseMetar_TemperatureAndAltimeter(t *testing.T) {
+	tests := []struct {
+		name                string
+		groups              string
+		expectedTemperature *int
+		expectedDewpoint    *int
+		expectedAltimeter   *sim.Altimeter
+	}{
+		{
+			name:                "QNH",
+			groups:              "12/07 Q1015",
+			expectedTemperature: intPtr(12),
+			expectedDewpoint:    intPtr(7),
+			expectedAltimeter:   &sim.Altimeter{HPa: 1015, InHg: 29.97, Unit: "hPa"},
+		},
+		{
+			name:                "inches of mercury",
+			groups:              "18/06 A3002",
+			expectedTemperature: intPtr(18),
+			expectedDewpoint:    intPtr(6),
+			expectedAltimeter:   &sim.Altimeter{HPa: 1016.6, InHg: 30.02, Unit: "inHg"},
+		},
+		{
+			name:                "below zero",
+			groups:              "M05/M12 Q0998",
+			expectedTemperature: intPtr(-5),
+			expectedDewpoint:    intPtr(-12),
+			expectedAltimeter:   &sim.Altimeter{HPa: 998, InHg: 29.47, Unit: "hPa"},
+		},
+		{
+			name:                "zero and minus zero",
+			groups:              "00/M00 Q1000",
+			expectedTemperature: intPtr(0),
+			expectedDewpoint:    intPtr(0),
+			expectedAltimeter:   &sim.Altimeter{HPa: 1000, InHg: 29.53, Unit: "hPa"},
+		},
+		{
+			name:                "dewpoint missing",
+			groups:              "22/ A2992",
+			expectedTemperature: intPtr(22),
+			expectedAltimeter:   &sim.Altimeter{HPa: 1013.2, InHg: 29.92, Unit: "inHg"},
+		},
+		{
+			name:   "not reported",
+			groups: "///// Q////",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metar, err := sim.ParseMetar("EDDB 171150Z 24012KT 9999 FEW025 " + tt.groups)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedTemperature, metar.Temperature)
+			assert.Equal(t, tt.expectedDewpoint, metar.Dewpoint)
+			if tt.expectedAltimeter == nil {
+				assert.Nil(t, metar.Altimeter)
+				return
+			}
+			require.NotNil(t, metar.Altimeter)
+			assert.InDelta(t, tt.expectedAltimeter.HPa, metar.Altimeter.HPa, 0.1)
+			assert.InDelta(t, tt.expectedAltimeter.InHg, metar.Altimeter.InHg, 0.01)
+			assert.Equal(t, tt.expectedAltimeter.Unit, metar.Altimeter.Unit)
+		})
+	}
+}
+
+func TestParseMetar_Trends(t *testing.T) {
+	tests := []struct {
+		name           string
+		trends         string
+		expectedTrends []sim.Trend
+	}{
+		{
+			name:           "no significant change",
+			trends:         "NOSIG",
+			expectedTrends: []sim.Trend{{Type: "NOSIG"}},
+		},
+		{
+			name:   "temporary rain",
+			trends: "TEMPO 4000 RA",
+			expectedTrends: []sim.Trend{{
+				Type: "TEMPO",
+				Conditions: sim.Conditions{
+					Visibility: &sim.Visibility{Meters: 4000, Miles: 4000 / 1609.344, Unit: "M"},
+					Weather:    []sim.WeatherPhenomenon{{Phenomena: []string{"RA"}}},
+				},
+			}},
+		},
+		{
+			name:   "becoming with time and wind",
+			trends: "BECMG FM1230 TL1330 30020G35KT BKN008",
+			expectedTrends: []sim.Trend{{
+				Type:  "BECMG",
+				From:  "1230",
+				Until: "1330",
+				Conditions: sim.Conditions{
+					Wind: &sim.Wind{Direction: 300, Speed: 20, Gust: 35, Unit: "KT"},
+					Sky:  []sim.SkyCondition{{Coverage: "BKN", Base: 800}},
+				},
+			}},
+		},
+		{
+			name:   "improvement to CAVOK",
+			trends: "BECMG AT1300 CAVOK",
+			expectedTrends: []sim.Trend{{
+				Type: "BECMG",
+				At:   "1300",
+				Conditions: sim.Conditions{
+					CAVOK:      true,
+					Visibility: &sim.Visibility{Meters: 10000, Miles: 10000 / 1609.344, Unit: "M", GreaterThan: true},
+				},
+			}},
+		},
+		{
+			name:   "two trends with no significant weather",
+			trends: "TEMPO +TSRA BKN015CB BECMG NSW NSC",
+			expectedTrends: []sim.Trend{
+				{
+					Type: "TEMPO",
+					Conditions: sim.Conditions{
+						Weather: []sim.WeatherPhenomenon{{Intensity: "+", Descriptor: "TS", Phenomena: []string{"RA"}}},
+						Sky:     []sim.SkyCondition{{Coverage: "BKN", Base: 1500, Cloud: "CB"}},
+					},
+				},
+				{
+					Type:       "BECMG",
+					Conditions: sim.Conditions{NSW: true, SkyClear: "NSC"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metar, err := sim.ParseMetar("EDDH 171150Z 27015KT 9999 -RA BKN012 10/08 Q1009 " + tt.trends)
+			require.NoError(t, err)
+			assert.Empty(t, metar.Unparsed)
+			assert.Equal(t, tt.expectedTrends, metar.Trends)
+
+			// Trend groups never leak into the report body
+			assert.Equal(t, &sim.Wind{Direction: 270, Speed: 15, Unit: "KT"}, metar.Wind)
+			assert.Equal(t, []sim.SkyCondition{{Coverage: "BKN", Base: 1200}}, metar.Sky)
+			assert.Equal(t, []sim.WeatherPhenomenon{{Intensity: "-", Phenomena: []string{"RA"}}}, metar.Weather)
+			assert.False(t, metar.CAVOK)
+		})
+	}
+}
+
+func TestParseMetar_Remarks(t *testing.T) {
+	metar, err := sim.ParseMetar("KJFK 171151Z 31008KT 10SM FEW050 18/06 A3002 RMK AO2 SLP166 T01780061")
+	require.NoError(t, err)
+
+	assert.Equal(t, "AO2 SLP166 T01780061", metar.Remarks)
+	assert.Empty(t, metar.Unparsed)
+	// Remarks are not decoded as groups
+	assert.Equal(t, intPtr(18), metar.Temperature)
+}
+
+func TestParseMetar_UnknownGroups(t *testing.T) {
+	metar, err := sim.ParseMetar("EDDB 171150Z 24012KT 9999 XYZZY FEW025 12/07 Q1015")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"XYZZY"}, metar.Unparsed)
+	assert.Equal(t, []sim.SkyCondition{{Coverage: "FEW", Base: 2500}}, metar.Sky)
+}
+
+func TestParseMetar_Corpus(t *testing.T) {
+	tests := []struct {
+		metar      string
+		visibility float64 // Statute miles
+		ceiling    string
+		weather    []string
+	}{
+		{metar: "EDDB 171150Z 24012KT 9999 FEW025 SCT040 12/07 Q1015 NOSIG", visibility: 6.21},
+		{metar: "EDDH 171150Z 27015G25KT 6000 -RA BKN012 OVC030 10/08 Q1009 TEMPO 4000 RA", visibility: 3.73, ceiling: "BKN012", weather: []string{"-RA"}},
+		{metar: "EGLL 171150Z 22008KT CAVOK 15/09 Q1020 NOSIG", visibility: 6.21},
+		{metar: "KJFK 171151Z 31008KT 10SM FEW050 18/06 A3002 RMK AO2", visibility: 10},
+		{metar: "KLAX 171153Z 25010KT 3SM BR OVC008 16/14 A2992 RMK AO2", visibility: 3, ceiling: "OVC008", weather: []string{"BR"}},
+		{metar: "KORD 171151Z 36012G20KT 1 1/4SM -SN BR OVC006 M02/M04 A2985", visibility: 1.25, ceiling: "OVC006", weather: []string{"-SN", "BR"}},
+		{metar: "KSEA 171153Z 18005KT 1/4SM R16L/1600VP6000FT FG VV001 09/09 A3005", visibility: 0.25, ceiling: "VV001", weather: []string{"FG"}},
+		{metar: "KDEN 171153Z VRB04KT P6SM FEW120 SCT200 24/M03 A3021", visibility: 6},
+		{metar: "KMIA 171153Z 09014G22KT 5SM +TSRA BKN020CB OVC045 27/24 A2996", visibility: 5, ceiling: "BKN020", weather: []string{"+TSRA"}},
+		{metar: "UUEE 171200Z 18004MPS 9999 SCT020 BKN100 08/03 Q1012 R06L/290042 NOSIG", visibility: 6.21, ceiling: "BKN100"},
+		{metar: "EDDF 171150Z 24004KT 0400 R25R/0600N R25C/0550D FG VV002 08/08 Q1020 BECMG 1500", visibility: 0.25, ceiling: "VV002", weather: []string{"FG"}},
+		{metar: "LFPG 171200Z AUTO 25008KT 210V280 9999 ///////// 11/08 Q1018", visibility: 6.21},
+		{metar: "RJTT 171200Z 34009KT 9999 FEW030 SCT/// 20/11 Q1021 NOSIG", visibility: 6.21},
+		{metar: "CYYZ 171200Z 30015G25KT 15SM -SHSN BKN025 M05/M10 A2998 RMK SC6", visibility: 15, ceiling: "BKN025", weather: []string{"-SHSN"}},
+		{metar: "PANC 171153Z 00000KT 1/2SM FZFG VV003 M18/M19 A3012", visibility: 0.5, ceiling: "VV003", weather: []string{"FZFG"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.metar[:4], func(t *testing.T) {
+			metar, err := sim.ParseMetar(tt.metar)
+			require.NoError(t, err)
+
+			require.NotNil(t, metar.Visibility)
+			assert.InDelta(t, tt.visibility, metar.Visibility.Miles, 0.01)
+
+			ceiling := ""
+			for _, sky := range metar.Sky {
+				if sky.Coverage == "BKN" || sky.Coverage == "OVC" || sky.Coverage == "VV" {
+					ceiling = fmt.Sprintf("%s%03d", sky.Coverage, sky.Base/100)
+					break
+				}
+			}
+			assert.Equal(t, tt.ceiling, ceiling)
+
+			var weather []string
+			for _, w := range metar.Weather {
+				weather = append(weather, w.String())
+			}
+			assert.Equal(t, tt.weather, weather)
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package sim
+
+import (
+	"atc_freq/internal/helpers"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const earthRadiusNM = 3440.065
+
+// airportListEntrySize is the size of SIMCONNECT_DATA_FACILITY_AIRPORT. SimConnect.h packs it to
+// one byte, the doubles follow the 9 bytes of ident and region unaligned: binary.Size reads that
+// packed layout where unsafe.Sizeof would add the Go alignment.
+var airportListEntrySize = binary.Size(SIMCONNECT_DATA_FACILITY_AIRPORT{})
+
+// ListedAirport is an airport of the facility list the simulator keeps around the user aircraft
+type ListedAirport struct {
+	ICAO        string      `json:"icao"`
+	Region      string      `json:"region"`
+	Coordinates Coordinates `json:"coordinates"`
+	Altitude    float64     `json:"altitude"` // Feet
+}
+
+// NearbyAirport is an airport found around a position
+type NearbyAirport struct {
+	ListedAirport
+	DistanceNM float64           `json:"distance_nm"` // Great circle distance from the center
+	Bearing    float64           `json:"bearing"`     // Initial course from the center in degrees true
+	Frequency  *AirportFrequency `json:"frequency"`   // Tower, CTAF or UNICOM frequency, nil when not looked up or not available
+}
+
+// localFrequencyTypes are the frequencies to call an airport on, in order of preference
+var localFrequencyTypes = []string{"TOWER", "CTAF", "UNICOM", "MULTICOM"}
+
+// GetAirportList retrieves the airports the simulator has loaded around the user aircraft, waiting at most timeout
+func (client *Client) GetAirportList(timeout time.Duration) ([]ListedAirport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return client.GetAirportListCtx(ctx)
+}
+
+// GetAirportListCtx retrieves the airports the simulator has loaded around the user aircraft until ctx is done.
+// Long lists arrive in several messages in order, the request ends with the last of them. An
+// empty list is a single message with DwOutOf 0.
+func (client *Client) GetAirportListCtx(ctx context.Context) ([]ListedAirport, error) {
+	session := client.session
+	sub, err := session.subscribe(1)
+	if err != nil {
+		return nil, err
+	}
+	defer sub.cancel()
+
+	_, err = session.send(sub, func() error {
+		return session.connection.RequestFacilitiesList(SIMCONNECT_FACILITY_LIST_TYPE_AIRPORT, sub.requestIDs[0])
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to request the airport list: %w", err)
+	}
+
+	var airports []ListedAirport
+	received := 0
+
+	for {
+		var d dispatch
+		select {
+		case d = <-sub.recv:
+		case <-ctx.Done():
+			return airports, doneError(ctx, &TimeoutError{Waiting: "airport list", Received: received})
+		}
+
+		switch d.id {
+		case SIMCONNECT_RECV_ID_QUIT:
+			return nil, errSimulatorQuit
+		case SIMCONNECT_RECV_ID_EXCEPTION:
+			return nil, newExceptionError(d)
+		case SIMCONNECT_RECV_ID_AIRPORT_LIST:
+			list, entries, err := decodeFacilitiesList(d, airportListEntrySize)
+			if err != nil {
+				return nil, err
+			}
+			decoded, err := decodeAirportList(entries)
+			if err != nil {
+				return nil, err
+			}
+			airports = append(airports, decoded...)
+			received++
+
+			if list.DwOutOf == 0 || list.DwEntryNumber+1 >= list.DwOutOf {
+				return airports, nil
+			}
+		}
+	}
+}
+
+// decodeAirportList decodes the SIMCONNECT_DATA_FACILITY_AIRPORT entries following the list header
+func decodeAirportList(data []byte) ([]ListedAirport, error) {
+	count := len(data) / airportListEntrySize
+	if count == 0 {
+		return nil, nil
+	}
+
+	airports := make([]ListedAirport, count)
+	for i := range airports {
+		entry, err := decodeFull[SIMCONNECT_DATA_FACILITY_AIRPORT](data[i*airportListEntrySize:], "airport list entry")
+		if err != nil {
+			return nil, err
+		}
+		airports[i] = ListedAirport{
+			ICAO:   charString(entry.Ident[:]),
+			Region: charString(entry.Region[:]),
+			Coordinates: Coordinates{
+				Lat: entry.Latitude,
+				Lon: entry.Longitude,
+			},
+			Altitude: entry.Altitude * feetPerMeter,
+		}
+	}
+	return airports, nil
+}
+
+// charString returns the NUL terminated string of a char array of the generated structs
+func charString(chars []int8) string {
+	b := make([]byte, len(chars))
+	for i, c := range chars {
+		b[i] = byte(c)
+	}
+	return helpers.TrimCString(b)
+}
+
+// DistanceNM returns the great circle distance between two points in nautical miles
+func DistanceNM(from, to Coordinates) float64 {
+	phi1, phi2 := from.Lat*math.Pi/180, to.Lat*math.Pi/180
+	dPhi := phi2 - phi1
+	dLambda := (to.Lon - from.Lon) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadiusNM * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Bearing returns the initial great circle course from one point to another in degrees true
+func Bearing(from, to Coordinates) float64 {
+	phi1, phi2 := from.Lat*math.Pi/180, to.Lat*math.Pi/180
+	dLambda := (to.Lon - from.Lon) * math.Pi / 180
+
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	return normalizeHeading(math.Atan2(y, x) * 180 / math.Pi)
+}
+
+// FilterNearby keeps the airports within radiusNM of center, nearest first
+func FilterNearby(airports []ListedAirport, center Coordinates, radiusNM float64) []NearbyAirport {
+	nearby := []NearbyAirport{}
+	for _, airport := range airports {
+		distance := DistanceNM(center, airport.Coordinates)
+		if distance > radiusNM {
+			continue
+		}
+		nearby = append(nearby, NearbyAirport{
+			ListedAirport: airport,
+			DistanceNM:    distance,
+			Bearing:       Bearing(center, airport.Coordinates),
+		})
+	}
+
+	sort.SliceStable(nearby, func(i, j int) bool {
+		if nearby[i].DistanceNM != nearby[j].DistanceNM {
+			return nearby[i].DistanceNM < nearby[j].DistanceNM
+		}
+		return nearby[i].ICAO < nearby[j].ICAO
+	})
+	return nearby
+}
+
+// LocalFrequency returns the frequency to call an airport on: tower, CTAF, UNICOM or MULTICOM
+// in that order of preference. It returns nil when the airport has none of them.
+func LocalFrequency(freqs []AirportFrequency) *AirportFrequency {
+	for _, freqType := range localFrequencyTypes {
+		for i := range freqs {
+			if freqs[i].Type == freqType {
+				return &freqs[i]
+			}
+		}
+	}
+	return nil
+}
+
+// NearbyAirports finds the airports within radiusNM of center, nearest first
+func (s *Service) NearbyAirports(center Coordinates, radiusNM float64) ([]NearbyAirport, error) {
+	return s.NearbyAirportsCtx(context.Background(), center, radiusNM)
+}
+
+// NearbyAirportsCtx finds the airports within radiusNM of center until ctx is done.
+// The simulator only lists the airports it has loaded around the user aircraft,
+// so airports far away from the aircraft are not found.
+func (s *Service) NearbyAirportsCtx(ctx context.Context, center Coordinates, radiusNM float64) ([]NearbyAirport, error) {
+	if radiusNM <= 0 {
+		return nil, fmt.Errorf("radius must be positive, got %g NM", radiusNM)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, clientTimeout)
+	defer cancel()
+
+	airports, err := s.client.GetAirportListCtx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the airport list: %w", err)
+	}
+
+	return FilterNearby(airports, center, radiusNM), nil
+}
+
+// FindNearby finds the airports within radiusNM of an ICAO code, a "lat,lon" position or the aircraft
+func (s *Service) FindNearby(center string, radiusNM float64, frequencies bool) ([]NearbyAirport, error) {
+	return s.FindNearbyCtx(context.Background(), center, radiusNM, frequencies)
+}
+
+// FindNearbyCtx finds the airports within radiusNM of an ICAO code, a "lat,lon" position or the user
+// aircraft when center is empty, nearest first, until ctx is done. With frequencies set every airport
+// gets its LocalFrequency. The airport searched around is not part of the result.
+func (s *Service) FindNearbyCtx(ctx context.Context, center string, radiusNM float64, frequencies bool) ([]NearbyAirport, error) {
+	var position Coordinates
+	var icao string
+	if strings.TrimSpace(center) == "" {
+		state, err := s.GetAircraftStateCtx(ctx)
+		if err != nil {
+			return nil, err
+		}
+		position = state.Position
+	} else {
+		var err error
+		if position, icao, err = ParsePosition(center); err != nil {
+			return nil, err
+		}
+	}
+
+	if icao != "" {
+		coords, err := s.GetWaypointCoordinatesCtx(ctx, []string{icao})
+		if err != nil {
+			return nil, err
+		}
+		position = coords[icao]
+	}
+
+	airports, err := s.NearbyAirportsCtx(ctx, position, radiusNM)
+	if err != nil {
+		return nil, err
+	}
+
+	nearby := airports[:0]
+	for _, airport := range airports {
+		if airport.ICAO != icao {
+			nearby = append(nearby, airport)
+		}
+	}
+
+	if frequencies {
+		if err := s.AddLocalFrequenciesCtx(ctx, nearby); err != nil {
+			return nil, err
+		}
+	}
+
+	return nearby, nil
+}
+
+// ParsePosition reads "52.35,13.49" as coordinates, anything else is returned as an upper case ICAO code
+func ParsePosition(s string) (Coordinates, string, error) {
+	s = strings.TrimSpace(s)
+	latStr, lonStr, found := strings.Cut(s, ",")
+	if !found {
+		return Coordinates{}, strings.ToUpper(s), nil
+	}
+
+	lat, errLat := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	lon, errLon := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if errLat != nil || errLon != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return Coordinates{}, "", fmt.Errorf("invalid position %q, expected lat,lon in degrees", s)
+	}
+	return Coordinates{Lat: lat, Lon: lon}, "", nil
+}
+
+// AddLocalFrequencies looks up the LocalFrequency of every airport in one batch
+func (s *Service) AddLocalFrequencies(airports []NearbyAirport) error {
+	return s.AddLocalFrequenciesCtx(context.Background(), airports)
+}
+
+// AddLocalFrequenciesCtx looks up the LocalFrequency of every airport until ctx is done.
+// Airports the simulator has no frequencies for are left without one.
+func (s *Service) AddLocalFrequenciesCtx(ctx context.Context, airports []NearbyAirport) error {
+	if len(airports) == 0 {
+		return nil
+	}
+
+	icaos := make([]string, len(airports))
+	for i, airport := range airports {
+		icaos[i] = airport.ICAO
+	}
+
+	freqs, err := s.GetFrequencyBatchCtx(ctx, icaos)
+	if err := IgnoreUnknownFacilities(err); err != nil {
+		return err
+	}
+
+	for i := range airports {
+		airports[i].Frequency = LocalFrequency(freqs[airports[i].ICAO])
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"atc_freq/internal/testutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	eddb = sim.Coordinates{Lat: 52.3514, Lon: 13.4939}
+	eddh = sim.Coordinates{Lat: 53.6304, Lon: 9.9883}
+)
+
+func TestDistanceNM(t *testing.T) {
+	assert.InDelta(t, 148, sim.DistanceNM(eddb, eddh), 1)
+	assert.InDelta(t, sim.DistanceNM(eddb, eddh), sim.DistanceNM(eddh, eddb), 0.001)
+	assert.Zero(t, sim.DistanceNM(eddb, eddb))
+
+	// One minute of latitude is one nautical mile
+	assert.InDelta(t, 60, sim.DistanceNM(sim.Coordinates{Lat: 0}, sim.Coordinates{Lat: 1}), 0.1)
+}
+
+func TestBearing(t *testing.T) {
+	assert.InDelta(t, 302, sim.Bearing(eddb, eddh), 1)
+	assert.InDelta(t, 0, sim.Bearing(sim.Coordinates{}, sim.Coordinates{Lat: 1}), 0.001)
+	assert.InDelta(t, 90, sim.Bearing(sim.Coordinates{}, sim.Coordinates{Lon: 1}), 0.001)
+	assert.InDelta(t, 270, sim.Bearing(sim.Coordinates{}, sim.Coordinates{Lon: -1}), 0.001)
+}
+
+func TestFilterNearby(t *testing.T) {
+	center := sim.Coordinates{}
+	airports := []sim.ListedAirport{
+		{ICAO: "FAR", Coordinates: sim.Coordinates{Lat: 1}},
+		{ICAO: "BBB", Coordinates: sim.Coordinates{Lon: 0.2}},
+		{ICAO: "NEAR", Coordinates: sim.Coordinates{Lat: 0.1}},
+		{ICAO: "AAA", Coordinates: sim.Coordinates{Lon: -0.2}},
+	}
+
+	nearby := sim.FilterNearby(airports, center, 30)
+
+	// Nearest first, equal distances by identifier
+	var icaos []string
+	for _, airport := range nearby {
+		icaos = append(icaos, airport.ICAO)
+	}
+	assert.Equal(t, []string{"NEAR", "AAA", "BBB"}, icaos)
+	assert.InDelta(t, 6, nearby[0].DistanceNM, 0.1)
+	assert.InDelta(t, 270, nearby[1].Bearing, 0.001)
+
+	assert.Empty(t, sim.FilterNearby(airports, center, 1))
+}
+
+func TestLocalFrequency(t *testing.T) {
+	freqs := []sim.AirportFrequency{
+		{Type: "ATIS", Name: "ATIS"},
+		{Type: "UNICOM", Name: "Unicom"},
+		{Type: "CTAF", Name: "Traffic"},
+	}
+	require.NotNil(t, sim.LocalFrequency(freqs))
+	assert.Equal(t, "Traffic", sim.LocalFrequency(freqs).Name)
+
+	freqs = append(freqs, sim.AirportFrequency{Type: "TOWER", Name: "Tower"})
+	assert.Equal(t, "Tower", sim.LocalFrequency(freqs).Name)
+
+	assert.Nil(t, sim.LocalFrequency(freqs[:1]))
+}
+
+func TestClient_GetAirportList(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	mockConn.On("RequestFacilitiesList", uint32(sim.SIMCONNECT_FACILITY_LIST_TYPE_AIRPORT), uint32(sim.FirstRequestID)).Return(nil).Once()
+
+	// The list arrives in two messages, the second one ends the request
+	mockConn.On("GetNextDispatch").Return(testutil.CreateAirportListResponse(sim.FirstRequestID, 0, 2,
+		testutil.ListAirport{ICAO: "EDAZ", Region: "ED", Lat: 52.2047, Lon: 13.1586, AltitudeM: 41}), true).Once()
+	mockConn.On("GetNextDispatch").Return(testutil.CreateAirportListResponse(sim.FirstRequestID, 1, 2,
+		testutil.ListAirport{ICAO: "EDDB", Region: "ED", Lat: 52.3514, Lon: 13.4939, AltitudeM: 48},
+		testutil.ListAirport{ICAO: "EDAY", Region: "ED", Lat: 52.5806, Lon: 13.9156, AltitudeM: 79}), true).Once()
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	airports, err := client.GetAirportList(5 * time.Second)
+	client.Close()
+
+	require.NoError(t, err)
+	require.Len(t, airports, 3)
+	assert.Equal(t, "EDAZ", airports[0].ICAO)
+	assert.Equal(t, "ED", airports[0].Region)
+	assert.InDelta(t, 52.2047, airports[0].Coordinates.Lat, 0.00001)
+	assert.InDelta(t, 13.1586, airports[0].Coordinates.Lon, 0.00001)
+	assert.InDelta(t, 134.5, airports[0].Altitude, 0.1)
+	assert.Equal(t, "EDAY", airports[2].ICAO)
+	mockConn.AssertExpectations(t)
+}
+
+func TestClient_GetAirportList_Empty(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+
+	// No airports are loaded, the only message has DwOutOf 0
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	mockConn.On("RequestFacilitiesList", uint32(sim.SIMCONNECT_FACILITY_LIST_TYPE_AIRPORT), uint32(sim.FirstRequestID)).Return(nil).Once()
+	mockConn.On("GetNextDispatch").Return(testutil.CreateAirportListResponse(sim.FirstRequestID, 0, 0), true).Once()
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	start := time.Now()
+	airports, err := client.GetAirportList(5 * time.Second)
+	client.Close()
+
+	require.NoError(t, err)
+	assert.Empty(t, airports)
+	assert.Less(t, time.Since(start), time.Second)
+	mockConn.AssertExpectations(t)
+}
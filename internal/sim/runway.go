@@ -0,0 +1,113 @@
+package sim
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// MaxCrosswindKnots is the crosswind, gusts included, above which a runway end is flagged
+	MaxCrosswindKnots = 20
+	// tailwindKnots is the smallest tailwind component that flags a runway end
+	tailwindKnots = 1
+)
+
+// RunwayWind is the wind component along and across one runway end
+type RunwayWind struct {
+	Runway             string    `json:"runway"` // Runway the end belongs to, e.g. 07L/25R
+	End                RunwayEnd `json:"end"`
+	Length             float64   `json:"length"`              // Feet
+	Headwind           float64   `json:"headwind"`            // Knots, negative for a tailwind
+	Crosswind          float64   `json:"crosswind"`           // Knots, positive when the wind comes from the right
+	GustHeadwind       float64   `json:"gust_headwind"`       // Headwind with the gust speed, equal to Headwind without gusts
+	GustCrosswind      float64   `json:"gust_crosswind"`      // Crosswind with the gust speed, equal to Crosswind without gusts
+	Tailwind           bool      `json:"tailwind"`            // The wind has a tailwind component on this end
+	ExcessiveCrosswind bool      `json:"excessive_crosswind"` // The crosswind, gusts included, is above MaxCrosswindKnots
+}
+
+// RunwayRecommendation ranks the runway ends of an airport by the reported wind
+type RunwayRecommendation struct {
+	ICAO        string       `json:"icao"`
+	Weather     *Weather     `json:"weather"`     // nil when the airport has no weather station
+	Wind        *Wind        `json:"wind"`        // Wind the ends are ranked by, nil when not reported
+	Ends        []RunwayWind `json:"ends"`        // Best end first
+	Recommended *RunwayWind  `json:"recommended"` // First of Ends, nil when the airport has no runways
+}
+
+// RankRunways computes the wind components for every runway end of airport and orders
+// the ends from the most to the least suitable: ends without tailwind and excessive
+// crosswind first, then by headwind, length and ILS. A nil or calm wind ranks by length.
+func RankRunways(airport *Airport, wind *Wind) []RunwayWind {
+	ends := make([]RunwayWind, 0, 2*len(airport.Runways))
+	for _, runway := range airport.Runways {
+		for _, end := range []RunwayEnd{runway.Primary, runway.Secondary} {
+			ends = append(ends, runwayWind(runway, end, wind))
+		}
+	}
+
+	sort.SliceStable(ends, func(i, j int) bool {
+		a, b := ends[i], ends[j]
+		if a.Tailwind != b.Tailwind {
+			return !a.Tailwind
+		}
+		if a.ExcessiveCrosswind != b.ExcessiveCrosswind {
+			return !a.ExcessiveCrosswind
+		}
+		// Differences below a knot are noise, prefer the longer runway instead
+		if ha, hb := math.Round(a.Headwind), math.Round(b.Headwind); ha != hb {
+			return ha > hb
+		}
+		if a.Length != b.Length {
+			return a.Length > b.Length
+		}
+		return a.End.ILS != nil && b.End.ILS == nil
+	})
+
+	return ends
+}
+
+func runwayWind(runway Runway, end RunwayEnd, wind *Wind) RunwayWind {
+	result := RunwayWind{
+		Runway: runway.Designator,
+		End:    end,
+		Length: runway.Length,
+	}
+	if wind == nil || wind.Calm() {
+		return result
+	}
+
+	speed := wind.SpeedKnots()
+	gust := max(wind.GustKnots(), speed)
+
+	if wind.Variable {
+		// The direction is unknown, no end gets a headwind and the whole wind may come from the side
+		result.Crosswind = speed
+		result.GustCrosswind = gust
+	} else {
+		result.Headwind, result.Crosswind = windComponents(float64(wind.Direction), speed, end.Heading)
+		result.GustHeadwind, result.GustCrosswind = windComponents(float64(wind.Direction), gust, end.Heading)
+
+		// A variable sector, e.g. 210V270, can turn the wind towards either of its limits
+		if wind.VariableFrom != 0 || wind.VariableTo != 0 {
+			for _, direction := range []int{wind.VariableFrom, wind.VariableTo} {
+				headwind, crosswind := windComponents(float64(direction), gust, end.Heading)
+				result.GustHeadwind = min(result.GustHeadwind, headwind)
+				if math.Abs(crosswind) > math.Abs(result.GustCrosswind) {
+					result.GustCrosswind = crosswind
+				}
+			}
+		}
+	}
+
+	result.Tailwind = result.GustHeadwind <= -tailwindKnots
+	result.ExcessiveCrosswind = math.Abs(result.GustCrosswind) > MaxCrosswindKnots
+
+	return result
+}
+
+// windComponents splits a wind from direction into the headwind and crosswind on a runway heading.
+// Direction and heading are both degrees true, crosswind is positive from the right.
+func windComponents(direction, speed, heading float64) (headwind, crosswind float64) {
+	angle := (direction - heading) * math.Pi / 180
+	return speed * math.Cos(angle), speed * math.Sin(angle)
+}
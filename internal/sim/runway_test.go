@@ -0,0 +1,143 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAirport has a long 07/25 without ILS and a shorter 16/34 with an ILS on 34
+var testAirport = &sim.Airport{
+	ICAO: "TEST",
+	Runways: []sim.Runway{
+		{
+			Designator: "07/25",
+			Primary:    sim.RunwayEnd{Designator: "07", Heading: 70},
+			Secondary:  sim.RunwayEnd{Designator: "25", Heading: 250},
+			Length:     9000,
+		},
+		{
+			Designator: "16/34",
+			Primary:    sim.RunwayEnd{Designator: "16", Heading: 160},
+			Secondary:  sim.RunwayEnd{Designator: "34", Heading: 340, ILS: &sim.ILS{Ident: "ITST"}},
+			Length:     6000,
+		},
+	},
+}
+
+func TestRankRunways(t *testing.T) {
+	tests := []struct {
+		name          string
+		metar         string
+		expectedOrder []string
+		check         func(*testing.T, map[string]sim.RunwayWind)
+	}{
+		{
+			name:          "wind along a runway",
+			metar:         "TEST 171150Z 25010KT 9999 FEW030 12/07 Q1015",
+			expectedOrder: []string{"25", "34", "16", "07"},
+			check: func(t *testing.T, ends map[string]sim.RunwayWind) {
+				assert.InDelta(t, 10, ends["25"].Headwind, 0.001)
+				assert.InDelta(t, 0, ends["25"].Crosswind, 0.001)
+				assert.InDelta(t, -10, ends["07"].Headwind, 0.001)
+				assert.True(t, ends["07"].Tailwind)
+				assert.False(t, ends["25"].Tailwind)
+			},
+		},
+		{
+			name:          "crosswind sides",
+			metar:         "TEST 171150Z 29010KT 9999 FEW030 12/07 Q1015",
+			expectedOrder: []string{"25", "34", "16", "07"},
+			check: func(t *testing.T, ends map[string]sim.RunwayWind) {
+				// 40° from the right on 25, 50° from the left on 34
+				assert.InDelta(t, 6.43, ends["25"].Crosswind, 0.01)
+				assert.InDelta(t, 7.66, ends["25"].Headwind, 0.01)
+				assert.InDelta(t, -7.66, ends["34"].Crosswind, 0.01)
+				assert.InDelta(t, 6.43, ends["34"].Headwind, 0.01)
+			},
+		},
+		{
+			name:          "gusts flag excessive crosswind",
+			metar:         "TEST 171150Z 34015G30KT 9999 FEW030 12/07 Q1015",
+			expectedOrder: []string{"34", "07", "25", "16"},
+			check: func(t *testing.T, ends map[string]sim.RunwayWind) {
+				// 90° on 07/25, the steady wind is within limits but the gusts are not
+				assert.InDelta(t, 15, ends["25"].Crosswind, 0.001)
+				assert.InDelta(t, 30, ends["25"].GustCrosswind, 0.001)
+				assert.True(t, ends["25"].ExcessiveCrosswind)
+				assert.False(t, ends["34"].ExcessiveCrosswind)
+				assert.InDelta(t, 30, ends["34"].GustHeadwind, 0.001)
+			},
+		},
+		{
+			name:          "variable sector turns into a tailwind",
+			metar:         "TEST 171150Z 16008KT 100V200 9999 FEW030 12/07 Q1015",
+			expectedOrder: []string{"16", "07", "25", "34"},
+			check: func(t *testing.T, ends map[string]sim.RunwayWind) {
+				assert.False(t, ends["16"].Tailwind)
+				// The wind is straight across 07/25, each limit of the sector is a tailwind on one end
+				assert.InDelta(t, 0, ends["25"].Headwind, 0.001)
+				assert.True(t, ends["25"].Tailwind)
+				assert.True(t, ends["07"].Tailwind)
+			},
+		},
+		{
+			name:          "calm wind prefers the longest runway",
+			metar:         "TEST 171150Z 00000KT 9999 FEW030 12/07 Q1015",
+			expectedOrder: []string{"07", "25", "34", "16"},
+			check: func(t *testing.T, ends map[string]sim.RunwayWind) {
+				for _, end := range ends {
+					assert.Zero(t, end.Headwind)
+					assert.False(t, end.Tailwind)
+				}
+			},
+		},
+		{
+			name:          "variable wind is all crosswind",
+			metar:         "TEST 171150Z VRB03KT 9999 FEW030 12/07 Q1015",
+			expectedOrder: []string{"07", "25", "34", "16"},
+			check: func(t *testing.T, ends map[string]sim.RunwayWind) {
+				assert.Zero(t, ends["07"].Headwind)
+				assert.InDelta(t, 3, ends["07"].Crosswind, 0.001)
+				assert.False(t, ends["07"].Tailwind)
+			},
+		},
+		{
+			name:          "wind in meters per second",
+			metar:         "TEST 171150Z 25005MPS 9999 FEW030 12/07 Q1015",
+			expectedOrder: []string{"25", "34", "16", "07"},
+			check: func(t *testing.T, ends map[string]sim.RunwayWind) {
+				assert.InDelta(t, 9.72, ends["25"].Headwind, 0.01)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metar, err := sim.ParseMetar(tt.metar)
+			require.NoError(t, err)
+
+			ranked := sim.RankRunways(testAirport, metar.Wind)
+
+			order := make([]string, len(ranked))
+			ends := make(map[string]sim.RunwayWind)
+			for i, end := range ranked {
+				order[i] = end.End.Designator
+				ends[end.End.Designator] = end
+			}
+			assert.Equal(t, tt.expectedOrder, order)
+			tt.check(t, ends)
+		})
+	}
+}
+
+func TestRankRunways_NoWind(t *testing.T) {
+	ranked := sim.RankRunways(testAirport, nil)
+	require.Len(t, ranked, 4)
+	assert.Equal(t, "07/25", ranked[0].Runway)
+	assert.Equal(t, "34", ranked[2].End.Designator, "the ILS end comes first between ends of the same length")
+
+	assert.Empty(t, sim.RankRunways(&sim.Airport{}, nil))
+}
@@ -1,35 +1,76 @@
 package sim
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 )
 
 const clientTimeout = 10 * time.Second
-const altStep = 500
-const maxAltitude = 10000
 
-// Service is a layer between applications and Client
+// Service is a layer between applications and Client. It caches the responses of the simulator,
+// see DefaultCacheTTLs, and answers frequency requests from a FrequencySource when one is set.
 type Service struct {
 	client *Client
+	cache  *cache
+
+	sourceMu   sync.RWMutex
+	source     FrequencySource
+	sourceMode SourceMode
 }
 
 // NewService creates a new Service with the provided Client
 func NewService(client *Client) *Service {
 	return &Service{
 		client: client,
+		cache:  newCache(DefaultCacheTTLs),
 	}
 }
 
+// SetCacheTTL changes how long responses of kind are cached, entries cached already keep their expiry.
+// Use CacheForever to keep them for the session, zero to stop caching them.
+func (s *Service) SetCacheTTL(kind CacheKind, ttl time.Duration) {
+	s.cache.setTTL(kind, ttl)
+}
+
+// InvalidateCache drops the cached responses of kinds, of every kind when none is given
+func (s *Service) InvalidateCache(kinds ...CacheKind) {
+	s.cache.invalidate(kinds...)
+}
+
+// CacheStats returns the hits, misses and entries of every cached kind
+func (s *Service) CacheStats() map[CacheKind]CacheStats {
+	return s.cache.snapshot()
+}
+
+// Close closes the SimConnect session shared by all requests
+func (s *Service) Close() {
+	s.client.Close()
+}
+
 // GetFrequency retrieves all frequencies for the specified ICAO airport code
 func (s *Service) GetFrequency(icao string) ([]AirportFrequency, error) {
+	return s.GetFrequencyCtx(context.Background(), icao)
+}
+
+// GetFrequencyCtx retrieves all frequencies for the specified ICAO airport code until ctx is done
+func (s *Service) GetFrequencyCtx(ctx context.Context, icao string) ([]AirportFrequency, error) {
 	icao = strings.ToUpper(strings.TrimSpace(icao))
 	if icao == "" {
 		return nil, fmt.Errorf("ICAO code cannot be empty")
 	}
 
-	freqs, err := s.client.GetAirportFrequencies(icao, clientTimeout)
+	requestCtx, cancel := context.WithTimeout(ctx, clientTimeout)
+	defer cancel()
+
+	freqs, err := cached(requestCtx, s.cache, CacheFacilities, "frequencies/"+icao, func(ctx context.Context) ([]AirportFrequency, error) {
+		return s.client.GetAirportFrequenciesCtx(ctx, icao)
+	})
+	// The source gets the context of the caller, the simulator may have used up the timeout
+	freqs, err = s.sourceFrequencies(ctx, icao, freqs, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get frequencies for %s: %w", icao, err)
 	}
@@ -37,64 +78,349 @@ func (s *Service) GetFrequency(icao string) ([]AirportFrequency, error) {
 	return freqs, nil
 }
 
+// GetFrequencyBatch retrieves the frequencies of several airports in one round trip
+func (s *Service) GetFrequencyBatch(icaos []string) (map[string][]AirportFrequency, error) {
+	return s.GetFrequencyBatchCtx(context.Background(), icaos)
+}
+
+// GetFrequencyBatchCtx retrieves the frequencies of several airports until ctx is done.
+// Airports that failed are reported in a *BatchError returned together with the others.
+func (s *Service) GetFrequencyBatchCtx(ctx context.Context, icaos []string) (map[string][]AirportFrequency, error) {
+	icaos = uniqueWaypoints(normalizeWaypoints(icaos))
+	if len(icaos) == 0 {
+		return nil, fmt.Errorf("no ICAO codes provided")
+	}
+
+	requestCtx, cancel := context.WithTimeout(ctx, clientTimeout)
+	defer cancel()
+
+	freqs, err := cachedBatch(requestCtx, s.cache, CacheFacilities, "frequencies/", icaos, s.client.GetAirportFrequenciesBatchCtx)
+	return s.sourceFrequencyBatch(ctx, icaos, freqs, err)
+}
+
 // GetWeather retrieves weather information for the specified waypoints
 func (s *Service) GetWeather(waypoints []string) (map[string]*Weather, error) {
+	return s.GetWeatherCtx(context.Background(), waypoints)
+}
+
+// GetWeatherCtx retrieves weather information for the specified waypoints until ctx is done
+func (s *Service) GetWeatherCtx(ctx context.Context, waypoints []string) (map[string]*Weather, error) {
 	if len(waypoints) == 0 {
 		return nil, fmt.Errorf("no waypoints provided")
 	}
 
-	cleanedWaypoints := cleanWaypoints(waypoints)
+	cleanedWaypoints := uniqueWaypoints(normalizeWaypoints(waypoints))
+	if len(cleanedWaypoints) == 0 {
+		return nil, fmt.Errorf("no valid waypoints provided")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, clientTimeout)
+	defer cancel()
+
+	return s.cachedWeather(ctx, cleanedWaypoints)
+}
+
+// cachedWeather returns the classified weather of normalized waypoints, asking the simulator
+// only for those not cached
+func (s *Service) cachedWeather(ctx context.Context, waypoints []string) (map[string]*Weather, error) {
+	return cachedBatch(ctx, s.cache, CacheWeather, "metar/", waypoints, func(ctx context.Context, missing []string) (map[string]*Weather, error) {
+		weather, err := s.client.GetWeatherCtx(ctx, missing)
+		for _, w := range weather {
+			w.classify()
+		}
+		return weather, err
+	})
+}
+
+// GetRouteWeather retrieves weather for the waypoints of a route in route order,
+// together with the worst flight category along it
+func (s *Service) GetRouteWeather(waypoints []string) (*RouteWeather, error) {
+	return s.GetRouteWeatherCtx(context.Background(), waypoints)
+}
+
+// GetRouteWeatherCtx retrieves weather for the waypoints of a route until ctx is done.
+// Waypoints without a weather station are left out.
+func (s *Service) GetRouteWeatherCtx(ctx context.Context, waypoints []string) (*RouteWeather, error) {
+	weather, err := s.GetWeatherCtx(ctx, waypoints)
+	if err := IgnoreUnknownFacilities(err); err != nil {
+		return nil, err
+	}
+
+	return SummarizeRoute(waypoints, weather), nil
+}
+
+// GetAirportDetails retrieves name, elevation, tower and runways of an airport
+func (s *Service) GetAirportDetails(icao string) (*Airport, error) {
+	return s.GetAirportDetailsCtx(context.Background(), icao)
+}
+
+// GetAirportDetailsCtx retrieves name, elevation, tower and runways of an airport until ctx is done
+func (s *Service) GetAirportDetailsCtx(ctx context.Context, icao string) (*Airport, error) {
+	icao = strings.ToUpper(strings.TrimSpace(icao))
+	if icao == "" {
+		return nil, fmt.Errorf("ICAO code cannot be empty")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, clientTimeout)
+	defer cancel()
+
+	airport, err := cached(ctx, s.cache, CacheFacilities, "airport/"+icao, func(ctx context.Context) (*Airport, error) {
+		return s.client.GetAirportDetailsCtx(ctx, icao)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get airport details for %s: %w", icao, err)
+	}
+	return airport, nil
+}
+
+// RecommendRunway ranks the runway ends of an airport by the wind in its METAR
+func (s *Service) RecommendRunway(icao string) (*RunwayRecommendation, error) {
+	return s.RecommendRunwayCtx(context.Background(), icao)
+}
+
+// RecommendRunwayCtx ranks the runway ends of an airport by the wind in its METAR until ctx is done.
+// Airports without a weather station are ranked as if the wind was calm.
+func (s *Service) RecommendRunwayCtx(ctx context.Context, icao string) (*RunwayRecommendation, error) {
+	icao = strings.ToUpper(strings.TrimSpace(icao))
+	if icao == "" {
+		return nil, fmt.Errorf("ICAO code cannot be empty")
+	}
+
+	airport, err := s.GetAirportDetailsCtx(ctx, icao)
+	if err != nil {
+		return nil, err
+	}
+
+	station, err := s.airportWeather(ctx, icao)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRunwayRecommendation(icao, airport, station), nil
+}
+
+// airportWeather returns the classified weather of an airport, nil when it has no weather station
+func (s *Service) airportWeather(ctx context.Context, icao string) (*Weather, error) {
+	ctx, cancel := context.WithTimeout(ctx, clientTimeout)
+	defer cancel()
+
+	weather, err := s.cachedWeather(ctx, []string{icao})
+	if err != nil && !errors.Is(err, ErrUnknownFacility) {
+		return nil, fmt.Errorf("failed to get weather for %s: %w", icao, err)
+	}
+
+	return weather[icao], nil
+}
+
+func newRunwayRecommendation(icao string, airport *Airport, station *Weather) *RunwayRecommendation {
+	recommendation := &RunwayRecommendation{ICAO: icao, Weather: station}
+	if station != nil && station.Metar != nil {
+		recommendation.Wind = station.Metar.Wind
+	}
+
+	recommendation.Ends = RankRunways(airport, recommendation.Wind)
+	if len(recommendation.Ends) > 0 {
+		recommendation.Recommended = &recommendation.Ends[0]
+	}
+
+	return recommendation
+}
+
+// Brief builds a pre-flight briefing for every airport of the route
+func (s *Service) Brief(route []string) (*Briefing, error) {
+	return s.BriefCtx(context.Background(), route)
+}
+
+// BriefCtx builds a pre-flight briefing for every airport of the route until ctx is done.
+// Route entries that aren't airports, like enroute fixes, are listed in Briefing.Unknown.
+func (s *Service) BriefCtx(ctx context.Context, route []string) (*Briefing, error) {
+	airports := uniqueWaypoints(normalizeWaypoints(route))
+	if len(airports) == 0 {
+		return nil, fmt.Errorf("no valid waypoints provided")
+	}
+
+	briefing := &Briefing{Airports: []AirportBriefing{}, Worst: CategoryUnknown}
+	var known []string
+	for _, icao := range airports {
+		airport, err := s.airportBriefing(ctx, icao)
+		if errors.Is(err, ErrUnknownFacility) {
+			briefing.Unknown = append(briefing.Unknown, icao)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if airport.Weather != nil && airport.Weather.Category.WorseThan(briefing.Worst) {
+			briefing.Worst = airport.Weather.Category
+		}
+		briefing.Airports = append(briefing.Airports, *airport)
+		known = append(known, icao)
+	}
+
+	if len(known) == 0 {
+		return briefing, nil
+	}
+
+	// Airports whose frequencies failed are briefed without them, like the levels of the clouds below
+	freqs, err := s.GetFrequencyBatchCtx(ctx, known)
+	var freqErr *BatchError
+	if err != nil && !errors.As(err, &freqErr) {
+		return nil, fmt.Errorf("failed to get frequencies: %w", err)
+	}
+
+	// Levels that failed are listed with their airport, the clouds only fail when none was answered
+	clouds, err := NewCloudDensities(s.GetCloudDensityCtx(ctx, known))
+	if err != nil {
+		return nil, err
+	}
+	for i := range briefing.Airports {
+		airport := &briefing.Airports[i]
+		airport.Frequencies = SortByPhase(freqs[airport.ICAO])
+		if freqErr != nil && freqErr.Errors[airport.ICAO] != nil {
+			airport.FrequencyError = freqErr.Errors[airport.ICAO].Error()
+		}
+		airport.Clouds = clouds.Clouds[airport.ICAO]
+		airport.CloudFailures = clouds.Failures[airport.ICAO]
+	}
+
+	return briefing, nil
+}
+
+func (s *Service) airportBriefing(ctx context.Context, icao string) (*AirportBriefing, error) {
+	airport, err := s.GetAirportDetailsCtx(ctx, icao)
+	if err != nil {
+		return nil, err
+	}
+
+	station, err := s.airportWeather(ctx, icao)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AirportBriefing{
+		ICAO:    icao,
+		Name:    airport.Name,
+		Weather: station,
+		Runway:  newRunwayRecommendation(icao, airport, station).Recommended,
+	}, nil
+}
+
+// GetWaypointCoordinates retrieves the position of waypoints and airports
+func (s *Service) GetWaypointCoordinates(waypoints []string) (map[string]Coordinates, error) {
+	return s.GetWaypointCoordinatesCtx(context.Background(), waypoints)
+}
+
+// GetWaypointCoordinatesCtx retrieves the position of waypoints and airports until ctx is done
+func (s *Service) GetWaypointCoordinatesCtx(ctx context.Context, waypoints []string) (map[string]Coordinates, error) {
+	cleanedWaypoints := uniqueWaypoints(normalizeWaypoints(waypoints))
 	if len(cleanedWaypoints) == 0 {
 		return nil, fmt.Errorf("no valid waypoints provided")
 	}
 
-	return s.client.GetWeather(cleanedWaypoints, clientTimeout)
+	ctx, cancel := context.WithTimeout(ctx, clientTimeout)
+	defer cancel()
+
+	return cachedBatch(ctx, s.cache, CacheFacilities, "position/", cleanedWaypoints, s.client.GetWaypointCoordinatesCtx)
 }
 
 // GetCloudDensity retrieves cloud density at multiple altitude layers for each waypoint
 func (s *Service) GetCloudDensity(waypoints []string) (map[string][]CloudDensity, error) {
+	return s.GetCloudDensityCtx(context.Background(), waypoints)
+}
+
+// GetCloudDensityCtx retrieves cloud density at the levels of DefaultCloudProfile for each waypoint until ctx is done
+func (s *Service) GetCloudDensityCtx(ctx context.Context, waypoints []string) (map[string][]CloudDensity, error) {
+	profiles, err := s.GetCloudProfileCtx(ctx, waypoints, DefaultCloudProfile)
+	if profiles == nil {
+		return nil, err
+	}
+
+	result := make(map[string][]CloudDensity, len(profiles))
+	for wp, profile := range profiles {
+		result[wp] = profile.Levels
+	}
+	return result, err
+}
+
+// GetCloudProfile retrieves the cloud profile of each waypoint for the levels of opts
+func (s *Service) GetCloudProfile(waypoints []string, opts CloudProfileOptions) (map[string]*CloudProfile, error) {
+	return s.GetCloudProfileCtx(context.Background(), waypoints, opts)
+}
+
+// GetCloudProfileCtx retrieves the cloud profile of each waypoint for the levels of opts until ctx is done
+func (s *Service) GetCloudProfileCtx(ctx context.Context, waypoints []string, opts CloudProfileOptions) (map[string]*CloudProfile, error) {
 	if len(waypoints) == 0 {
 		return nil, fmt.Errorf("no waypoints provided")
 	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
 
-	cleanedWaypoints := cleanWaypoints(waypoints)
+	cleanedWaypoints := uniqueWaypoints(normalizeWaypoints(waypoints))
 	if len(cleanedWaypoints) == 0 {
 		return nil, fmt.Errorf("no valid waypoints provided")
 	}
 
-	// Get coordinates for all waypoints
-	coords, err := s.client.GetWaypointCoordinates(cleanedWaypoints, clientTimeout)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get waypoint coordinates: %w", err)
+	prefix := fmt.Sprintf("clouds/%d-%d-%d/", opts.MinAlt, opts.MaxAlt, opts.Step)
+	return cachedBatch(ctx, s.cache, CacheClouds, prefix, cleanedWaypoints, func(ctx context.Context, waypoints []string) (map[string]*CloudProfile, error) {
+		return s.cloudProfiles(ctx, waypoints, opts)
+	})
+}
+
+// GetCloudGrid retrieves the cloud density grid of a square of boxKm around waypoint between minAlt and maxAlt feet
+func (s *Service) GetCloudGrid(waypoint string, boxKm float64, minAlt, maxAlt int) (*CloudGrid, error) {
+	return s.GetCloudGridCtx(context.Background(), waypoint, boxKm, minAlt, maxAlt)
+}
+
+// GetCloudGridCtx retrieves the cloud density grid of a square of boxKm around waypoint between minAlt and maxAlt
+// feet until ctx is done
+func (s *Service) GetCloudGridCtx(ctx context.Context, waypoint string, boxKm float64, minAlt, maxAlt int) (*CloudGrid, error) {
+	cleaned := normalizeWaypoints([]string{waypoint})
+	if len(cleaned) == 0 {
+		return nil, fmt.Errorf("no valid waypoint provided")
 	}
+	waypoint = cleaned[0]
 
-	// Get cloud density for each waypoint at all altitude layers (0-10000 feet, 500 feet step)
-	result := make(map[string][]CloudDensity)
-	for wp, coord := range coords {
-		var layers []CloudDensity
-		for minAlt := 0; minAlt < maxAltitude; minAlt += altStep {
-			maxAlt := minAlt + altStep
-			density, err := s.client.GetCloudDensityByCoordinates(coord, float32(minAlt), float32(maxAlt), clientTimeout)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get cloud density for %s at %d-%d ft: %w", wp, minAlt, maxAlt, err)
+	key := fmt.Sprintf("grid/%s/%g/%d-%d", waypoint, boxKm, minAlt, maxAlt)
+	return cached(ctx, s.cache, CacheClouds, key, func(ctx context.Context) (*CloudGrid, error) {
+		coords, err := s.GetWaypointCoordinatesCtx(ctx, []string{waypoint})
+		position, ok := coords[waypoint]
+		if !ok {
+			if err == nil {
+				err = &UnknownFacilityError{Idents: []string{waypoint}}
 			}
-			density.MinAlt = minAlt
-			density.MaxAlt = maxAlt
-			layers = append(layers, density)
+			return nil, fmt.Errorf("failed to get waypoint coordinates: %w", err)
 		}
-		result[wp] = layers
-	}
 
-	return result, nil
+		ctx, cancel := context.WithTimeout(ctx, clientTimeout)
+		defer cancel()
+		return s.client.GetCloudGridCtx(ctx, position, boxKm, minAlt, maxAlt)
+	})
 }
 
-func cleanWaypoints(waypoints []string) []string {
-	cleaned := make([]string, 0, len(waypoints))
-	for _, wp := range waypoints {
-		wp = strings.TrimSpace(wp)
-		if wp != "" {
-			cleaned = append(cleaned, wp)
-		}
+// cloudProfiles asks the simulator for the cloud profiles of waypoints, all levels of all waypoints at once.
+// Waypoints the simulator doesn't know are reported in the *BatchError of the levels that failed.
+func (s *Service) cloudProfiles(ctx context.Context, waypoints []string, opts CloudProfileOptions) (map[string]*CloudProfile, error) {
+	coords, err := s.GetWaypointCoordinatesCtx(ctx, waypoints)
+	var unknown *UnknownFacilityError
+	if err != nil && (!errors.As(err, &unknown) || len(coords) == 0) {
+		return nil, fmt.Errorf("failed to get waypoint coordinates: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, clientTimeout)
+	defer cancel()
+	profiles, err := s.client.GetCloudProfilesCtx(ctx, coords, opts)
+	if unknown == nil {
+		return profiles, err
+	}
+
+	batchErr := &BatchError{Errors: make(map[string]error)}
+	if err != nil && !errors.As(err, &batchErr) {
+		return nil, err
+	}
+	for _, wp := range unknown.Idents {
+		batchErr.Errors[wp] = &UnknownFacilityError{Idents: []string{wp}}
 	}
-	return cleaned
+	return profiles, batchErr
 }
@@ -0,0 +1,402 @@
+package sim
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// dispatchPollInterval is how long the dispatch loop sleeps when SimConnect has nothing queued
+const dispatchPollInterval = 10 * time.Millisecond
+
+// Session keeps a single Connection open and runs one dispatch goroutine
+// that routes every received message to the request waiting for it.
+type Session struct {
+	connection Connection
+	name       string
+
+	defineIDs  *IDAllocator
+	requestIDs *IDAllocator
+	eventIDs   *IDAllocator
+
+	mu            sync.Mutex
+	opened        bool
+	subscriptions map[uint32]*subscription
+	sends         map[uint32]*subscription // By the send ID of the packets sent for the subscription
+	definitions   map[string]*registeredDefinition
+	events        map[string]*registeredDefinition
+	wake          chan struct{}
+	stop          chan struct{}
+	stopped       chan struct{}
+
+	// sendMu serializes definition setup so a definition is only registered once
+	sendMu sync.Mutex
+	// packetMu serializes sending packets, so the last send ID is the one of the packet just sent
+	packetMu sync.Mutex
+}
+
+// facilityDefinition describes a SimConnect facility definition shared by every request that needs it
+type facilityDefinition struct {
+	name   string
+	fields []string
+}
+
+// dataDefinition describes a SimConnect data definition of simulation variables, all requested as FLOAT64
+type dataDefinition struct {
+	name      string
+	variables []dataVariable
+}
+
+// dataVariable is a simulation variable and the units it is requested in
+type dataVariable struct {
+	name  string
+	units string
+}
+
+// registeredDefinition tracks the ID assigned to a facilityDefinition, dataDefinition or client event
+type registeredDefinition struct {
+	id         uint32
+	registered bool
+}
+
+// subscription receives copies of the dispatches addressed to its request IDs and the
+// exceptions about the packets sent for it
+type subscription struct {
+	session    *Session
+	requestIDs []uint32
+	sendIDs    []uint32
+	recv       chan dispatch
+	done       chan struct{}
+	once       sync.Once
+}
+
+// NewSession creates a Session for the provided Connection. The connection is
+// opened lazily on the first request.
+func NewSession(conn Connection, name string) *Session {
+	return &Session{
+		connection:    conn,
+		name:          name,
+		defineIDs:     NewIDAllocator(FirstDefineID, maxID),
+		requestIDs:    NewIDAllocator(FirstRequestID, maxID),
+		eventIDs:      NewIDAllocator(FirstEventID, maxID),
+		subscriptions: make(map[uint32]*subscription),
+		sends:         make(map[uint32]*subscription),
+		definitions:   make(map[string]*registeredDefinition),
+		events:        make(map[string]*registeredDefinition),
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// Open opens the connection and starts the dispatch loop if it is not running yet
+func (s *Session) Open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.opened {
+		return nil
+	}
+
+	if err := s.connection.Open(s.name); err != nil {
+		return err
+	}
+
+	s.opened = true
+	// A new connection numbers its packets from the start again
+	clear(s.sends)
+	// Definitions and events keep their IDs but have to be registered again on a new connection
+	for _, def := range s.definitions {
+		def.registered = false
+	}
+	for _, event := range s.events {
+		event.registered = false
+	}
+	s.stop = make(chan struct{})
+	s.stopped = make(chan struct{})
+	go s.dispatchLoop(s.stop, s.stopped)
+
+	return nil
+}
+
+// Close stops the dispatch loop and closes the connection
+func (s *Session) Close() {
+	s.mu.Lock()
+	if !s.opened {
+		s.mu.Unlock()
+		return
+	}
+	s.opened = false
+	stop, stopped := s.stop, s.stopped
+	s.mu.Unlock()
+
+	close(stop)
+	<-stopped
+	s.connection.Close()
+}
+
+// define registers a facility definition once per opened connection and
+// returns its define ID. Exceptions about the fields go to sub.
+func (s *Session) define(sub *subscription, def facilityDefinition) (uint32, error) {
+	return s.register(s.definitions, s.defineIDs, def.name, func(id uint32) error {
+		for _, field := range def.fields {
+			if _, err := s.send(sub, func() error { return s.connection.AddField(field, id) }); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// defineData registers a data definition once per opened connection and
+// returns its define ID. Exceptions about the variables go to sub.
+func (s *Session) defineData(sub *subscription, def dataDefinition) (uint32, error) {
+	return s.register(s.definitions, s.defineIDs, def.name, func(id uint32) error {
+		for _, variable := range def.variables {
+			_, err := s.send(sub, func() error {
+				return s.connection.AddToDataDefinition(id, variable.name, variable.units, SIMCONNECT_DATATYPE_FLOAT64)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// mapEvent maps a client event to the simulator event name once per opened
+// connection and returns its event ID
+func (s *Session) mapEvent(name string) (uint32, error) {
+	return s.register(s.events, s.eventIDs, name, func(id uint32) error {
+		_, err := s.send(nil, func() error { return s.connection.MapClientEventToSimEvent(id, name) })
+		return err
+	})
+}
+
+// send sends a packet with request and returns its send ID. An exception naming the send ID
+// is routed to sub, packets sent without a subscription have their exceptions dropped.
+// The error of reading the send ID is returned as well, the exceptions of the packet would reach no one.
+func (s *Session) send(sub *subscription, request func() error) (uint32, error) {
+	s.packetMu.Lock()
+	defer s.packetMu.Unlock()
+
+	if err := request(); err != nil {
+		return 0, err
+	}
+	sendID, err := s.connection.GetLastSentPacketID()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read send ID: %w", err)
+	}
+	if sub == nil {
+		return sendID, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-sub.done:
+		// Cancelled, nobody is waiting for the exception anymore
+	default:
+		s.sends[sendID] = sub
+		sub.sendIDs = append(sub.sendIDs, sendID)
+	}
+	return sendID, nil
+}
+
+// register assigns an ID from ids to the entry of registry called name and calls
+// add to send it, unless that was already done on the opened connection.
+// Facility and data definitions share the define IDs.
+func (s *Session) register(registry map[string]*registeredDefinition, ids *IDAllocator, name string, add func(id uint32) error) (uint32, error) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	s.mu.Lock()
+	registered, exists := registry[name]
+	if !exists {
+		id, err := ids.Acquire()
+		if err != nil {
+			s.mu.Unlock()
+			return 0, fmt.Errorf("failed to allocate ID for %s: %w", name, err)
+		}
+		registered = &registeredDefinition{id: id}
+		registry[name] = registered
+	}
+	id, done := registered.id, registered.registered
+	s.mu.Unlock()
+
+	if done {
+		return id, nil
+	}
+
+	if err := add(id); err != nil {
+		// The connection may hold part of the definition under id and has no call to clear a facility
+		// definition. The entry is dropped so a retry starts over under a fresh ID, and id is never
+		// released so no other definition is added on top of that part.
+		s.mu.Lock()
+		if registry[name] == registered {
+			delete(registry, name)
+		}
+		s.mu.Unlock()
+		return 0, err
+	}
+
+	s.mu.Lock()
+	registered.registered = true
+	s.mu.Unlock()
+
+	return id, nil
+}
+
+// subscribe allocates n request IDs and registers interest in the dispatches
+// addressed to them. Requests must be sent only after subscribing.
+func (s *Session) subscribe(n int) (*subscription, error) {
+	if err := s.Open(); err != nil {
+		return nil, err
+	}
+
+	requestIDs, err := s.requestIDs.AcquireN(n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate request IDs: %w", err)
+	}
+
+	sub := &subscription{
+		session:    s,
+		requestIDs: requestIDs,
+		recv:       make(chan dispatch, 16),
+		done:       make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	for _, id := range requestIDs {
+		s.subscriptions[id] = sub
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return sub, nil
+}
+
+// cancel removes the subscription from the session and releases its request IDs
+func (sub *subscription) cancel() {
+	sub.once.Do(func() {
+		s := sub.session
+		s.mu.Lock()
+		for _, id := range sub.requestIDs {
+			if s.subscriptions[id] == sub {
+				delete(s.subscriptions, id)
+			}
+		}
+		for _, id := range sub.sendIDs {
+			if s.sends[id] == sub {
+				delete(s.sends, id)
+			}
+		}
+		s.mu.Unlock()
+		s.requestIDs.Release(sub.requestIDs...)
+		close(sub.done)
+	})
+}
+
+func (s *Session) hasSubscriptions() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscriptions) > 0
+}
+
+// dispatchLoop polls the connection while there are requests waiting for data
+func (s *Session) dispatchLoop(stop, stopped chan struct{}) {
+	defer close(stopped)
+
+	for {
+		if !s.hasSubscriptions() {
+			select {
+			case <-stop:
+				return
+			case <-s.wake:
+				continue
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		data, ok := s.connection.GetNextDispatch()
+		if !ok {
+			select {
+			case <-stop:
+				return
+			case <-time.After(dispatchPollInterval):
+			}
+			continue
+		}
+
+		// A message too short for its header can't be routed, it is dropped
+		d, err := newDispatch(data)
+		if err != nil {
+			continue
+		}
+		s.route(d, stop)
+
+		if d.id == SIMCONNECT_RECV_ID_QUIT {
+			return
+		}
+	}
+}
+
+// route delivers a dispatch to its subscriber. Exceptions go to the subscriber
+// the packet named by their DwSendID was sent for. Quit notifications go to
+// every subscriber and also mark the session closed, so the next request
+// opens a fresh connection.
+func (s *Session) route(d dispatch, stop chan struct{}) {
+	var targets []*subscription
+	quit := false
+
+	if d.id == SIMCONNECT_RECV_ID_EXCEPTION {
+		// The packet was sent before its exception arrived, waiting for a send in progress
+		// makes sure the send ID of the packet is mapped
+		s.packetMu.Lock()
+		s.packetMu.Unlock()
+	}
+
+	s.mu.Lock()
+	if requestID, ok := d.requestID(); ok {
+		if sub, exists := s.subscriptions[requestID]; exists {
+			targets = append(targets, sub)
+		}
+	} else if sendID, ok := d.sendID(); ok {
+		if sub, exists := s.sends[sendID]; exists {
+			targets = append(targets, sub)
+		}
+	} else if d.id == SIMCONNECT_RECV_ID_QUIT {
+		seen := make(map[*subscription]bool)
+		for _, sub := range s.subscriptions {
+			if !seen[sub] {
+				seen[sub] = true
+				targets = append(targets, sub)
+			}
+		}
+	}
+	if d.id == SIMCONNECT_RECV_ID_QUIT && s.opened && s.stop == stop {
+		s.opened = false
+		quit = true
+	}
+	s.mu.Unlock()
+
+	if quit {
+		s.connection.Close()
+	}
+
+	for _, sub := range targets {
+		select {
+		case sub.recv <- d:
+		case <-sub.done:
+		case <-stop:
+			return
+		}
+	}
+}
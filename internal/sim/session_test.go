@@ -0,0 +1,153 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"atc_freq/internal/testutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSession_ReusesConnection(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+
+	// The connection is opened and the facility definition is registered only once,
+	// every request gets its own request ID
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	mockConn.On("AddField", mock.Anything, uint32(sim.FirstDefineID)).Return(nil).Times(7)
+	mockConn.On("RequestFacilityData", "EDDB", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once()
+
+	// Responses for the second airport are only delivered after it was requested
+	secondRequested := make(chan time.Time)
+	mockConn.On("RequestFacilityData", "EDDH", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID+1)).Return(nil).Once().
+		Run(func(mock.Arguments) { close(secondRequested) })
+
+	mockConn.On("GetNextDispatch").Return(testutil.CreateFacilityDataResponse(sim.FirstRequestID, 6, 118700000, "Tower"), true).Once()
+	mockConn.On("GetNextDispatch").Return(testutil.CreateFacilityDataEndResponse(sim.FirstRequestID), true).Once()
+	mockConn.On("GetNextDispatch").Return(testutil.CreateFacilityDataResponse(sim.FirstRequestID+1, 5, 121800000, "Ground"), true).Once().
+		WaitUntil(secondRequested)
+	mockConn.On("GetNextDispatch").Return(testutil.CreateFacilityDataEndResponse(sim.FirstRequestID+1), true).Once()
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	freqs, err := client.GetAirportFrequencies("EDDB", 5*time.Second)
+	assert.NoError(t, err)
+	assert.Len(t, freqs, 1)
+	assert.Equal(t, "TOWER", freqs[0].Type)
+
+	freqs, err = client.GetAirportFrequencies("EDDH", 5*time.Second)
+	assert.NoError(t, err)
+	assert.Len(t, freqs, 1)
+	assert.Equal(t, "GROUND", freqs[0].Type)
+
+	client.Close()
+	mockConn.AssertExpectations(t)
+}
+
+func TestSession_ReopensAfterQuit(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+
+	// Both the connection and the facility definition are set up again after the sim quits
+	mockConn.On("Open", "atc-freq").Return(nil).Twice()
+	mockConn.On("AddField", mock.Anything, uint32(sim.FirstDefineID)).Return(nil).Times(14)
+	mockConn.On("RequestFacilityData", "KJFK", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID)).Return(nil).Once()
+	mockConn.On("RequestFacilityData", "KJFK", "", uint32(sim.FirstDefineID), uint32(sim.FirstRequestID+1)).Return(nil).Once()
+
+	mockConn.On("GetNextDispatch").Return(testutil.CreateQuitResponse(), true).Once()
+	mockConn.On("GetNextDispatch").Return(testutil.CreateFacilityDataResponse(sim.FirstRequestID+1, 6, 118700000, "Tower"), true).Once()
+	mockConn.On("GetNextDispatch").Return(testutil.CreateFacilityDataEndResponse(sim.FirstRequestID+1), true).Once()
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+
+	mockConn.On("Close").Return().Twice()
+
+	client := sim.NewClient(mockConn)
+
+	_, err := client.GetAirportFrequencies("KJFK", 5*time.Second)
+	assert.ErrorIs(t, err, sim.ErrNotConnected)
+
+	freqs, err := client.GetAirportFrequencies("KJFK", 5*time.Second)
+	assert.NoError(t, err)
+	assert.Len(t, freqs, 1)
+
+	client.Close()
+	mockConn.AssertExpectations(t)
+}
+
+func TestSession_RoutesExceptionToSender(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+
+	// The aircraft request sends packets 1-11, the weather request packet 12
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	expectAircraftDefinition(mockConn)
+	aircraftRequested := make(chan time.Time)
+	mockConn.On("RequestDataOnSimObject", uint32(sim.FirstRequestID), uint32(sim.FirstDefineID), uint32(sim.SIMCONNECT_OBJECT_ID_USER),
+		uint32(sim.SIMCONNECT_PERIOD_ONCE), uint32(0)).Return(nil).Once().
+		Run(func(mock.Arguments) { close(aircraftRequested) })
+	weatherRequested := make(chan time.Time)
+	mockConn.On("RequestWeatherObservation", "XXXX", uint32(sim.FirstRequestID+1)).Return(nil).Once().
+		Run(func(mock.Arguments) { close(weatherRequested) })
+
+	// The weather request is rejected while the aircraft request is still waiting
+	mockConn.On("GetNextDispatch").Return(testutil.CreateExceptionResponse(sim.SIMCONNECT_EXCEPTION_WEATHER_UNABLE_TO_GET_OBSERVATION, 12, 2), true).Once().
+		WaitUntil(weatherRequested)
+	mockConn.On("GetNextDispatch").Return(testutil.CreateSimObjectDataResponse(sim.FirstRequestID, sim.FirstDefineID,
+		52.3622, 13.5122, 157, 245, 12.4, 1, 121880000, 118800000, 123080000, 121600000), true).Once()
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	type aircraftResult struct {
+		state *sim.AircraftState
+		err   error
+	}
+	aircraft := make(chan aircraftResult, 1)
+	go func() {
+		state, err := client.GetAircraftState(5 * time.Second)
+		aircraft <- aircraftResult{state, err}
+	}()
+	<-aircraftRequested
+
+	_, err := client.GetWeather([]string{"XXXX"}, 5*time.Second)
+	assert.ErrorIs(t, err, sim.ErrUnknownFacility)
+
+	result := <-aircraft
+	assert.NoError(t, result.err)
+	assert.NotNil(t, result.state)
+
+	client.Close()
+	mockConn.AssertExpectations(t)
+}
+
+func TestSession_RetriesFailedDefinition(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+
+	// The third field of the first attempt fails, the retry defines all fields under a fresh ID
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	mockConn.On("AddField", mock.Anything, uint32(sim.FirstDefineID)).Return(nil).Twice()
+	mockConn.On("AddField", mock.Anything, uint32(sim.FirstDefineID)).Return(sim.ErrNotConnected).Once()
+	mockConn.On("AddField", mock.Anything, uint32(sim.FirstDefineID+1)).Return(nil).Times(7)
+	mockConn.On("RequestFacilityData", "EDDB", "", uint32(sim.FirstDefineID+1), uint32(sim.FirstRequestID+1)).Return(nil).Once()
+
+	mockConn.On("GetNextDispatch").Return(testutil.CreateFacilityDataResponse(sim.FirstRequestID+1, 6, 118700000, "Tower"), true).Once()
+	mockConn.On("GetNextDispatch").Return(testutil.CreateFacilityDataEndResponse(sim.FirstRequestID+1), true).Once()
+	mockConn.On("GetNextDispatch").Return(nil, false).Maybe()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	_, err := client.GetAirportFrequencies("EDDB", 5*time.Second)
+	assert.ErrorIs(t, err, sim.ErrNotConnected)
+
+	freqs, err := client.GetAirportFrequencies("EDDB", 5*time.Second)
+	assert.NoError(t, err)
+	assert.Len(t, freqs, 1)
+
+	client.Close()
+	mockConn.AssertExpectations(t)
+}
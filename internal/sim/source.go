@@ -0,0 +1,182 @@
+package sim
+
+import (
+	"atc_freq/internal/helpers"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+)
+
+// SourceSimulator tags the frequencies read from the simulator
+const SourceSimulator = "simulator"
+
+// FrequencySource provides airport frequencies without the simulator, like a database imported
+// from OurAirports or X-Plane
+type FrequencySource interface {
+	// Name tags the frequencies of the source, see AirportFrequency.Source
+	Name() string
+	// Frequencies returns the frequencies of the airport with the upper case ICAO code.
+	// Airports the source doesn't know return an error matching ErrUnknownFacility.
+	Frequencies(ctx context.Context, icao string) ([]AirportFrequency, error)
+}
+
+// SourceMode selects how the Service combines the simulator with its FrequencySource
+type SourceMode int
+
+const (
+	// SourceFallback answers from the source only when the simulator can't, because it isn't
+	// running, doesn't answer or doesn't know the airport
+	SourceFallback SourceMode = iota
+	// SourceMerge also adds the frequencies of the source the simulator doesn't have
+	SourceMerge
+)
+
+// NewAirportFrequency creates a frequency of source from a type name like "TOWER"
+func NewAirportFrequency(freqType string, hz int, name string, source string) AirportFrequency {
+	freqType = strings.ToUpper(freqType)
+
+	var typeCode int32
+	for code, typeName := range freqTypeMap {
+		if typeName == freqType {
+			typeCode = code
+			break
+		}
+	}
+
+	return AirportFrequency{
+		Type:     freqType,
+		TypeCode: typeCode,
+		Name:     name,
+		Hz:       hz,
+		MHz:      helpers.HzToMHz(hz),
+		Source:   source,
+	}
+}
+
+// SetFrequencySource makes GetFrequency and GetFrequencyBatch use source as selected by mode,
+// nil removes it. Responses of the source are not cached, it is expected to be local.
+func (s *Service) SetFrequencySource(source FrequencySource, mode SourceMode) {
+	s.sourceMu.Lock()
+	defer s.sourceMu.Unlock()
+
+	s.source = source
+	s.sourceMode = mode
+}
+
+func (s *Service) frequencySource() (FrequencySource, SourceMode) {
+	s.sourceMu.RLock()
+	defer s.sourceMu.RUnlock()
+
+	return s.source, s.sourceMode
+}
+
+// shouldFallBack reports whether the source may answer a request the simulator failed with err.
+// Requests cancelled by the caller are not retried.
+func shouldFallBack(err error) bool {
+	return errors.Is(err, ErrNotConnected) || errors.Is(err, ErrTimeout) || errors.Is(err, ErrUnknownFacility)
+}
+
+// sourceFrequencies combines the frequencies of icao from the simulator, or its error,
+// with those of the source. The simulator error is returned when the source can't help either.
+func (s *Service) sourceFrequencies(ctx context.Context, icao string, freqs []AirportFrequency, err error) ([]AirportFrequency, error) {
+	source, mode := s.frequencySource()
+	if source == nil {
+		return freqs, err
+	}
+
+	if err != nil {
+		if !shouldFallBack(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		sourceFreqs, sourceErr := source.Frequencies(ctx, icao)
+		if sourceErr != nil {
+			return nil, err
+		}
+		return sourceFreqs, nil
+	}
+
+	if mode != SourceMerge {
+		return freqs, nil
+	}
+	sourceFreqs, sourceErr := source.Frequencies(ctx, icao)
+	if sourceErr != nil {
+		// The simulator answered, airports missing from the source are not an error
+		return freqs, nil
+	}
+	return mergeFrequencies(freqs, sourceFreqs), nil
+}
+
+// sourceFrequencyBatch applies sourceFrequencies to the result of a batch request.
+// err is nil, a *BatchError or an error for the whole batch.
+func (s *Service) sourceFrequencyBatch(ctx context.Context, icaos []string, result map[string][]AirportFrequency, err error) (map[string][]AirportFrequency, error) {
+	source, _ := s.frequencySource()
+	if source == nil {
+		return result, err
+	}
+
+	failed := make(map[string]error)
+	var batchErr *BatchError
+	switch {
+	case err == nil:
+	case errors.As(err, &batchErr):
+		for icao, identErr := range batchErr.Errors {
+			failed[icao] = identErr
+		}
+	default:
+		// The simulator didn't answer at all, ask the source for the airports still missing
+		for _, icao := range icaos {
+			if _, found := result[icao]; !found {
+				failed[icao] = err
+			}
+		}
+	}
+
+	merged := make(map[string][]AirportFrequency, len(icaos))
+	for icao, freqs := range result {
+		merged[icao], _ = s.sourceFrequencies(ctx, icao, freqs, nil)
+	}
+
+	remaining := make(map[string]error)
+	for icao, identErr := range failed {
+		freqs, err := s.sourceFrequencies(ctx, icao, nil, identErr)
+		if err != nil {
+			remaining[icao] = err
+			continue
+		}
+		merged[icao] = freqs
+	}
+
+	switch {
+	case len(remaining) == 0:
+		return merged, nil
+	case batchErr == nil && len(remaining) == len(icaos):
+		// Nothing was found anywhere, keep the original error
+		return merged, err
+	default:
+		return merged, &BatchError{Errors: remaining}
+	}
+}
+
+// mergeFrequencies appends the frequencies of extra whose type and frequency freqs doesn't have.
+// freqs may be cached and is not modified.
+func mergeFrequencies(freqs, extra []AirportFrequency) []AirportFrequency {
+	type key struct {
+		freqType string
+		hz       int
+	}
+
+	known := make(map[key]bool, len(freqs))
+	for _, f := range freqs {
+		known[key{f.Type, f.Hz}] = true
+	}
+
+	merged := slices.Clip(freqs)
+	for _, f := range extra {
+		if !known[key{f.Type, f.Hz}] {
+			known[key{f.Type, f.Hz}] = true
+			merged = append(merged, f)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,181 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RadioName is a radio of the user aircraft that can be tuned
+type RadioName string
+
+const (
+	RadioCOM1 RadioName = "COM1"
+	RadioCOM2 RadioName = "COM2"
+	RadioNAV1 RadioName = "NAV1"
+	RadioNAV2 RadioName = "NAV2"
+)
+
+// RadioSlot is the active or the standby frequency of a radio
+type RadioSlot string
+
+const (
+	SlotActive  RadioSlot = "active"
+	SlotStandby RadioSlot = "standby"
+)
+
+// ErrInvalidFrequency is matched by every *FrequencyError
+var ErrInvalidFrequency = errors.New("invalid frequency")
+
+// FrequencyError is returned when a frequency is not a channel the radio can be tuned to
+type FrequencyError struct {
+	Radio  RadioName
+	Hz     int
+	Reason string
+}
+
+func (e *FrequencyError) Error() string {
+	return fmt.Sprintf("%.3f MHz can't be tuned on %s: %s", float64(e.Hz)/1e6, e.Radio, e.Reason)
+}
+
+func (e *FrequencyError) Is(target error) bool {
+	return target == ErrInvalidFrequency
+}
+
+// radioEvents are the simulator events that set the standby frequency of a radio and swap it with the active one
+var radioEvents = map[RadioName]struct{ setStandby, swap string }{
+	RadioCOM1: {"COM_STBY_RADIO_SET_HZ", "COM1_RADIO_SWAP"},
+	RadioCOM2: {"COM2_STBY_RADIO_SET_HZ", "COM2_RADIO_SWAP"},
+	RadioNAV1: {"NAV1_STBY_SET_HZ", "NAV1_RADIO_SWAP"},
+	RadioNAV2: {"NAV2_STBY_SET_HZ", "NAV2_RADIO_SWAP"},
+}
+
+// ParseRadio reads a radio name like "com1", case is ignored
+func ParseRadio(s string) (RadioName, error) {
+	radio := RadioName(strings.ToUpper(strings.TrimSpace(s)))
+	if _, known := radioEvents[radio]; !known {
+		return "", fmt.Errorf("unknown radio %q, expected one of COM1, COM2, NAV1, NAV2", s)
+	}
+	return radio, nil
+}
+
+// ParseSlot reads "active" or "standby", case is ignored
+func ParseSlot(s string) (RadioSlot, error) {
+	switch slot := RadioSlot(strings.ToLower(strings.TrimSpace(s))); slot {
+	case SlotActive, SlotStandby:
+		return slot, nil
+	}
+	return "", fmt.Errorf("unknown radio slot %q, expected active or standby", s)
+}
+
+// ParseMHz reads a frequency like "118.705" in MHz and returns it in Hz, rounded to the kHz
+func ParseMHz(s string) (int, error) {
+	mhz, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || mhz <= 0 {
+		return 0, fmt.Errorf("invalid frequency %q, expected MHz like 118.700", s)
+	}
+	return int(math.Round(mhz*1000)) * 1000, nil
+}
+
+// ValidateFrequency checks that hz is a channel of the radio. COM radios take 25 kHz channels and
+// 8.33 kHz channel names (118.705, 118.710, 118.715 between 118.700 and 118.725) from 118.000 to 136.990 MHz.
+// NAV radios take 50 kHz channels from 108.000 to 117.950 MHz.
+func ValidateFrequency(radio RadioName, hz int) error {
+	invalid := func(reason string) error {
+		return &FrequencyError{Radio: radio, Hz: hz, Reason: reason}
+	}
+
+	switch radio {
+	case RadioCOM1, RadioCOM2:
+		if hz < 118000000 || hz > 136990000 {
+			return invalid("COM radios tune 118.000 to 136.990 MHz")
+		}
+		// Within each 25 kHz channel the 8.33 kHz channels are named .005, .010 and .015
+		if offset := hz % 25000; hz%5000 != 0 || offset > 15000 {
+			return invalid("not a 25 kHz or 8.33 kHz channel")
+		}
+	case RadioNAV1, RadioNAV2:
+		if hz < 108000000 || hz > 117950000 {
+			return invalid("NAV radios tune 108.000 to 117.950 MHz")
+		}
+		if hz%50000 != 0 {
+			return invalid("not a 50 kHz channel")
+		}
+	default:
+		return fmt.Errorf("unknown radio %q", radio)
+	}
+	return nil
+}
+
+// TuneRadio sets a radio of the user aircraft to hz, waiting at most timeout for the connection
+func (client *Client) TuneRadio(radio RadioName, slot RadioSlot, hz int, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return client.TuneRadioCtx(ctx, radio, slot, hz)
+}
+
+// TuneRadioCtx sets a radio of the user aircraft to hz. The active frequency is tuned like a pilot
+// does: set the standby frequency and swap, so the previous active frequency stays in standby.
+// The simulator doesn't confirm client events, a radio without power ignores them.
+func (client *Client) TuneRadioCtx(ctx context.Context, radio RadioName, slot RadioSlot, hz int) error {
+	if err := ValidateFrequency(radio, hz); err != nil {
+		return err
+	}
+	events := radioEvents[radio]
+	if slot != SlotActive && slot != SlotStandby {
+		return fmt.Errorf("unknown radio slot %q", slot)
+	}
+
+	session := client.session
+	if err := session.Open(); err != nil {
+		return err
+	}
+
+	names := []string{events.setStandby}
+	data := []uint32{uint32(hz)}
+	if slot == SlotActive {
+		names = append(names, events.swap)
+		data = append(data, 0)
+	}
+
+	for i, name := range names {
+		if err := ctx.Err(); err != nil {
+			return doneError(ctx, &TimeoutError{Waiting: "radio tuning", Received: i, Expected: len(names)})
+		}
+
+		eventID, err := session.mapEvent(name)
+		if err != nil {
+			return err
+		}
+		_, err = session.send(nil, func() error {
+			return session.connection.TransmitClientEvent(SIMCONNECT_OBJECT_ID_USER, eventID, data[i],
+				SIMCONNECT_GROUP_PRIORITY_HIGHEST, SIMCONNECT_EVENT_FLAG_GROUPID_IS_PRIORITY)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// TuneRadio sets the active or standby frequency of a COM or NAV radio of the user aircraft
+func (s *Service) TuneRadio(radio RadioName, slot RadioSlot, hz int) error {
+	return s.TuneRadioCtx(context.Background(), radio, slot, hz)
+}
+
+// TuneRadioCtx sets the active or standby frequency of a COM or NAV radio until ctx is done.
+// Frequencies that are not a channel of the radio are rejected before anything is sent.
+func (s *Service) TuneRadioCtx(ctx context.Context, radio RadioName, slot RadioSlot, hz int) error {
+	ctx, cancel := context.WithTimeout(ctx, clientTimeout)
+	defer cancel()
+
+	if err := s.client.TuneRadioCtx(ctx, radio, slot, hz); err != nil {
+		return fmt.Errorf("failed to tune %s %s: %w", radio, slot, err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package sim_test
+
+import (
+	"atc_freq/internal/sim"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateFrequency(t *testing.T) {
+	tests := []struct {
+		radio sim.RadioName
+		hz    int
+		valid bool
+	}{
+		{sim.RadioCOM1, 118700000, true},
+		{sim.RadioCOM1, 118725000, true},
+		{sim.RadioCOM2, 118705000, true}, // 8.33 kHz channel names
+		{sim.RadioCOM2, 118710000, true},
+		{sim.RadioCOM2, 118715000, true},
+		{sim.RadioCOM1, 118720000, false},
+		{sim.RadioCOM1, 118702000, false},
+		{sim.RadioCOM1, 136990000, true},
+		{sim.RadioCOM1, 117975000, false},
+		{sim.RadioCOM1, 137000000, false},
+		{sim.RadioNAV1, 110100000, true},
+		{sim.RadioNAV2, 117950000, true},
+		{sim.RadioNAV1, 110125000, false},
+		{sim.RadioNAV1, 118000000, false},
+	}
+
+	for _, tt := range tests {
+		err := sim.ValidateFrequency(tt.radio, tt.hz)
+		if tt.valid {
+			assert.NoError(t, err, "%s %d", tt.radio, tt.hz)
+		} else {
+			assert.ErrorIs(t, err, sim.ErrInvalidFrequency, "%s %d", tt.radio, tt.hz)
+		}
+	}
+}
+
+func TestParseRadioSlotMHz(t *testing.T) {
+	radio, err := sim.ParseRadio(" com2")
+	require.NoError(t, err)
+	assert.Equal(t, sim.RadioCOM2, radio)
+	_, err = sim.ParseRadio("ADF1")
+	assert.Error(t, err)
+
+	slot, err := sim.ParseSlot("Standby")
+	require.NoError(t, err)
+	assert.Equal(t, sim.SlotStandby, slot)
+	_, err = sim.ParseSlot("both")
+	assert.Error(t, err)
+
+	hz, err := sim.ParseMHz("118.705")
+	require.NoError(t, err)
+	assert.Equal(t, 118705000, hz)
+	hz, err = sim.ParseMHz("121.8")
+	require.NoError(t, err)
+	assert.Equal(t, 121800000, hz)
+	_, err = sim.ParseMHz("tower")
+	assert.Error(t, err)
+}
+
+func TestClient_TuneRadio(t *testing.T) {
+	mockConn := new(sim.MockConnection)
+
+	mockConn.On("Open", "atc-freq").Return(nil).Once()
+	// Events are mapped once, tuning the active frequency sets standby and swaps
+	mockConn.On("MapClientEventToSimEvent", uint32(sim.FirstEventID), "COM_STBY_RADIO_SET_HZ").Return(nil).Once()
+	mockConn.On("MapClientEventToSimEvent", uint32(sim.FirstEventID+1), "COM1_RADIO_SWAP").Return(nil).Once()
+	mockConn.On("TransmitClientEvent", uint32(sim.SIMCONNECT_OBJECT_ID_USER), uint32(sim.FirstEventID), uint32(118700000),
+		uint32(sim.SIMCONNECT_GROUP_PRIORITY_HIGHEST), uint32(sim.SIMCONNECT_EVENT_FLAG_GROUPID_IS_PRIORITY)).Return(nil).Once()
+	mockConn.On("TransmitClientEvent", uint32(sim.SIMCONNECT_OBJECT_ID_USER), uint32(sim.FirstEventID+1), uint32(0),
+		mock.Anything, mock.Anything).Return(nil).Once()
+	mockConn.On("TransmitClientEvent", uint32(sim.SIMCONNECT_OBJECT_ID_USER), uint32(sim.FirstEventID), uint32(121805000),
+		mock.Anything, mock.Anything).Return(nil).Once()
+	mockConn.On("Close").Return().Once()
+
+	client := sim.NewClient(mockConn)
+
+	require.NoError(t, client.TuneRadio(sim.RadioCOM1, sim.SlotActive, 118700000, 5*time.Second))
+	require.NoError(t, client.TuneRadio(sim.RadioCOM1, sim.SlotStandby, 121805000, 5*time.Second))
+
+	// Invalid channels are rejected before anything is sent
+	err := client.TuneRadio(sim.RadioCOM1, sim.SlotStandby, 121802000, 5*time.Second)
+	assert.ErrorIs(t, err, sim.ErrInvalidFrequency)
+
+	client.Close()
+	mockConn.AssertExpectations(t)
+}
@@ -0,0 +1,119 @@
+// Package simcapture records the traffic of a sim.Connection to a capture file and replays it,
+// so a session with the real simulator can be turned into a regression test that runs anywhere.
+//
+// A capture is a JSON document per line: a Header followed by one Event per outbound call and
+// per dispatch received. Polls of GetNextDispatch without a dispatch are not recorded.
+package simcapture
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Format and Version identify capture files, Version changes when the layout of events does
+const (
+	Format  = "atc_freq capture"
+	Version = 2
+)
+
+// Calls recorded in Event.Call, one per method of sim.Connection
+const (
+	CallOpen                   = "Open"
+	CallClose                  = "Close"
+	CallAddField               = "AddField"
+	CallRequestFacilityData    = "RequestFacilityData"
+	CallRequestWeather         = "RequestWeatherObservation"
+	CallRequestCloudState      = "RequestCloudState"
+	CallRequestFacilitiesList  = "RequestFacilitiesList"
+	CallAddToDataDefinition    = "AddToDataDefinition"
+	CallRequestDataOnSimObject = "RequestDataOnSimObject"
+	CallMapClientEvent         = "MapClientEventToSimEvent"
+	CallTransmitClientEvent    = "TransmitClientEvent"
+	CallGetLastSentPacketID    = "GetLastSentPacketID"
+	CallDispatch               = "GetNextDispatch"
+)
+
+// Header is the first line of a capture
+type Header struct {
+	Format   string    `json:"format"`
+	Version  int       `json:"version"`
+	Recorded time.Time `json:"recorded"`
+}
+
+// Event is an outbound call with its result, or a dispatch received from the simulator
+type Event struct {
+	Call         string   `json:"call"`
+	Args         []string `json:"args,omitempty"`          // Arguments formatted with %v
+	Err          string   `json:"err,omitempty"`           // Error returned by the call
+	NotConnected bool     `json:"not_connected,omitempty"` // Err matched sim.ErrNotConnected
+	SendID       uint32   `json:"send_id,omitempty"`       // Send ID returned by GetLastSentPacketID
+	Dispatch     []byte   `json:"dispatch,omitempty"`      // Dispatch as returned by the connection, base64 in the file
+}
+
+// ErrUnsupportedCapture is returned for files that are not a capture of a known version
+var ErrUnsupportedCapture = errors.New("unsupported capture")
+
+// Read reads a capture written by a Recorder
+func Read(r io.Reader) ([]Event, error) {
+	scanner := bufio.NewScanner(r)
+	// Cloud state dispatches are the largest, 64x64 density bytes in base64
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: empty file", ErrUnsupportedCapture)
+	}
+	var header Header
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Format != Format {
+		return nil, fmt.Errorf("%w: missing header", ErrUnsupportedCapture)
+	}
+	if header.Version != Version {
+		return nil, fmt.Errorf("%w: version %d, expected %d", ErrUnsupportedCapture, header.Version, Version)
+	}
+
+	var events []Event
+	line := 1
+	for scanner.Scan() {
+		line++
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("capture line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("capture line %d: %w", line, err)
+	}
+	return events, nil
+}
+
+// Load reads the capture file at path
+func Load(path string) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	events, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return events, nil
+}
+
+// args formats call arguments the same way when recording and replaying
+func args(values ...any) []string {
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		formatted[i] = fmt.Sprint(value)
+	}
+	return formatted
+}
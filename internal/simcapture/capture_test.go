@@ -0,0 +1,136 @@
+package simcapture_test
+
+import (
+	"atc_freq/internal/sim"
+	"atc_freq/internal/simcapture"
+	"atc_freq/internal/simfake"
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "record testdata/eddb.capture again from the fake simulator")
+
+// session runs the requests of the captures in the tests
+type session struct {
+	freqs   []sim.AirportFrequency
+	weather map[string]*sim.Weather
+	coords  map[string]sim.Coordinates
+}
+
+func runSession(t *testing.T, connection sim.Connection) session {
+	client := sim.NewClient(connection)
+	defer client.Close()
+
+	var s session
+	var err error
+	s.freqs, err = client.GetAirportFrequencies("EDDB", time.Second)
+	require.NoError(t, err)
+	s.weather, err = client.GetWeather([]string{"EDDB", "EDDH"}, time.Second)
+	require.NoError(t, err)
+	s.coords, err = client.GetWaypointCoordinates([]string{"EDDH"}, time.Second)
+	require.NoError(t, err)
+	return s
+}
+
+func TestRecorder_Replay(t *testing.T) {
+	var capture bytes.Buffer
+	recorder, err := simcapture.NewRecorder(simfake.NewConnection(nil), &capture)
+	require.NoError(t, err)
+	recorded := runSession(t, recorder)
+	require.NoError(t, recorder.Err())
+
+	events, err := simcapture.Read(&capture)
+	require.NoError(t, err)
+	assert.Equal(t, simcapture.CallOpen, events[0].Call)
+	assert.Equal(t, simcapture.CallClose, events[len(events)-1].Call)
+
+	// The replay answers the same requests without the fake simulator
+	replay := simcapture.NewReplay(events)
+	replayed := runSession(t, replay)
+	require.NoError(t, replay.Err())
+	assert.True(t, replay.Done())
+	assert.Equal(t, recorded, replayed)
+}
+
+func TestReplay_Mismatch(t *testing.T) {
+	var capture bytes.Buffer
+	recorder, err := simcapture.NewRecorder(simfake.NewConnection(nil), &capture)
+	require.NoError(t, err)
+	runSession(t, recorder)
+
+	events, err := simcapture.Read(&capture)
+	require.NoError(t, err)
+	replay := simcapture.NewReplay(events)
+
+	client := sim.NewClient(replay)
+	defer client.Close()
+	_, err = client.GetAirportFrequencies("EDDH", time.Second)
+
+	var mismatch *simcapture.MismatchError
+	require.ErrorAs(t, err, &mismatch)
+	assert.Contains(t, mismatch.Expected, "EDDB")
+	assert.Contains(t, mismatch.Got, "EDDH")
+	assert.Equal(t, mismatch, replay.Err())
+}
+
+func TestReplay_NotConnected(t *testing.T) {
+	connection := simfake.NewConnection(nil)
+	connection.SetOpenError(sim.ErrNotConnected)
+
+	var capture bytes.Buffer
+	recorder, err := simcapture.NewRecorder(connection, &capture)
+	require.NoError(t, err)
+	client := sim.NewClient(recorder)
+	_, err = client.GetAirportFrequencies("EDDB", time.Second)
+	require.ErrorIs(t, err, sim.ErrNotConnected)
+
+	events, err := simcapture.Read(&capture)
+	require.NoError(t, err)
+	_, err = sim.NewClient(simcapture.NewReplay(events)).GetAirportFrequencies("EDDB", time.Second)
+	assert.ErrorIs(t, err, sim.ErrNotConnected)
+}
+
+func TestRead_Version(t *testing.T) {
+	_, err := simcapture.Read(strings.NewReader(`{"format":"atc_freq capture","version":99}` + "\n"))
+	assert.ErrorIs(t, err, simcapture.ErrUnsupportedCapture)
+	assert.ErrorContains(t, err, "version 99")
+
+	_, err = simcapture.Read(strings.NewReader(`{"call":"Open"}` + "\n"))
+	assert.ErrorIs(t, err, simcapture.ErrUnsupportedCapture)
+}
+
+// TestReplay_Capture replays a capture file, captures of the real simulator are tested the same way
+func TestReplay_Capture(t *testing.T) {
+	path := filepath.Join("testdata", "eddb.capture")
+	if *update {
+		recorder, err := simcapture.Create(path, simfake.NewConnection(nil))
+		require.NoError(t, err)
+		runSession(t, recorder)
+		require.NoError(t, recorder.Err())
+	}
+
+	replay, err := simcapture.LoadReplay(path)
+	require.NoError(t, err)
+	s := runSession(t, replay)
+	require.NoError(t, replay.Err())
+
+	require.Len(t, s.freqs, 6)
+	assert.Equal(t, "ATIS", s.freqs[0].Type)
+	assert.Equal(t, 123080000, s.freqs[0].Hz)
+	require.Contains(t, s.weather, "EDDH")
+	assert.NotEmpty(t, s.weather["EDDH"].RawMetar)
+	assert.InDelta(t, 53.63, s.coords["EDDH"].Lat, 0.01)
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	os.Exit(m.Run())
+}
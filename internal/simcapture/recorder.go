@@ -0,0 +1,140 @@
+package simcapture
+
+import (
+	"atc_freq/internal/sim"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Recorder is a sim.Connection passing every call to another connection and writing it,
+// together with the dispatches received, to a capture. Events are written as they happen,
+// so the capture of a session that crashed is still usable.
+type Recorder struct {
+	connection sim.Connection
+
+	mu      sync.Mutex
+	encoder *json.Encoder
+	err     error // First write error, recording stops after it
+}
+
+// NewRecorder records the traffic of connection to w, starting with the Header
+func NewRecorder(connection sim.Connection, w io.Writer) (*Recorder, error) {
+	r := &Recorder{connection: connection, encoder: json.NewEncoder(w)}
+	if err := r.encoder.Encode(Header{Format: Format, Version: Version, Recorded: time.Now().UTC()}); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Create records the traffic of connection to a new capture file at path. The file stays open
+// while the process runs, the session opens the connection again after the simulator restarts.
+func Create(path string, connection sim.Connection) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewRecorder(connection, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Err returns the first error writing the capture, the connection keeps working after it
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+// record writes an event, err is the result of the call
+func (r *Recorder) record(event Event, err error) error {
+	if err != nil {
+		event.Err = err.Error()
+		event.NotConnected = errors.Is(err, sim.ErrNotConnected)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err == nil {
+		r.err = r.encoder.Encode(event)
+	}
+	return err
+}
+
+func (r *Recorder) Open(name string) error {
+	return r.record(Event{Call: CallOpen, Args: args(name)}, r.connection.Open(name))
+}
+
+func (r *Recorder) Close() {
+	r.connection.Close()
+	r.record(Event{Call: CallClose}, nil)
+}
+
+func (r *Recorder) AddField(field string, defineID uint32) error {
+	return r.record(Event{Call: CallAddField, Args: args(field, defineID)}, r.connection.AddField(field, defineID))
+}
+
+func (r *Recorder) RequestFacilityData(icao string, region string, defineID uint32, requestID uint32) error {
+	err := r.connection.RequestFacilityData(icao, region, defineID, requestID)
+	return r.record(Event{Call: CallRequestFacilityData, Args: args(icao, region, defineID, requestID)}, err)
+}
+
+func (r *Recorder) RequestWeatherObservation(icao string, requestID uint32) error {
+	err := r.connection.RequestWeatherObservation(icao, requestID)
+	return r.record(Event{Call: CallRequestWeather, Args: args(icao, requestID)}, err)
+}
+
+func (r *Recorder) RequestCloudState(requestID uint32, minLat, minLon, minAlt, maxLat, maxLon, maxAlt float32) error {
+	err := r.connection.RequestCloudState(requestID, minLat, minLon, minAlt, maxLat, maxLon, maxAlt)
+	return r.record(Event{Call: CallRequestCloudState, Args: args(requestID, minLat, minLon, minAlt, maxLat, maxLon, maxAlt)}, err)
+}
+
+func (r *Recorder) RequestFacilitiesList(listType uint32, requestID uint32) error {
+	err := r.connection.RequestFacilitiesList(listType, requestID)
+	return r.record(Event{Call: CallRequestFacilitiesList, Args: args(listType, requestID)}, err)
+}
+
+func (r *Recorder) AddToDataDefinition(defineID uint32, datumName string, unitsName string, datumType uint32) error {
+	err := r.connection.AddToDataDefinition(defineID, datumName, unitsName, datumType)
+	return r.record(Event{Call: CallAddToDataDefinition, Args: args(defineID, datumName, unitsName, datumType)}, err)
+}
+
+func (r *Recorder) RequestDataOnSimObject(requestID uint32, defineID uint32, objectID uint32, period uint32, flags uint32) error {
+	err := r.connection.RequestDataOnSimObject(requestID, defineID, objectID, period, flags)
+	return r.record(Event{Call: CallRequestDataOnSimObject, Args: args(requestID, defineID, objectID, period, flags)}, err)
+}
+
+func (r *Recorder) MapClientEventToSimEvent(eventID uint32, eventName string) error {
+	err := r.connection.MapClientEventToSimEvent(eventID, eventName)
+	return r.record(Event{Call: CallMapClientEvent, Args: args(eventID, eventName)}, err)
+}
+
+func (r *Recorder) TransmitClientEvent(objectID uint32, eventID uint32, data uint32, groupID uint32, flags uint32) error {
+	err := r.connection.TransmitClientEvent(objectID, eventID, data, groupID, flags)
+	return r.record(Event{Call: CallTransmitClientEvent, Args: args(objectID, eventID, data, groupID, flags)}, err)
+}
+
+func (r *Recorder) GetLastSentPacketID() (uint32, error) {
+	sendID, err := r.connection.GetLastSentPacketID()
+	return sendID, r.record(Event{Call: CallGetLastSentPacketID, SendID: sendID}, err)
+}
+
+// GetNextDispatch records every dispatch received as returned by the connection
+func (r *Recorder) GetNextDispatch() ([]byte, bool) {
+	data, ok := r.connection.GetNextDispatch()
+	if !ok || data == nil {
+		return data, ok
+	}
+
+	r.record(Event{Call: CallDispatch, Dispatch: data}, nil)
+	return data, ok
+}
@@ -0,0 +1,196 @@
+package simcapture
+
+import (
+	"atc_freq/internal/sim"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// MismatchError is returned by a Replay when the client makes a call the capture doesn't have next
+type MismatchError struct {
+	Index    int    // Index of the expected call among the calls of the capture
+	Expected string // Expected call and arguments, empty at the end of the capture
+	Got      string
+}
+
+func (e *MismatchError) Error() string {
+	if e.Expected == "" {
+		return fmt.Sprintf("capture call %d: got %s after the end of the capture", e.Index, e.Got)
+	}
+	return fmt.Sprintf("capture call %d: expected %s, got %s", e.Index, e.Expected, e.Got)
+}
+
+// replayedDispatch is a dispatch of the capture with the number of calls recorded before it
+type replayedDispatch struct {
+	callsBefore int
+	data        []byte
+}
+
+// Replay is a sim.Connection serving a capture. Calls must match the recorded calls in order,
+// dispatches are handed out once the calls recorded before them were made, so requests sent
+// concurrently by the session may interleave with the responses differently than when recorded.
+type Replay struct {
+	mu         sync.Mutex
+	calls      []Event
+	dispatches []replayedDispatch
+	nextCall   int
+	next       int   // Next dispatch
+	err        error // First mismatch
+}
+
+// NewReplay creates a connection replaying events
+func NewReplay(events []Event) *Replay {
+	r := &Replay{}
+	for _, event := range events {
+		if event.Call == CallDispatch {
+			r.dispatches = append(r.dispatches, replayedDispatch{callsBefore: len(r.calls), data: event.Dispatch})
+		} else {
+			r.calls = append(r.calls, event)
+		}
+	}
+	return r
+}
+
+// LoadReplay creates a connection replaying the capture file at path
+func LoadReplay(path string) (*Replay, error) {
+	events, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplay(events), nil
+}
+
+// Err returns the first call that didn't match the capture
+func (r *Replay) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+// Done reports whether every call and dispatch of the capture was replayed
+func (r *Replay) Done() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.nextCall == len(r.calls) && r.next == len(r.dispatches)
+}
+
+// call matches a call against the next recorded one and returns the recorded result
+func (r *Replay) call(name string, values ...any) error {
+	_, err := r.replay(name, values...)
+	return err
+}
+
+// replay matches a call against the next recorded one and returns the recorded event and error
+func (r *Replay) replay(name string, values ...any) (Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	got := describe(Event{Call: name, Args: args(values...)})
+	if r.nextCall == len(r.calls) {
+		return Event{}, r.mismatch(&MismatchError{Index: r.nextCall, Got: got})
+	}
+
+	expected := r.calls[r.nextCall]
+	if expected.Call != name || !slices.Equal(expected.Args, args(values...)) {
+		return Event{}, r.mismatch(&MismatchError{Index: r.nextCall, Expected: describe(expected), Got: got})
+	}
+	r.nextCall++
+
+	switch {
+	case expected.Err == "":
+		return expected, nil
+	case expected.NotConnected:
+		return expected, fmt.Errorf("%w: %s", sim.ErrNotConnected, expected.Err)
+	default:
+		return expected, errors.New(expected.Err)
+	}
+}
+
+// mismatch keeps the first mismatch for Err, r.mu must be held
+func (r *Replay) mismatch(err *MismatchError) error {
+	if r.err == nil {
+		r.err = err
+	}
+	return err
+}
+
+func describe(event Event) string {
+	return fmt.Sprintf("%s(%s)", event.Call, strings.Join(event.Args, ", "))
+}
+
+func (r *Replay) Open(name string) error {
+	return r.call(CallOpen, name)
+}
+
+// Close consumes a recorded Close, it is ignored where the capture has none since
+// the session closes the connection on cleanup paths too
+func (r *Replay) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.nextCall < len(r.calls) && r.calls[r.nextCall].Call == CallClose {
+		r.nextCall++
+	}
+}
+
+func (r *Replay) AddField(field string, defineID uint32) error {
+	return r.call(CallAddField, field, defineID)
+}
+
+func (r *Replay) RequestFacilityData(icao string, region string, defineID uint32, requestID uint32) error {
+	return r.call(CallRequestFacilityData, icao, region, defineID, requestID)
+}
+
+func (r *Replay) RequestWeatherObservation(icao string, requestID uint32) error {
+	return r.call(CallRequestWeather, icao, requestID)
+}
+
+func (r *Replay) RequestCloudState(requestID uint32, minLat, minLon, minAlt, maxLat, maxLon, maxAlt float32) error {
+	return r.call(CallRequestCloudState, requestID, minLat, minLon, minAlt, maxLat, maxLon, maxAlt)
+}
+
+func (r *Replay) RequestFacilitiesList(listType uint32, requestID uint32) error {
+	return r.call(CallRequestFacilitiesList, listType, requestID)
+}
+
+func (r *Replay) AddToDataDefinition(defineID uint32, datumName string, unitsName string, datumType uint32) error {
+	return r.call(CallAddToDataDefinition, defineID, datumName, unitsName, datumType)
+}
+
+func (r *Replay) RequestDataOnSimObject(requestID uint32, defineID uint32, objectID uint32, period uint32, flags uint32) error {
+	return r.call(CallRequestDataOnSimObject, requestID, defineID, objectID, period, flags)
+}
+
+func (r *Replay) MapClientEventToSimEvent(eventID uint32, eventName string) error {
+	return r.call(CallMapClientEvent, eventID, eventName)
+}
+
+func (r *Replay) TransmitClientEvent(objectID uint32, eventID uint32, data uint32, groupID uint32, flags uint32) error {
+	return r.call(CallTransmitClientEvent, objectID, eventID, data, groupID, flags)
+}
+
+func (r *Replay) GetLastSentPacketID() (uint32, error) {
+	event, err := r.replay(CallGetLastSentPacketID)
+	return event.SendID, err
+}
+
+// GetNextDispatch returns the next recorded dispatch once the calls recorded before it were made
+func (r *Replay) GetNextDispatch() ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.next == len(r.dispatches) || r.dispatches[r.next].callsBefore > r.nextCall {
+		return nil, false
+	}
+
+	// A copy, the session may keep the dispatch while the capture is replayed again
+	data := slices.Clone(r.dispatches[r.next].data)
+	r.next++
+
+	return data, true
+}
@@ -0,0 +1,185 @@
+package simfake
+
+import (
+	"atc_freq/internal/sim"
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// simVar is a simulation variable the fake aircraft can report
+type simVar struct {
+	units string
+	value func(a *Aircraft) float64
+}
+
+var simVars = map[string]simVar{
+	"PLANE LATITUDE":                 {"degrees", func(a *Aircraft) float64 { return a.Latitude }},
+	"PLANE LONGITUDE":                {"degrees", func(a *Aircraft) float64 { return a.Longitude }},
+	"PLANE ALTITUDE":                 {"feet", func(a *Aircraft) float64 { return a.Altitude }},
+	"PLANE HEADING DEGREES MAGNETIC": {"degrees", func(a *Aircraft) float64 { return a.Heading }},
+	"GROUND VELOCITY":                {"knots", func(a *Aircraft) float64 { return a.GroundSpeed }},
+	"SIM ON GROUND":                  {"bool", func(a *Aircraft) float64 { return float64(boolToInt32(a.OnGround)) }},
+	"COM ACTIVE FREQUENCY:1":         {"Hz", func(a *Aircraft) float64 { return float64(a.COM1Active) }},
+	"COM STANDBY FREQUENCY:1":        {"Hz", func(a *Aircraft) float64 { return float64(a.COM1Standby) }},
+	"COM ACTIVE FREQUENCY:2":         {"Hz", func(a *Aircraft) float64 { return float64(a.COM2Active) }},
+	"COM STANDBY FREQUENCY:2":        {"Hz", func(a *Aircraft) float64 { return float64(a.COM2Standby) }},
+}
+
+// simEvents are the client events the fake aircraft reacts to
+var simEvents = map[string]func(a *Aircraft, data uint32){
+	"COM_STBY_RADIO_SET_HZ":  func(a *Aircraft, data uint32) { a.COM1Standby = int32(data) },
+	"COM2_STBY_RADIO_SET_HZ": func(a *Aircraft, data uint32) { a.COM2Standby = int32(data) },
+	"NAV1_STBY_SET_HZ":       func(a *Aircraft, data uint32) { a.NAV1Standby = int32(data) },
+	"NAV2_STBY_SET_HZ":       func(a *Aircraft, data uint32) { a.NAV2Standby = int32(data) },
+	"COM1_RADIO_SWAP":        func(a *Aircraft, _ uint32) { a.COM1Active, a.COM1Standby = a.COM1Standby, a.COM1Active },
+	"COM2_RADIO_SWAP":        func(a *Aircraft, _ uint32) { a.COM2Active, a.COM2Standby = a.COM2Standby, a.COM2Active },
+	"NAV1_RADIO_SWAP":        func(a *Aircraft, _ uint32) { a.NAV1Active, a.NAV1Standby = a.NAV1Standby, a.NAV1Active },
+	"NAV2_RADIO_SWAP":        func(a *Aircraft, _ uint32) { a.NAV2Active, a.NAV2Standby = a.NAV2Standby, a.NAV2Active },
+}
+
+// dataRequest is a periodic RequestDataOnSimObject request
+type dataRequest struct {
+	defineID uint32
+	flags    uint32
+	next     time.Time
+	last     []byte // Data of the last record sent, to honour SIMCONNECT_DATA_REQUEST_FLAG_CHANGED
+}
+
+// SetAircraft moves the user aircraft or changes its radios, periodic requests report the change
+func (c *Connection) SetAircraft(aircraft Aircraft) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.aircraft = aircraft
+}
+
+// Aircraft returns the user aircraft as changed by SetAircraft and client events
+func (c *Connection) Aircraft() Aircraft {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.aircraft
+}
+
+// AddToDataDefinition accepts the variables of the fake aircraft as FLOAT64 in the units they are stored in
+func (c *Connection) AddToDataDefinition(defineID uint32, datumName string, unitsName string, datumType uint32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.opened {
+		return sim.ErrNotConnected
+	}
+	c.sendID++
+
+	variable, known := simVars[datumName]
+	switch {
+	case !known:
+		return fmt.Errorf("add datum %q: unsupported simulation variable", datumName)
+	case variable.units != unitsName:
+		return fmt.Errorf("add datum %q: unsupported units %q, expected %q", datumName, unitsName, variable.units)
+	case datumType != sim.SIMCONNECT_DATATYPE_FLOAT64:
+		return fmt.Errorf("add datum %q: only FLOAT64 is supported", datumName)
+	}
+
+	c.dataDefinitions[defineID] = append(c.dataDefinitions[defineID], datumName)
+	return nil
+}
+
+// RequestDataOnSimObject serves the user aircraft once or every second. Other periods are treated as a second.
+func (c *Connection) RequestDataOnSimObject(requestID uint32, defineID uint32, objectID uint32, period uint32, flags uint32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.opened {
+		return sim.ErrNotConnected
+	}
+	c.sendID++
+
+	if _, exists := c.dataDefinitions[defineID]; !exists || objectID != sim.SIMCONNECT_OBJECT_ID_USER {
+		c.queueException(exceptionUnrecognizedID, 1)
+		return nil
+	}
+
+	switch period {
+	case sim.SIMCONNECT_PERIOD_NEVER:
+		delete(c.dataRequests, requestID)
+	case sim.SIMCONNECT_PERIOD_ONCE:
+		c.queue = append(c.queue, c.simObjectData(requestID, defineID, flags))
+	default:
+		c.dataRequests[requestID] = &dataRequest{defineID: defineID, flags: flags}
+	}
+	return nil
+}
+
+// queueDueData queues the records of the periodic requests whose second has passed
+func (c *Connection) queueDueData(now time.Time) {
+	for requestID, request := range c.dataRequests {
+		if now.Before(request.next) {
+			continue
+		}
+		request.next = now.Add(time.Second)
+
+		rec := c.simObjectData(requestID, request.defineID, request.flags)
+		data := rec[len(rec)-8*len(c.dataDefinitions[request.defineID]):]
+		if request.flags&sim.SIMCONNECT_DATA_REQUEST_FLAG_CHANGED != 0 && bytes.Equal(data, request.last) {
+			continue
+		}
+		request.last = data
+		c.queue = append(c.queue, rec)
+	}
+}
+
+// simObjectData builds the SIMCONNECT_RECV_SIMOBJECT_DATA record of the user aircraft
+func (c *Connection) simObjectData(requestID, defineID, flags uint32) []byte {
+	variables := c.dataDefinitions[defineID]
+
+	rec := newRecord(sim.SIMCONNECT_RECV_ID_SIMOBJECT_DATA)
+	rec.write(requestID)
+	rec.write(uint32(sim.SIMCONNECT_OBJECT_ID_USER))
+	rec.write(defineID)
+	rec.write(flags)
+	rec.write(uint32(1)) // dwentrynumber
+	rec.write(uint32(1)) // dwoutof
+	rec.write(uint32(len(variables)))
+	for _, name := range variables {
+		rec.write(simVars[name].value(&c.aircraft))
+	}
+	return rec.finish()
+}
+
+// MapClientEventToSimEvent accepts the radio events in simEvents
+func (c *Connection) MapClientEventToSimEvent(eventID uint32, eventName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.opened {
+		return sim.ErrNotConnected
+	}
+	c.sendID++
+
+	if _, known := simEvents[eventName]; !known {
+		return fmt.Errorf("map event %q: unsupported event", eventName)
+	}
+	c.events[eventID] = eventName
+	return nil
+}
+
+// TransmitClientEvent applies a mapped event to the user aircraft
+func (c *Connection) TransmitClientEvent(objectID uint32, eventID uint32, data uint32, groupID uint32, flags uint32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.opened {
+		return sim.ErrNotConnected
+	}
+	c.sendID++
+
+	name, mapped := c.events[eventID]
+	if !mapped || objectID != sim.SIMCONNECT_OBJECT_ID_USER {
+		c.queueException(exceptionUnrecognizedID, 1)
+		return nil
+	}
+	simEvents[name](&c.aircraft, data)
+	return nil
+}
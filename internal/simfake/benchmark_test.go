@@ -0,0 +1,45 @@
+package simfake_test
+
+import (
+	"atc_freq/internal/sim"
+	"atc_freq/internal/simfake"
+	"context"
+	"testing"
+)
+
+// benchmarkWaypoints are the positions of the cloud benchmarks, three airports of a route
+var benchmarkWaypoints = map[string]sim.Coordinates{
+	"EDDB": {Lat: 52.3514, Lon: 13.4939},
+	"EDDH": {Lat: 53.6304, Lon: 9.9882},
+	"UUMI": {Lat: 55.6117, Lon: 36.65},
+}
+
+// BenchmarkCloudProfiles_Sweep requests every level of every waypoint at once
+func BenchmarkCloudProfiles_Sweep(b *testing.B) {
+	client := sim.NewClient(simfake.NewConnection(nil))
+	defer client.Close()
+
+	for b.Loop() {
+		if _, err := client.GetCloudProfilesCtx(context.Background(), benchmarkWaypoints, sim.DefaultCloudProfile); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCloudProfiles_Sequential waits for every level before requesting the next one,
+// like the profiles were built before the sweep
+func BenchmarkCloudProfiles_Sequential(b *testing.B) {
+	client := sim.NewClient(simfake.NewConnection(nil))
+	defer client.Close()
+
+	opts := sim.DefaultCloudProfile
+	for b.Loop() {
+		for _, coords := range benchmarkWaypoints {
+			for minAlt := opts.MinAlt; minAlt < opts.MaxAlt; minAlt += opts.Step {
+				if _, err := client.GetCloudGridCtx(context.Background(), coords, sim.DefaultCloudBoxKm, minAlt, minAlt+opts.Step); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+}
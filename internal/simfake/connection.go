@@ -0,0 +1,434 @@
+// Package simfake implements sim.Connection in pure Go, so the app can be
+// developed and tested without Flight Simulator or SimConnect.dll.
+package simfake
+
+import (
+	"atc_freq/internal/sim"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// cloudGridSize is the number of cells per side of the SimConnect cloud state grid
+	cloudGridSize = 64
+
+	// airportListChunk is the number of airports per SIMCONNECT_RECV_AIRPORT_LIST message,
+	// small enough that the fixtures exercise lists split over several messages
+	airportListChunk = 4
+
+	// Exception codes from the SIMCONNECT_EXCEPTION enum
+	exceptionUnrecognizedID = 3
+	exceptionInvalidEnum    = 27
+)
+
+// Connection is a fake SimConnect connection answering requests from Fixtures.
+// Responses are queued when a request is sent and handed out by GetNextDispatch
+// with the same binary layout SimConnect uses.
+type Connection struct {
+	fixtures *Fixtures
+
+	mu              sync.Mutex
+	opened          bool
+	openErr         error
+	aircraft        Aircraft
+	definitions     map[uint32]*definition
+	dataDefinitions map[uint32][]string // Simulation variables of each data definition
+	dataRequests    map[uint32]*dataRequest
+	events          map[uint32]string // Simulator event name of each client event ID
+	queue           [][]byte
+	sendID          uint32
+	uniqueID        uint32
+}
+
+// definition is a facility definition built from AddField calls
+type definition struct {
+	root  *definitionNode
+	stack []*definitionNode
+}
+
+// definitionNode is one OPEN <kind> ... CLOSE <kind> block of a facility definition
+type definitionNode struct {
+	kind     string
+	fields   []string
+	children []*definitionNode
+}
+
+// NewConnection creates a fake connection serving fixtures, nil uses DefaultFixtures
+func NewConnection(fixtures *Fixtures) *Connection {
+	if fixtures == nil {
+		fixtures = DefaultFixtures()
+	}
+	return &Connection{
+		fixtures:        fixtures,
+		aircraft:        fixtures.Aircraft,
+		definitions:     make(map[uint32]*definition),
+		dataDefinitions: make(map[uint32][]string),
+		dataRequests:    make(map[uint32]*dataRequest),
+		events:          make(map[uint32]string),
+	}
+}
+
+// SetOpenError makes Open fail with err, nil restores the default behaviour
+func (c *Connection) SetOpenError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.openErr = err
+}
+
+// Quit queues SIMCONNECT_RECV_ID_QUIT as if the simulator was shutting down
+func (c *Connection) Quit() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.queue = append(c.queue, newRecord(sim.SIMCONNECT_RECV_ID_QUIT).finish())
+}
+
+func (c *Connection) Open(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.openErr != nil {
+		return c.openErr
+	}
+	c.opened = true
+	return nil
+}
+
+func (c *Connection) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.opened = false
+	c.definitions = make(map[uint32]*definition)
+	c.dataDefinitions = make(map[uint32][]string)
+	c.dataRequests = make(map[uint32]*dataRequest)
+	c.events = make(map[uint32]string)
+	c.queue = nil
+}
+
+func (c *Connection) AddField(field string, defineID uint32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.opened {
+		return sim.ErrNotConnected
+	}
+	c.sendID++
+
+	def, exists := c.definitions[defineID]
+	if !exists {
+		def = &definition{}
+		c.definitions[defineID] = def
+	}
+
+	if err := def.add(field); err != nil {
+		return fmt.Errorf("add field %q: %w", field, err)
+	}
+	return nil
+}
+
+func (c *Connection) RequestFacilityData(icao string, region string, defineID uint32, requestID uint32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.opened {
+		return sim.ErrNotConnected
+	}
+	c.sendID++
+
+	def, exists := c.definitions[defineID]
+	if !exists || def.root == nil || len(def.stack) > 0 {
+		c.queueException(exceptionUnrecognizedID, 1)
+		return nil
+	}
+
+	// Airports and the ILS of their runways are served, any other facility is unknown
+	switch def.root.kind {
+	case "AIRPORT":
+		airport, found := c.fixtures.airport(icao)
+		if found && (region == "" || strings.EqualFold(region, airport.Region)) {
+			c.queueFacility(def.root, &airport, requestID, 0, false, 0, 0)
+		}
+	case "VOR":
+		if ils, found := c.fixtures.ils(icao, region); found {
+			c.queueFacility(def.root, &ils, requestID, 0, false, 0, 0)
+		}
+	}
+
+	end := newRecord(sim.SIMCONNECT_RECV_ID_FACILITY_DATA_END)
+	end.write(requestID)
+	c.queue = append(c.queue, end.finish())
+
+	return nil
+}
+
+func (c *Connection) RequestWeatherObservation(icao string, requestID uint32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.opened {
+		return sim.ErrNotConnected
+	}
+	c.sendID++
+
+	metar, found := c.fixtures.metar(icao)
+	if !found {
+		c.queueException(sim.SIMCONNECT_EXCEPTION_WEATHER_UNABLE_TO_GET_OBSERVATION, 2)
+		return nil
+	}
+
+	rec := newRecord(sim.SIMCONNECT_RECV_ID_WEATHER_OBSERVATION)
+	rec.write(requestID)
+	rec.WriteString(metar)
+	rec.WriteByte(0)
+	c.queue = append(c.queue, rec.finish())
+
+	return nil
+}
+
+func (c *Connection) RequestCloudState(requestID uint32, minLat, minLon, minAlt, maxLat, maxLon, maxAlt float32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.opened {
+		return sim.ErrNotConnected
+	}
+	c.sendID++
+
+	grid := c.cloudGrid(float64(minLat), float64(minLon), float64(minAlt), float64(maxLat), float64(maxLon), float64(maxAlt))
+
+	rec := newRecord(sim.SIMCONNECT_RECV_ID_CLOUD_STATE)
+	rec.write(requestID)
+	rec.write(uint32(len(grid)))
+	rec.Write(grid)
+	c.queue = append(c.queue, rec.finish())
+
+	return nil
+}
+
+// RequestFacilitiesList lists every fixture airport, as if the whole world was loaded around the aircraft.
+// Only airport lists are supported.
+func (c *Connection) RequestFacilitiesList(listType uint32, requestID uint32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.opened {
+		return sim.ErrNotConnected
+	}
+	c.sendID++
+
+	if listType != sim.SIMCONNECT_FACILITY_LIST_TYPE_AIRPORT {
+		c.queueException(exceptionInvalidEnum, 1)
+		return nil
+	}
+
+	airports := c.fixtures.Airports
+	// An empty list is a single message with DwOutOf 0
+	outOf := (len(airports) + airportListChunk - 1) / airportListChunk
+	for entry := 0; entry < max(outOf, 1); entry++ {
+		chunk := airports[min(entry*airportListChunk, len(airports)):min((entry+1)*airportListChunk, len(airports))]
+
+		rec := newRecord(sim.SIMCONNECT_RECV_ID_AIRPORT_LIST)
+		rec.write(requestID)
+		rec.write(uint32(len(chunk)))
+		rec.write(uint32(entry))
+		rec.write(uint32(outOf))
+		for _, airport := range chunk {
+			// binary.Write packs SIMCONNECT_DATA_FACILITY_AIRPORT like SimConnect.h, the doubles
+			// follow the strings unaligned
+			entry := sim.SIMCONNECT_DATA_FACILITY_AIRPORT{
+				Latitude:  airport.Latitude,
+				Longitude: airport.Longitude,
+				Altitude:  airport.Altitude,
+			}
+			for i, c := range fixedString(airport.ICAO, len(entry.Ident)) {
+				entry.Ident[i] = int8(c)
+			}
+			for i, c := range fixedString(airport.Region, len(entry.Region)) {
+				entry.Region[i] = int8(c)
+			}
+			rec.write(entry)
+		}
+		c.queue = append(c.queue, rec.finish())
+	}
+
+	return nil
+}
+
+func (c *Connection) GetLastSentPacketID() (uint32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.opened {
+		return 0, sim.ErrNotConnected
+	}
+	return c.sendID, nil
+}
+
+func (c *Connection) GetNextDispatch() ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.queue) == 0 {
+		c.queueDueData(time.Now())
+	}
+	if len(c.queue) == 0 {
+		return nil, false
+	}
+
+	message := c.queue[0]
+	c.queue = c.queue[1:]
+
+	return message, true
+}
+
+// queueFacility queues a SIMCONNECT_RECV_FACILITY_DATA record for item followed by the records of its children
+func (c *Connection) queueFacility(node *definitionNode, item any, requestID, parentID uint32, isListItem bool, index, size int) {
+	kind := facilityKinds[node.kind]
+
+	c.uniqueID++
+	uniqueID := c.uniqueID
+
+	rec := newRecord(sim.SIMCONNECT_RECV_ID_FACILITY_DATA)
+	rec.write(requestID)
+	rec.write(uniqueID)
+	rec.write(parentID)
+	rec.write(kind.dataType)
+	rec.write(boolToUint32(isListItem))
+	rec.write(uint32(index))
+	rec.write(uint32(size))
+	for _, field := range node.fields {
+		rec.write(kind.fields[field](item))
+	}
+	c.queue = append(c.queue, rec.finish())
+
+	for _, child := range node.children {
+		items := kind.children[child.kind](item)
+		for i, childItem := range items {
+			c.queueFacility(child, childItem, requestID, uniqueID, true, i, len(items))
+		}
+	}
+}
+
+func (c *Connection) queueException(exception uint32, index uint32) {
+	rec := newRecord(sim.SIMCONNECT_RECV_ID_EXCEPTION)
+	rec.write(exception)
+	rec.write(c.sendID)
+	rec.write(index)
+	c.queue = append(c.queue, rec.finish())
+}
+
+// cloudGrid returns the densities of the cloud state grid for the requested area.
+// Rows go from minLat to maxLat, columns from minLon to maxLon.
+func (c *Connection) cloudGrid(minLat, minLon, minAlt, maxLat, maxLon, maxAlt float64) []byte {
+	grid := make([]byte, cloudGridSize*cloudGridSize)
+
+	for row := 0; row < cloudGridSize; row++ {
+		lat := minLat + (maxLat-minLat)*(float64(row)+0.5)/cloudGridSize
+		for col := 0; col < cloudGridSize; col++ {
+			lon := minLon + (maxLon-minLon)*(float64(col)+0.5)/cloudGridSize
+
+			var density uint8
+			for _, cloud := range c.fixtures.Clouds {
+				if cloud.TopFt < minAlt || cloud.BaseFt > maxAlt {
+					continue
+				}
+				if sim.DistanceNM(sim.Coordinates{Lat: lat, Lon: lon}, sim.Coordinates{Lat: cloud.Latitude, Lon: cloud.Longitude}) > cloud.RadiusNM {
+					continue
+				}
+				density = max(density, cloud.Density)
+			}
+			grid[row*cloudGridSize+col] = density
+		}
+	}
+
+	return grid
+}
+
+// add appends a field to the definition, checking it the way SimConnect does when the data is requested
+func (d *definition) add(field string) error {
+	switch {
+	case strings.HasPrefix(field, "OPEN "):
+		kind := strings.TrimPrefix(field, "OPEN ")
+		if _, known := facilityKinds[kind]; !known {
+			return fmt.Errorf("unsupported facility type %s", kind)
+		}
+
+		node := &definitionNode{kind: kind}
+		if len(d.stack) == 0 {
+			if d.root != nil {
+				return fmt.Errorf("definition already has a root %s", d.root.kind)
+			}
+			d.root = node
+		} else {
+			parent := d.stack[len(d.stack)-1]
+			if _, allowed := facilityKinds[parent.kind].children[kind]; !allowed {
+				return fmt.Errorf("%s can't be opened inside %s", kind, parent.kind)
+			}
+			parent.children = append(parent.children, node)
+		}
+		d.stack = append(d.stack, node)
+
+	case strings.HasPrefix(field, "CLOSE "):
+		kind := strings.TrimPrefix(field, "CLOSE ")
+		if len(d.stack) == 0 || d.stack[len(d.stack)-1].kind != kind {
+			return fmt.Errorf("%s is not open", kind)
+		}
+		d.stack = d.stack[:len(d.stack)-1]
+
+	default:
+		if len(d.stack) == 0 {
+			return fmt.Errorf("no facility type is open")
+		}
+		node := d.stack[len(d.stack)-1]
+		if _, known := facilityKinds[node.kind].fields[field]; !known {
+			return fmt.Errorf("unsupported %s field", node.kind)
+		}
+		node.fields = append(node.fields, field)
+	}
+
+	return nil
+}
+
+// record builds a SimConnect message: the SIMCONNECT_RECV header followed by packed little endian fields
+type record struct {
+	bytes.Buffer
+}
+
+func newRecord(id uint32) *record {
+	rec := &record{}
+	rec.write(uint32(0)) // DwSize, set by finish
+	rec.write(uint32(0)) // DwVersion
+	rec.write(id)
+	return rec
+}
+
+func (r *record) write(value any) {
+	// Writing fixed size values to a bytes.Buffer never fails
+	_ = binary.Write(&r.Buffer, binary.LittleEndian, value)
+}
+
+func (r *record) finish() []byte {
+	data := r.Bytes()
+	binary.LittleEndian.PutUint32(data, uint32(len(data)))
+	return data
+}
+
+func boolToUint32(value bool) uint32 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func boolToInt32(value bool) int32 {
+	if value {
+		return 1
+	}
+	return 0
+}
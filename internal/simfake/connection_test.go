@@ -0,0 +1,762 @@
+package simfake_test
+
+import (
+	"atc_freq/internal/sim"
+	"atc_freq/internal/simfake"
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnection_AirportFrequencies(t *testing.T) {
+	tests := []struct {
+		name          string
+		icao          string
+		expectedFreqs []sim.AirportFrequency
+		expectedError error
+	}{
+		{
+			name: "known airport",
+			icao: "EDDH",
+			expectedFreqs: []sim.AirportFrequency{
+				{Type: "ATIS", TypeCode: 1, Name: "Hamburg ATIS", Hz: 123130000, MHz: 123.13, Source: sim.SourceSimulator},
+				{Type: "CLEARANCE", TypeCode: 7, Name: "Hamburg Delivery", Hz: 121805000, MHz: 121.805, Source: sim.SourceSimulator},
+				{Type: "GROUND", TypeCode: 5, Name: "Hamburg Ground", Hz: 121705000, MHz: 121.705, Source: sim.SourceSimulator},
+				{Type: "TOWER", TypeCode: 6, Name: "Hamburg Tower", Hz: 121280000, MHz: 121.28, Source: sim.SourceSimulator},
+				{Type: "APPROACH", TypeCode: 8, Name: "Hamburg Arrival", Hz: 120600000, MHz: 120.6, Source: sim.SourceSimulator},
+			},
+		},
+		{
+			name:          "lower case identifier",
+			icao:          "uumi",
+			expectedFreqs: []sim.AirportFrequency{{Type: "TOWER", TypeCode: 6, Name: "Kubinka Tower", Hz: 126500000, MHz: 126.5, Source: sim.SourceSimulator}},
+		},
+		{
+			name:          "unknown airport",
+			icao:          "XXXX",
+			expectedError: sim.ErrUnknownFacility,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := sim.NewClient(simfake.NewConnection(nil))
+			defer client.Close()
+
+			freqs, err := client.GetAirportFrequencies(tt.icao, 5*time.Second)
+
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, freqs, len(tt.expectedFreqs))
+			for i, expected := range tt.expectedFreqs {
+				assert.Equal(t, expected.Type, freqs[i].Type)
+				assert.Equal(t, expected.TypeCode, freqs[i].TypeCode)
+				assert.Equal(t, expected.Name, freqs[i].Name)
+				assert.Equal(t, expected.Hz, freqs[i].Hz)
+				assert.InDelta(t, expected.MHz, freqs[i].MHz, 0.0001)
+			}
+		})
+	}
+}
+
+func TestConnection_Weather(t *testing.T) {
+	client := sim.NewClient(simfake.NewConnection(nil))
+	defer client.Close()
+
+	weather, err := client.GetWeather([]string{"KLAX", "KJFK"}, 5*time.Second)
+	require.NoError(t, err)
+	require.Len(t, weather, 2)
+
+	assert.Equal(t, 3, weather["KLAX"].Visibility)
+	assert.Equal(t, []sim.CloudLayer{{Base: 800, Coverage: "OVC"}}, weather["KLAX"].Clouds)
+	assert.Equal(t, 10, weather["KJFK"].Visibility)
+	assert.Contains(t, weather["KJFK"].RawMetar, "FEW050")
+	require.NotNil(t, weather["KJFK"].Metar)
+	assert.Equal(t, "KJFK", weather["KJFK"].Metar.Station)
+	assert.InDelta(t, 30.02, weather["KJFK"].Metar.Altimeter.InHg, 0.001)
+
+	_, err = client.GetWeather([]string{"XXXX"}, 5*time.Second)
+	assert.ErrorIs(t, err, sim.ErrUnknownFacility)
+
+	// A waypoint without a weather station fails alone
+	weather, err = client.GetWeather([]string{"KLAX", "XXXX", "KJFK"}, 5*time.Second)
+	var batchErr *sim.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, []string{"XXXX"}, slices.Collect(maps.Keys(batchErr.Errors)))
+	assert.ErrorIs(t, batchErr.Errors["XXXX"], sim.ErrUnknownFacility)
+	assert.Len(t, weather, 2)
+}
+
+func TestConnection_WaypointCoordinates(t *testing.T) {
+	client := sim.NewClient(simfake.NewConnection(nil))
+	defer client.Close()
+
+	coords, err := client.GetWaypointCoordinates([]string{"EDDB", "XXXX"}, 5*time.Second)
+	assert.ErrorIs(t, err, sim.ErrUnknownFacility)
+	require.Contains(t, coords, "EDDB")
+	assert.InDelta(t, 52.3514, coords["EDDB"].Lat, 0.0001)
+	assert.InDelta(t, 13.4939, coords["EDDB"].Lon, 0.0001)
+	assert.NotContains(t, coords, "XXXX")
+}
+
+func TestConnection_CloudState(t *testing.T) {
+	client := sim.NewClient(simfake.NewConnection(nil))
+	defer client.Close()
+
+	klax := sim.Coordinates{Lat: 33.9425, Lon: -118.4081}
+
+	density, err := client.GetCloudDensityByCoordinates(klax, 500, 1000, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, byte(230), density.Value)
+	assert.Equal(t, "OVC", density.Coverage)
+
+	// The layer tops out at 1800 ft
+	density, err = client.GetCloudDensityByCoordinates(klax, 2000, 2500, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "CLR", density.Coverage)
+}
+
+func TestConnection_CloudGrid(t *testing.T) {
+	client := sim.NewClient(simfake.NewConnection(nil))
+	defer client.Close()
+
+	// The layer around KLAX has a radius of 15 NM, a 60 km box reaches past it in every direction
+	klax := sim.Coordinates{Lat: 33.9425, Lon: -118.4081}
+	grid, err := client.GetCloudGrid(klax, 60, 1000, 1500, 5*time.Second)
+	require.NoError(t, err)
+
+	assert.Len(t, grid.Cells, sim.CloudGridSize*sim.CloudGridSize)
+	assert.Equal(t, byte(230), grid.MaxValue)
+	assert.Greater(t, grid.Coverage, 0.3)
+	assert.Less(t, grid.Coverage, 0.9)
+	assert.InDelta(t, 230*grid.Coverage, grid.Mean, 1e-9)
+	assert.Equal(t, "OVC", grid.Center().Coverage)
+	assert.Equal(t, "CLR", grid.Cell(0, 0).Coverage)
+}
+
+func TestConnection_CloudProfile(t *testing.T) {
+	client := sim.NewClient(simfake.NewConnection(nil))
+	defer client.Close()
+
+	// The layer over KLAX reaches from 800 to 1800 ft
+	klax := sim.Coordinates{Lat: 33.9425, Lon: -118.4081}
+	profile, err := client.GetCloudProfile(klax, sim.CloudProfileOptions{MinAlt: 0, MaxAlt: 2800, Step: 500}, 5*time.Second)
+	require.NoError(t, err)
+
+	require.Len(t, profile.Levels, 6)
+	assert.Equal(t, 2500, profile.Levels[5].MinAlt)
+	assert.Equal(t, 2800, profile.Levels[5].MaxAlt)
+	assert.Equal(t, []sim.CloudProfileLayer{
+		{Base: 500, Top: 2000, Thickness: 1500, MaxValue: 230, Coverage: "OVC", Percentage: percentage(230)},
+	}, profile.Layers)
+
+	_, err = client.GetCloudProfile(klax, sim.CloudProfileOptions{MinAlt: 0, MaxAlt: 10000, Step: 0}, 5*time.Second)
+	assert.ErrorContains(t, err, "invalid cloud profile")
+}
+
+func TestConnection_CloudProfiles(t *testing.T) {
+	client := sim.NewClient(simfake.NewConnection(nil))
+	defer client.Close()
+
+	coords := map[string]sim.Coordinates{
+		"EDDB": {Lat: 52.3514, Lon: 13.4939},
+		"EDDH": {Lat: 53.6304, Lon: 9.9882},
+		"KLAX": {Lat: 33.9425, Lon: -118.4081},
+	}
+	profiles, err := client.GetCloudProfiles(coords, sim.DefaultCloudProfile, 5*time.Second)
+	require.NoError(t, err)
+	require.Len(t, profiles, 3)
+
+	// The sweep matches the profiles requested one position at a time
+	for wp, position := range coords {
+		profile, err := client.GetCloudProfile(position, sim.DefaultCloudProfile, 5*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, profile, profiles[wp], wp)
+	}
+	// The layer over EDDB reaches from 2500 to 4500 ft, the levels touching it count as cloudy
+	assert.Equal(t, 2000, profiles["EDDB"].Layers[0].Base)
+	assert.Equal(t, 5000, profiles["EDDB"].Layers[0].Top)
+}
+
+func TestService_CloudProfileCache(t *testing.T) {
+	service := sim.NewService(sim.NewClient(simfake.NewConnection(nil)))
+	defer service.Close()
+
+	// The layer over EDDH reaches from 1200 to 6000 ft
+	profiles, err := service.GetCloudProfile([]string{"eddh"}, sim.CloudProfileOptions{MinAlt: 0, MaxAlt: 8000, Step: 1000})
+	require.NoError(t, err)
+	assert.Equal(t, []sim.CloudProfileLayer{
+		{Base: 1000, Top: 7000, Thickness: 6000, MaxValue: 170, Coverage: "BKN", Percentage: percentage(170)},
+	}, profiles["EDDH"].Layers)
+
+	// The default levels are cached apart from the ones above
+	clouds, err := service.GetCloudDensity([]string{"EDDH"})
+	require.NoError(t, err)
+	assert.Len(t, clouds["EDDH"], 20)
+	assert.Equal(t, 0, service.CacheStats()[sim.CacheClouds].Hits)
+
+	_, err = service.GetCloudProfile([]string{"EDDH"}, sim.DefaultCloudProfile)
+	require.NoError(t, err)
+	assert.Equal(t, 1, service.CacheStats()[sim.CacheClouds].Hits)
+}
+
+func TestService_CloudProfileUnknownWaypoint(t *testing.T) {
+	service := sim.NewService(sim.NewClient(simfake.NewConnection(nil)))
+	defer service.Close()
+
+	// The profile of the waypoint that resolved is kept, the unknown one is reported
+	result, err := sim.NewCloudProfiles(service.GetCloudProfile([]string{"EDDH", "LUROS"}, sim.DefaultCloudProfile))
+	require.NoError(t, err)
+	assert.Contains(t, result.Profiles, "EDDH")
+	assert.Equal(t, []string{"LUROS"}, result.Unknown)
+
+	_, err = service.GetCloudGrid("LUROS", sim.DefaultCloudBoxKm, 0, 500)
+	assert.ErrorIs(t, err, sim.ErrUnknownFacility)
+}
+
+func TestConnection_OpenError(t *testing.T) {
+	conn := simfake.NewConnection(nil)
+	conn.SetOpenError(sim.ErrNotConnected)
+
+	client := sim.NewClient(conn)
+	defer client.Close()
+
+	_, err := client.GetAirportFrequencies("EDDB", time.Second)
+	assert.ErrorIs(t, err, sim.ErrNotConnected)
+
+	conn.SetOpenError(nil)
+	freqs, err := client.GetAirportFrequencies("EDDB", time.Second)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, freqs)
+}
+
+func TestConnection_RejectsUnsupportedFields(t *testing.T) {
+	conn := simfake.NewConnection(nil)
+	require.NoError(t, conn.Open("test"))
+	defer conn.Close()
+
+	assert.NoError(t, conn.AddField("OPEN AIRPORT", 1))
+	assert.Error(t, conn.AddField("OPEN VOR", 1))
+	assert.Error(t, conn.AddField("CLOSE FREQUENCY", 1))
+	assert.Error(t, conn.AddField("NOT_A_FIELD", 1))
+	assert.NoError(t, conn.AddField("CLOSE AIRPORT", 1))
+
+	assert.Error(t, conn.AddField("LATITUDE", 2), "a field needs an open facility type")
+}
+
+func TestLoadFixtures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	data := `{
+		"airports": [{"icao": "LOWI", "name": "Innsbruck", "frequencies": [{"type": 6, "hz": 120100000, "name": "Innsbruck Tower"}]}]
+	}`
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+
+	fixtures, err := simfake.LoadFixtures(path)
+	require.NoError(t, err)
+
+	client := sim.NewClient(simfake.NewConnection(fixtures))
+	defer client.Close()
+
+	freqs, err := client.GetAirportFrequencies("LOWI", time.Second)
+	require.NoError(t, err)
+	require.Len(t, freqs, 1)
+	assert.Equal(t, "Innsbruck Tower", freqs[0].Name)
+
+	_, err = client.GetAirportFrequencies("EDDB", time.Second)
+	assert.ErrorIs(t, err, sim.ErrUnknownFacility)
+
+	_, err = simfake.LoadFixtures(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestService_RouteWeather(t *testing.T) {
+	service := sim.NewService(sim.NewClient(simfake.NewConnection(nil)))
+	defer service.Close()
+
+	route, err := service.GetRouteWeather([]string{"EDDB", "KLAX", "EDDH"})
+	require.NoError(t, err)
+	require.Len(t, route.Stations, 3)
+
+	assert.Equal(t, sim.CategoryVFR, route.Stations[0].Category)
+	assert.Nil(t, route.Stations[0].Ceiling)
+	assert.Equal(t, sim.CategoryIFR, route.Stations[1].Category)
+	require.NotNil(t, route.Stations[1].Ceiling)
+	assert.Equal(t, 800, *route.Stations[1].Ceiling)
+	assert.Equal(t, sim.CategoryMVFR, route.Stations[2].Category)
+
+	assert.Equal(t, sim.CategoryIFR, route.Worst)
+	assert.Equal(t, []string{"KLAX"}, route.WorstAt)
+
+	// Enroute fixes have no weather station and are left out
+	route, err = service.GetRouteWeather([]string{"EDDB", "LUROS", "EDDH"})
+	require.NoError(t, err)
+	assert.Len(t, route.Stations, 2)
+}
+
+func TestService_RecommendRunway(t *testing.T) {
+	service := sim.NewService(sim.NewClient(simfake.NewConnection(nil)))
+	defer service.Close()
+
+	// EDDB reports 24012KT, both 25s have a headwind and 25L is the longer one
+	recommendation, err := service.RecommendRunway("eddb")
+	require.NoError(t, err)
+	require.NotNil(t, recommendation.Wind)
+	assert.Equal(t, 240, recommendation.Wind.Direction)
+	assert.Equal(t, sim.CategoryVFR, recommendation.Weather.Category)
+
+	require.Len(t, recommendation.Ends, 4)
+	require.NotNil(t, recommendation.Recommended)
+	assert.Equal(t, "25L", recommendation.Recommended.End.Designator)
+	assert.Equal(t, "07R/25L", recommendation.Recommended.Runway)
+	assert.InDelta(t, 245, recommendation.Recommended.End.MagneticHeading, 0.001)
+	assert.InDelta(t, 11.8, recommendation.Recommended.Headwind, 0.1)
+	require.NotNil(t, recommendation.Recommended.End.ILS)
+	assert.Equal(t, 111300000, recommendation.Recommended.End.ILS.Hz)
+	assert.InDelta(t, 245, recommendation.Recommended.End.ILS.Course, 0.001)
+	assert.True(t, recommendation.Recommended.End.ILS.HasGlideSlope)
+	assert.Equal(t, "25R", recommendation.Ends[1].End.Designator)
+	assert.True(t, recommendation.Ends[3].Tailwind)
+
+	// EDDH reports 27015G25KT, the gusts put 33 over the crosswind limit
+	recommendation, err = service.RecommendRunway("EDDH")
+	require.NoError(t, err)
+	assert.Equal(t, "23", recommendation.Recommended.End.Designator)
+	assert.Equal(t, "33", recommendation.Ends[1].End.Designator)
+	assert.True(t, recommendation.Ends[1].ExcessiveCrosswind)
+	require.NotNil(t, recommendation.Ends[1].End.ILS)
+	assert.False(t, recommendation.Ends[1].End.ILS.HasGlideSlope)
+
+	_, err = service.RecommendRunway("XXXX")
+	assert.ErrorIs(t, err, sim.ErrUnknownFacility)
+}
+
+func TestService_Brief(t *testing.T) {
+	service := sim.NewService(sim.NewClient(simfake.NewConnection(nil)))
+	defer service.Close()
+
+	briefing, err := service.Brief([]string{"eddb", "LUROS", "EDDH", "EDDB"})
+	require.NoError(t, err)
+
+	// Fixes aren't airports, repeated airports are briefed once
+	assert.Equal(t, []string{"LUROS"}, briefing.Unknown)
+	require.Len(t, briefing.Airports, 2)
+	assert.Equal(t, sim.CategoryMVFR, briefing.Worst)
+
+	eddb := briefing.Airports[0]
+	assert.Equal(t, "EDDB", eddb.ICAO)
+	require.NotNil(t, eddb.Weather)
+	assert.Equal(t, sim.CategoryVFR, eddb.Weather.Category)
+	require.NotNil(t, eddb.Runway)
+	assert.Equal(t, "25L", eddb.Runway.End.Designator)
+	assert.Len(t, eddb.Clouds, 20)
+
+	var types []string
+	for _, f := range eddb.Frequencies {
+		types = append(types, f.Type)
+	}
+	assert.Equal(t, []string{"ATIS", "CLEARANCE", "GROUND", "TOWER", "DEPARTURE", "APPROACH"}, types)
+
+	assert.Equal(t, "EDDH", briefing.Airports[1].ICAO)
+	assert.Equal(t, "23", briefing.Airports[1].Runway.End.Designator)
+}
+
+func TestConnection_AirportDetails(t *testing.T) {
+	client := sim.NewClient(simfake.NewConnection(nil))
+	defer client.Close()
+
+	airport, err := client.GetAirportDetails("UUMI", 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "Kubinka", airport.Name)
+	assert.InDelta(t, 610.2, airport.Elevation, 0.1)
+	assert.Nil(t, airport.Tower)
+	require.Len(t, airport.Runways, 1)
+	assert.Equal(t, "04/22", airport.Runways[0].Designator)
+	assert.Equal(t, "CONCRETE", airport.Runways[0].Surface)
+	assert.Nil(t, airport.Runways[0].Primary.ILS)
+}
+
+func TestConnection_AirportFrequenciesBatch(t *testing.T) {
+	client := sim.NewClient(simfake.NewConnection(nil))
+	defer client.Close()
+
+	freqs, err := client.GetAirportFrequenciesBatch([]string{"EDDB", "XXXX", "UUMI", "EDDH"}, 5*time.Second)
+	assert.ErrorIs(t, err, sim.ErrUnknownFacility)
+
+	require.Len(t, freqs, 3)
+	assert.Len(t, freqs["EDDB"], 6)
+	assert.Len(t, freqs["EDDH"], 5)
+	assert.Equal(t, []sim.AirportFrequency{
+		{Type: "TOWER", TypeCode: 6, Name: "Kubinka Tower", Hz: 126500000, MHz: 126.5, Source: sim.SourceSimulator},
+	}, freqs["UUMI"])
+}
+
+func TestService_NearbyAirports(t *testing.T) {
+	service := sim.NewService(sim.NewClient(simfake.NewConnection(nil)))
+	defer service.Close()
+
+	coords, err := service.GetWaypointCoordinates([]string{"EDDB"})
+	require.NoError(t, err)
+	center := coords["EDDB"]
+
+	nearby, err := service.NearbyAirports(center, 30)
+	require.NoError(t, err)
+	require.Len(t, nearby, 3)
+	assert.Equal(t, "EDDB", nearby[0].ICAO)
+	assert.Equal(t, "EDAZ", nearby[1].ICAO)
+	assert.InDelta(t, 15.2, nearby[1].DistanceNM, 0.1)
+	assert.Equal(t, "EDAY", nearby[2].ICAO)
+
+	require.NoError(t, service.AddLocalFrequencies(nearby))
+	require.NotNil(t, nearby[0].Frequency)
+	assert.Equal(t, "TOWER", nearby[0].Frequency.Type)
+	require.NotNil(t, nearby[1].Frequency)
+	assert.Equal(t, "CTAF", nearby[1].Frequency.Type)
+	require.NotNil(t, nearby[2].Frequency)
+	assert.Equal(t, "UNICOM", nearby[2].Frequency.Type)
+
+	_, err = service.NearbyAirports(center, 0)
+	assert.Error(t, err)
+}
+
+func TestService_SubscribeAircraft(t *testing.T) {
+	connection := simfake.NewConnection(nil)
+	service := sim.NewService(sim.NewClient(connection))
+	defer service.Close()
+
+	state, err := service.GetAircraftState()
+	require.NoError(t, err)
+	assert.InDelta(t, 52.3622, state.Position.Lat, 0.0001)
+	assert.Equal(t, 121880000, state.COM1.ActiveHz)
+	assert.Equal(t, 123080000, state.COM2.ActiveHz)
+
+	sub := service.SubscribeAircraft()
+	first := <-sub.Updates()
+	assert.Equal(t, *state, first)
+
+	// Only changes are sent, the next update is the retuned radio
+	moved := simfake.DefaultFixtures().Aircraft
+	moved.COM1Active = 118800000
+	connection.SetAircraft(moved)
+
+	select {
+	case second := <-sub.Updates():
+		assert.Equal(t, 118800000, second.COM1.ActiveHz)
+		assert.True(t, second.Tuned(118800000))
+	case <-time.After(3 * time.Second):
+		t.Fatal("no update after the radio was retuned")
+	}
+
+	sub.Close()
+	_, open := <-sub.Updates()
+	assert.False(t, open)
+	assert.NoError(t, sub.Err())
+}
+
+func TestService_SubscribeAircraft_Quit(t *testing.T) {
+	connection := simfake.NewConnection(nil)
+	service := sim.NewService(sim.NewClient(connection))
+	defer service.Close()
+
+	sub := service.SubscribeAircraft()
+	<-sub.Updates()
+	connection.Quit()
+
+	for range sub.Updates() {
+	}
+	assert.ErrorIs(t, sub.Err(), sim.ErrNotConnected)
+}
+
+func TestService_TuneRadio(t *testing.T) {
+	connection := simfake.NewConnection(nil)
+	service := sim.NewService(sim.NewClient(connection))
+	defer service.Close()
+
+	require.NoError(t, service.TuneRadio(sim.RadioCOM1, sim.SlotActive, 118800000))
+	require.NoError(t, service.TuneRadio(sim.RadioNAV1, sim.SlotStandby, 109500000))
+
+	aircraft := connection.Aircraft()
+	assert.Equal(t, int32(118800000), aircraft.COM1Active)
+	assert.Equal(t, int32(121880000), aircraft.COM1Standby, "the previous active frequency stays in standby")
+	assert.Equal(t, int32(109500000), aircraft.NAV1Standby)
+	assert.Equal(t, int32(111300000), aircraft.NAV1Active)
+
+	state, err := service.GetAircraftState()
+	require.NoError(t, err)
+	assert.True(t, state.COM1.Tuned(118800000))
+}
+
+// slowConnection counts facility requests and answers them late, so identical requests overlap
+type slowConnection struct {
+	*simfake.Connection
+	facilityRequests atomic.Int32
+}
+
+func (c *slowConnection) RequestFacilityData(icao string, region string, defineID uint32, requestID uint32) error {
+	c.facilityRequests.Add(1)
+	time.Sleep(50 * time.Millisecond)
+	return c.Connection.RequestFacilityData(icao, region, defineID, requestID)
+}
+
+func TestService_CacheFacilities(t *testing.T) {
+	connection := simfake.NewConnection(nil)
+	service := sim.NewService(sim.NewClient(connection))
+	defer service.Close()
+
+	first, err := service.GetFrequency("EDDB")
+	require.NoError(t, err)
+	second, err := service.GetFrequency("eddb")
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	freqs, err := service.GetFrequencyBatch([]string{"EDDB", "EDDH"})
+	require.NoError(t, err)
+	assert.Equal(t, first, freqs["EDDB"])
+	assert.NotEmpty(t, freqs["EDDH"])
+
+	stats := service.CacheStats()[sim.CacheFacilities]
+	assert.Equal(t, 2, stats.Hits)
+	assert.Equal(t, 2, stats.Misses)
+	assert.Equal(t, 2, stats.Entries)
+
+	// Facility data is kept for the session, even once the simulator is gone
+	connection.Quit()
+	_, err = service.GetFrequency("EDDH")
+	require.NoError(t, err)
+
+	service.InvalidateCache(sim.CacheFacilities)
+	assert.Zero(t, service.CacheStats()[sim.CacheFacilities].Entries)
+	_, err = service.GetFrequency("EDDH")
+	assert.ErrorIs(t, err, sim.ErrNotConnected)
+}
+
+func TestService_CacheOnlyBatchErrors(t *testing.T) {
+	service := sim.NewService(sim.NewClient(simfake.NewConnection(nil)))
+	defer service.Close()
+
+	// The positions come with an *UnknownFacilityError for the whole request, they aren't cached
+	coords, err := service.GetWaypointCoordinates([]string{"EDDH", "LUROS"})
+	assert.ErrorIs(t, err, sim.ErrUnknownFacility)
+	assert.Contains(t, coords, "EDDH")
+	assert.Zero(t, service.CacheStats()[sim.CacheFacilities].Entries)
+
+	// Weather comes with a *BatchError, the stations that answered are cached
+	_, err = service.GetWeather([]string{"KLAX", "XXXX"})
+	assert.ErrorIs(t, err, sim.ErrUnknownFacility)
+	assert.Equal(t, 1, service.CacheStats()[sim.CacheWeather].Entries)
+}
+
+func TestService_CacheWeatherTTL(t *testing.T) {
+	connection := simfake.NewConnection(nil)
+	service := sim.NewService(sim.NewClient(connection))
+	defer service.Close()
+	service.SetCacheTTL(sim.CacheWeather, 100*time.Millisecond)
+
+	// Repeated waypoints of a route are asked for once
+	_, err := service.GetRouteWeather([]string{"EDDB", "EDDH", "EDDB"})
+	require.NoError(t, err)
+	_, err = service.GetWeather([]string{"EDDH"})
+	require.NoError(t, err)
+
+	stats := service.CacheStats()[sim.CacheWeather]
+	assert.Equal(t, 1, stats.Hits)
+	assert.Equal(t, 2, stats.Misses)
+
+	time.Sleep(150 * time.Millisecond)
+	_, err = service.GetWeather([]string{"EDDH"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, service.CacheStats()[sim.CacheWeather].Misses)
+
+	// Without a TTL nothing is cached
+	service.SetCacheTTL(sim.CacheWeather, 0)
+	service.InvalidateCache(sim.CacheWeather)
+	_, err = service.GetWeather([]string{"EDDH"})
+	require.NoError(t, err)
+	assert.Zero(t, service.CacheStats()[sim.CacheWeather].Entries)
+}
+
+func TestService_CacheCoalescesRequests(t *testing.T) {
+	connection := &slowConnection{Connection: simfake.NewConnection(nil)}
+	service := sim.NewService(sim.NewClient(connection))
+	defer service.Close()
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.GetFrequency("EDDB")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), connection.facilityRequests.Load())
+
+	stats := service.CacheStats()[sim.CacheFacilities]
+	assert.Equal(t, 1, stats.Misses)
+	assert.Equal(t, callers-1, stats.Hits+stats.Coalesced)
+}
+
+// staticSource is a FrequencySource answering from a map
+type staticSource map[string][]sim.AirportFrequency
+
+func (s staticSource) Name() string {
+	return "static"
+}
+
+func (s staticSource) Frequencies(ctx context.Context, icao string) ([]sim.AirportFrequency, error) {
+	freqs, found := s[icao]
+	if !found {
+		return nil, &sim.UnknownFacilityError{Idents: []string{icao}}
+	}
+	return freqs, nil
+}
+
+var testSource = staticSource{
+	"EDDB": {
+		sim.NewAirportFrequency("TOWER", 118800000, "Brandenburg Tower", "static"),
+		sim.NewAirportFrequency("TOWER", 120030000, "Brandenburg Tower South", "static"),
+	},
+	"EDXX": {sim.NewAirportFrequency("UNICOM", 122700000, "Info", "static")},
+}
+
+func TestService_FrequencySourceFallback(t *testing.T) {
+	connection := simfake.NewConnection(nil)
+	service := sim.NewService(sim.NewClient(connection))
+	defer service.Close()
+	service.SetFrequencySource(testSource, sim.SourceFallback)
+
+	// The simulator answers the airports it knows, the source the others
+	freqs, err := service.GetFrequency("EDDB")
+	require.NoError(t, err)
+	assert.Len(t, freqs, 6)
+	assert.Equal(t, sim.SourceSimulator, freqs[0].Source)
+
+	freqs, err = service.GetFrequency("edxx")
+	require.NoError(t, err)
+	assert.Equal(t, testSource["EDXX"], freqs)
+
+	batch, err := service.GetFrequencyBatch([]string{"EDDB", "EDXX", "XXXX"})
+	var batchErr *sim.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Len(t, batchErr.Errors, 1)
+	assert.ErrorIs(t, batchErr.Errors["XXXX"], sim.ErrUnknownFacility)
+	assert.Len(t, batch["EDDB"], 6)
+	assert.Equal(t, testSource["EDXX"], batch["EDXX"])
+
+	// Once the simulator is gone everything comes from the source
+	connection.SetOpenError(sim.ErrNotConnected)
+	connection.Quit()
+	service.InvalidateCache()
+
+	for range 2 {
+		freqs, err = service.GetFrequency("EDDB")
+		require.NoError(t, err)
+		assert.Equal(t, testSource["EDDB"], freqs)
+	}
+
+	batch, err = service.GetFrequencyBatch([]string{"EDDB", "XXXX"})
+	require.ErrorAs(t, err, &batchErr)
+	assert.ErrorIs(t, batchErr.Errors["XXXX"], sim.ErrNotConnected)
+	assert.Equal(t, testSource["EDDB"], batch["EDDB"])
+
+	_, err = service.GetFrequency("XXXX")
+	assert.ErrorIs(t, err, sim.ErrNotConnected)
+}
+
+func TestService_FrequencySourceDisconnected(t *testing.T) {
+	connection := sim.NewDisconnectedConnection(errors.New("SimConnect.dll not found"))
+	service := sim.NewService(sim.NewClient(connection))
+	defer service.Close()
+
+	_, err := service.GetFrequency("EDDB")
+	assert.ErrorIs(t, err, sim.ErrNotConnected)
+	assert.ErrorContains(t, err, "SimConnect.dll not found")
+
+	service.SetFrequencySource(testSource, sim.SourceFallback)
+	freqs, err := service.GetFrequency("EDDB")
+	require.NoError(t, err)
+	assert.Equal(t, testSource["EDDB"], freqs)
+}
+
+func TestService_FrequencySourceMerge(t *testing.T) {
+	service := sim.NewService(sim.NewClient(simfake.NewConnection(nil)))
+	defer service.Close()
+	service.SetFrequencySource(testSource, sim.SourceMerge)
+
+	// The tower the simulator has already is not listed twice
+	freqs, err := service.GetFrequency("EDDB")
+	require.NoError(t, err)
+	require.Len(t, freqs, 7)
+	assert.Equal(t, testSource["EDDB"][1], freqs[6])
+
+	// The cached simulator response is not modified by the merge
+	service.SetFrequencySource(nil, sim.SourceFallback)
+	freqs, err = service.GetFrequency("EDDB")
+	require.NoError(t, err)
+	assert.Len(t, freqs, 6)
+}
+
+func TestConnection_FacilityDefinition(t *testing.T) {
+	type runway struct {
+		Number  int32   `facility:"PRIMARY_NUMBER"`
+		Heading float32 `facility:"HEADING"`
+	}
+	type frequency struct {
+		Type int32  `facility:"TYPE"`
+		Name string `facility:"NAME,64"`
+	}
+	type airport struct {
+		ICAO        string      `facility:"ICAO,8"`
+		Frequencies []frequency `facility:"FREQUENCY"`
+		Runways     []runway    `facility:"RUNWAY"`
+	}
+	def := sim.MustFacilityDefinition[airport]("test airport tree", "AIRPORT")
+
+	client := sim.NewClient(simfake.NewConnection(nil))
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	airports, err := sim.RequestFacilities(ctx, client, def, []sim.FacilityRef{{Ident: "EDDB"}, {Ident: "XXXX"}, {Ident: "EDDH"}})
+
+	var unknown *sim.UnknownFacilityError
+	require.ErrorAs(t, err, &unknown)
+	assert.Equal(t, []string{"XXXX"}, unknown.Idents)
+
+	require.Len(t, airports, 2)
+	eddb := airports["EDDB"]
+	assert.Equal(t, "EDDB", eddb.ICAO)
+	assert.Len(t, eddb.Frequencies, 6)
+	assert.Equal(t, frequency{Type: 9, Name: "Berlin Departure"}, eddb.Frequencies[5])
+	assert.Equal(t, []runway{{Number: 7, Heading: 69.5}, {Number: 7, Heading: 69.5}}, eddb.Runways)
+
+	eddh := airports["EDDH"]
+	assert.Len(t, eddh.Frequencies, 5)
+	require.Len(t, eddh.Runways, 2)
+	assert.Equal(t, int32(5), eddh.Runways[0].Number)
+}
+
+// percentage converts a density the way the client does
+func percentage(value byte) float64 {
+	return float64(value) / 255.0 * 100.0
+}
@@ -0,0 +1,127 @@
+package simfake
+
+import (
+	"atc_freq/internal/sim"
+)
+
+// facilityKind describes how a facility type named in OPEN <kind> is encoded
+type facilityKind struct {
+	dataType uint32                        // SIMCONNECT_FACILITY_DATA_TYPE reported in the record
+	fields   map[string]func(item any) any // Value written for each supported field, in the SimConnect layout
+	children map[string]func(item any) []any
+}
+
+var facilityKinds = map[string]facilityKind{
+	"AIRPORT": {
+		dataType: sim.SIMCONNECT_FACILITY_DATA_AIRPORT,
+		fields: map[string]func(item any) any{
+			"LATITUDE":      func(item any) any { return item.(*Airport).Latitude },
+			"LONGITUDE":     func(item any) any { return item.(*Airport).Longitude },
+			"ALTITUDE":      func(item any) any { return item.(*Airport).Altitude },
+			"MAGVAR":        func(item any) any { return item.(*Airport).MagVar },
+			"NAME":          func(item any) any { return fixedString(item.(*Airport).Name, 32) },
+			"NAME64":        func(item any) any { return fixedString(item.(*Airport).Name, 64) },
+			"ICAO":          func(item any) any { return fixedString(item.(*Airport).ICAO, 8) },
+			"REGION":        func(item any) any { return fixedString(item.(*Airport).Region, 8) },
+			"N_FREQUENCIES": func(item any) any { return int32(len(item.(*Airport).Frequencies)) },
+			"N_RUNWAYS":     func(item any) any { return int32(len(item.(*Airport).Runways)) },
+			"TOWER_LATITUDE": func(item any) any {
+				return towerField(item.(*Airport), func(t *Tower) float64 { return t.Latitude })
+			},
+			"TOWER_LONGITUDE": func(item any) any {
+				return towerField(item.(*Airport), func(t *Tower) float64 { return t.Longitude })
+			},
+			"TOWER_ALTITUDE": func(item any) any {
+				return towerField(item.(*Airport), func(t *Tower) float64 { return t.Altitude })
+			},
+		},
+		children: map[string]func(item any) []any{
+			"FREQUENCY": func(item any) []any {
+				airport := item.(*Airport)
+				items := make([]any, len(airport.Frequencies))
+				for i := range airport.Frequencies {
+					items[i] = &airport.Frequencies[i]
+				}
+				return items
+			},
+			"RUNWAY": func(item any) []any {
+				airport := item.(*Airport)
+				items := make([]any, len(airport.Runways))
+				for i := range airport.Runways {
+					items[i] = &runwayItem{Runway: &airport.Runways[i], region: airport.Region}
+				}
+				return items
+			},
+		},
+	},
+	"RUNWAY": {
+		dataType: sim.SIMCONNECT_FACILITY_DATA_RUNWAY,
+		fields: map[string]func(item any) any{
+			"LATITUDE":             func(item any) any { return item.(*runwayItem).Latitude },
+			"LONGITUDE":            func(item any) any { return item.(*runwayItem).Longitude },
+			"ALTITUDE":             func(item any) any { return item.(*runwayItem).Altitude },
+			"HEADING":              func(item any) any { return item.(*runwayItem).Heading },
+			"LENGTH":               func(item any) any { return item.(*runwayItem).Length },
+			"WIDTH":                func(item any) any { return item.(*runwayItem).Width },
+			"SURFACE":              func(item any) any { return item.(*runwayItem).Surface },
+			"PRIMARY_NUMBER":       func(item any) any { return item.(*runwayItem).PrimaryNumber },
+			"PRIMARY_DESIGNATOR":   func(item any) any { return item.(*runwayItem).PrimaryDesignator },
+			"SECONDARY_NUMBER":     func(item any) any { return item.(*runwayItem).SecondaryNumber },
+			"SECONDARY_DESIGNATOR": func(item any) any { return item.(*runwayItem).SecondaryDesignator },
+			"PRIMARY_ILS_ICAO":     func(item any) any { return fixedString(item.(*runwayItem).PrimaryILS, 8) },
+			"PRIMARY_ILS_REGION":   func(item any) any { return item.(*runwayItem).ilsRegion(item.(*runwayItem).PrimaryILS) },
+			"SECONDARY_ILS_ICAO":   func(item any) any { return fixedString(item.(*runwayItem).SecondaryILS, 8) },
+			"SECONDARY_ILS_REGION": func(item any) any { return item.(*runwayItem).ilsRegion(item.(*runwayItem).SecondaryILS) },
+		},
+	},
+	"FREQUENCY": {
+		dataType: sim.SIMCONNECT_FACILITY_DATA_FREQUENCY,
+		fields: map[string]func(item any) any{
+			"TYPE":      func(item any) any { return item.(*Frequency).Type },
+			"FREQUENCY": func(item any) any { return item.(*Frequency).Hz },
+			"NAME":      func(item any) any { return fixedString(item.(*Frequency).Name, 64) },
+		},
+	},
+	"VOR": {
+		dataType: sim.SIMCONNECT_FACILITY_DATA_VOR,
+		fields: map[string]func(item any) any{
+			"ICAO":              func(item any) any { return fixedString(item.(*ILS).Ident, 8) },
+			"REGION":            func(item any) any { return fixedString(item.(*ILS).Region, 8) },
+			"FREQUENCY":         func(item any) any { return item.(*ILS).Hz },
+			"LOCALIZER":         func(item any) any { return int32(1) },
+			"LOCALIZER_HEADING": func(item any) any { return item.(*ILS).LocalizerHeading },
+			"HAS_GLIDE_SLOPE":   func(item any) any { return boolToInt32(item.(*ILS).GlideSlope > 0) },
+			"GLIDE_SLOPE":       func(item any) any { return item.(*ILS).GlideSlope },
+			"NAME":              func(item any) any { return fixedString(item.(*ILS).Name, 64) },
+		},
+	},
+}
+
+// runwayItem is a runway together with the region of its airport, which is also the region of its ILS
+type runwayItem struct {
+	*Runway
+	region string
+}
+
+// ilsRegion returns the region of the ILS with the given ident, empty when the runway end has none
+func (r *runwayItem) ilsRegion(ident string) []byte {
+	if ident == "" {
+		return fixedString("", 8)
+	}
+	return fixedString(r.region, 8)
+}
+
+// towerField returns a value of the tower position, 0 like SimConnect when the airport has no tower
+func towerField(airport *Airport, value func(*Tower) float64) float64 {
+	if airport.Tower == nil {
+		return 0
+	}
+	return value(airport.Tower)
+}
+
+// fixedString returns s as a NUL padded char array of the given size, truncated to leave room for the terminator
+func fixedString(s string, size int) []byte {
+	out := make([]byte, size)
+	copy(out[:size-1], s)
+	return out
+}
@@ -0,0 +1,164 @@
+package simfake
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+//go:embed fixtures.json
+var defaultFixtures []byte
+
+// Fixtures is the world served by the fake simulator
+type Fixtures struct {
+	Airports []Airport         `json:"airports"`
+	Metars   map[string]string `json:"metars"` // Raw METAR by station ICAO
+	Clouds   []CloudArea       `json:"clouds"`
+	ILS      []ILS             `json:"ils"`
+	Aircraft Aircraft          `json:"aircraft"` // The user aircraft
+}
+
+// Airport is a facility returned by RequestFacilityData
+type Airport struct {
+	ICAO        string      `json:"icao"`
+	Region      string      `json:"region"`
+	Name        string      `json:"name"`
+	Latitude    float64     `json:"latitude"`
+	Longitude   float64     `json:"longitude"`
+	Altitude    float64     `json:"altitude"` // Meters above sea level
+	MagVar      float32     `json:"magvar"`   // Degrees, east positive
+	Tower       *Tower      `json:"tower"`    // nil for airports without a tower
+	Frequencies []Frequency `json:"frequencies"`
+	Runways     []Runway    `json:"runways"`
+}
+
+// Tower is the position of the airport control tower
+type Tower struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude"` // Meters above sea level
+}
+
+// Runway is an airport runway. Numbers and designators use the SimConnect encoding (1 = LEFT, 2 = RIGHT),
+// the ILS fields hold the ident of an entry in Fixtures.ILS.
+type Runway struct {
+	Latitude            float64 `json:"latitude"`
+	Longitude           float64 `json:"longitude"`
+	Altitude            float64 `json:"altitude"` // Meters above sea level
+	Heading             float32 `json:"heading"`  // Degrees true of the primary end
+	Length              float32 `json:"length"`   // Meters
+	Width               float32 `json:"width"`    // Meters
+	Surface             int32   `json:"surface"`  // SimConnect surface type (0 = CONCRETE, 4 = ASPHALT)
+	PrimaryNumber       int32   `json:"primary_number"`
+	PrimaryDesignator   int32   `json:"primary_designator"`
+	SecondaryNumber     int32   `json:"secondary_number"`
+	SecondaryDesignator int32   `json:"secondary_designator"`
+	PrimaryILS          string  `json:"primary_ils"`
+	SecondaryILS        string  `json:"secondary_ils"`
+}
+
+// Frequency is an airport frequency, Type is the SimConnect frequency type (6 = TOWER)
+type Frequency struct {
+	Type int32  `json:"type"`
+	Hz   int32  `json:"hz"`
+	Name string `json:"name"`
+}
+
+// CloudArea is a round cloud layer reported by RequestCloudState
+type CloudArea struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	RadiusNM  float64 `json:"radius_nm"`
+	BaseFt    float64 `json:"base_ft"`
+	TopFt     float64 `json:"top_ft"`
+	Density   uint8   `json:"density"` // 0-255, as in the cloud state grid
+}
+
+// ILS is a localizer returned by RequestFacilityData for a VOR definition
+type ILS struct {
+	Ident            string  `json:"ident"`
+	Region           string  `json:"region"`
+	Name             string  `json:"name"`
+	Hz               int32   `json:"hz"`
+	LocalizerHeading float32 `json:"localizer_heading"` // Degrees true
+	GlideSlope       float32 `json:"glide_slope"`       // Degrees, 0 for a localizer without glide slope
+}
+
+// Aircraft is the user aircraft reported by RequestDataOnSimObject, radio frequencies are in Hz
+type Aircraft struct {
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Altitude    float64 `json:"altitude"`     // Feet above sea level
+	Heading     float64 `json:"heading"`      // Degrees magnetic
+	GroundSpeed float64 `json:"ground_speed"` // Knots
+	OnGround    bool    `json:"on_ground"`
+	COM1Active  int32   `json:"com1_active"`
+	COM1Standby int32   `json:"com1_standby"`
+	COM2Active  int32   `json:"com2_active"`
+	COM2Standby int32   `json:"com2_standby"`
+	NAV1Active  int32   `json:"nav1_active"`
+	NAV1Standby int32   `json:"nav1_standby"`
+	NAV2Active  int32   `json:"nav2_active"`
+	NAV2Standby int32   `json:"nav2_standby"`
+}
+
+// DefaultFixtures returns the sample airports, METARs and clouds embedded in the package.
+// The data is only good enough for development and must not be used for navigation.
+func DefaultFixtures() *Fixtures {
+	fixtures, err := parseFixtures(defaultFixtures)
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded fixtures: %v", err))
+	}
+	return fixtures
+}
+
+// LoadFixtures reads fixtures from a JSON file in the format of the embedded fixtures.json
+func LoadFixtures(path string) (*Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+
+	fixtures, err := parseFixtures(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fixtures %s: %w", path, err)
+	}
+	return fixtures, nil
+}
+
+func parseFixtures(data []byte) (*Fixtures, error) {
+	var fixtures Fixtures
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, err
+	}
+	return &fixtures, nil
+}
+
+func (f *Fixtures) airport(icao string) (Airport, bool) {
+	for _, airport := range f.Airports {
+		if strings.EqualFold(airport.ICAO, icao) {
+			return airport, true
+		}
+	}
+	return Airport{}, false
+}
+
+func (f *Fixtures) ils(ident, region string) (ILS, bool) {
+	for _, ils := range f.ILS {
+		if strings.EqualFold(ils.Ident, ident) && (region == "" || strings.EqualFold(ils.Region, region)) {
+			return ils, true
+		}
+	}
+	return ILS{}, false
+}
+
+func (f *Fixtures) metar(icao string) (string, bool) {
+	for station, metar := range f.Metars {
+		if strings.EqualFold(station, icao) {
+			return metar, true
+		}
+	}
+	return "", false
+}
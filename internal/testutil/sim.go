@@ -2,12 +2,105 @@ package testutil
 
 import (
 	"atc_freq/internal/sim"
-	"unsafe"
+	"encoding/binary"
 )
 
-// FacilityDataBuffer is a struct that holds both the header and inline data
-// This mimics how SimConnect returns data with a flexible array member
-type FacilityDataBuffer struct {
+// message encodes the parts of a SimConnect message little endian and without padding, the first
+// part starts with the SIMCONNECT_RECV header whose DwSize and DwID are filled in
+func message(id uint32, parts ...any) []byte {
+	var buf []byte
+	for _, part := range parts {
+		var err error
+		if buf, err = binary.Append(buf, binary.LittleEndian, part); err != nil {
+			panic(err)
+		}
+	}
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(buf)))
+	binary.LittleEndian.PutUint32(buf[8:], id)
+	return buf
+}
+
+// CreateFacilityDataResponse creates a mock SIMCONNECT_RECV for facility data
+func CreateFacilityDataResponse(requestID uint32, freqType int32, frequency int32, name string) []byte {
+	return createFrequencyRecord(requestID, 0, 0, freqType, frequency, name)
+}
+
+// CreateAirportRecordResponse creates the AIRPORT record of the frequency definition,
+// it has no fields and only carries the unique request ID its FREQUENCY children refer to
+func CreateAirportRecordResponse(requestID, uniqueID uint32) []byte {
+	return message(sim.SIMCONNECT_RECV_ID_FACILITY_DATA, facilityRecord[uint32]{
+		UserRequestId:   requestID,
+		UniqueRequestId: uniqueID,
+		Type:            sim.SIMCONNECT_FACILITY_DATA_AIRPORT,
+	})
+}
+
+// CreateFrequencyRecordResponse creates a FREQUENCY record that is a child of the AIRPORT record parentID
+func CreateFrequencyRecordResponse(requestID, uniqueID, parentID uint32, freqType int32, frequency int32, name string) []byte {
+	return createFrequencyRecord(requestID, uniqueID, parentID, freqType, frequency, name)
+}
+
+func createFrequencyRecord(requestID, uniqueID, parentID uint32, freqType int32, frequency int32, name string) []byte {
+	data := sim.FACILITY_FREQUENCY_DATA{
+		TYPE:      freqType,
+		FREQUENCY: frequency,
+	}
+	copy(data.NAME[:], name)
+
+	return message(sim.SIMCONNECT_RECV_ID_FACILITY_DATA, facilityRecord[sim.FACILITY_FREQUENCY_DATA]{
+		UserRequestId:         requestID,
+		UniqueRequestId:       uniqueID,
+		ParentUniqueRequestId: parentID,
+		Type:                  sim.SIMCONNECT_FACILITY_DATA_FREQUENCY,
+		Data:                  data,
+	})
+}
+
+// CreateFacilityRecordResponse creates a record of dataType that is item index of the children of the
+// record parentID, data holds the fields of the definition in order
+func CreateFacilityRecordResponse(requestID, uniqueID, parentID, dataType, index uint32, data any) []byte {
+	return message(sim.SIMCONNECT_RECV_ID_FACILITY_DATA, facilityRecord[struct{}]{
+		UserRequestId:         requestID,
+		UniqueRequestId:       uniqueID,
+		ParentUniqueRequestId: parentID,
+		Type:                  dataType,
+		ItemIndex:             index,
+	}, data)
+}
+
+// CreateFacilityDataEndResponse creates a mock SIMCONNECT_RECV for facility data end
+func CreateFacilityDataEndResponse(requestID uint32) []byte {
+	return message(sim.SIMCONNECT_RECV_ID_FACILITY_DATA_END, sim.SIMCONNECT_RECV_FACILITY_DATA_END{
+		RequestId: requestID,
+	})
+}
+
+// CreateQuitResponse creates a mock SIMCONNECT_RECV sent when the simulator shuts down
+func CreateQuitResponse() []byte {
+	return message(sim.SIMCONNECT_RECV_ID_QUIT, sim.SIMCONNECT_RECV{})
+}
+
+// CreateExceptionResponse creates a mock SIMCONNECT_RECV for an exception
+func CreateExceptionResponse(exception uint32, sendID uint32, index uint32) []byte {
+	return message(sim.SIMCONNECT_RECV_ID_EXCEPTION, sim.SIMCONNECT_RECV_EXCEPTION{
+		DwException: exception,
+		DwSendID:    sendID,
+		DwIndex:     index,
+	})
+}
+
+// CreateWeatherResponse creates a SIMCONNECT_RECV_WEATHER_OBSERVATION, the METAR runs to the end of the message
+func CreateWeatherResponse(requestID uint32, metar string) []byte {
+	return message(sim.SIMCONNECT_RECV_ID_WEATHER_OBSERVATION, [12]byte{}, requestID, []byte(metar+"\x00"))
+}
+
+// CreateCloudStateResponse creates a SIMCONNECT_RECV_CLOUD_STATE with a density byte per grid cell
+func CreateCloudStateResponse(requestID uint32, densities []byte) []byte {
+	return message(sim.SIMCONNECT_RECV_ID_CLOUD_STATE, [12]byte{}, requestID, uint32(len(densities)), densities)
+}
+
+// facilityRecord holds a SIMCONNECT_RECV_FACILITY_DATA header followed by inline data of type T
+type facilityRecord[T any] struct {
 	Pad_cgo_0             [12]byte // SIMCONNECT_RECV header
 	UserRequestId         uint32
 	UniqueRequestId       uint32
@@ -16,39 +109,180 @@ type FacilityDataBuffer struct {
 	IsListItem            uint32
 	ItemIndex             uint32
 	ListSize              uint32
-	Data                  sim.FACILITY_FREQUENCY_DATA // Inline frequency data
+	Data                  T
 }
 
-// CreateFacilityDataResponse creates a mock SIMCONNECT_RECV for facility data
-func CreateFacilityDataResponse(freqType int32, frequency int32, name string) *sim.SIMCONNECT_RECV {
-	var nameBytes [64]byte
-	copy(nameBytes[:], name)
+func createFacilityRecord[T any](requestID uint32, dataType uint32, itemIndex uint32, listSize uint32, data T) []byte {
+	record := facilityRecord[T]{
+		UserRequestId: requestID,
+		Type:          dataType,
+		ItemIndex:     itemIndex,
+		ListSize:      listSize,
+		Data:          data,
+	}
+	if listSize > 0 {
+		record.IsListItem = 1
+	}
 
-	buf := &FacilityDataBuffer{
-		UserRequestId: sim.REQUEST_ID,
-		Type:          sim.SIMCONNECT_FACILITY_DATA_FREQUENCY,
-		Data: sim.FACILITY_FREQUENCY_DATA{
-			TYPE:      freqType,
-			FREQUENCY: frequency,
-			NAME:      nameBytes,
-		},
+	return message(sim.SIMCONNECT_RECV_ID_FACILITY_DATA, record)
+}
+
+// Airport describes the AIRPORT record returned for the airport details definition
+type Airport struct {
+	ICAO      string
+	Name      string
+	Lat       float64
+	Lon       float64
+	AltitudeM float64
+	MagVar    float32
+	TowerLat  float64
+	TowerLon  float64
+	TowerAltM float64
+	NRunways  int32
+}
+
+// Runway describes a RUNWAY record returned for the airport details definition
+type Runway struct {
+	Lat                 float64
+	Lon                 float64
+	AltitudeM           float64
+	Heading             float32
+	LengthM             float32
+	WidthM              float32
+	Surface             int32
+	PrimaryNumber       int32
+	PrimaryDesignator   int32
+	SecondaryNumber     int32
+	SecondaryDesignator int32
+	PrimaryILS          string
+	SecondaryILS        string
+	Region              string
+}
+
+// ILS describes the VOR record returned for the ILS definition
+type ILS struct {
+	Hz               int32
+	LocalizerHeading float32
+	GlideSlope       float32
+	Name             string
+}
+
+// CreateAirportDataResponse creates a mock SIMCONNECT_RECV for the airport record of the airport details definition
+func CreateAirportDataResponse(requestID uint32, airport Airport) []byte {
+	data := sim.FACILITY_AIRPORT_DATA{
+		LATITUDE:        airport.Lat,
+		LONGITUDE:       airport.Lon,
+		ALTITUDE:        airport.AltitudeM,
+		TOWER_LATITUDE:  airport.TowerLat,
+		TOWER_LONGITUDE: airport.TowerLon,
+		TOWER_ALTITUDE:  airport.TowerAltM,
+		MAGVAR:          airport.MagVar,
+		N_RUNWAYS:       airport.NRunways,
 	}
+	copy(data.ICAO[:], airport.ICAO)
+	copy(data.NAME64[:], airport.Name)
 
-	// Set DwID in the header (offset 8 bytes: DwSize(4) + DwVersion(4))
-	*(*uint32)(unsafe.Pointer(&buf.Pad_cgo_0[8])) = sim.SIMCONNECT_RECV_ID_FACILITY_DATA
+	return createFacilityRecord(requestID, sim.SIMCONNECT_FACILITY_DATA_AIRPORT, 0, 0, data)
+}
 
-	return (*sim.SIMCONNECT_RECV)(unsafe.Pointer(buf))
+// CreateRunwayDataResponse creates a mock SIMCONNECT_RECV for a runway of the airport details definition
+func CreateRunwayDataResponse(requestID uint32, index uint32, count uint32, runway Runway) []byte {
+	data := sim.FACILITY_RUNWAY_DATA{
+		LATITUDE:             runway.Lat,
+		LONGITUDE:            runway.Lon,
+		ALTITUDE:             runway.AltitudeM,
+		HEADING:              runway.Heading,
+		LENGTH:               runway.LengthM,
+		WIDTH:                runway.WidthM,
+		SURFACE:              runway.Surface,
+		PRIMARY_NUMBER:       runway.PrimaryNumber,
+		PRIMARY_DESIGNATOR:   runway.PrimaryDesignator,
+		SECONDARY_NUMBER:     runway.SecondaryNumber,
+		SECONDARY_DESIGNATOR: runway.SecondaryDesignator,
+	}
+	copy(data.PRIMARY_ILS_ICAO[:], runway.PrimaryILS)
+	copy(data.SECONDARY_ILS_ICAO[:], runway.SecondaryILS)
+	if runway.PrimaryILS != "" {
+		copy(data.PRIMARY_ILS_REGION[:], runway.Region)
+	}
+	if runway.SecondaryILS != "" {
+		copy(data.SECONDARY_ILS_REGION[:], runway.Region)
+	}
+
+	return createFacilityRecord(requestID, sim.SIMCONNECT_FACILITY_DATA_RUNWAY, index, count, data)
 }
 
-// CreateFacilityDataEndResponse creates a mock SIMCONNECT_RECV for facility data end
-func CreateFacilityDataEndResponse() *sim.SIMCONNECT_RECV {
-	endData := &sim.SIMCONNECT_RECV_FACILITY_DATA_END{
-		RequestId: sim.REQUEST_ID,
+// CreateILSDataResponse creates a mock SIMCONNECT_RECV for the VOR record of the ILS definition
+func CreateILSDataResponse(requestID uint32, ils ILS) []byte {
+	data := sim.FACILITY_VOR_DATA{
+		FREQUENCY:         ils.Hz,
+		LOCALIZER:         1,
+		LOCALIZER_HEADING: ils.LocalizerHeading,
+		GLIDE_SLOPE:       ils.GlideSlope,
+	}
+	if ils.GlideSlope > 0 {
+		data.HAS_GLIDE_SLOPE = 1
+	}
+	copy(data.NAME[:], ils.Name)
+
+	return createFacilityRecord(requestID, sim.SIMCONNECT_FACILITY_DATA_VOR, 0, 0, data)
+}
+
+// ListAirport is an entry of SIMCONNECT_RECV_AIRPORT_LIST
+type ListAirport struct {
+	ICAO      string
+	Region    string
+	Lat       float64
+	Lon       float64
+	AltitudeM float64
+}
+
+// CreateAirportListResponse creates message entry of outOf of an airport list
+func CreateAirportListResponse(requestID, entry, outOf uint32, airports ...ListAirport) []byte {
+	header := sim.SIMCONNECT_RECV_FACILITIES_LIST{
+		DwRequestID:   requestID,
+		DwArraySize:   uint32(len(airports)),
+		DwEntryNumber: entry,
+		DwOutOf:       outOf,
+	}
+
+	entries := make([]sim.SIMCONNECT_DATA_FACILITY_AIRPORT, len(airports))
+	for i, airport := range airports {
+		entries[i] = sim.SIMCONNECT_DATA_FACILITY_AIRPORT{
+			Latitude:  airport.Lat,
+			Longitude: airport.Lon,
+			Altitude:  airport.AltitudeM,
+		}
+		copyChars(entries[i].Ident[:5], airport.ICAO)
+		copyChars(entries[i].Region[:2], airport.Region)
 	}
 
-	// The Pad_cgo_0 [12]byte contains the SIMCONNECT_RECV header
-	// Set DwID in the header (offset 8 bytes: DwSize(4) + DwVersion(4))
-	*(*uint32)(unsafe.Pointer(&endData.Pad_cgo_0[8])) = sim.SIMCONNECT_RECV_ID_FACILITY_DATA_END
+	return message(sim.SIMCONNECT_RECV_ID_AIRPORT_LIST, header, entries)
+}
 
-	return (*sim.SIMCONNECT_RECV)(unsafe.Pointer(endData))
-}
\ No newline at end of file
+// copyChars copies s into a char array of the generated structs
+func copyChars(chars []int8, s string) {
+	for i := 0; i < len(chars) && i < len(s); i++ {
+		chars[i] = int8(s[i])
+	}
+}
+
+// CreateSimObjectDataResponse creates a SIMCONNECT_RECV_SIMOBJECT_DATA of the user aircraft,
+// values are the FLOAT64 variables of the data definition in order
+func CreateSimObjectDataResponse(requestID, defineID uint32, values ...float64) []byte {
+	header := sim.SIMCONNECT_RECV_SIMOBJECT_DATA{
+		DwRequestID:   requestID,
+		DwObjectID:    sim.SIMCONNECT_OBJECT_ID_USER,
+		DwDefineID:    defineID,
+		Dwentrynumber: 1,
+		Dwoutof:       1,
+		DwDefineCount: uint32(len(values)),
+	}
+
+	// The variables start at DwData, the placeholder of the flexible array member
+	head, err := binary.Append(nil, binary.LittleEndian, header)
+	if err != nil {
+		panic(err)
+	}
+	return message(sim.SIMCONNECT_RECV_ID_SIMOBJECT_DATA, head[:len(head)-4], values)
+}
@@ -1,8 +1,12 @@
 import './style.css';
 import './app.css';
 
-import {GetFrequencies} from '../wailsjs/go/app/App';
-import {sim} from '../wailsjs/go/models';
+import {GetFrequencies, GetRouteWeather, GetRunwayRecommendation, OpenFlightPlan, SetAdvisorRoute, SetAutoTune, TuneRadio} from '../wailsjs/go/app/App';
+import {app, sim} from '../wailsjs/go/models';
+import {EventsOn} from '../wailsjs/runtime/runtime';
+
+// Last state of the user aircraft, used to mark the frequencies its radios are tuned to
+let aircraft: sim.AircraftState | null = null;
 
 // Setup the getFreq function
 window.getFreq = function () {
@@ -13,6 +17,8 @@ window.getFreq = function () {
     if (icao === "") return;
 
     resultElement!.innerText = "Fetching frequencies for " + icao + "...";
+    runwayResultElement!.innerText = "";
+    window.getRunway(icao);
 
     // Call App.GetFrequencies(icao)
     try {
@@ -20,16 +26,18 @@ window.getFreq = function () {
             .then((result: sim.AirportFrequency[]) => {
                 if (result && result.length > 0) {
                     let html = '<table style="width:100%; text-align: left; border-collapse: collapse;">';
-                    html += '<tr><th>Type</th><th>MHz</th><th>Name</th></tr>';
+                    html += '<tr><th>Type</th><th>MHz</th><th>Name</th><th></th></tr>';
                     result.forEach((f: sim.AirportFrequency) => {
-                        html += `<tr>
-                            <td>${f.Type}</td>
-                            <td>${f.MHz.toFixed(3)}</td>
-                            <td>${f.Name}</td>
+                        html += `<tr data-hz="${f.hz}">
+                            <td>${f.type}</td>
+                            <td>${f.mhz.toFixed(3)}</td>
+                            <td>${f.name}${sourceTag(f)}</td>
+                            <td>${tuneButton(f.hz)}</td>
                         </tr>`;
                     });
                     html += '</table>';
                     resultElement!.innerHTML = html;
+                    markTuned();
                 } else {
                     resultElement!.innerText = "No frequencies found or error occurred.";
                 }
@@ -44,6 +52,48 @@ window.getFreq = function () {
     }
 };
 
+// Marks frequencies from the offline database, the simulator may use others
+function sourceTag(f: sim.AirportFrequency): string {
+    if (!f.source || f.source === "simulator") return "";
+    return ` <span class="source-tag" title="From the ${f.source} database">offline</span>`;
+}
+
+// Show the runway expected in use next to the frequencies, ranked by the METAR wind
+window.getRunway = function (icao: string) {
+    GetRunwayRecommendation(icao)
+        .then((recommendation: sim.RunwayRecommendation) => {
+            const best = recommendation.recommended;
+            if (!best) {
+                runwayResultElement!.innerText = "";
+                return;
+            }
+
+            let html = `<p>Expected runway: <strong>${best.end.designator}</strong> (${runwayWindText(best)})`;
+            if (best.end.ils && best.end.ils.hz) {
+                html += `, ILS ${best.end.ils.ident} ${best.end.ils.mhz.toFixed(2)}`;
+            }
+            if (best.tailwind) {
+                html += ` <span class="warning">tailwind</span>`;
+            }
+            if (best.excessive_crosswind) {
+                html += ` <span class="warning">strong crosswind</span>`;
+            }
+            html += '</p>';
+            runwayResultElement!.innerHTML = html;
+        })
+        .catch((err: any) => {
+            console.error(err);
+            runwayResultElement!.innerText = "";
+        });
+};
+
+// Headwind and crosswind of a runway end, e.g. "head 12 kt, cross 2 kt L"
+function runwayWindText(end: sim.RunwayWind): string {
+    const cross = Math.round(end.crosswind);
+    const side = cross > 0 ? " R" : cross < 0 ? " L" : "";
+    return `head ${Math.round(end.headwind)} kt, cross ${Math.abs(cross)} kt${side}`;
+}
+
 // Tab switching function
 window.switchTab = function (tabName: string) {
     // Hide all tab contents
@@ -70,6 +120,13 @@ window.switchTab = function (tabName: string) {
 };
 
 document.querySelector('#app')!.innerHTML = `
+    <div class="aircraft-status" id="aircraft-status">Waiting for the simulator...</div>
+    <div class="next-frequency input-box">
+        <input class="input" id="advisor-route" type="text" autocomplete="off" placeholder="Route (e.g. EDDB EDDH)" />
+        <button class="btn-small" onclick="setAdvisorRoute()">Set route</button>
+        <label title="Put the next frequency in COM1 standby"><input type="checkbox" id="auto-tune" onchange="setAutoTune()" /> Auto-tune COM1 STBY</label>
+        <span id="next-frequency">Set a route or open a flight plan to see the next frequency</span>
+    </div>
     <div class="tabs">
         <button class="tab active" onclick="switchTab('frequencies')">Frequencies</button>
         <button class="tab" onclick="switchTab('weather')">Weather</button>
@@ -80,7 +137,15 @@ document.querySelector('#app')!.innerHTML = `
           <div class="input-box" id="input">
             <input class="input" id="icao" type="text" autocomplete="off" placeholder="Enter ICAO (e.g. EDDB)" />
             <button class="btn" onclick="getFreq()">Get freq</button>
+            <select class="input" id="tune-target" title="Radio the tune buttons set">
+              <option value="COM1:active">COM1</option>
+              <option value="COM1:standby">COM1 STBY</option>
+              <option value="COM2:active">COM2</option>
+              <option value="COM2:standby">COM2 STBY</option>
+            </select>
           </div>
+          <div id="tune-result"></div>
+          <div id="runway-result"></div>
           <div class="result" id="result">Results will appear here</div>
         </div>
     </div>
@@ -88,19 +153,220 @@ document.querySelector('#app')!.innerHTML = `
     <div id="weather" class="tab-content" style="display: none;">
         <div class="container">
           <div class="input-box">
-            <input class="input" id="waypoint" type="text" autocomplete="off" placeholder="Enter waypoint" />
+            <input class="input" id="waypoint" type="text" autocomplete="off" placeholder="Enter waypoints (e.g. EDDB,EDDH)" />
             <button class="btn" onclick="getWeather()">Get</button>
+            <button class="btn" onclick="openFlightPlan()">Open flight plan</button>
           </div>
           <div class="result" id="weather-result">Weather will appear here</div>
         </div>
     </div>
 `;
 
-// Get weather function (does nothing for now)
+// Flight category badge coloured like on aviation weather charts
+function categoryBadge(category: string): string {
+    return `<span class="category category-${category.toLowerCase()}">${category}</span>`;
+}
+
+// Setup the getWeather function
 window.getWeather = function () {
-    console.log('Get weather clicked');
+    let waypoints = waypointElement!.value.split(",").map(wp => wp.trim()).filter(wp => wp !== "");
+
+    // Check if the input is empty
+    if (waypoints.length === 0) return;
+
+    weatherResultElement!.innerText = "Fetching weather for " + waypoints.join(", ") + "...";
+
+    // Call App.GetRouteWeather(waypoints)
+    GetRouteWeather(waypoints)
+        .then((route: sim.RouteWeather) => {
+            if (!route || route.stations.length === 0) {
+                weatherResultElement!.innerText = "No weather found.";
+                return;
+            }
+
+            weatherResultElement!.innerHTML = routeWeatherHtml(route);
+        })
+        .catch((err: any) => {
+            console.error(err);
+            weatherResultElement!.innerText = "Error: " + err;
+        });
+};
+
+// Load a .pln or .lnmpln file and show weather and frequencies for every airport on it
+window.openFlightPlan = function () {
+    weatherResultElement!.innerText = "Loading flight plan...";
+
+    OpenFlightPlan()
+        .then((plan: app.FlightPlan | null) => {
+            // The dialog was cancelled
+            if (!plan) {
+                weatherResultElement!.innerText = "Weather will appear here";
+                return;
+            }
+
+            const airports = plan.weather.stations.map((w: sim.Weather) => w.waypoint);
+            waypointElement.value = airports.join(",");
+            // Loading the plan set the route of the next frequency advice
+            if (plan.plan.departure && plan.plan.arrival) {
+                advisorRouteElement.value = `${plan.plan.departure.ident} ${plan.plan.arrival.ident}`;
+            }
+
+            let html = `<p>${plan.plan.title || plan.path}</p>`;
+            html += plan.weather.stations.length > 0 ? routeWeatherHtml(plan.weather) : '<p>No weather found.</p>';
+            Object.keys(plan.frequencies).forEach((icao: string) => {
+                const freqs = plan.frequencies[icao];
+                if (!freqs || freqs.length === 0) return;
+
+                html += `<h4>${icao}</h4>`;
+                html += '<table style="width:100%; text-align: left; border-collapse: collapse;">';
+                html += '<tr><th>Type</th><th>MHz</th><th>Name</th><th></th></tr>';
+                freqs.forEach((f: sim.AirportFrequency) => {
+                    html += `<tr data-hz="${f.hz}"><td>${f.type}</td><td>${f.mhz.toFixed(3)}</td><td>${f.name}</td><td>${tuneButton(f.hz)}</td></tr>`;
+                });
+                html += '</table>';
+            });
+            weatherResultElement!.innerHTML = html;
+            markTuned();
+        })
+        .catch((err: any) => {
+            console.error(err);
+            weatherResultElement!.innerText = "Error: " + err;
+        });
 };
 
+// Weather table of a route with the worst category below it
+function routeWeatherHtml(route: sim.RouteWeather): string {
+    let html = '<table style="width:100%; text-align: left; border-collapse: collapse;">';
+    html += '<tr><th>Waypoint</th><th>Category</th><th>Visibility</th><th>Ceiling</th><th>METAR</th></tr>';
+    route.stations.forEach((w: sim.Weather) => {
+        html += `<tr>
+            <td>${w.waypoint}</td>
+            <td>${categoryBadge(w.category)}</td>
+            <td>${w.visibility} SM</td>
+            <td>${w.ceiling != null ? w.ceiling + " ft" : "-"}</td>
+            <td>${w.raw_metar}</td>
+        </tr>`;
+    });
+    html += '</table>';
+    if (route.worst_at.length > 0) {
+        html += `<p>Worst category along route: ${categoryBadge(route.worst)} at ${route.worst_at.join(", ")}</p>`;
+    }
+    return html;
+}
+
+// Button of a frequency table row that tunes the radio picked in the tune target list
+function tuneButton(hz: number): string {
+    return `<button class="btn btn-small" onclick="tune(${hz})">Tune</button>`;
+}
+
+// Tune the radio picked in the tune target list, the aircraft events then mark the row as tuned
+window.tune = function (hz: number) {
+    const [radio, slot] = tuneTargetElement.value.split(":");
+    const mhz = (hz / 1e6).toFixed(3);
+
+    TuneRadio(radio, slot, hz)
+        .then(() => {
+            tuneResultElement!.innerText = `${radio} ${slot} set to ${mhz}`;
+        })
+        .catch((err: any) => {
+            console.error(err);
+            tuneResultElement!.innerText = "Error: " + err;
+        });
+};
+
+// The simulator reports 8.33 kHz channels by their real frequency, 118.705 is tuned as 118.7083 MHz
+const tunedToleranceHz = 4000;
+
+function isTuned(hz: number): boolean {
+    if (!aircraft) return false;
+    return [aircraft.com1.active_hz, aircraft.com2.active_hz]
+        .some((active: number) => active !== 0 && Math.abs(active - hz) < tunedToleranceHz);
+}
+
+// Mark the rows of every frequency table the COM radios are tuned to
+function markTuned() {
+    document.querySelectorAll('tr[data-hz]').forEach(row => {
+        row.classList.toggle('tuned', isTuned(Number((row as HTMLElement).dataset.hz)));
+    });
+}
+
+// Follow the flight between the two airports of the route field with the next frequency panel
+window.setAdvisorRoute = function () {
+    const [departure, destination] = advisorRouteElement.value.trim().split(/[\s,]+/);
+    if (!departure || !destination) {
+        nextFrequencyElement!.innerText = "Please enter a departure and a destination airport";
+        return;
+    }
+
+    SetAdvisorRoute(departure, destination)
+        .then(() => {
+            nextFrequencyElement!.innerText = `Following ${departure} to ${destination}, waiting for the aircraft...`;
+        })
+        .catch((err: any) => {
+            console.error(err);
+            nextFrequencyElement!.innerText = "Error: " + err;
+        });
+};
+
+window.setAutoTune = function () {
+    SetAutoTune(autoTuneElement.checked);
+};
+
+// The advised frequency with a button tuning it, e.g. "Next (preflight): EDDB TOWER 118.800"
+function nextFrequencyHtml(advice: sim.FrequencyAdvice): string {
+    const f = advice.frequency;
+    return `Next (${advice.phase}): ${advice.icao} ${f.type} <b>${f.mhz.toFixed(3)}</b> ${f.name} ${tuneButton(f.hz)}`;
+}
+
+// One line with the radios and the nearest airport, e.g. "COM1 121.880 / 118.800 · EDDB 0.9 NM"
+function aircraftStatusText(update: app.AircraftUpdate): string {
+    const radio = (r: sim.Radio) => `${r.active_mhz.toFixed(3)} / ${r.standby_mhz.toFixed(3)}`;
+    let text = `COM1 ${radio(update.aircraft.com1)} · COM2 ${radio(update.aircraft.com2)}`;
+    if (update.nearest) {
+        text += ` · ${update.nearest.icao} ${update.nearest.distance_nm.toFixed(1)} NM`;
+        if (update.nearest.frequency) {
+            text += ` ${update.nearest.frequency.type} ${update.nearest.frequency.mhz.toFixed(3)}`;
+        }
+    }
+    return text;
+}
+
+EventsOn('aircraft', (update: app.AircraftUpdate) => {
+    aircraft = update.aircraft;
+    aircraftStatusElement!.innerText = aircraftStatusText(update);
+    markTuned();
+    if (update.next) {
+        nextFrequencyElement!.innerHTML = nextFrequencyHtml(update.next);
+    }
+
+    // Show the frequencies of the nearest airport until the user looks up another one
+    if (update.nearest && icaoElement.value === "") {
+        icaoElement.value = update.nearest.icao;
+        window.getFreq();
+    }
+});
+
+EventsOn('aircraft:lost', (message: string) => {
+    aircraft = null;
+    aircraftStatusElement!.innerText = message;
+    markTuned();
+});
+
+let aircraftStatusElement = document.getElementById("aircraft-status");
+let tuneTargetElement = (document.getElementById("tune-target") as HTMLSelectElement);
+let tuneResultElement = document.getElementById("tune-result");
+let nextFrequencyElement = document.getElementById("next-frequency");
+let autoTuneElement = (document.getElementById("auto-tune") as HTMLInputElement);
+let advisorRouteElement = (document.getElementById("advisor-route") as HTMLInputElement);
+advisorRouteElement.addEventListener("input", () => {
+    advisorRouteElement.value = advisorRouteElement.value.toUpperCase();
+});
+advisorRouteElement.addEventListener("keydown", (e) => {
+    if (e.key === "Enter") {
+        window.setAdvisorRoute();
+    }
+});
+
 let icaoElement = (document.getElementById("icao") as HTMLInputElement);
 icaoElement.focus();
 icaoElement.addEventListener("input", () => {
@@ -112,11 +378,28 @@ icaoElement.addEventListener("keydown", (e) => {
     }
 });
 let resultElement = document.getElementById("result");
+let runwayResultElement = document.getElementById("runway-result");
+
+let waypointElement = (document.getElementById("waypoint") as HTMLInputElement);
+waypointElement.addEventListener("input", () => {
+    waypointElement.value = waypointElement.value.toUpperCase();
+});
+waypointElement.addEventListener("keydown", (e) => {
+    if (e.key === "Enter") {
+        window.getWeather();
+    }
+});
+let weatherResultElement = document.getElementById("weather-result");
 
 declare global {
     interface Window {
         getFreq: () => void;
+        getRunway: (icao: string) => void;
         getWeather: () => void;
+        openFlightPlan: () => void;
+        setAdvisorRoute: () => void;
+        setAutoTune: () => void;
         switchTab: (tabName: string) => void;
+        tune: (hz: number) => void;
     }
 }
@@ -2,8 +2,8 @@ package main
 
 import (
 	"atc_freq/internal/app"
-	"atc_freq/internal/sim"
 	wailsAssets "atc_freq/wails"
+	"flag"
 	"fmt"
 	"os"
 
@@ -13,13 +13,28 @@ import (
 )
 
 func main() {
-	connection, err := sim.NewConnection()
+	var connectionOptions app.ConnectionOptions
+	flag.BoolVar(&connectionOptions.FakeSim, "fake-sim", false, "use the built-in fake simulator instead of MSFS")
+	flag.StringVar(&connectionOptions.Fixtures, "fixtures", "", "JSON file with airports, METARs and clouds for -fake-sim")
+	flag.StringVar(&connectionOptions.Record, "record", "", "record the SimConnect traffic of the session to a capture file")
+	flag.StringVar(&connectionOptions.Replay, "replay", "", "replay a capture file recorded with -record instead of connecting to the simulator")
+	database := flag.String("database", "", "offline frequency database for when the simulator isn't running, defaults to the one written by the CLI import command")
+	mergeDatabase := flag.Bool("merge-database", false, "add the frequencies of the offline database the simulator doesn't have")
+	flag.Parse()
+
+	connection, err := app.NewConnection(connectionOptions)
 	if err != nil {
 		fmt.Printf("Can't create application: %v\n", err)
 		os.Exit(1)
 	}
 
-	a := app.NewApp(connection)
+	host := app.NewHost(connection)
+	if path := app.FrequencyDatabasePath(*database); path != "" {
+		if _, err := host.LoadFrequencyDatabase(path, *mergeDatabase); err != nil {
+			fmt.Printf("Can't load frequency database: %v\n", err)
+			os.Exit(1)
+		}
+	}
 	_ = wails.Run(&options.App{
 		Title:  "ATC Frequency Finder",
 		Width:  600,
@@ -28,9 +43,12 @@ func main() {
 			Assets: wailsAssets.Assets,
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
-		OnStartup:        a.AddContext,
+		OnStartup:        host.AddContext,
+		OnDomReady:       host.StartAircraftEvents,
+		OnShutdown:       host.Shutdown,
+		// Only the App is bound, the lifecycle and session methods of the host stay out of reach of the frontend
 		Bind: []interface{}{
-			a,
+			host.App,
 		},
 	})
 }